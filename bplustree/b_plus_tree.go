@@ -1,10 +1,10 @@
 package bplustree
 
 import (
-	"bytes"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
 	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
@@ -19,16 +19,86 @@ type BPlusTree struct {
 	bPlusTreeMutex    *sync.RWMutex
 	metadata          *codec.MetaData
 	bufferPoolManager bpm.BufferPoolManager
+
+	// defines the order of keys in the B+ tree
+	comparator codec.Comparator
+
+	// algorithm used to compress values written to the B+ tree
+	compression      codec.CompressionType
+	compressionStats CompressionStats
+
+	// tablespace every node of the B+ tree is stored in
+	tablespaceId uint64
+}
+
+// values smaller than this are stored uncompressed, since compressing them rarely saves space.
+const MIN_COMPRESSED_VALUE_SIZE = 64
+
+// CompressionStats counts the values written to the B+ tree since it was opened, and their total size before and after compression.
+type CompressionStats struct {
+	CompressedValues   uint64
+	UncompressedValues uint64
+	RawBytes           uint64
+	StoredBytes        uint64
+}
+
+// Ratio returns the compression ratio achieved over all values written, 1 if no values were written.
+func (stats CompressionStats) Ratio() float64 {
+
+	if stats.StoredBytes == 0 {
+		return 1
+	}
+	return float64(stats.RawBytes) / float64(stats.StoredBytes)
 }
 
-func NewBPlusTree(BPlusTreeId uint64, bufferPoolManager bpm.BufferPoolManager, metadata *codec.MetaData) *BPlusTree {
+// NewBPlusTree opens the B+ tree using the comparator recorded for it in the metadata page, B+ trees without a recorded comparator
+// use the bytewise comparator. A B+ tree whose comparator isn't registered can't be opened, since its nodes would appear unsorted.
+func NewBPlusTree(BPlusTreeId uint64, bufferPoolManager bpm.BufferPoolManager, metadata *codec.MetaData) (*BPlusTree, error) {
+
+	comparator := codec.BytewiseComparator
+
+	if name, recorded := metadata.Comparators[BPlusTreeId]; recorded {
+
+		registeredComparator, exists := codec.GetComparator(name)
+
+		if !exists {
+			return nil, fmt.Errorf("B Plus Tree was created with comparator %s, which is not registered", name)
+		}
+
+		comparator = registeredComparator
+	}
+
+	return newBPlusTree(BPlusTreeId, bufferPoolManager, metadata, comparator), nil
+}
+
+// NewBPlusTreeWithComparator opens the B+ tree using the given comparator. If the B+ tree has a comparator recorded in the metadata page,
+// it must have the same name as the given comparator, otherwise the comparator is recorded for the B+ tree.
+func NewBPlusTreeWithComparator(BPlusTreeId uint64, bufferPoolManager bpm.BufferPoolManager, metadata *codec.MetaData, comparator codec.Comparator) (*BPlusTree, error) {
+
+	if name, recorded := metadata.Comparators[BPlusTreeId]; recorded && name != comparator.Name {
+		return nil, fmt.Errorf("B Plus Tree was created with comparator %s, cannot open with comparator %s", name, comparator.Name)
+	}
+
+	if metadata.Comparators == nil {
+		metadata.Comparators = make(map[uint64]string)
+	}
+	metadata.Comparators[BPlusTreeId] = comparator.Name
+
+	return newBPlusTree(BPlusTreeId, bufferPoolManager, metadata, comparator), nil
+}
+
+func newBPlusTree(BPlusTreeId uint64, bufferPoolManager bpm.BufferPoolManager, metadata *codec.MetaData, comparator codec.Comparator) *BPlusTree {
 
 	bptree := &BPlusTree{
-		BPlusTreeId:       BPlusTreeId,
-		rootNodePageId:    metadata.RootPages[BPlusTreeId],
-		bPlusTreeMutex:    &sync.RWMutex{},
-		metadata:          metadata,
-		bufferPoolManager: bufferPoolManager,
+		BPlusTreeId:         BPlusTreeId,
+		rootNodePageId:      metadata.RootPages[BPlusTreeId],
+		firstLeafNodePageId: metadata.FirstLeafNodePages[BPlusTreeId],
+		bPlusTreeMutex:      &sync.RWMutex{},
+		metadata:            metadata,
+		bufferPoolManager:   bufferPoolManager,
+		comparator:          comparator,
+		compression:         codec.CompressionType(metadata.CompressionTypes[BPlusTreeId]),
+		tablespaceId:        metadata.Tablespaces[BPlusTreeId],
 	}
 	return bptree
 }
@@ -96,6 +166,11 @@ func (bptree *BPlusTree) Get(key []byte) ([]byte, error) {
 	fmt.Println()
 	slog.Info("Starting Get operation", "key", string(key), "function", "Get", "at", "btree")
 
+	// tree is empty
+	if bptree.rootNodePageId == 0 {
+		return nil, fmt.Errorf("key not found")
+	}
+
 	slog.Info("Creating read guard for root node", "root_node_page_ID", bptree.rootNodePageId, "function", "Get", "at", "btree")
 	//rootNodeGuard, err := bptree.fetchRootNodeReadGuard()
 
@@ -120,20 +195,26 @@ func (bptree *BPlusTree) readTraversal(key []byte, cursor *ReadCursor) ([]byte,
 
 	if cursor.IsLeafNode() {
 
-		leafNodeReader := NewLeafNodeReader(cursor.GetCurrentNodeReadGuard())
+		leafNodeReader := NewLeafNodeReader(cursor.GetCurrentNodeReadGuard(), bptree.comparator)
 		leafNodeReader.PrintElements()
-		value, ok := leafNodeReader.FindValue(key)
+		element, ok := leafNodeReader.FindElement(key)
 
 		if !ok {
 			slog.Info("Key not found in leaf node", "key", string(key), "function", "readTraversal", "at", "btree")
 			return nil, fmt.Errorf("key not found")
 		}
 
-		slog.Info("Key found, returning value", "key", string(key), "value_length", len(value), "function", "readTraversal", "at", "btree")
-		return value, nil
+		// expired elements are filtered lazily, until they are deleted by the expiry reaper.
+		if element.IsExpired(currentTimestamp()) {
+			slog.Info("Key has expired", "key", string(key), "function", "readTraversal", "at", "btree")
+			return nil, fmt.Errorf("key not found")
+		}
+
+		slog.Info("Key found, returning value", "key", string(key), "value_length", len(element.Value), "function", "readTraversal", "at", "btree")
+		return codec.DecompressValue(element.Value, element.Compression)
 	}
 
-	internalNodeReader := NewInternalNodeReader(cursor.GetCurrentNodeReadGuard())
+	internalNodeReader := NewInternalNodeReader(cursor.GetCurrentNodeReadGuard(), bptree.comparator)
 	internalNodeReader.PrintElements()
 	childNodePageId := internalNodeReader.FindNextChildNodePageId(key)
 
@@ -153,7 +234,224 @@ func (bptree *BPlusTree) readTraversal(key []byte, cursor *ReadCursor) ([]byte,
 	return bptree.readTraversal(key, cursor)
 }
 
+// findLeafNodeReadGuard traverses the tree from the root node, and returns a read guard for the leaf node where the key could be found.
+// Read guards of internal nodes are released as soon as the guard of the next node in the traversal is acquired.
+// Caller must hold the B+ tree read lock, and must call Done on the returned guard.
+func (bptree *BPlusTree) findLeafNodeReadGuard(key []byte) (*bpm.ReadGuard, error) {
+
+	currNodeGuard, err := bptree.bufferPoolManager.NewReadGuard(bptree.rootNodePageId)
+
+	if err != nil {
+		slog.Error("Failed to create read guard for root node", "error", err.Error(), "function", "findLeafNodeReadGuard", "at", "btree")
+		return nil, err
+	}
+
+	cursor := NewReadCursor(currNodeGuard)
+
+	for !cursor.IsLeafNode() {
+
+		internalNodeReader := NewInternalNodeReader(currNodeGuard, bptree.comparator)
+		childNodePageId := internalNodeReader.FindNextChildNodePageId(key)
+
+		childNodeReadGuard, err := bptree.bufferPoolManager.NewReadGuard(childNodePageId)
+
+		currNodeGuard.Done()
+
+		if err != nil {
+			slog.Error("Failed to create read guard for child node", "next_page_ID", childNodePageId, "error", err.Error(), "function", "findLeafNodeReadGuard", "at", "btree")
+			return nil, err
+		}
+
+		currNodeGuard = childNodeReadGuard
+		cursor.SetCurrentNodeReadGuard(currNodeGuard)
+	}
+
+	return currNodeGuard, nil
+}
+
+// Exists checks whether a key is present in the B+ tree, without copying the value corresponding to it.
+func (bptree *BPlusTree) Exists(key []byte) (bool, error) {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	fmt.Println()
+	slog.Info("Starting Exists operation", "key", string(key), "function", "Exists", "at", "btree")
+
+	// tree is empty
+	if bptree.rootNodePageId == 0 {
+		return false, nil
+	}
+
+	leafNodeGuard, err := bptree.findLeafNodeReadGuard(key)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer leafNodeGuard.Done()
+
+	return NewLeafNodeReader(leafNodeGuard, bptree.comparator).ContainsKey(key, currentTimestamp()), nil
+}
+
+// Count returns the number of keys in the range [startKey, endKey). A nil endKey counts all keys >= startKey.
+// The leaf node containing startKey is found using a read traversal, after which the leaf chain is walked until endKey is reached.
+func (bptree *BPlusTree) Count(startKey []byte, endKey []byte) (uint64, error) {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	fmt.Println()
+	slog.Info("Starting Count operation", "start_key", string(startKey), "end_key", string(endKey), "function", "Count", "at", "btree")
+
+	// tree is empty, or range is empty
+	if bptree.rootNodePageId == 0 || (endKey != nil && bptree.comparator.Compare(startKey, endKey) >= 0) {
+		return 0, nil
+	}
+
+	leafNodeGuard, err := bptree.findLeafNodeReadGuard(startKey)
+
+	if err != nil {
+		return 0, err
+	}
+
+	readAheadDetector := bptree.newLeafChainReadAheadDetector()
+
+	total := uint64(0)
+	now := currentTimestamp()
+
+	for {
+
+		leafNodeReader := NewLeafNodeReader(leafNodeGuard, bptree.comparator)
+		readAheadDetector.Access(leafNodeGuard.GetPageId(), leafNodeGuard.GetPageData())
+
+		count, endReached := leafNodeReader.CountKeysInRange(startKey, endKey, now)
+		total += uint64(count)
+
+		nextLeafNodePageId := leafNodeReader.GetNextLeafNodePageId()
+
+		leafNodeGuard.Done()
+
+		if endReached || nextLeafNodePageId == 0 {
+			break
+		}
+
+		leafNodeGuard, err = bptree.bufferPoolManager.NewReadGuard(nextLeafNodePageId)
+
+		if err != nil {
+			slog.Error("Failed to create read guard for next leaf node", "next_page_ID", nextLeafNodePageId, "error", err.Error(), "function", "Count", "at", "btree")
+			return 0, err
+		}
+	}
+
+	slog.Info("Count operation complete", "count", total, "function", "Count", "at", "btree")
+	return total, nil
+}
+
+// Scan calls visit for every unexpired key value pair with a key in the range [startKey, endKey), in key order, until visit returns false.
+// A nil endKey scans all keys >= startKey. visit is called while the B+ tree read lock is held, so it must not call methods of the B+ tree.
+func (bptree *BPlusTree) Scan(startKey []byte, endKey []byte, visit func(key []byte, value []byte) bool) error {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	fmt.Println()
+	slog.Info("Starting Scan operation", "start_key", string(startKey), "end_key", string(endKey), "function", "Scan", "at", "btree")
+
+	// tree is empty, or range is empty
+	if bptree.rootNodePageId == 0 || (endKey != nil && bptree.comparator.Compare(startKey, endKey) >= 0) {
+		return nil
+	}
+
+	leafNodeGuard, err := bptree.findLeafNodeReadGuard(startKey)
+
+	if err != nil {
+		return err
+	}
+
+	readAheadDetector := bptree.newLeafChainReadAheadDetector()
+
+	now := currentTimestamp()
+
+	for {
+
+		leafNodeReader := NewLeafNodeReader(leafNodeGuard, bptree.comparator)
+		readAheadDetector.Access(leafNodeGuard.GetPageId(), leafNodeGuard.GetPageData())
+
+		elements, endReached := leafNodeReader.GetElementsInRange(startKey, endKey, now)
+		nextLeafNodePageId := leafNodeReader.GetNextLeafNodePageId()
+
+		leafNodeGuard.Done()
+
+		for _, element := range elements {
+
+			value, err := codec.DecompressValue(element.Value, element.Compression)
+
+			if err != nil {
+				slog.Error("Failed to decompress value", "key", string(element.Key), "error", err.Error(), "function", "Scan", "at", "btree")
+				return err
+			}
+
+			if !visit(element.Key, value) {
+				return nil
+			}
+		}
+
+		if endReached || nextLeafNodePageId == 0 {
+			return nil
+		}
+
+		leafNodeGuard, err = bptree.bufferPoolManager.NewReadGuard(nextLeafNodePageId)
+
+		if err != nil {
+			slog.Error("Failed to create read guard for next leaf node", "next_page_ID", nextLeafNodePageId, "error", err.Error(), "function", "Scan", "at", "btree")
+			return err
+		}
+	}
+}
+
+// currentTimestamp returns the current unix timestamp in nanoseconds, used to compare against element expiry timestamps.
+func currentTimestamp() uint64 {
+
+	return uint64(time.Now().UnixNano())
+}
+
+// Insert inserts a key value pair that never expires, or updates the value of an existing key.
 func (bptree *BPlusTree) Insert(key []byte, value []byte) error {
+
+	return bptree.insert(key, value, 0)
+}
+
+// InsertWithTTL inserts a key value pair that expires once the ttl has elapsed, or updates the value of an existing key.
+// Expired keys are filtered out by reads, and deleted in the background by the expiry reaper of the storage engine.
+// A ttl <= 0 means the key never expires.
+func (bptree *BPlusTree) InsertWithTTL(key []byte, value []byte, ttl time.Duration) error {
+
+	if ttl <= 0 {
+		return bptree.insert(key, value, 0)
+	}
+
+	return bptree.insert(key, value, currentTimestamp()+uint64(ttl))
+}
+
+func (bptree *BPlusTree) insert(key []byte, value []byte, expiresAt uint64) error {
+
+	bptree.bPlusTreeMutex.RLock()
+	compression := bptree.compression
+	bptree.bPlusTreeMutex.RUnlock()
+
+	if len(value) < MIN_COMPRESSED_VALUE_SIZE {
+		compression = codec.CompressionNone
+	}
+
+	// values are compressed before the B+ tree lock is acquired
+	storedValue, compression, err := codec.CompressValue(value, compression)
+
+	if err != nil {
+		slog.Error("Failed to compress value", "key", string(key), "error", err.Error(), "function", "insert", "at", "btree")
+		return err
+	}
+
 	// slog.Info("before insert")
 	// bptree.bufferPoolManager.PrintAllPages()
 	// print := func() {
@@ -166,7 +464,8 @@ func (bptree *BPlusTree) Insert(key []byte, value []byte) error {
 
 	if bptree.rootNodePageId == 0 {
 
-		rootNodePageId, err := bptree.bufferPoolManager.NewPage()
+		// the first leaf node starts an extent of the B+ tree in its tablespace, the leaf nodes split from it are stored after it.
+		rootNodePageId, err := bptree.bufferPoolManager.NewPageNear(bpm.TablespacePageId(bptree.tablespaceId, 0), bptree.BPlusTreeId)
 		bptree.firstLeafNodePageId = rootNodePageId
 		if err != nil {
 			return err
@@ -187,17 +486,19 @@ func (bptree *BPlusTree) Insert(key []byte, value []byte) error {
 	defer rootNodeGuard.Done()
 
 	writeCursor := NewWriteCursor(rootNodeGuard)
-	extraKey, leftChildNodePageId, rightChildNodePageId, err := bptree.writeTraversal(key, value, writeCursor)
+	extraKey, leftChildNodePageId, rightChildNodePageId, err := bptree.writeTraversal(key, storedValue, expiresAt, compression, writeCursor)
 
 	if err != nil {
 		slog.Error("Error during write traversal", "error", err.Error(), "function", "Insert", "at", "btree")
 		return err
 	}
+
+	bptree.compressionStats.record(len(value), len(storedValue), compression)
 	// new root node required.
 	if extraKey != nil {
 		slog.Info("Creating new root node due to split", "extra_key", string(extraKey), "left_child_page_ID", leftChildNodePageId, "right_child_page_ID", rightChildNodePageId, "function", "Insert", "at", "btree")
 
-		newRootPageId, err := bptree.bufferPoolManager.NewPage()
+		newRootPageId, err := bptree.bufferPoolManager.NewPageInTablespace(bptree.tablespaceId)
 
 		if err != nil {
 			slog.Error("Failed to create new root node page", "error", err.Error(), "function", "Insert", "at", "btree")
@@ -212,7 +513,7 @@ func (bptree *BPlusTree) Insert(key []byte, value []byte) error {
 		}
 		defer newRootGuard.Done()
 
-		internalNodeWriter := NewInternalNodeWriter(newRootGuard)
+		internalNodeWriter := NewInternalNodeWriter(newRootGuard, bptree.comparator)
 		internalNodeWriter.SetNodeType()
 		internalNodeWriter.InsertKey(extraKey, leftChildNodePageId, rightChildNodePageId)
 
@@ -227,7 +528,7 @@ func (bptree *BPlusTree) Insert(key []byte, value []byte) error {
 	return nil
 }
 
-func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteCursor) (extraKey []byte, leftChildNodePageId uint64, rightChildNodePageId uint64, err error) {
+func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, expiresAt uint64, compression codec.CompressionType, cursor *WriteCursor) (extraKey []byte, leftChildNodePageId uint64, rightChildNodePageId uint64, err error) {
 
 	currWriteGuard := cursor.GetCurrentNodeWriteGuard()
 
@@ -236,17 +537,18 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 	if cursor.IsLeafNode() {
 
-		leafNodeWriter := NewLeafNodeWriter(cursor.GetCurrentNodeWriteGuard())
+		leafNodeWriter := NewLeafNodeWriter(cursor.GetCurrentNodeWriteGuard(), bptree.comparator)
 		leafNodeWriter.PrintElements()
 		if _, found := leafNodeWriter.FindValue(key); found {
 
-			ok := leafNodeWriter.SetValue(key, value)
+			ok := leafNodeWriter.SetValue(key, value, expiresAt, compression)
 
 			if ok {
 				return nil, 0, 0, nil
 			}
 
-			rightChildNodePageId, err := bptree.bufferPoolManager.NewPage()
+			// the new leaf node is stored close to the leaf node it is split from, so the leaf chain is read mostly sequentially.
+			rightChildNodePageId, err := bptree.bufferPoolManager.NewPageNear(leafNodeWriter.GetPageId(), bptree.BPlusTreeId)
 
 			if err != nil {
 				return nil, 0, 0, err
@@ -262,26 +564,28 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 			defer writeGuard.Done()
 
-			rightLeafNodeWriter := NewLeafNodeWriter(writeGuard)
-
+			rightLeafNodeWriter := NewLeafNodeWriter(writeGuard, bptree.comparator)
+			rightLeafNodeWriter.SetNodeType()
 			extraKey := leafNodeWriter.Split(rightLeafNodeWriter)
 
-			if bytes.Compare(key, extraKey) < 0 {
-				leafNodeWriter.InsertKeyValue(key, value)
+			// the existing element is moved to one of the two nodes during the split, so its value is updated in that node.
+			if bptree.comparator.Compare(key, extraKey) < 0 {
+				leafNodeWriter.SetValue(key, value, expiresAt, compression)
 			} else {
-				rightLeafNodeWriter.InsertKeyValue(key, value)
+				rightLeafNodeWriter.SetValue(key, value, expiresAt, compression)
 			}
 			return extraKey, leafNodeWriter.GetPageId(), rightLeafNodeWriter.GetPageId(), nil
 
 		} else {
 
-			ok := leafNodeWriter.InsertKeyValue(key, value)
+			ok := leafNodeWriter.InsertKeyValue(key, value, expiresAt, compression)
 
 			if ok {
 				return nil, 0, 0, nil
 			}
 
-			rightChildNodePageId, err := bptree.bufferPoolManager.NewPage()
+			// the new leaf node is stored close to the leaf node it is split from, so the leaf chain is read mostly sequentially.
+			rightChildNodePageId, err := bptree.bufferPoolManager.NewPageNear(leafNodeWriter.GetPageId(), bptree.BPlusTreeId)
 
 			if err != nil {
 				return nil, 0, 0, err
@@ -297,17 +601,17 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 			defer writeGuard.Done()
 
-			rightLeafNodeWriter := NewLeafNodeWriter(writeGuard)
+			rightLeafNodeWriter := NewLeafNodeWriter(writeGuard, bptree.comparator)
 			rightLeafNodeWriter.SetNodeType()
 			extraKey := leafNodeWriter.Split(rightLeafNodeWriter)
 
-			if bytes.Compare(key, extraKey) < 0 {
+			if bptree.comparator.Compare(key, extraKey) < 0 {
 
-				leafNodeWriter.InsertKeyValue(key, value)
+				leafNodeWriter.InsertKeyValue(key, value, expiresAt, compression)
 
 			} else {
 
-				rightLeafNodeWriter.InsertKeyValue(key, value)
+				rightLeafNodeWriter.InsertKeyValue(key, value, expiresAt, compression)
 
 			}
 
@@ -320,7 +624,7 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 	}
 
-	internalNodeWriter := NewInternalNodeWriter(cursor.GetCurrentNodeWriteGuard())
+	internalNodeWriter := NewInternalNodeWriter(cursor.GetCurrentNodeWriteGuard(), bptree.comparator)
 
 	nextChildNodePageId := internalNodeWriter.FindNextChildNodePageId(key)
 
@@ -335,7 +639,7 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 	cursor.SetCurrentNodeWriteGuard(childNodeWriteGuard)
 
-	extraKey, leftChildNodePageId, rightChildNodePageId, err = bptree.writeTraversal(key, value, cursor)
+	extraKey, leftChildNodePageId, rightChildNodePageId, err = bptree.writeTraversal(key, value, expiresAt, compression, cursor)
 
 	if err != nil {
 		return nil, 0, 0, err
@@ -345,7 +649,7 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 		return nil, 0, 0, nil
 	}
 
-	internalNodeWriter = NewInternalNodeWriter(currWriteGuard)
+	internalNodeWriter = NewInternalNodeWriter(currWriteGuard, bptree.comparator)
 
 	ok := internalNodeWriter.InsertKey(extraKey, leftChildNodePageId, rightChildNodePageId)
 
@@ -353,27 +657,29 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 		return nil, 0, 0, nil
 	}
 
-	rightChildNodePageId, err = bptree.bufferPoolManager.NewPage()
+	// the new internal node gets its own page ID, the right child node page ID is still needed to insert the extra key after the split.
+	rightInternalNodePageId, err := bptree.bufferPoolManager.NewPageInTablespace(bptree.tablespaceId)
 
 	if err != nil {
 		return nil, 0, 0, err
 	}
 
-	writeGuard, err := bptree.bufferPoolManager.NewWriteGuard(rightChildNodePageId)
+	writeGuard, err := bptree.bufferPoolManager.NewWriteGuard(rightInternalNodePageId)
 
 	if err != nil {
 
-		bptree.bufferPoolManager.CleanupPage(rightChildNodePageId)
+		bptree.bufferPoolManager.CleanupPage(rightInternalNodePageId)
 		return nil, 0, 0, err
 	}
 
 	defer writeGuard.Done()
 
-	rightInternalNodeWriter := NewInternalNodeWriter(writeGuard)
+	rightInternalNodeWriter := NewInternalNodeWriter(writeGuard, bptree.comparator)
+	rightInternalNodeWriter.SetNodeType()
 
 	splitKey := internalNodeWriter.Split(rightInternalNodeWriter)
 
-	if bytes.Compare(extraKey, splitKey) < 0 {
+	if bptree.comparator.Compare(extraKey, splitKey) < 0 {
 		internalNodeWriter.InsertKey(extraKey, leftChildNodePageId, rightChildNodePageId)
 	} else {
 		rightInternalNodeWriter.InsertKey(extraKey, leftChildNodePageId, rightChildNodePageId)
@@ -383,10 +689,242 @@ func (bptree *BPlusTree) writeTraversal(key []byte, value []byte, cursor *WriteC
 
 }
 
+// findLeafNodeWriteGuard traverses the tree from the root node, and returns a write guard for the leaf node where the key could be found.
+// Write guards of internal nodes are released as soon as the guard of the next node in the traversal is acquired,
+// so the caller must not modify the structure of the tree. Caller must hold the B+ tree write lock, and must call Done on the returned guard.
+func (bptree *BPlusTree) findLeafNodeWriteGuard(key []byte) (*bpm.WriteGuard, error) {
+
+	currNodeGuard, err := bptree.bufferPoolManager.NewWriteGuard(bptree.rootNodePageId)
+
+	if err != nil {
+		slog.Error("Failed to create write guard for root node", "error", err.Error(), "function", "findLeafNodeWriteGuard", "at", "btree")
+		return nil, err
+	}
+
+	cursor := NewWriteCursor(currNodeGuard)
+
+	for !cursor.IsLeafNode() {
+
+		internalNodeWriter := NewInternalNodeWriter(currNodeGuard, bptree.comparator)
+		childNodePageId := internalNodeWriter.FindNextChildNodePageId(key)
+
+		childNodeWriteGuard, err := bptree.bufferPoolManager.NewWriteGuard(childNodePageId)
+
+		currNodeGuard.Done()
+
+		if err != nil {
+			slog.Error("Failed to create write guard for child node", "next_page_ID", childNodePageId, "error", err.Error(), "function", "findLeafNodeWriteGuard", "at", "btree")
+			return nil, err
+		}
+
+		currNodeGuard = childNodeWriteGuard
+		cursor.SetCurrentNodeWriteGuard(currNodeGuard)
+	}
+
+	return currNodeGuard, nil
+}
+
+// Delete removes a key from the B+ tree. Returns an error if the key does not exist, or has expired.
+// Leaf nodes that underflow as a result of the delete are not merged with their siblings.
 func (bptree *BPlusTree) Delete(key []byte) error {
+
+	bptree.bPlusTreeMutex.Lock()
+	defer bptree.bPlusTreeMutex.Unlock()
+
+	fmt.Println()
+	slog.Info("Starting Delete operation", "key", string(key), "function", "Delete", "at", "btree")
+
+	deleted, err := bptree.deleteKey(key, func(element codec.LeafNodeElement) bool {
+		return !element.IsExpired(currentTimestamp())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return fmt.Errorf("key not found")
+	}
 	return nil
 }
+
+// deleteKey deletes the element corresponding to the key if shouldDelete returns true for it.
+// Caller must hold the B+ tree write lock.
+func (bptree *BPlusTree) deleteKey(key []byte, shouldDelete func(element codec.LeafNodeElement) bool) (deleted bool, err error) {
+
+	// tree is empty
+	if bptree.rootNodePageId == 0 {
+		return false, nil
+	}
+
+	leafNodeGuard, err := bptree.findLeafNodeWriteGuard(key)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer leafNodeGuard.Done()
+
+	leafNodeWriter := NewLeafNodeWriter(leafNodeGuard, bptree.comparator)
+
+	element, found := leafNodeWriter.FindElement(key)
+
+	if !found || !shouldDelete(element) {
+		return false, nil
+	}
+
+	return leafNodeWriter.DeleteKeyValue(key), nil
+}
+
+// DeleteExpired deletes all elements that have expired at the given time, in key order, and returns the number of elements deleted.
+// The leaf chain is scanned under a read lock, after which each expired key is deleted under a separate write lock,
+// so foreground operations are only blocked for the duration of a single delete.
+func (bptree *BPlusTree) DeleteExpired(now time.Time) (int, error) {
+
+	expiredKeys, err := bptree.ExpiredKeys(now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	numDeleted := 0
+
+	for _, key := range expiredKeys {
+
+		_, deleted, err := bptree.DeleteIfExpired(key, now)
+
+		if err != nil {
+			return numDeleted, err
+		}
+
+		if deleted {
+			numDeleted++
+		}
+	}
+
+	if numDeleted > 0 {
+		slog.Info("Deleted expired keys", "BPlusTreeId", bptree.BPlusTreeId, "count", numDeleted, "function", "DeleteExpired", "at", "btree")
+	}
+	return numDeleted, nil
+}
+
+// ExpiredKeys returns the keys of all elements that have expired at the given time, in key order.
+func (bptree *BPlusTree) ExpiredKeys(now time.Time) ([][]byte, error) {
+
+	return bptree.findExpiredKeys(uint64(now.UnixNano()))
+}
+
+// DeleteIfExpired deletes the element corresponding to the key if it has expired at the given time, and returns the value it held.
+// The key may have been updated with a new expiry timestamp after it was found to be expired, so expiry is checked again under the write lock.
+func (bptree *BPlusTree) DeleteIfExpired(key []byte, now time.Time) (value []byte, deleted bool, err error) {
+
+	timestamp := uint64(now.UnixNano())
+
+	bptree.bPlusTreeMutex.Lock()
+	defer bptree.bPlusTreeMutex.Unlock()
+
+	var expiredElement codec.LeafNodeElement
+
+	deleted, err = bptree.deleteKey(key, func(element codec.LeafNodeElement) bool {
+		expiredElement = element
+		return element.IsExpired(timestamp)
+	})
+
+	if err != nil || !deleted {
+		return nil, false, err
+	}
+
+	value, err = codec.DecompressValue(expiredElement.Value, expiredElement.Compression)
+
+	return value, true, err
+}
+
+// findExpiredKeys walks the leaf chain and returns the keys that have expired at the given unix timestamp (in nanoseconds), in key order.
+func (bptree *BPlusTree) findExpiredKeys(now uint64) ([][]byte, error) {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	expiredKeys := make([][]byte, 0)
+
+	leafNodePageId := bptree.firstLeafNodePageId
+
+	for leafNodePageId != 0 {
+
+		leafNodeGuard, err := bptree.bufferPoolManager.NewReadGuard(leafNodePageId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		leafNodeReader := NewLeafNodeReader(leafNodeGuard, bptree.comparator)
+
+		expiredKeys = append(expiredKeys, leafNodeReader.GetExpiredKeys(now)...)
+		leafNodePageId = leafNodeReader.GetNextLeafNodePageId()
+
+		leafNodeGuard.Done()
+	}
+
+	return expiredKeys, nil
+}
 func (bptree *BPlusTree) Close() {
+	bptree.recordMetaData()
+}
+
+// RecordMetaData records the root node, first leaf node and compression of the B+ tree in the metadata,
+// so they are written with the next metadata page, without closing the B+ tree.
+func (bptree *BPlusTree) RecordMetaData() {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	bptree.recordMetaData()
+}
+
+func (bptree *BPlusTree) recordMetaData() {
 	bptree.metadata.RootPages[bptree.BPlusTreeId] = bptree.rootNodePageId
 	bptree.metadata.FirstLeafNodePages[bptree.BPlusTreeId] = bptree.firstLeafNodePageId
+
+	// B+ trees without a recorded compression type aren't compressed, so uncompressed B+ trees take no room in the metadata page.
+	if bptree.compression == codec.CompressionNone {
+		delete(bptree.metadata.CompressionTypes, bptree.BPlusTreeId)
+		return
+	}
+
+	if bptree.metadata.CompressionTypes == nil {
+		bptree.metadata.CompressionTypes = make(map[uint64]uint8)
+	}
+	bptree.metadata.CompressionTypes[bptree.BPlusTreeId] = uint8(bptree.compression)
+}
+
+// SetCompression sets the algorithm used to compress values written to the B+ tree from now on. Values already written are left as is,
+// since every element records the algorithm it was compressed with. The setting is recorded in the metadata page when the B+ tree is closed.
+func (bptree *BPlusTree) SetCompression(compression codec.CompressionType) {
+
+	bptree.bPlusTreeMutex.Lock()
+	defer bptree.bPlusTreeMutex.Unlock()
+
+	bptree.compression = compression
+}
+
+// GetCompressionStats returns the compression statistics of values written to the B+ tree since it was opened.
+func (bptree *BPlusTree) GetCompressionStats() CompressionStats {
+
+	bptree.bPlusTreeMutex.RLock()
+	defer bptree.bPlusTreeMutex.RUnlock()
+
+	return bptree.compressionStats
+}
+
+// record adds a written value to the statistics. Caller must hold the B+ tree write lock.
+func (stats *CompressionStats) record(rawSize int, storedSize int, compression codec.CompressionType) {
+
+	if compression == codec.CompressionNone {
+		stats.UncompressedValues++
+	} else {
+		stats.CompressedValues++
+	}
+
+	stats.RawBytes += uint64(rawSize)
+	stats.StoredBytes += uint64(storedSize)
 }
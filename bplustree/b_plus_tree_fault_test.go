@@ -0,0 +1,166 @@
+package bplustree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+	"github.com/stretchr/testify/suite"
+)
+
+type BPlusTreeFaultTestSuite struct {
+	suite.Suite
+	btree      *BPlusTree
+	bufferPool *bpm.SimpleBufferPoolManager
+	disk       *bpm.FaultInjectingDiskManager
+}
+
+func (fs *BPlusTreeFaultTestSuite) SetupTest() {
+
+	memoryDisk, metadata := bpm.NewMemoryDiskManager()
+
+	fs.disk = bpm.NewFaultInjectingDiskManager(memoryDisk, 1)
+
+	// a small buffer pool, so pages are evicted and read back from disk while the B+ tree grows.
+	bufferPool, err := bpm.NewSimpleBufferPoolManager(10, 4096, bpm.NewLRUReplacer(), fs.disk)
+	fs.Require().NoError(err)
+
+	fs.bufferPool = bufferPool
+	fs.btree, err = NewBPlusTree(0, bufferPool, metadata)
+	fs.Require().NoError(err)
+}
+
+func (fs *BPlusTreeFaultTestSuite) TearDownTest() {
+
+	fs.disk.ClearFaults()
+	_ = fs.bufferPool.Close()
+}
+
+func faultTestKey(i int) []byte {
+	return []byte(fmt.Sprintf("key_%05d", i))
+}
+
+func faultTestValue(i int) []byte {
+	return append([]byte(fmt.Sprintf("value_%05d_", i)), bytes.Repeat([]byte("x"), 100)...)
+}
+
+func (fs *BPlusTreeFaultTestSuite) TestInsertWithIOErrors() {
+
+	fs.disk.SetFaultConfig(bpm.FaultConfig{ReadErrorRate: 0.2, WriteErrorRate: 0.2})
+
+	inserted := make([]int, 0)
+	failed := 0
+
+	// keys are inserted in random order, so most inserts read a leaf node evicted from the buffer pool.
+	for _, i := range rand.New(rand.NewSource(1)).Perm(300) {
+
+		if err := fs.btree.Insert(faultTestKey(i), faultTestValue(i)); err != nil {
+			failed++
+			continue
+		}
+
+		inserted = append(inserted, i)
+	}
+
+	fs.Require().Greater(failed, 0)
+
+	fs.disk.ClearFaults()
+
+	// a failed insert doesn't lose the keys inserted before it.
+	for _, i := range inserted {
+
+		value, err := fs.btree.Get(faultTestKey(i))
+		fs.Require().NoError(err, "key %d", i)
+		fs.Assert().Equal(faultTestValue(i), value)
+	}
+}
+
+func (fs *BPlusTreeFaultTestSuite) TestGetWithReadErrors() {
+
+	for i := range 200 {
+		fs.Require().NoError(fs.btree.Insert(faultTestKey(i), faultTestValue(i)))
+	}
+
+	failedGets := 0
+
+	for i := range 200 {
+
+		reads, _ := fs.disk.Operations()
+		fs.Require().NoError(fs.disk.ScheduleFault(bpm.Fault{Type: bpm.FaultReadError, Operation: reads + 1}))
+
+		// Get only reads from disk if a page on the path to the key isn't in the buffer pool.
+		if _, err := fs.btree.Get(faultTestKey(i)); err != nil {
+			fs.Assert().ErrorIs(err, bpm.ErrInjectedFault)
+			failedGets++
+		}
+
+		fs.disk.ClearFaults()
+
+		value, err := fs.btree.Get(faultTestKey(i))
+		fs.Require().NoError(err)
+		fs.Assert().Equal(faultTestValue(i), value)
+	}
+
+	fs.Assert().Greater(failedGets, 0)
+}
+
+func (fs *BPlusTreeFaultTestSuite) TestCrashRecovery() {
+
+	filePath := filepath.Join(fs.T().TempDir(), "crash_test.db")
+
+	directIODisk, metadata, _, err := bpm.NewDirectIODiskManager(filePath)
+	fs.Require().NoError(err)
+
+	disk := bpm.NewFaultInjectingDiskManager(directIODisk, 1)
+
+	bufferPool, err := bpm.NewSimpleBufferPoolManager(10, 4096, bpm.NewLRUReplacer(), disk)
+	fs.Require().NoError(err)
+
+	btree, err := NewBPlusTree(0, bufferPool, metadata)
+	fs.Require().NoError(err)
+
+	for i := range 200 {
+		fs.Require().NoError(btree.Insert(faultTestKey(i), faultTestValue(i)))
+	}
+
+	btree.RecordMetaData()
+	fs.Require().NoError(bufferPool.Sync())
+
+	// keys inserted after the sync are lost in the crash, even though some of their pages were written to disk when they were evicted.
+	for i := 200; i < 400; i++ {
+		fs.Require().NoError(btree.Insert(faultTestKey(i), faultTestValue(i)))
+	}
+
+	fs.Require().NoError(disk.Crash())
+
+	directIODisk, metadata, isNewDatabase, err := bpm.NewDirectIODiskManager(filePath)
+	fs.Require().NoError(err)
+	fs.Require().False(isNewDatabase)
+
+	bufferPool, err = bpm.NewSimpleBufferPoolManager(10, 4096, bpm.NewLRUReplacer(), directIODisk)
+	fs.Require().NoError(err)
+
+	btree, err = NewBPlusTree(0, bufferPool, metadata)
+	fs.Require().NoError(err)
+
+	for i := range 200 {
+
+		value, err := btree.Get(faultTestKey(i))
+		fs.Require().NoError(err, "key %d", i)
+		fs.Assert().Equal(faultTestValue(i), value)
+	}
+
+	count, err := btree.Count(nil, nil)
+	fs.Require().NoError(err)
+	fs.Assert().Equal(uint64(200), count)
+
+	btree.Close()
+	fs.Require().NoError(bufferPool.Close())
+}
+
+func TestBPlusTreeFaultInjection(t *testing.T) {
+	suite.Run(t, new(BPlusTreeFaultTestSuite))
+}
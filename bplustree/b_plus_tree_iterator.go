@@ -4,15 +4,23 @@ import (
 	"fmt"
 
 	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
 )
 
 type BPlusTreeIterator struct {
 	cursor            *IterativeCursor
 	bufferPoolManager bpm.BufferPoolManager
+
+	// reads leaf nodes ahead of the iterator once it is found to be walking the leaf chain.
+	readAheadDetector *bpm.SequentialReadDetector
 }
 
 func NewBPlusIterator(bptree *BPlusTree) (*BPlusTreeIterator, error) {
 
+	if bptree.firstLeafNodePageId == 0 {
+		return nil, fmt.Errorf("B Plus Tree is empty")
+	}
+
 	readGuard, err := bptree.bufferPoolManager.NewReadGuard(bptree.firstLeafNodePageId)
 
 	if err != nil {
@@ -20,35 +28,64 @@ func NewBPlusIterator(bptree *BPlusTree) (*BPlusTreeIterator, error) {
 		return nil, err
 	}
 
+	readAheadDetector := bptree.newLeafChainReadAheadDetector()
+	readAheadDetector.Access(readGuard.GetPageId(), readGuard.GetPageData())
+
 	return &BPlusTreeIterator{
-		cursor:            newIterativeCursor(readGuard),
+		cursor:            newIterativeCursor(readGuard, bptree.comparator),
 		bufferPoolManager: bptree.bufferPoolManager,
+		readAheadDetector: readAheadDetector,
 	}, nil
 }
 
+// newLeafChainReadAheadDetector returns a detector that reads leaf nodes ahead of a scan following the leaf chain.
+func (bptree *BPlusTree) newLeafChainReadAheadDetector() *bpm.SequentialReadDetector {
+
+	leafNodeCodec := codec.NewLeafNodeCodecWithComparator(bptree.comparator)
+
+	return bpm.NewSequentialReadDetector(bptree.bufferPoolManager, leafNodeCodec.GetNextLeafNodePageId, bpm.DEFAULT_READ_AHEAD_PAGES)
+}
+
+// Next moves the iterator to the next element in key order, skipping deleted and expired elements.
+// Next must be called before the first element can be accessed.
 func (i *BPlusTreeIterator) Next() (ok bool, err error) {
 
-	nextSlotId := i.cursor.nextSlot()
+	now := currentTimestamp()
+
+	for {
+
+		nextSlotId := i.cursor.nextSlot(now)
+
+		if nextSlotId != -1 {
+			i.cursor.currentSlotId = nextSlotId
+			return true, nil
+		}
 
-	if nextSlotId == -1 {
 		nextLeafNodePageId := i.cursor.NextLeafNodePageId()
 
 		if nextLeafNodePageId == 0 {
 			return false, fmt.Errorf("end of iterator")
 		}
-		i.cursor.readGuard.Done()
 
 		readGuard, err := i.bufferPoolManager.NewReadGuard(nextLeafNodePageId)
 
 		if err != nil {
 			return false, err
 		}
+
+		i.readAheadDetector.Access(nextLeafNodePageId, readGuard.GetPageData())
+
+		i.cursor.readGuard.Done()
 		i.cursor.readGuard = readGuard
 	}
-	return true, nil
 }
 
-func (i *BPlusTreeIterator) GetValue() []byte {
+func (i *BPlusTreeIterator) GetKey() []byte {
+
+	return i.cursor.CurrentKey()
+}
+
+func (i *BPlusTreeIterator) GetValue() ([]byte, error) {
 
 	return i.cursor.CurrentValue()
 }
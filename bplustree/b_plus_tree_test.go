@@ -1,9 +1,12 @@
 package bplustree
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log/slog"
-	"os"
+	"math/rand"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,7 +18,6 @@ import (
 type BPlusTreeTestSuite struct {
 	suite.Suite
 	btree    *BPlusTree
-	disk     *bpm.DirectIODiskManager
 	metadata *codec.MetaData
 }
 
@@ -29,15 +31,10 @@ func (ts *BPlusTreeTestSuite) SetupTest() {
 
 	// slog.SetDefault(logger)
 
-	// Create test file
-	testFile := "dragon.db"
+	// Initialize an in-memory disk manager, so tests don't share a database file
+	disk, metadata := bpm.NewMemoryDiskManager()
 
-	// Initialize disk manager
-	disk, actualMetadata, _, err := bpm.NewDirectIODiskManager(testFile)
-	ts.Require().NoError(err)
-
-	ts.disk = disk
-	ts.metadata = actualMetadata
+	ts.metadata = metadata
 
 	// Create replacer and buffer pool manager
 	replacer := bpm.NewLRUReplacer()
@@ -45,16 +42,14 @@ func (ts *BPlusTreeTestSuite) SetupTest() {
 	ts.Require().NoError(err)
 
 	// Create BPlusTree
-	ts.btree = NewBPlusTree(0, bufferPoolManager, ts.metadata)
+	ts.btree, err = NewBPlusTree(0, bufferPoolManager, ts.metadata)
+	ts.Require().NoError(err)
 }
 
 func (ts *BPlusTreeTestSuite) TearDownTest() {
 	if ts.btree != nil {
 		ts.btree.Close()
 	}
-
-	// Clean up test file
-	os.Remove("dragon.db")
 }
 
 func (ts *BPlusTreeTestSuite) TestInsertSingleElement() {
@@ -225,6 +220,480 @@ func (ts *BPlusTreeTestSuite) TestInsertEmptyValue() {
 	ts.Assert().Equal(value, retrievedValue)
 }
 
+func (ts *BPlusTreeTestSuite) TestExists() {
+
+	// Test exists on empty tree
+	exists, err := ts.btree.Exists([]byte("key1"))
+	ts.Require().NoError(err)
+	ts.Assert().False(exists)
+
+	err = ts.btree.Insert([]byte("key1"), []byte("value1"))
+	ts.Require().NoError(err)
+
+	exists, err = ts.btree.Exists([]byte("key1"))
+	ts.Require().NoError(err)
+	ts.Assert().True(exists)
+
+	exists, err = ts.btree.Exists([]byte("key2"))
+	ts.Require().NoError(err)
+	ts.Assert().False(exists)
+}
+
+func (ts *BPlusTreeTestSuite) TestCount() {
+
+	// Test count on empty tree
+	count, err := ts.btree.Count([]byte("key_0000"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(0), count)
+
+	// Insert enough elements to span multiple leaf nodes
+	numElements := 20
+	largeValue := make([]byte, 500)
+
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		err := ts.btree.Insert(key, largeValue)
+		ts.Require().NoError(err)
+	}
+
+	count, err = ts.btree.Count([]byte("key_0000"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements), count)
+
+	count, err = ts.btree.Count([]byte("key_0005"), []byte("key_0015"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(10), count)
+
+	count, err = ts.btree.Count([]byte("key_0015"), []byte("key_0005"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(0), count)
+}
+
+func (ts *BPlusTreeTestSuite) TestScan() {
+
+	visit := func(keys *[]string) func(key []byte, value []byte) bool {
+		return func(key []byte, value []byte) bool {
+			*keys = append(*keys, string(key))
+			return true
+		}
+	}
+
+	// Test scan on empty tree
+	keys := make([]string, 0)
+	err := ts.btree.Scan([]byte("key_0000"), nil, visit(&keys))
+	ts.Require().NoError(err)
+	ts.Assert().Empty(keys)
+
+	// Insert enough elements to span multiple leaf nodes
+	numElements := 20
+	largeValue := make([]byte, 500)
+
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		err := ts.btree.Insert(key, largeValue)
+		ts.Require().NoError(err)
+	}
+
+	keys = make([]string, 0)
+	err = ts.btree.Scan([]byte("key_0005"), []byte("key_0015"), visit(&keys))
+	ts.Require().NoError(err)
+	ts.Require().Len(keys, 10)
+
+	for i, key := range keys {
+		ts.Assert().Equal(fmt.Sprintf("key_%04d", i+5), key)
+	}
+
+	// Test early termination of the scan
+	numVisited := 0
+	err = ts.btree.Scan([]byte("key_0000"), nil, func(key []byte, value []byte) bool {
+		numVisited++
+		return numVisited < 3
+	})
+	ts.Require().NoError(err)
+	ts.Assert().Equal(3, numVisited)
+}
+
+func (ts *BPlusTreeTestSuite) TestInsertKeysWithSharedPrefix() {
+
+	prefix := "tenant_00000042/2026-10-18T00:00:00/"
+	numElements := 200
+
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("%sitem_%04d", prefix, i))
+		err := ts.btree.Insert(key, []byte(fmt.Sprintf("value_%04d", i)))
+		ts.Require().NoError(err)
+	}
+
+	// keys that don't share the prefix force the prefix of the leaf nodes they are inserted into to be shortened
+	otherKeys := [][]byte{[]byte("a"), []byte("tenant_00000042/2026"), []byte("tenant_00000043"), []byte("z")}
+
+	for _, key := range otherKeys {
+		err := ts.btree.Insert(key, key)
+		ts.Require().NoError(err)
+	}
+
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("%sitem_%04d", prefix, i))
+		value, err := ts.btree.Get(key)
+		ts.Require().NoError(err)
+		ts.Assert().Equal([]byte(fmt.Sprintf("value_%04d", i)), value)
+	}
+
+	for _, key := range otherKeys {
+		value, err := ts.btree.Get(key)
+		ts.Require().NoError(err)
+		ts.Assert().Equal(key, value)
+	}
+
+	count, err := ts.btree.Count([]byte{}, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements+len(otherKeys)), count)
+}
+
+func (ts *BPlusTreeTestSuite) TestDelete() {
+
+	// Test delete on empty tree
+	err := ts.btree.Delete([]byte("key1"))
+	ts.Assert().Error(err)
+
+	err = ts.btree.Insert([]byte("key1"), []byte("value1"))
+	ts.Require().NoError(err)
+
+	err = ts.btree.Insert([]byte("key2"), []byte("value2"))
+	ts.Require().NoError(err)
+
+	err = ts.btree.Delete([]byte("key1"))
+	ts.Require().NoError(err)
+
+	_, err = ts.btree.Get([]byte("key1"))
+	ts.Assert().Error(err)
+
+	retrievedValue, err := ts.btree.Get([]byte("key2"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("value2"), retrievedValue)
+
+	// deleting the same key twice should fail
+	err = ts.btree.Delete([]byte("key1"))
+	ts.Assert().Error(err)
+}
+
+func (ts *BPlusTreeTestSuite) TestInsertWithTTL() {
+
+	err := ts.btree.InsertWithTTL([]byte("session_1"), []byte("value1"), 20*time.Millisecond)
+	ts.Require().NoError(err)
+
+	err = ts.btree.InsertWithTTL([]byte("session_2"), []byte("value2"), time.Hour)
+	ts.Require().NoError(err)
+
+	retrievedValue, err := ts.btree.Get([]byte("session_1"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("value1"), retrievedValue)
+
+	time.Sleep(30 * time.Millisecond)
+
+	// expired keys are filtered by reads
+	_, err = ts.btree.Get([]byte("session_1"))
+	ts.Assert().Error(err)
+
+	exists, err := ts.btree.Exists([]byte("session_1"))
+	ts.Require().NoError(err)
+	ts.Assert().False(exists)
+
+	count, err := ts.btree.Count([]byte("session"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(1), count)
+
+	// re-inserting an expired key without a TTL makes it visible again
+	err = ts.btree.Insert([]byte("session_1"), []byte("value3"))
+	ts.Require().NoError(err)
+
+	retrievedValue, err = ts.btree.Get([]byte("session_1"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("value3"), retrievedValue)
+}
+
+func (ts *BPlusTreeTestSuite) TestDeleteExpired() {
+
+	numElements := 20
+	largeValue := make([]byte, 500)
+
+	// every other key expires
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+
+		ttl := time.Duration(0)
+		if i%2 == 0 {
+			ttl = time.Millisecond
+		}
+		err := ts.btree.InsertWithTTL(key, largeValue, ttl)
+		ts.Require().NoError(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	numDeleted, err := ts.btree.DeleteExpired(time.Now())
+	ts.Require().NoError(err)
+	ts.Assert().Equal(numElements/2, numDeleted)
+
+	// expired keys were already deleted
+	numDeleted, err = ts.btree.DeleteExpired(time.Now())
+	ts.Require().NoError(err)
+	ts.Assert().Equal(0, numDeleted)
+
+	count, err := ts.btree.Count([]byte("key_0000"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements/2), count)
+}
+
+func (ts *BPlusTreeTestSuite) TestIterator() {
+
+	numElements := 20
+	largeValue := make([]byte, 500)
+
+	for i := numElements - 1; i >= 0; i-- {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		err := ts.btree.Insert(key, largeValue)
+		ts.Require().NoError(err)
+	}
+
+	err := ts.btree.Delete([]byte("key_0003"))
+	ts.Require().NoError(err)
+
+	iterator, err := NewBPlusIterator(ts.btree)
+	ts.Require().NoError(err)
+	defer iterator.Close()
+
+	keys := make([]string, 0)
+
+	for ok, _ := iterator.Next(); ok; ok, _ = iterator.Next() {
+		keys = append(keys, string(iterator.GetKey()))
+	}
+
+	ts.Assert().Equal(numElements-1, len(keys))
+	ts.Assert().IsIncreasing(keys)
+	ts.Assert().NotContains(keys, "key_0003")
+}
+
+func (ts *BPlusTreeTestSuite) TestComparator() {
+
+	btree, err := NewBPlusTreeWithComparator(1, ts.btree.bufferPoolManager, ts.metadata, codec.LittleEndianInt64Comparator)
+	ts.Require().NoError(err)
+	defer btree.Close()
+
+	// insert little-endian signed integer keys out of order, enough to span multiple leaf nodes
+	largeValue := make([]byte, 200)
+
+	for _, i := range rand.New(rand.NewSource(1)).Perm(60) {
+		key := binary.LittleEndian.AppendUint16(nil, uint16(int16((i-30)*100)))
+		err := btree.Insert(key, largeValue)
+		ts.Require().NoError(err)
+	}
+
+	iterator, err := NewBPlusIterator(btree)
+	ts.Require().NoError(err)
+	defer iterator.Close()
+
+	keys := make([]int16, 0)
+
+	for ok, _ := iterator.Next(); ok; ok, _ = iterator.Next() {
+		keys = append(keys, int16(binary.LittleEndian.Uint16(iterator.GetKey())))
+	}
+
+	ts.Assert().Len(keys, 60)
+	ts.Assert().IsIncreasing(keys)
+
+	startKey, endKey := int16(-1000), int16(1000)
+
+	count, err := btree.Count(binary.LittleEndian.AppendUint16(nil, uint16(startKey)), binary.LittleEndian.AppendUint16(nil, uint16(endKey)))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(20), count)
+
+	// the B+ tree can't be opened with a different comparator
+	_, err = NewBPlusTreeWithComparator(1, ts.btree.bufferPoolManager, ts.metadata, codec.BytewiseComparator)
+	ts.Assert().Error(err)
+
+	// nor with the bytewise comparator, if the comparator it was created with isn't registered.
+	unregisteredComparator := codec.NewComparator("unregistered", codec.BytewiseComparator.Compare)
+
+	_, err = NewBPlusTreeWithComparator(2, ts.btree.bufferPoolManager, ts.metadata, unregisteredComparator)
+	ts.Require().NoError(err)
+
+	_, err = NewBPlusTree(2, ts.btree.bufferPoolManager, ts.metadata)
+	ts.Assert().ErrorContains(err, "not registered")
+}
+
+func (ts *BPlusTreeTestSuite) TestComparatorWithNonUnitResults() {
+
+	// orders decimal keys by their value, returning the difference between the values rather than -1, 0 or 1.
+	numericComparator := codec.NewComparator("numeric", func(a []byte, b []byte) int {
+
+		x, _ := strconv.Atoi(string(a))
+		y, _ := strconv.Atoi(string(b))
+
+		return x - y
+	})
+
+	btree, err := NewBPlusTreeWithComparator(1, ts.btree.bufferPoolManager, ts.metadata, numericComparator)
+	ts.Require().NoError(err)
+	defer btree.Close()
+
+	numElements := 300
+	largeValue := make([]byte, 200)
+
+	// enough keys to split leaf nodes and internal nodes.
+	for _, i := range rand.New(rand.NewSource(1)).Perm(numElements) {
+		ts.Require().NoError(btree.Insert([]byte(strconv.Itoa(i*7)), largeValue))
+	}
+
+	for i := range numElements {
+
+		exists, err := btree.Exists([]byte(strconv.Itoa(i * 7)))
+		ts.Require().NoError(err)
+		ts.Assert().True(exists, i*7)
+	}
+
+	for i := 0; i < numElements; i += 3 {
+		ts.Require().NoError(btree.Delete([]byte(strconv.Itoa(i * 7))))
+	}
+
+	iterator, err := NewBPlusIterator(btree)
+	ts.Require().NoError(err)
+	defer iterator.Close()
+
+	keys := make([]int, 0)
+
+	for ok, _ := iterator.Next(); ok; ok, _ = iterator.Next() {
+
+		key, err := strconv.Atoi(string(iterator.GetKey()))
+		ts.Require().NoError(err)
+		keys = append(keys, key)
+	}
+
+	ts.Assert().Len(keys, numElements-numElements/3)
+	ts.Assert().IsIncreasing(keys)
+
+	// the keys from 70 up to 700 are i*7 for i = 10 to 99, the 30 keys with i divisible by 3 were deleted.
+	count, err := btree.Count([]byte("70"), []byte("700"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(60), count)
+}
+
+func (ts *BPlusTreeTestSuite) TestCompression() {
+
+	// only compressed B+ trees are recorded in the metadata.
+	ts.btree.RecordMetaData()
+	ts.Assert().NotContains(ts.metadata.CompressionTypes, ts.btree.BPlusTreeId)
+
+	ts.btree.SetCompression(codec.CompressionFlate)
+
+	ts.btree.RecordMetaData()
+	ts.Assert().Equal(uint8(codec.CompressionFlate), ts.metadata.CompressionTypes[ts.btree.BPlusTreeId])
+
+	numElements := 30
+	jsonValue := []byte(strings.Repeat(`{"name":"charizard","type":"fire","level":36},`, 20))
+
+	for i := range numElements {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		err := ts.btree.Insert(key, jsonValue)
+		ts.Require().NoError(err)
+	}
+
+	// small values are stored uncompressed
+	err := ts.btree.Insert([]byte("small"), []byte("value"))
+	ts.Require().NoError(err)
+
+	stats := ts.btree.GetCompressionStats()
+	ts.Assert().Equal(uint64(numElements), stats.CompressedValues)
+	ts.Assert().Equal(uint64(1), stats.UncompressedValues)
+	ts.Assert().Greater(stats.Ratio(), 4.0)
+
+	// values written after compression is disabled coexist with compressed values
+	ts.btree.SetCompression(codec.CompressionNone)
+
+	ts.btree.RecordMetaData()
+	ts.Assert().NotContains(ts.metadata.CompressionTypes, ts.btree.BPlusTreeId)
+
+	err = ts.btree.Insert([]byte("key_0000"), []byte("uncompressed"))
+	ts.Require().NoError(err)
+
+	value, err := ts.btree.Get([]byte("key_0000"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("uncompressed"), value)
+
+	for i := 1; i < numElements; i++ {
+		value, err := ts.btree.Get([]byte(fmt.Sprintf("key_%04d", i)))
+		ts.Require().NoError(err)
+		ts.Assert().Equal(jsonValue, value)
+	}
+
+	iterator, err := NewBPlusIterator(ts.btree)
+	ts.Require().NoError(err)
+	defer iterator.Close()
+
+	ok, err := iterator.Next()
+	ts.Require().True(ok)
+	ts.Require().NoError(err)
+
+	value, err = iterator.GetValue()
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("uncompressed"), value)
+
+	ok, err = iterator.Next()
+	ts.Require().True(ok)
+	ts.Require().NoError(err)
+
+	value, err = iterator.GetValue()
+	ts.Require().NoError(err)
+	ts.Assert().Equal(jsonValue, value)
+}
+
+func (ts *BPlusTreeTestSuite) TestLeafNodeLocality() {
+
+	otherBtree, err := NewBPlusTree(1, ts.btree.bufferPoolManager, ts.metadata)
+	ts.Require().NoError(err)
+	defer otherBtree.Close()
+
+	// both B+ trees grow at the same time, so without extents their leaf nodes would be interleaved in the file.
+	for i := range 2000 {
+
+		key := []byte(fmt.Sprintf("key_%05d", i))
+		value := []byte(fmt.Sprintf("value_%05d_%s", i, strings.Repeat("v", 100)))
+
+		ts.Require().NoError(ts.btree.Insert(key, value))
+		ts.Require().NoError(otherBtree.Insert(key, value))
+	}
+
+	for _, btree := range []*BPlusTree{ts.btree, otherBtree} {
+
+		leafNodePageIds := make([]uint64, 0)
+
+		for pageId := btree.firstLeafNodePageId; pageId != 0; {
+
+			guard, err := btree.bufferPoolManager.NewReadGuard(pageId)
+			ts.Require().NoError(err)
+
+			leafNodePageIds = append(leafNodePageIds, pageId)
+			pageId = NewLeafNodeReader(guard, btree.comparator).GetNextLeafNodePageId()
+			guard.Done()
+		}
+
+		ts.Require().Greater(len(leafNodePageIds), 2*bpm.EXTENT_SIZE)
+
+		// number of leaf nodes stored in the page right after the leaf node before them in the leaf chain.
+		sequential := 0
+
+		for i := 1; i < len(leafNodePageIds); i++ {
+
+			if leafNodePageIds[i] == leafNodePageIds[i-1]+1 {
+				sequential++
+			}
+		}
+
+		// the leaf nodes of a B+ tree are only apart when an extent of the B+ tree is full.
+		ts.Assert().GreaterOrEqual(sequential, (len(leafNodePageIds)-1)*9/10)
+	}
+}
+
 func TestBPlusTree(t *testing.T) {
 	suite.Run(t, new(BPlusTreeTestSuite))
 }
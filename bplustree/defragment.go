@@ -0,0 +1,293 @@
+package bplustree
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// DefragmentStats reports the work done by a defragmentation pass.
+type DefragmentStats struct {
+
+	// number of nodes whose garbage was removed.
+	CompactedPages int
+
+	// number of bytes of free space reclaimed by compacting nodes.
+	ReclaimedBytes int
+
+	// number of leaf nodes merged into the leaf node before them, and deallocated.
+	ReclaimedPages int
+}
+
+// defragmentation tracks a pass over the B+ tree compacting nodes and merging underfull leaf nodes.
+type defragmentation struct {
+	startKey   []byte
+	fillFactor float64
+	maxPages   int
+
+	// number of pages changed in this pass.
+	changedPages int
+
+	// set once maxPages pages have been changed, nextKey is the key the next pass resumes from.
+	stopped bool
+	nextKey []byte
+
+	// depth of the leaf nodes, 0 if the root node is a leaf node.
+	leafNodeLevel int
+
+	stats DefragmentStats
+}
+
+// Defragment compacts the nodes of the B+ tree, and merges adjacent leaf nodes under the same parent whose elements fit in fillFactor of a page.
+// Leaf nodes holding keys before startKey are skipped. The B+ tree is locked for the duration of the call,
+// and at most maxPages pages are changed, so a pass over the B+ tree is made a batch at a time.
+// It returns the key the next batch starts from, nil once the last leaf node was visited.
+func (bptree *BPlusTree) Defragment(startKey []byte, fillFactor float64, maxPages int) (stats DefragmentStats, nextKey []byte, err error) {
+
+	if fillFactor <= 0 || fillFactor > 1 {
+		return stats, nil, fmt.Errorf("fill factor must be in (0, 1], got %v", fillFactor)
+	}
+
+	if maxPages <= 0 {
+		return stats, nil, fmt.Errorf("max pages must be positive, got %d", maxPages)
+	}
+
+	bptree.bPlusTreeMutex.Lock()
+	defer bptree.bPlusTreeMutex.Unlock()
+
+	fmt.Println()
+	slog.Info("Defragmenting B+ tree...", "BPlusTreeId", bptree.BPlusTreeId, "startKey", startKey, "fillFactor", fillFactor, "maxPages", maxPages, "function", "Defragment", "at", "btree")
+
+	if bptree.rootNodePageId == 0 {
+		return stats, nil, nil
+	}
+
+	leafNodeLevel, err := bptree.findLeafNodeLevel()
+
+	if err != nil {
+		return stats, nil, err
+	}
+
+	d := &defragmentation{
+		startKey:      startKey,
+		fillFactor:    fillFactor,
+		maxPages:      maxPages,
+		leafNodeLevel: leafNodeLevel,
+	}
+
+	if leafNodeLevel == 0 {
+		err = bptree.compactLeafNode(bptree.rootNodePageId, d)
+	} else {
+		err = bptree.defragmentChildNodes(bptree.rootNodePageId, nil, nil, 0, d)
+	}
+
+	if err != nil {
+		return d.stats, nil, err
+	}
+
+	slog.Info("Defragmented B+ tree", "BPlusTreeId", bptree.BPlusTreeId, "compactedPages", d.stats.CompactedPages, "reclaimedBytes", d.stats.ReclaimedBytes, "reclaimedPages", d.stats.ReclaimedPages, "nextKey", d.nextKey, "function", "Defragment", "at", "btree")
+
+	return d.stats, d.nextKey, nil
+}
+
+// stop ends the pass once maxPages pages are changed, the next pass starts from the leaf node holding the given key.
+func (d *defragmentation) stop(key []byte) {
+
+	d.stopped = true
+	d.nextKey = key
+
+	// an empty key starts from the first leaf node, since a nil key marks the end of a pass.
+	if d.nextKey == nil {
+		d.nextKey = []byte{}
+	}
+}
+
+// defragmentChildNodes visits the children of an internal node at the given depth in key order. Leaf nodes are compacted,
+// then merged with the leaf nodes following them under the same internal node, and the internal node is compacted once all its children are visited.
+// lowerKey and upperKey bound the keys found under the internal node, nil if it is the first or last node at its depth.
+func (bptree *BPlusTree) defragmentChildNodes(pageId uint64, lowerKey []byte, upperKey []byte, level int, d *defragmentation) error {
+
+	guard, err := bptree.bufferPoolManager.NewReadGuard(pageId)
+
+	if err != nil {
+		return err
+	}
+
+	childNodePageIds, keys := NewInternalNodeReader(guard, bptree.comparator).GetChildNodePageIds()
+	guard.Done()
+
+	isLeafNode := level+1 == d.leafNodeLevel
+
+	for i := 0; i < len(childNodePageIds); i++ {
+
+		// a split leaves the key it moves up to the parent as the first key of the new internal node, so the first child of the new node
+		// is also the last child of the node it was split from. No key can be found through the copy, so it is skipped.
+		if i == 0 && lowerKey != nil && bptree.comparator.Compare(keys[0], lowerKey) <= 0 {
+			continue
+		}
+
+		childLowerKey, childUpperKey := lowerKey, upperKey
+
+		if i > 0 {
+			childLowerKey = keys[i-1]
+		}
+
+		if i < len(keys) {
+			childUpperKey = keys[i]
+		}
+
+		// the child was visited by an earlier pass.
+		if d.startKey != nil && childUpperKey != nil && bptree.comparator.Compare(childUpperKey, d.startKey) <= 0 {
+			continue
+		}
+
+		if d.changedPages >= d.maxPages {
+			d.stop(childLowerKey)
+			return nil
+		}
+
+		if !isLeafNode {
+
+			if err := bptree.defragmentChildNodes(childNodePageIds[i], childLowerKey, childUpperKey, level+1, d); err != nil {
+				return err
+			}
+
+			if d.stopped {
+				return nil
+			}
+
+			continue
+		}
+
+		if err := bptree.compactLeafNode(childNodePageIds[i], d); err != nil {
+			return err
+		}
+
+		// the internal node can't be left without elements, so the last two children are never merged.
+		// The last child may also be the first child of the next internal node, left there as a copy by a split,
+		// so it is only merged into the leaf node before it in the last internal node at its depth.
+		canMerge := func() bool {
+			return i+1 < len(childNodePageIds) && len(keys) > 1 && (i+2 < len(childNodePageIds) || upperKey == nil)
+		}
+
+		for canMerge() && d.changedPages < d.maxPages {
+
+			merged, err := bptree.mergeLeafNodes(pageId, childNodePageIds[i], childNodePageIds[i+1], d)
+
+			if err != nil {
+				return err
+			}
+
+			if !merged {
+				break
+			}
+
+			// the key separating the merged leaf nodes is removed from the internal node along with the right leaf node.
+			childNodePageIds = slices.Delete(childNodePageIds, i+1, i+2)
+			keys = slices.Delete(keys, i, i+1)
+		}
+
+		// the leaf node may still be merged with the leaf nodes following it, so the next pass starts from it.
+		if d.changedPages >= d.maxPages && canMerge() {
+			d.stop(childLowerKey)
+			return nil
+		}
+	}
+
+	if d.changedPages >= d.maxPages {
+		return nil
+	}
+
+	writeGuard, err := bptree.bufferPoolManager.NewWriteGuard(pageId)
+
+	if err != nil {
+		return err
+	}
+
+	defer writeGuard.Done()
+
+	if reclaimedBytes := NewInternalNodeWriter(writeGuard, bptree.comparator).Compact(); reclaimedBytes > 0 {
+
+		d.changedPages++
+		d.stats.CompactedPages++
+		d.stats.ReclaimedBytes += reclaimedBytes
+	}
+
+	return nil
+}
+
+// compactLeafNode removes the garbage left in a leaf node by deleted and updated elements.
+func (bptree *BPlusTree) compactLeafNode(pageId uint64, d *defragmentation) error {
+
+	writeGuard, err := bptree.bufferPoolManager.NewWriteGuard(pageId)
+
+	if err != nil {
+		return err
+	}
+
+	defer writeGuard.Done()
+
+	if reclaimedBytes := NewLeafNodeWriter(writeGuard, bptree.comparator).Compact(); reclaimedBytes > 0 {
+
+		d.changedPages++
+		d.stats.CompactedPages++
+		d.stats.ReclaimedBytes += reclaimedBytes
+	}
+
+	return nil
+}
+
+// mergeLeafNodes moves the elements of a leaf node into the leaf node before it under the same internal node, and deallocates it.
+// It returns merged = false if the elements don't fit in fillFactor of a page, or the right leaf node is in use by a reader.
+func (bptree *BPlusTree) mergeLeafNodes(parentPageId uint64, leftPageId uint64, rightPageId uint64, d *defragmentation) (merged bool, err error) {
+
+	parentGuard, err := bptree.bufferPoolManager.NewWriteGuard(parentPageId)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer parentGuard.Done()
+
+	leftGuard, err := bptree.bufferPoolManager.NewWriteGuard(leftPageId)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer leftGuard.Done()
+
+	rightGuard, err := bptree.bufferPoolManager.NewWriteGuard(rightPageId)
+
+	if err != nil {
+		return false, err
+	}
+
+	leftPage := bytes.Clone(leftGuard.GetPageData())
+
+	if !NewLeafNodeWriter(leftGuard, bptree.comparator).MergeNodes(NewLeafNodeWriter(rightGuard, bptree.comparator), d.fillFactor) {
+		rightGuard.Done()
+		return false, nil
+	}
+
+	// the right leaf node can't be deallocated while it is pinned by a reader, such as an iterator, so the merge is undone.
+	if !rightGuard.DeletePage() {
+
+		slog.Warn("Page is in use, leaving it in place", "pageId", rightPageId, "function", "mergeLeafNodes", "at", "btree")
+
+		copy(leftGuard.GetPageData(), leftPage)
+		rightGuard.Done()
+
+		return false, nil
+	}
+
+	NewInternalNodeWriter(parentGuard, bptree.comparator).MergeChildNodes(leftPageId, rightPageId)
+
+	slog.Info("Merged leaf nodes", "BPlusTreeId", bptree.BPlusTreeId, "leftPageId", leftPageId, "rightPageId", rightPageId, "function", "mergeLeafNodes", "at", "btree")
+
+	d.changedPages++
+	d.stats.ReclaimedPages++
+
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package bplustree
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (ts *BPlusTreeTestSuite) TestDefragment() {
+
+	bufferPoolManager := ts.btree.bufferPoolManager
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("key_%05d", i))
+	}
+
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("value_%05d_%s", i, strings.Repeat("v", 100)))
+	}
+
+	for i := range 1000 {
+		ts.Require().NoError(ts.btree.Insert(key(i), value(i)))
+	}
+
+	// deleting most keys leaves garbage in every leaf node, and leaf nodes too small to keep apart.
+	for i := range 1000 {
+		if i%4 != 0 {
+			ts.Require().NoError(ts.btree.Delete(key(i)))
+		}
+	}
+
+	_, _, err := ts.btree.Defragment(nil, 1.5, 8)
+	ts.Assert().Error(err)
+
+	maxAllocatedPageId, deallocatedPages := bufferPoolManager.AllocatedPages()
+	pagesInUse := int(maxAllocatedPageId) - deallocatedPages
+
+	stats := DefragmentStats{}
+	batches := 0
+
+	var startKey []byte
+
+	for {
+
+		batchStats, nextKey, err := ts.btree.Defragment(startKey, 0.9, 8)
+		ts.Require().NoError(err)
+
+		batches++
+		stats.CompactedPages += batchStats.CompactedPages
+		stats.ReclaimedBytes += batchStats.ReclaimedBytes
+		stats.ReclaimedPages += batchStats.ReclaimedPages
+
+		if nextKey == nil {
+			break
+		}
+
+		startKey = nextKey
+	}
+
+	ts.Assert().Greater(batches, 1)
+	ts.Assert().Greater(stats.CompactedPages, 0)
+	ts.Assert().Greater(stats.ReclaimedBytes, 0)
+	ts.Assert().Greater(stats.ReclaimedPages, 0)
+
+	maxAllocatedPageId, deallocatedPages = bufferPoolManager.AllocatedPages()
+	ts.Assert().Equal(pagesInUse-stats.ReclaimedPages, int(maxAllocatedPageId)-deallocatedPages)
+
+	for i := range 1000 {
+
+		storedValue, err := ts.btree.Get(key(i))
+
+		if i%4 != 0 {
+			ts.Assert().Error(err)
+			continue
+		}
+
+		ts.Require().NoError(err)
+		ts.Assert().Equal(value(i), storedValue)
+	}
+
+	// the leaf chain skips the merged leaf nodes.
+	count, err := ts.btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(250), count)
+
+	// a second pass finds nothing left to merge.
+	stats, nextKey, err := ts.btree.Defragment(nil, 0.9, 1000)
+	ts.Require().NoError(err)
+	ts.Assert().Nil(nextKey)
+	ts.Assert().Zero(stats.ReclaimedPages)
+
+	// keys can be inserted into the merged leaf nodes.
+	for i := range 1000 {
+		if i%4 != 0 {
+			ts.Require().NoError(ts.btree.Insert(key(i), value(i)))
+		}
+	}
+
+	count, err = ts.btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(1000), count)
+}
+
+// leafNodeChain returns the page IDs of the leaf nodes linked in the leaf chain.
+func (ts *BPlusTreeTestSuite) leafNodeChain() map[uint64]bool {
+
+	chain := make(map[uint64]bool)
+
+	for pageId := ts.btree.firstLeafNodePageId; pageId != 0; {
+
+		guard, err := ts.btree.bufferPoolManager.NewReadGuard(pageId)
+		ts.Require().NoError(err)
+
+		chain[pageId] = true
+		pageId = NewLeafNodeReader(guard, ts.btree.comparator).GetNextLeafNodePageId()
+		guard.Done()
+	}
+
+	return chain
+}
+
+// assertLeafNodesInChain checks that every leaf node referenced by the internal nodes under a node is in the leaf chain,
+// including the first child of an internal node that is a copy of the last child of the internal node before it.
+func (ts *BPlusTreeTestSuite) assertLeafNodesInChain(pageId uint64, level int, leafNodeLevel int, chain map[uint64]bool) {
+
+	guard, err := ts.btree.bufferPoolManager.NewReadGuard(pageId)
+	ts.Require().NoError(err)
+
+	childNodePageIds, _ := NewInternalNodeReader(guard, ts.btree.comparator).GetChildNodePageIds()
+	guard.Done()
+
+	for _, childNodePageId := range childNodePageIds {
+
+		if level+1 == leafNodeLevel {
+			ts.Require().True(chain[childNodePageId], "internal node %d points to merged leaf node %d", pageId, childNodePageId)
+			continue
+		}
+
+		ts.assertLeafNodesInChain(childNodePageId, level+1, leafNodeLevel, chain)
+	}
+}
+
+func (ts *BPlusTreeTestSuite) TestDefragmentKeepsCopiedChildNodes() {
+
+	// keys with a long common prefix keep the number of children of internal nodes low, so internal nodes are split,
+	// leaving copies of the last child of an internal node as the first child of the next one.
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%s_%05d", strings.Repeat("k", 200), i))
+	}
+
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("value_%05d_%s", i, strings.Repeat("v", 200)))
+	}
+
+	for i := range 600 {
+		ts.Require().NoError(ts.btree.Insert(key(i), value(i)))
+	}
+
+	leafNodeLevel, err := ts.btree.findLeafNodeLevel()
+	ts.Require().NoError(err)
+	ts.Require().GreaterOrEqual(leafNodeLevel, 2)
+
+	for i := range 600 {
+		if i%8 != 0 {
+			ts.Require().NoError(ts.btree.Delete(key(i)))
+		}
+	}
+
+	stats, nextKey, err := ts.btree.Defragment(nil, 0.9, 10000)
+	ts.Require().NoError(err)
+	ts.Require().Nil(nextKey)
+	ts.Require().Greater(stats.ReclaimedPages, 0)
+
+	ts.assertLeafNodesInChain(ts.btree.rootNodePageId, 0, leafNodeLevel, ts.leafNodeChain())
+
+	for i := range 600 {
+
+		storedValue, err := ts.btree.Get(key(i))
+
+		if i%8 != 0 {
+			ts.Assert().Error(err)
+			continue
+		}
+
+		ts.Require().NoError(err)
+		ts.Assert().Equal(value(i), storedValue)
+	}
+}
@@ -20,10 +20,10 @@ type InternalNodeReader struct {
 	codec codec.InternalNodeCodec
 }
 
-func NewInternalNodeReader(rg *bpm.ReadGuard) *InternalNodeReader {
+func NewInternalNodeReader(rg *bpm.ReadGuard, comparator codec.Comparator) *InternalNodeReader {
 	return &InternalNodeReader{
 		guard: rg,
-		codec: codec.NewInternalNodeCodec(),
+		codec: codec.NewInternalNodeCodecWithComparator(comparator),
 	}
 }
 
@@ -33,6 +33,13 @@ func (r *InternalNodeReader) FindNextChildNodePageId(key []byte) (pageId uint64)
 	return r.codec.FindNextChildNodePageId(r.guard.GetPageData(), key)
 }
 
+// GetChildNodePageIds returns the page IDs of the children of the internal node in key order,
+// and the keys of its elements, where keys[i] separates child i from child i+1.
+func (r *InternalNodeReader) GetChildNodePageIds() (childNodePageIds []uint64, keys [][]byte) {
+
+	return r.codec.GetChildNodePageIds(r.guard.GetPageData())
+}
+
 func (r *InternalNodeReader) PrintElements() {
 
 	r.codec.PrintElements(r.guard.GetPageData())
@@ -14,11 +14,11 @@ type InternalNodeWriter struct {
 	codec codec.InternalNodeCodec
 }
 
-func NewInternalNodeWriter(wg *bpm.WriteGuard) *InternalNodeWriter {
+func NewInternalNodeWriter(wg *bpm.WriteGuard, comparator codec.Comparator) *InternalNodeWriter {
 
 	return &InternalNodeWriter{
 		guard: wg,
-		codec: codec.NewInternalNodeCodec(),
+		codec: codec.NewInternalNodeCodecWithComparator(comparator),
 	}
 }
 
@@ -87,6 +87,44 @@ func (w *InternalNodeWriter) Split(rightNodeWriter *InternalNodeWriter) (extraKe
 	return extraKey
 }
 
+// ReplaceChildNodePageId points the internal node to the page a child node was moved to.
+func (w *InternalNodeWriter) ReplaceChildNodePageId(oldChildNodePageId uint64, newChildNodePageId uint64) bool {
+
+	if !w.guard.IsActive() {
+		return false
+	}
+
+	w.guard.SetDirtyFlag()
+	return w.codec.ReplaceChildNodePageId(w.guard.GetPageData(), oldChildNodePageId, newChildNodePageId)
+}
+
+// Compact removes the garbage left in the internal node by deleted elements, and returns the number of bytes reclaimed.
+func (w *InternalNodeWriter) Compact() (reclaimedBytes int) {
+
+	if !w.guard.IsActive() {
+		return 0
+	}
+
+	reclaimedBytes = w.codec.Compact(w.guard.GetPageData())
+
+	if reclaimedBytes > 0 {
+		w.guard.SetDirtyFlag()
+	}
+
+	return reclaimedBytes
+}
+
+// MergeChildNodes removes the element separating two adjacent children, once the right child is merged into the left child.
+func (w *InternalNodeWriter) MergeChildNodes(leftChildNodePageId uint64, rightChildNodePageId uint64) bool {
+
+	if !w.guard.IsActive() {
+		return false
+	}
+
+	w.guard.SetDirtyFlag()
+	return w.codec.MergeChildNodes(w.guard.GetPageData(), leftChildNodePageId, rightChildNodePageId)
+}
+
 func (w *InternalNodeWriter) PrintElements() {
 
 	w.codec.PrintElements(w.guard.GetPageData())
@@ -6,37 +6,50 @@ import (
 )
 
 type IterativeCursor struct {
-	readGuard     *bpm.ReadGuard
+	readGuard *bpm.ReadGuard
+
+	// index of the slot in the current leaf node that the cursor points to, -1 if the cursor points before the first slot.
 	currentSlotId int
 	codec         codec.LeafNodeCodec
 }
 
-func newIterativeCursor(rg *bpm.ReadGuard) *IterativeCursor {
+func newIterativeCursor(rg *bpm.ReadGuard, comparator codec.Comparator) *IterativeCursor {
 	return &IterativeCursor{
 		readGuard:     rg,
-		currentSlotId: 0,
-		codec:         codec.NewLeafNodeCodec(),
+		currentSlotId: -1,
+		codec:         codec.NewLeafNodeCodecWithComparator(comparator),
 	}
 }
 func (i *IterativeCursor) NextLeafNodePageId() uint64 {
-	i.currentSlotId = 0
+	i.currentSlotId = -1
 	return i.codec.GetNextLeafNodePageId(i.readGuard.GetPageData())
 }
 
-func (i *IterativeCursor) CurrentValue() []byte {
+func (i *IterativeCursor) CurrentKey() []byte {
 
-	return i.codec.GetValueCorrespondingToSlot(i.readGuard.GetPageData(), uint16(i.currentSlotId))
+	return i.codec.GetElementCorrespondingToSlot(i.readGuard.GetPageData(), uint16(i.currentSlotId)).Key
 }
 
-func (i *IterativeCursor) nextSlot() int {
+// CurrentValue returns the decompressed value of the element the cursor points to
+func (i *IterativeCursor) CurrentValue() ([]byte, error) {
 
-	numSlots := int(i.codec.GetNumSlots(i.readGuard.GetPageData()))
-	currentSlotId := i.currentSlotId
-	for currentSlotId < numSlots && !i.codec.IsSlotDeleted(i.readGuard.GetPageData(), currentSlotId) {
-		currentSlotId++
-	}
-	if currentSlotId == numSlots {
-		return -1
+	element := i.codec.GetElementCorrespondingToSlot(i.readGuard.GetPageData(), uint16(i.currentSlotId))
+
+	return codec.DecompressValue(element.Value, element.Compression)
+}
+
+// nextSlot returns the index of the next slot in the current leaf node that points to an element which is neither deleted nor expired,
+// or -1 if no such slot exists.
+func (i *IterativeCursor) nextSlot(now uint64) int {
+
+	page := i.readGuard.GetPageData()
+	numSlots := int(i.codec.GetNumSlots(page))
+
+	for currentSlotId := i.currentSlotId + 1; currentSlotId < numSlots; currentSlotId++ {
+
+		if !i.codec.IsSlotDeleted(page, currentSlotId) && !i.codec.IsSlotExpired(page, currentSlotId, now) {
+			return currentSlotId
+		}
 	}
-	return currentSlotId
+	return -1
 }
@@ -11,11 +11,11 @@ type LeafNodeReader struct {
 	codec codec.LeafNodeCodec
 }
 
-func NewLeafNodeReader(rg *bpm.ReadGuard) *LeafNodeReader {
+func NewLeafNodeReader(rg *bpm.ReadGuard, comparator codec.Comparator) *LeafNodeReader {
 
 	return &LeafNodeReader{
 		guard: rg,
-		codec: codec.NewLeafNodeCodec(),
+		codec: codec.NewLeafNodeCodecWithComparator(comparator),
 	}
 }
 
@@ -25,7 +25,43 @@ func (r *LeafNodeReader) FindValue(key []byte) (value []byte, found bool) {
 	return r.codec.FindValue(r.guard.GetPageData(), key)
 }
 
+// FindElement searches for and returns the element corresponding to key, including its expiry timestamp
+func (r *LeafNodeReader) FindElement(key []byte) (element codec.LeafNodeElement, found bool) {
+
+	return r.codec.FindElement(r.guard.GetPageData(), key)
+}
+
 func (w *LeafNodeReader) PrintElements() {
 
 	w.codec.PrintElements(w.guard.GetPageData())
 }
+
+// ContainsKey checks whether the key exists and has not expired in the leaf node, without copying the value corresponding to it
+func (r *LeafNodeReader) ContainsKey(key []byte, now uint64) bool {
+
+	return r.codec.ContainsKey(r.guard.GetPageData(), key, now)
+}
+
+// CountKeysInRange returns the number of unexpired keys in the leaf node that lie in the range [startKey, endKey)
+func (r *LeafNodeReader) CountKeysInRange(startKey []byte, endKey []byte, now uint64) (count int, endReached bool) {
+
+	return r.codec.CountKeysInRange(r.guard.GetPageData(), startKey, endKey, now)
+}
+
+// GetNextLeafNodePageId returns the page ID of the next leaf node in the leaf chain
+func (r *LeafNodeReader) GetNextLeafNodePageId() uint64 {
+
+	return r.codec.GetNextLeafNodePageId(r.guard.GetPageData())
+}
+
+// GetExpiredKeys returns the keys in the leaf node that have expired at the given unix timestamp (in nanoseconds)
+func (r *LeafNodeReader) GetExpiredKeys(now uint64) [][]byte {
+
+	return r.codec.GetExpiredKeys(r.guard.GetPageData(), now)
+}
+
+// GetElementsInRange returns the unexpired elements in the leaf node with keys in the range [startKey, endKey)
+func (r *LeafNodeReader) GetElementsInRange(startKey []byte, endKey []byte, now uint64) (elements []codec.LeafNodeElement, endReached bool) {
+
+	return r.codec.GetElementsInRange(r.guard.GetPageData(), startKey, endKey, now)
+}
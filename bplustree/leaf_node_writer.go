@@ -14,11 +14,11 @@ type LeafNodeWriter struct {
 	codec codec.LeafNodeCodec
 }
 
-func NewLeafNodeWriter(wg *bpm.WriteGuard) *LeafNodeWriter {
+func NewLeafNodeWriter(wg *bpm.WriteGuard, comparator codec.Comparator) *LeafNodeWriter {
 
 	return &LeafNodeWriter{
 		guard: wg,
-		codec: codec.NewLeafNodeCodec(),
+		codec: codec.NewLeafNodeCodecWithComparator(comparator),
 	}
 }
 
@@ -38,14 +38,18 @@ func (w *LeafNodeWriter) SetNodeType() {
 	w.codec.SetNodeType(w.guard.GetPageData())
 }
 
-// InsertKeyValue inserts a key value element in the B+ Tree leaf node
-func (w *LeafNodeWriter) InsertKeyValue(key []byte, value []byte) bool {
+// InsertKeyValue inserts a key value element in the B+ Tree leaf node.
+// expiresAt is the unix timestamp (in nanoseconds) after which the element expires, 0 if it should never expire.
+// compression is the algorithm the value was compressed with.
+func (w *LeafNodeWriter) InsertKeyValue(key []byte, value []byte, expiresAt uint64, compression codec.CompressionType) bool {
 
 	if !w.guard.IsActive() {
 		return false
 	}
+
+	w.guard.SetDirtyFlag()
 	slog.Info(fmt.Sprintf("inserting key %s value %s into page-id %d", string(key), string(value), w.GetPageId()))
-	return w.codec.InsertElement(w.guard.GetPageData(), key, value)
+	return w.codec.InsertElement(w.guard.GetPageData(), key, value, expiresAt, compression)
 }
 
 // FindValue searches for and returns value corresponding to key
@@ -58,6 +62,16 @@ func (w *LeafNodeWriter) FindValue(key []byte) (value []byte, found bool) {
 	return w.codec.FindValue(w.guard.GetPageData(), key)
 }
 
+// FindElement searches for and returns the element corresponding to key, including its expiry timestamp
+func (w *LeafNodeWriter) FindElement(key []byte) (element codec.LeafNodeElement, found bool) {
+
+	if !w.guard.IsActive() {
+		return codec.LeafNodeElement{}, false
+	}
+
+	return w.codec.FindElement(w.guard.GetPageData(), key)
+}
+
 // DeleteKeyValue deletes key value pair in the B+ tree leaf node
 func (w *LeafNodeWriter) DeleteKeyValue(key []byte) bool {
 
@@ -65,17 +79,19 @@ func (w *LeafNodeWriter) DeleteKeyValue(key []byte) bool {
 		return false
 	}
 
+	w.guard.SetDirtyFlag()
 	return w.codec.DeleteElement(w.guard.GetPageData(), key)
 }
 
-// SetValue sets a new value for an existing key in the B+ Tree leaf node
-func (w *LeafNodeWriter) SetValue(key []byte, value []byte) bool {
+// SetValue sets a new value, expiry timestamp and compression type for an existing key in the B+ Tree leaf node
+func (w *LeafNodeWriter) SetValue(key []byte, value []byte, expiresAt uint64, compression codec.CompressionType) bool {
 
 	if !w.guard.IsActive() {
 		return false
 	}
 
-	return w.codec.SetValue(w.guard.GetPageData(), key, value)
+	w.guard.SetDirtyFlag()
+	return w.codec.SetValue(w.guard.GetPageData(), key, value, expiresAt, compression)
 }
 
 // Split is used to split a B+ Tree leaf node
@@ -85,10 +101,55 @@ func (w *LeafNodeWriter) Split(rightLeafNodeWrite *LeafNodeWriter) (extraKey []b
 		return nil
 	}
 
+	w.guard.SetDirtyFlag()
+	rightLeafNodeWrite.guard.SetDirtyFlag()
 	slog.Info(fmt.Sprintf("splitting node %d", w.GetPageId()))
 	return w.codec.SplitNode(w.guard.GetPageData(), rightLeafNodeWrite.guard.GetPageData(), rightLeafNodeWrite.GetPageId())
 }
 
+// SetNextLeafNodePageId links the leaf node to the next leaf node in the leaf chain.
+func (w *LeafNodeWriter) SetNextLeafNodePageId(nextLeafNodePageId uint64) {
+
+	if !w.guard.IsActive() {
+		return
+	}
+
+	w.guard.SetDirtyFlag()
+	w.codec.SetNextLeafNodePageId(w.guard.GetPageData(), nextLeafNodePageId)
+}
+
+// Compact removes the garbage left in the leaf node by deleted and updated elements, and returns the number of bytes reclaimed.
+func (w *LeafNodeWriter) Compact() (reclaimedBytes int) {
+
+	if !w.guard.IsActive() {
+		return 0
+	}
+
+	reclaimedBytes = w.codec.Compact(w.guard.GetPageData())
+
+	if reclaimedBytes > 0 {
+		w.guard.SetDirtyFlag()
+	}
+
+	return reclaimedBytes
+}
+
+// MergeNodes moves the elements of the right leaf node into the leaf node, if it uses at most fillFactor of the page afterwards.
+// The right leaf node is left unchanged, the caller is responsible for deallocating it.
+func (w *LeafNodeWriter) MergeNodes(rightLeafNodeWriter *LeafNodeWriter, fillFactor float64) bool {
+
+	if !w.guard.IsActive() || !rightLeafNodeWriter.guard.IsActive() {
+		return false
+	}
+
+	if !w.codec.MergeNodes(w.guard.GetPageData(), rightLeafNodeWriter.guard.GetPageData(), fillFactor) {
+		return false
+	}
+
+	w.guard.SetDirtyFlag()
+	return true
+}
+
 func (w *LeafNodeWriter) PrintElements() {
 
 	w.codec.PrintElements(w.guard.GetPageData())
@@ -0,0 +1,377 @@
+package bplustree
+
+import (
+	"fmt"
+	"log/slog"
+
+	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+)
+
+// relocation tracks a pass over the B+ tree moving nodes stored at or after a page ID limit into deallocated pages before it.
+type relocation struct {
+	limit    uint64
+	maxPages int
+
+	relocatedPages int
+
+	// set once a node at or after the limit is found that can't be moved in this pass, because maxPages nodes have been moved,
+	// or no deallocated page is left before the limit.
+	stopped bool
+
+	// depth of the leaf nodes, 0 if the root node is a leaf node.
+	leafNodeLevel int
+
+	// page ID of the last leaf node visited, which links to the next leaf node visited in the leaf chain.
+	prevLeafNodePageId uint64
+
+	// the last child at or after the limit of the last internal node visited at every depth, by the depth of the child.
+	pendingChildNodes map[int]*pendingChildNode
+}
+
+// pendingChildNode is the last child of an internal node, stored at or after the limit. Moving it is deferred until the next internal node
+// at the same depth as its parent is visited, since a split may have left a copy of it as the first child of that node, which must point to the moved node too.
+type pendingChildNode struct {
+	parentPageId uint64
+	pageId       uint64
+	isLeafNode   bool
+
+	// page ID of the leaf node before it in the leaf chain, 0 if it is the first leaf node.
+	prevLeafNodePageId uint64
+}
+
+// RelocatePages moves up to maxPages nodes stored in pages with IDs >= limit into deallocated pages with IDs < limit,
+// updating the parent of every moved node, the leaf chain, and the root and first leaf node page IDs.
+// The B+ tree is locked for the duration of the call, so maxPages bounds how long other operations wait for it.
+// It returns done = true once no node is left at or after the limit.
+func (bptree *BPlusTree) RelocatePages(limit uint64, maxPages int) (relocatedPages int, done bool, err error) {
+
+	bptree.bPlusTreeMutex.Lock()
+	defer bptree.bPlusTreeMutex.Unlock()
+
+	fmt.Println()
+	slog.Info("Relocating pages...", "BPlusTreeId", bptree.BPlusTreeId, "limit", limit, "maxPages", maxPages, "function", "RelocatePages", "at", "btree")
+
+	if bptree.rootNodePageId == 0 {
+		return 0, true, nil
+	}
+
+	leafNodeLevel, err := bptree.findLeafNodeLevel()
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	r := &relocation{
+		limit:             limit,
+		maxPages:          maxPages,
+		leafNodeLevel:     leafNodeLevel,
+		pendingChildNodes: make(map[int]*pendingChildNode),
+	}
+
+	rootNodePageId := bptree.rootNodePageId
+
+	if rootNodePageId >= limit {
+
+		newPageId, moved, err := bptree.relocatePage(rootNodePageId, r)
+
+		if err != nil {
+			return r.relocatedPages, false, err
+		}
+
+		if moved {
+
+			bptree.rootNodePageId = newPageId
+
+			if leafNodeLevel == 0 {
+				bptree.firstLeafNodePageId = newPageId
+			}
+
+			rootNodePageId = newPageId
+		}
+	}
+
+	if leafNodeLevel > 0 && !r.stopped {
+		err = bptree.relocateChildNodes(rootNodePageId, nil, 0, r)
+	}
+
+	// the last nodes at every depth have no internal node after their parent. Deeper nodes are moved first, while their parent is still in place.
+	for level := leafNodeLevel; level > 0 && err == nil && !r.stopped; level-- {
+
+		if pending, exists := r.pendingChildNodes[level]; exists {
+			err = bptree.relocatePendingChildNode(pending, []uint64{pending.parentPageId}, r)
+		}
+	}
+
+	slog.Info("Relocated pages", "BPlusTreeId", bptree.BPlusTreeId, "relocatedPages", r.relocatedPages, "done", !r.stopped, "function", "RelocatePages", "at", "btree")
+
+	return r.relocatedPages, !r.stopped && err == nil, err
+}
+
+// findLeafNodeLevel returns the depth of the leaf nodes, found by following the first child of every internal node from the root node.
+// All leaf nodes are at the same depth, since the B+ tree only grows by splitting the root node.
+func (bptree *BPlusTree) findLeafNodeLevel() (int, error) {
+
+	level := 0
+	pageId := bptree.rootNodePageId
+
+	for {
+
+		guard, err := bptree.bufferPoolManager.NewReadGuard(pageId)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if NewReadCursor(guard).IsLeafNode() {
+			guard.Done()
+			return level, nil
+		}
+
+		childNodePageIds, _ := NewInternalNodeReader(guard, bptree.comparator).GetChildNodePageIds()
+		pageId = childNodePageIds[0]
+		guard.Done()
+
+		level++
+	}
+}
+
+// relocateChildNodes visits the children of an internal node at the given depth in key order, moving children stored at or after the limit.
+// lowerKey is the smallest key that can be found under the internal node, nil if it is the first node at its depth.
+// Only internal nodes are read, the leaf nodes are only locked if they are moved, or the leaf node before them is moved.
+// Guards aren't held while visiting the children, so the number of pinned pages doesn't grow with the height of the B+ tree.
+func (bptree *BPlusTree) relocateChildNodes(pageId uint64, lowerKey []byte, level int, r *relocation) error {
+
+	guard, err := bptree.bufferPoolManager.NewReadGuard(pageId)
+
+	if err != nil {
+		return err
+	}
+
+	childNodePageIds, keys := NewInternalNodeReader(guard, bptree.comparator).GetChildNodePageIds()
+	guard.Done()
+
+	isLeafNode := level+1 == r.leafNodeLevel
+
+	for i, childNodePageId := range childNodePageIds {
+
+		// a split leaves the key it moves up to the parent as the first key of the new internal node, so the first child of the new node
+		// is also the last child of the node it was split from. No key can be found through the copy, so it is only visited to point it to the moved node.
+		isCopy := i == 0 && lowerKey != nil && bptree.comparator.Compare(keys[0], lowerKey) <= 0
+
+		if pending, exists := r.pendingChildNodes[level+1]; exists && i == 0 {
+
+			delete(r.pendingChildNodes, level+1)
+
+			parentPageIds := []uint64{pending.parentPageId}
+
+			if isCopy && childNodePageId == pending.pageId {
+				parentPageIds = append(parentPageIds, pageId)
+			}
+
+			if err := bptree.relocatePendingChildNode(pending, parentPageIds, r); err != nil {
+				return err
+			}
+
+			if r.stopped {
+				return nil
+			}
+		}
+
+		if isCopy {
+			continue
+		}
+
+		if childNodePageId >= r.limit {
+
+			// the last child is moved once it is known whether the next internal node holds a copy of it. Its children are visited in the meantime.
+			if i == len(childNodePageIds)-1 {
+
+				r.pendingChildNodes[level+1] = &pendingChildNode{
+					parentPageId:       pageId,
+					pageId:             childNodePageId,
+					isLeafNode:         isLeafNode,
+					prevLeafNodePageId: r.prevLeafNodePageId,
+				}
+
+			} else {
+
+				newPageId, moved, err := bptree.relocateChildNode([]uint64{pageId}, childNodePageId, isLeafNode, r.prevLeafNodePageId, r)
+
+				if err != nil {
+					return err
+				}
+
+				if moved {
+					childNodePageId = newPageId
+				}
+			}
+		}
+
+		if r.stopped {
+			return nil
+		}
+
+		if isLeafNode {
+			r.prevLeafNodePageId = childNodePageId
+			continue
+		}
+
+		childLowerKey := lowerKey
+
+		if i > 0 {
+			childLowerKey = keys[i-1]
+		}
+
+		if err := bptree.relocateChildNodes(childNodePageId, childLowerKey, level+1, r); err != nil {
+			return err
+		}
+
+		if r.stopped {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// relocatePage copies a node into the lowest deallocated page before the limit, and deallocates the page it was stored in.
+// It returns moved = false, and stops the relocation, if the node can't be moved.
+func (bptree *BPlusTree) relocatePage(pageId uint64, r *relocation) (newPageId uint64, moved bool, err error) {
+
+	if r.relocatedPages >= r.maxPages {
+		r.stopped = true
+		return 0, false, nil
+	}
+
+	newPageId, found := bptree.bufferPoolManager.NewPageBelow(r.limit)
+
+	if !found {
+		r.stopped = true
+		return 0, false, nil
+	}
+
+	newPageGuard, err := bptree.bufferPoolManager.NewWriteGuard(newPageId)
+
+	if err != nil {
+		bptree.bufferPoolManager.CleanupPage(newPageId)
+		return 0, false, err
+	}
+
+	oldPageGuard, err := bptree.bufferPoolManager.NewWriteGuard(pageId)
+
+	if err != nil {
+		newPageGuard.DeletePage()
+		return 0, false, err
+	}
+
+	copy(newPageGuard.GetPageData(), oldPageGuard.GetPageData())
+	newPageGuard.SetDirtyFlag()
+
+	// the old page can't be deallocated while it is pinned by a reader, such as an iterator, so the node stays where it is.
+	if !oldPageGuard.DeletePage() {
+
+		slog.Warn("Page is in use, leaving it in place", "pageId", pageId, "function", "relocatePage", "at", "btree")
+
+		oldPageGuard.Done()
+		newPageGuard.DeletePage()
+
+		r.stopped = true
+		return 0, false, nil
+	}
+
+	newPageGuard.Done()
+
+	slog.Info("Relocated page", "BPlusTreeId", bptree.BPlusTreeId, "oldPageId", pageId, "newPageId", newPageId, "function", "relocatePage", "at", "btree")
+
+	r.relocatedPages++
+
+	return newPageId, true, nil
+}
+
+// relocatePendingChildNode moves a deferred last child of an internal node, pointing every parent in parentPageIds to the page it was moved to.
+func (bptree *BPlusTree) relocatePendingChildNode(pending *pendingChildNode, parentPageIds []uint64, r *relocation) error {
+
+	newPageId, moved, err := bptree.relocateChildNode(parentPageIds, pending.pageId, pending.isLeafNode, pending.prevLeafNodePageId, r)
+
+	if err != nil || !moved {
+		return err
+	}
+
+	if pending.isLeafNode && r.prevLeafNodePageId == pending.pageId {
+		r.prevLeafNodePageId = newPageId
+	}
+
+	// deferred children of the moved node still refer to its old page.
+	for _, child := range r.pendingChildNodes {
+
+		if child.parentPageId == pending.pageId {
+			child.parentPageId = newPageId
+		}
+	}
+
+	return nil
+}
+
+// relocateChildNode moves a child node of internal nodes, and points the internal nodes, and the leaf node before it if it is a leaf node,
+// to the page it was moved to. Their guards are acquired before the child node is moved, so it is never deallocated while still referenced.
+// An internal node split leaves a copy of the child in a second parent, both parents must be given.
+func (bptree *BPlusTree) relocateChildNode(parentPageIds []uint64, pageId uint64, isLeafNode bool, prevLeafNodePageId uint64, r *relocation) (newPageId uint64, moved bool, err error) {
+
+	if r.relocatedPages >= r.maxPages {
+		r.stopped = true
+		return 0, false, nil
+	}
+
+	parentGuards := make([]*bpm.WriteGuard, 0, len(parentPageIds))
+
+	defer func() {
+		for _, parentGuard := range parentGuards {
+			parentGuard.Done()
+		}
+	}()
+
+	for _, parentPageId := range parentPageIds {
+
+		parentGuard, err := bptree.bufferPoolManager.NewWriteGuard(parentPageId)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		parentGuards = append(parentGuards, parentGuard)
+	}
+
+	var prevLeafNodeGuard *bpm.WriteGuard
+
+	if isLeafNode && prevLeafNodePageId != 0 {
+
+		prevLeafNodeGuard, err = bptree.bufferPoolManager.NewWriteGuard(prevLeafNodePageId)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		defer prevLeafNodeGuard.Done()
+	}
+
+	newPageId, moved, err = bptree.relocatePage(pageId, r)
+
+	if err != nil || !moved {
+		return 0, false, err
+	}
+
+	for _, parentGuard := range parentGuards {
+		NewInternalNodeWriter(parentGuard, bptree.comparator).ReplaceChildNodePageId(pageId, newPageId)
+	}
+
+	if isLeafNode {
+
+		if prevLeafNodeGuard != nil {
+			NewLeafNodeWriter(prevLeafNodeGuard, bptree.comparator).SetNextLeafNodePageId(newPageId)
+		} else {
+			bptree.firstLeafNodePageId = newPageId
+		}
+	}
+
+	return newPageId, true, nil
+}
@@ -0,0 +1,129 @@
+package bplustree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// assertChildNodesBefore checks that every child page ID stored in the internal nodes under a node is before the limit,
+// including the first child of an internal node that is a copy of the last child of the internal node before it.
+func (ts *BPlusTreeTestSuite) assertChildNodesBefore(pageId uint64, limit uint64, visited map[uint64]bool) {
+
+	if visited[pageId] {
+		return
+	}
+	visited[pageId] = true
+
+	guard, err := ts.btree.bufferPoolManager.NewReadGuard(pageId)
+	ts.Require().NoError(err)
+
+	if NewReadCursor(guard).IsLeafNode() {
+		guard.Done()
+		return
+	}
+
+	childNodePageIds, _ := NewInternalNodeReader(guard, ts.btree.comparator).GetChildNodePageIds()
+	guard.Done()
+
+	for _, childNodePageId := range childNodePageIds {
+
+		ts.Require().Less(childNodePageId, limit, "internal node %d points to page %d", pageId, childNodePageId)
+		ts.assertChildNodesBefore(childNodePageId, limit, visited)
+	}
+}
+
+func (ts *BPlusTreeTestSuite) TestRelocatePages() {
+
+	bufferPoolManager := ts.btree.bufferPoolManager
+
+	// pages allocated before the B+ tree, and deallocated once it is built, leave free space at the start of the file.
+	freePageIds := make([]uint64, 0)
+
+	for range 60 {
+
+		pageId, err := bufferPoolManager.NewPage()
+		ts.Require().NoError(err)
+		freePageIds = append(freePageIds, pageId)
+	}
+
+	// keys with a long common prefix make long separator keys, which keep the number of children of internal nodes low,
+	// so the B+ tree has internal nodes below the root node.
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%s_%05d", strings.Repeat("k", 200), i))
+	}
+
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("value_%05d_%s", i, strings.Repeat("v", 200)))
+	}
+
+	for i := range 600 {
+		ts.Require().NoError(ts.btree.Insert(key(i), value(i)))
+	}
+
+	leafNodeLevel, err := ts.btree.findLeafNodeLevel()
+	ts.Require().NoError(err)
+	ts.Require().GreaterOrEqual(leafNodeLevel, 2)
+
+	for _, pageId := range freePageIds {
+		bufferPoolManager.CleanupPage(pageId)
+	}
+
+	maxAllocatedPageId, deallocatedPages := bufferPoolManager.AllocatedPages()
+	limit := maxAllocatedPageId - uint64(deallocatedPages) + 1
+
+	batches := 0
+	relocatedPages := 0
+
+	for {
+
+		relocated, done, err := ts.btree.RelocatePages(limit, 8)
+		ts.Require().NoError(err)
+		ts.Require().LessOrEqual(relocated, 8)
+
+		batches++
+		relocatedPages += relocated
+
+		if done {
+			break
+		}
+
+		ts.Require().NotZero(relocated)
+	}
+
+	// pages at or after the limit left unused in the extents of the B+ tree don't need to be moved.
+	ts.Assert().Greater(batches, 1)
+	ts.Assert().LessOrEqual(relocatedPages, int(maxAllocatedPageId-limit+1))
+
+	ts.Assert().Less(ts.btree.rootNodePageId, limit)
+	ts.Assert().Less(ts.btree.firstLeafNodePageId, limit)
+
+	ts.assertChildNodesBefore(ts.btree.rootNodePageId, limit, make(map[uint64]bool))
+
+	// every page at or after the limit is now deallocated.
+	releasedPages, err := bufferPoolManager.Shrink()
+	ts.Require().NoError(err)
+	ts.Assert().Equal(int(maxAllocatedPageId-limit+1), releasedPages)
+
+	maxAllocatedPageId, deallocatedPages = bufferPoolManager.AllocatedPages()
+	ts.Assert().Equal(limit-1, maxAllocatedPageId)
+	ts.Assert().Zero(deallocatedPages)
+
+	for i := range 600 {
+
+		storedValue, err := ts.btree.Get(key(i))
+		ts.Require().NoError(err)
+		ts.Assert().Equal(value(i), storedValue)
+	}
+
+	// the leaf chain is intact.
+	count, err := ts.btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(600), count)
+
+	// the B+ tree can still grow after its pages are moved.
+	ts.Require().NoError(ts.btree.Insert(key(600), value(600)))
+
+	count, err = ts.btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(601), count)
+}
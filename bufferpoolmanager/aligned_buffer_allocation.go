@@ -2,9 +2,12 @@ package bufferpoolmanager
 
 import "unsafe"
 
+// Direct I/O buffers are aligned to 4096 bytes, the largest logical block size of the disks in use. Every page size is a multiple of it.
+const BUFFER_ALIGNMENT = 4096
+
 // returns offset in page where starting address of buffer begins.
 func findOffset(buffer []byte) uintptr {
-	return uintptr(unsafe.Pointer(&buffer[0])) % uintptr(4096)
+	return uintptr(unsafe.Pointer(&buffer[0])) % uintptr(BUFFER_ALIGNMENT)
 }
 
 func isAligned(buffer []byte) bool {
@@ -12,20 +15,21 @@ func isAligned(buffer []byte) bool {
 	return (findOffset(buffer) == 0)
 }
 
-func AllocateAlignedBuffer() []byte {
+// AllocateAlignedBuffer returns a buffer of the given size, starting at an address aligned to BUFFER_ALIGNMENT.
+func AllocateAlignedBuffer(size int) []byte {
 
-	buffer := make([]byte, (8192))
+	buffer := make([]byte, size+BUFFER_ALIGNMENT)
 
 	if isAligned(buffer) {
-		return buffer[:4096]
+		return buffer[:size]
 	}
 
 	// distance from previous aligned address just smaller than the starting address of buffer.
 	offset := findOffset(buffer)
 
 	// distance to next page aligned address just greater than starting address of buffer.
-	distance := 4096 - offset
+	distance := BUFFER_ALIGNMENT - offset
 
-	return buffer[distance : distance+4096]
+	return buffer[distance : distance+uintptr(size)]
 
 }
@@ -0,0 +1,267 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BackgroundWriterConfig controls how eagerly the background writer flushes dirty pages.
+// The dirty ratio is the fraction of frames in the buffer pool holding dirty pages.
+type BackgroundWriterConfig struct {
+
+	// time between flush rounds.
+	Interval time.Duration
+
+	// dirty pages are flushed once the dirty ratio exceeds LowDirtyRatio, until it drops back to LowDirtyRatio.
+	LowDirtyRatio float64
+
+	// above HighDirtyRatio, rounds are not limited to MaxPagesPerRound, and run back to back until the dirty ratio drops below it.
+	HighDirtyRatio float64
+
+	// maximum number of pages flushed in a round while the dirty ratio is between LowDirtyRatio and HighDirtyRatio.
+	MaxPagesPerRound int
+}
+
+func DefaultBackgroundWriterConfig() BackgroundWriterConfig {
+
+	return BackgroundWriterConfig{
+		Interval:         200 * time.Millisecond,
+		LowDirtyRatio:    0.1,
+		HighDirtyRatio:   0.5,
+		MaxPagesPerRound: 16,
+	}
+}
+
+// backgroundWriter is the state of the goroutine started by StartBackgroundWriter.
+type backgroundWriter struct {
+	config BackgroundWriterConfig
+
+	// closed to signal the goroutine to exit.
+	shutdown  chan struct{}
+	waitGroup *sync.WaitGroup
+}
+
+// StartBackgroundWriter starts a goroutine that periodically writes dirty unpinned pages to disk,
+// so pages are usually clean by the time they are evicted, and Close has fewer pages to write.
+func (bufferPool *SimpleBufferPoolManager) StartBackgroundWriter(config BackgroundWriterConfig) error {
+
+	if config.Interval <= 0 || config.MaxPagesPerRound <= 0 {
+		return fmt.Errorf("background writer interval and pages per round must be positive")
+	}
+
+	if config.LowDirtyRatio < 0 || config.LowDirtyRatio > config.HighDirtyRatio || config.HighDirtyRatio > 1 {
+		return fmt.Errorf("background writer dirty ratios must satisfy 0 <= low <= high <= 1")
+	}
+
+	bufferPool.backgroundWriterMutex.Lock()
+	defer bufferPool.backgroundWriterMutex.Unlock()
+
+	if bufferPool.backgroundWriter != nil {
+		return fmt.Errorf("background writer is already running")
+	}
+
+	writer := &backgroundWriter{
+		config:    config,
+		shutdown:  make(chan struct{}),
+		waitGroup: &sync.WaitGroup{},
+	}
+
+	bufferPool.backgroundWriter = writer
+
+	writer.waitGroup.Add(1)
+
+	go func() {
+
+		defer writer.waitGroup.Done()
+
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+
+			case <-writer.shutdown:
+				return
+
+			case <-ticker.C:
+
+				// keep flushing without waiting for the next tick while the dirty ratio stays above the high threshold
+				for bufferPool.runBackgroundWriterRound(config) {
+
+					select {
+					case <-writer.shutdown:
+						return
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	slog.Info("Started background writer", "interval", config.Interval, "lowDirtyRatio", config.LowDirtyRatio, "highDirtyRatio", config.HighDirtyRatio, "function", "StartBackgroundWriter", "at", "buffer Pool Manager")
+
+	return nil
+}
+
+// stopBackgroundWriter stops the background writer goroutine, if it is running, and waits for it to exit.
+func (bufferPool *SimpleBufferPoolManager) stopBackgroundWriter() {
+
+	bufferPool.backgroundWriterMutex.Lock()
+	writer := bufferPool.backgroundWriter
+	bufferPool.backgroundWriter = nil
+	bufferPool.backgroundWriterMutex.Unlock()
+
+	if writer == nil {
+		return
+	}
+
+	close(writer.shutdown)
+	writer.waitGroup.Wait()
+}
+
+// runBackgroundWriterRound flushes dirty unpinned pages until the dirty ratio drops to the low threshold,
+// or MaxPagesPerRound pages are flushed while the dirty ratio is below the high threshold.
+// It returns true if the dirty ratio is still above the high threshold, and another round should run right away.
+func (bufferPool *SimpleBufferPoolManager) runBackgroundWriterRound(config BackgroundWriterConfig) bool {
+
+	numDirtyPages, candidatePageIds := bufferPool.findDirtyPages()
+
+	poolSize := bufferPool.getPoolSize()
+
+	dirtyRatio := float64(numDirtyPages) / float64(poolSize)
+
+	if dirtyRatio <= config.LowDirtyRatio {
+		return false
+	}
+
+	aboveHighDirtyRatio := dirtyRatio > config.HighDirtyRatio
+
+	pagesToFlush := numDirtyPages - int(config.LowDirtyRatio*float64(poolSize))
+
+	if !aboveHighDirtyRatio {
+		pagesToFlush = min(pagesToFlush, config.MaxPagesPerRound)
+	}
+
+	flushedPages := 0
+
+	for _, pageId := range candidatePageIds {
+
+		if flushedPages == pagesToFlush {
+			break
+		}
+
+		flushed, err := bufferPool.flushUnpinnedPage(pageId)
+
+		if err != nil {
+			slog.Error("Background writer failed to flush page", "pageId", pageId, "error", err.Error(), "function", "runBackgroundWriterRound", "at", "buffer Pool Manager")
+			return false
+		}
+
+		if flushed {
+			flushedPages++
+		}
+	}
+
+	slog.Info("Background writer flushed pages", "dirtyRatio", dirtyRatio, "flushedPages", flushedPages, "function", "runBackgroundWriterRound", "at", "buffer Pool Manager")
+
+	remainingDirtyRatio := float64(numDirtyPages-flushedPages) / float64(poolSize)
+
+	// if nothing could be flushed, every dirty page is pinned, so wait for the next tick instead of spinning.
+	return flushedPages > 0 && remainingDirtyRatio > config.HighDirtyRatio
+}
+
+// findDirtyPages returns the number of dirty pages in the buffer pool, and the IDs of the dirty pages that are currently unpinned.
+// Pages locked by a write guard are counted as dirty, since they are about to be modified.
+func (bufferPool *SimpleBufferPoolManager) findDirtyPages() (numDirtyPages int, unpinnedPageIds []uint64) {
+
+	unpinnedPageIds = make([]uint64, 0)
+
+	for _, shard := range bufferPool.shards {
+
+		shard.lookupMutex.RLock()
+
+		for pageId, frameId := range shard.pageTable {
+
+			frame := shard.frames[frameId]
+
+			// waiting for the page lock while holding the lookup mutex could deadlock with a guard being released.
+			if !frame.mutex.TryRLock() {
+				numDirtyPages++
+				continue
+			}
+
+			if frame.dirty {
+
+				numDirtyPages++
+
+				frame.pinCountMutex.Lock()
+				if frame.pinCount == 0 {
+					unpinnedPageIds = append(unpinnedPageIds, pageId)
+				}
+				frame.pinCountMutex.Unlock()
+			}
+
+			frame.mutex.RUnlock()
+		}
+
+		shard.lookupMutex.RUnlock()
+	}
+
+	return numDirtyPages, unpinnedPageIds
+}
+
+// flushUnpinnedPage writes a page to disk and marks it clean, if it is still in the buffer pool, dirty and unpinned.
+// The lookup mutex is released while the page is written, so fetches of other pages in the shard aren't blocked by the write.
+func (bufferPool *SimpleBufferPoolManager) flushUnpinnedPage(pageId uint64) (bool, error) {
+
+	shard := bufferPool.getShard(pageId)
+
+	shard.lookupMutex.RLock()
+
+	frameId, exists := shard.pageTable[pageId]
+
+	if !exists {
+		shard.lookupMutex.RUnlock()
+		return false, nil
+	}
+
+	frame := shard.frames[frameId]
+
+	// the page is unpinned, so the exclusive page lock is normally free. Holding it prevents the page from being modified while it is written,
+	// and a load evicting the page from the frame waits for it before the frame is reused.
+	if !frame.mutex.TryLock() {
+		shard.lookupMutex.RUnlock()
+		return false, nil
+	}
+	defer frame.mutex.Unlock()
+
+	frame.pinCountMutex.Lock()
+	pinned := frame.pinCount > 0
+	frame.pinCountMutex.Unlock()
+
+	// a frame being loaded is pinned or clean, its evicted page is written back by the load.
+	if pinned || !frame.dirty || frame.inFlight != nil {
+		shard.lookupMutex.RUnlock()
+		return false, nil
+	}
+
+	shard.lookupMutex.RUnlock()
+
+	if err := bufferPool.disk.write(int64(pageId)*int64(bufferPool.pageSize), frame.data); err != nil {
+		return false, err
+	}
+
+	bufferPool.counters.dirtyWrites.Add(1)
+
+	shard.lookupMutex.RLock()
+	defer shard.lookupMutex.RUnlock()
+
+	// the page may have been evicted while it was written. The load reusing the frame wrote it back again, and reset the dirty flag for the loaded page.
+	if frame.pageId == pageId && frame.inFlight == nil {
+		frame.dirty = false
+	}
+
+	return true, nil
+}
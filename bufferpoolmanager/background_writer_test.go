@@ -0,0 +1,160 @@
+package bufferpoolmanager
+
+import (
+	"time"
+)
+
+// dirtyPage overwrites a page using a write guard, and marks it dirty.
+func (bs *BufferPoolManagerTestSuite) dirtyPage(pageId uint64, start int) {
+
+	guard, err := bs.bufferPool.NewWriteGuard(pageId)
+	bs.Require().NoError(err)
+
+	copy(guard.GetPageData(), createPage(start))
+	guard.SetDirtyFlag()
+	guard.Done()
+}
+
+// assertPageOnDisk checks the contents of a page on disk, bypassing the buffer pool.
+func (bs *BufferPoolManagerTestSuite) assertPageOnDisk(pageId uint64, start int) {
+
+	data, err := bs.disk.read(int64(pageId)*PAGE_SIZE, PAGE_SIZE)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(true, checkPage(start, data))
+}
+
+func (bs *BufferPoolManagerTestSuite) TestBackgroundWriterRound() {
+
+	config := BackgroundWriterConfig{
+		Interval:         time.Second,
+		LowDirtyRatio:    0.4,
+		HighDirtyRatio:   1,
+		MaxPagesPerRound: 1,
+	}
+
+	bs.dirtyPage(0, 100)
+
+	// 1 out of 3 frames is dirty, which is below the low dirty ratio
+	bs.Assert().Equal(false, bs.bufferPool.runBackgroundWriterRound(config))
+	bs.assertPageOnDisk(0, 0)
+
+	bs.dirtyPage(1, 101)
+
+	// page 2 is dirty, but pinned
+	bs.dirtyPage(2, 102)
+	_, err := bs.bufferPool.fetchPage(2)
+	bs.Require().NoError(err)
+
+	// the dirty ratio is between the thresholds, so only MaxPagesPerRound pages are flushed
+	bs.Assert().Equal(false, bs.bufferPool.runBackgroundWriterRound(config))
+
+	numDirtyPages, _ := bs.bufferPool.findDirtyPages()
+	bs.Assert().Equal(2, numDirtyPages)
+
+	// flushing one more page brings the dirty ratio down to the low threshold
+	bs.bufferPool.runBackgroundWriterRound(config)
+
+	numDirtyPages, unpinnedPageIds := bs.bufferPool.findDirtyPages()
+	bs.Assert().Equal(1, numDirtyPages)
+	bs.Assert().Empty(unpinnedPageIds)
+
+	bs.assertPageOnDisk(0, 100)
+	bs.assertPageOnDisk(1, 101)
+	bs.assertPageOnDisk(2, 2)
+}
+
+func (bs *BufferPoolManagerTestSuite) TestBackgroundWriter() {
+
+	err := bs.bufferPool.StartBackgroundWriter(BackgroundWriterConfig{
+		Interval:         10 * time.Millisecond,
+		LowDirtyRatio:    0,
+		HighDirtyRatio:   0.5,
+		MaxPagesPerRound: 1,
+	})
+	bs.Require().NoError(err)
+
+	bs.Assert().Error(bs.bufferPool.StartBackgroundWriter(DefaultBackgroundWriterConfig()))
+
+	for pageId := range 3 {
+		bs.dirtyPage(uint64(pageId), 100+pageId)
+	}
+
+	bs.Assert().Eventually(func() bool {
+		numDirtyPages, _ := bs.bufferPool.findDirtyPages()
+		return numDirtyPages == 0
+	}, time.Second, 10*time.Millisecond)
+
+	bs.bufferPool.stopBackgroundWriter()
+
+	for pageId := range 3 {
+		bs.assertPageOnDisk(uint64(pageId), 100+pageId)
+	}
+}
+
+// blockingDiskManager blocks writes of a page until release is closed, signalling started when a write of the page begins.
+type blockingDiskManager struct {
+	DiskManager
+	pageId  uint64
+	started chan struct{}
+	release chan struct{}
+}
+
+func (disk *blockingDiskManager) write(offset int64, data []byte) error {
+
+	if offset == int64(disk.pageId)*PAGE_SIZE {
+		close(disk.started)
+		<-disk.release
+	}
+
+	return disk.DiskManager.write(offset, data)
+}
+
+func (bs *BufferPoolManagerTestSuite) TestBackgroundWriterDoesNotBlockFetches() {
+
+	disk := &blockingDiskManager{
+		DiskManager: bs.disk,
+		pageId:      0,
+		started:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, PAGE_SIZE, NewLRUReplacer(), disk)
+	bs.Require().NoError(err)
+
+	bs.bufferPool = bufferPool
+	bs.dirtyPage(0, 100)
+
+	flushed := make(chan bool)
+
+	go func() {
+		ok, err := bufferPool.flushUnpinnedPage(0)
+		bs.Assert().NoError(err)
+		flushed <- ok
+	}()
+
+	<-disk.started
+
+	// loading another page of the shard needs the lookup mutex exclusively, which the write of page 0 must not hold.
+	fetched := make(chan struct{})
+
+	go func() {
+		guard, err := bufferPool.NewReadGuard(1)
+		bs.Assert().NoError(err)
+		guard.Done()
+		close(fetched)
+	}()
+
+	select {
+	case <-fetched:
+	case <-time.After(time.Second):
+		bs.Fail("fetch waited for the background write of another page")
+	}
+
+	close(disk.release)
+
+	bs.Assert().True(<-flushed)
+	bs.assertPageOnDisk(0, 100)
+
+	numDirtyPages, _ := bufferPool.findDirtyPages()
+	bs.Assert().Equal(0, numDirtyPages)
+}
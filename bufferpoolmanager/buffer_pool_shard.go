@@ -0,0 +1,282 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// default number of shards used by NewShardedBufferPoolManager callers that don't need a specific number.
+const DEFAULT_NUM_SHARDS = 16
+
+// bufferPoolShard is a partition of the buffer pool. Every page ID is mapped to a single shard,
+// which stores the page in one of its own frames, so fetches of pages in different shards never contend on the same locks.
+// Frame IDs are local to the shard.
+type bufferPoolShard struct {
+
+	// synchronizes access to the page table, and to the page ID, pin count and in-flight marker of the shard's frames
+	// whenever a frame is assigned to a page. It is never held across disk I/O.
+	lookupMutex *sync.RWMutex
+
+	// pageTable is used to map page IDs to frame IDs.
+	// While a frame is being loaded, the page being read and the page being evicted from the frame (if any) both map to the frame.
+	pageTable map[uint64]FrameID
+
+	// fixed size array of frames owned by the shard.
+	frames []*Frame
+
+	// used to keep track of empty frames.
+	freeFrames []FrameID
+
+	// used to synchronize access to the list of free frames.
+	frameAllocationMutex *sync.Mutex
+
+	// selects the frame to evict when the shard has no free frames.
+	replacer Replacer
+
+	// closed when a frame of the shard is unpinned or freed, to wake up fetches waiting for a frame. It is created by the first waiting fetch.
+	frameReleasedMutex *sync.Mutex
+	frameReleased      chan struct{}
+}
+
+func newBufferPoolShard(numFrames int, pageSize int, replacer Replacer) (*bufferPoolShard, error) {
+
+	frames := make([]*Frame, numFrames)
+	freeFrames := make([]FrameID, 0, numFrames)
+
+	for i := range frames {
+
+		frame, err := newFrame(pageSize)
+
+		if err != nil {
+			return nil, err
+		}
+		frames[i] = frame
+
+		freeFrames = append(freeFrames, FrameID(i))
+	}
+
+	return &bufferPoolShard{
+		lookupMutex:          &sync.RWMutex{},
+		pageTable:            make(map[uint64]FrameID),
+		frames:               frames,
+		freeFrames:           freeFrames,
+		frameAllocationMutex: &sync.Mutex{},
+		replacer:             replacer,
+		frameReleasedMutex:   &sync.Mutex{},
+	}, nil
+}
+
+// newFrame creates an empty frame, whose buffer is locked in memory.
+func newFrame(pageSize int) (*Frame, error) {
+
+	buf, err := createFrameBuffer(pageSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frame{
+		mutex:         &sync.RWMutex{},
+		pinCountMutex: &sync.Mutex{},
+		data:          buf,
+	}, nil
+}
+
+// pin increments the pin count of a frame, removing it from the replacer if it was unpinned.
+// The lookup mutex must be held, in shared or exclusive mode.
+func (shard *bufferPoolShard) pin(frameId FrameID) *Frame {
+
+	frame := shard.frames[frameId]
+
+	frame.pinCountMutex.Lock()
+	defer frame.pinCountMutex.Unlock()
+
+	frame.pinCount++
+
+	if frame.pinCount == 1 {
+		shard.replacer.remove(frameId)
+	}
+
+	return frame
+}
+
+// acquireFrame returns a free frame, or a victim frame chosen by the replacer. evicted is true if the frame holds a page that must be evicted.
+// It returns false if every frame of the shard is pinned. The lookup mutex must be held exclusively.
+func (shard *bufferPoolShard) acquireFrame() (frameId FrameID, evicted bool, found bool) {
+
+	shard.frameAllocationMutex.Lock()
+	defer shard.frameAllocationMutex.Unlock()
+
+	if len(shard.freeFrames) > 0 {
+
+		frameId = shard.freeFrames[0]
+
+		slog.Info(fmt.Sprintf("free frame chosen => %d", frameId), "function", "acquireFrame", "at", "buffer Pool Manager")
+
+		shard.freeFrames = shard.freeFrames[1:]
+
+		slog.Info(fmt.Sprintf("free frame list => %v", shard.freeFrames), "function", "acquireFrame", "at", "buffer Pool Manager")
+
+		return frameId, false, true
+	}
+
+	frameId, found = shard.replacer.victim()
+
+	return frameId, found, found
+}
+
+// releaseFrame returns a frame that no longer holds a valid page to the free frame list.
+// The lookup mutex must be held exclusively.
+func (shard *bufferPoolShard) releaseFrame(frameId FrameID) {
+
+	shard.frameAllocationMutex.Lock()
+	shard.freeFrames = append(shard.freeFrames, frameId)
+	shard.frameAllocationMutex.Unlock()
+
+	shard.replacer.forget(frameId)
+	shard.signalFrameReleased()
+}
+
+// getFrameReleasedChannel returns the channel closed when the next frame of the shard is released.
+func (shard *bufferPoolShard) getFrameReleasedChannel() <-chan struct{} {
+
+	shard.frameReleasedMutex.Lock()
+	defer shard.frameReleasedMutex.Unlock()
+
+	if shard.frameReleased == nil {
+		shard.frameReleased = make(chan struct{})
+	}
+
+	return shard.frameReleased
+}
+
+// signalFrameReleased wakes up all fetches waiting for a frame of the shard to be released.
+func (shard *bufferPoolShard) signalFrameReleased() {
+
+	shard.frameReleasedMutex.Lock()
+	defer shard.frameReleasedMutex.Unlock()
+
+	if shard.frameReleased != nil {
+		close(shard.frameReleased)
+		shard.frameReleased = nil
+	}
+}
+
+// getShard returns the shard responsible for a page.
+func (bufferPool *SimpleBufferPoolManager) getShard(pageId uint64) *bufferPoolShard {
+
+	return bufferPool.shards[pageId%uint64(len(bufferPool.shards))]
+}
+
+// loadPage assigns a frame of the shard to a page that isn't in the buffer pool, and reads the page into it.
+// The frame is marked as in flight before the lookup mutex is released, so the write back of an evicted dirty page and the read
+// are performed without holding the lookup mutex. Fetches of either page wait for the in-flight marker to be cleared, and look the page up again.
+// The lookup mutex must be held exclusively when loadPage is called, and it is held again when loadPage returns.
+//
+// A page read ahead is left unpinned and inserted into the replacer as a cold frame, otherwise the page is returned pinned.
+// If every frame is pinned, it returns ErrBufferPoolExhausted, along with a channel that is closed once a frame of the shard is released.
+func (bufferPool *SimpleBufferPoolManager) loadPage(shard *bufferPoolShard, pageId uint64, readAhead bool) (*Frame, <-chan struct{}, error) {
+
+	frameId, evicted, found := shard.acquireFrame()
+
+	if !found {
+
+		// the lookup mutex is held exclusively, so no frame can be released before the channel is handed out.
+		slog.Warn("No frame available for page", "pageId", pageId, "function", "loadPage", "at", "buffer Pool Manager")
+		return nil, shard.getFrameReleasedChannel(), ErrBufferPoolExhausted
+	}
+
+	frame := shard.frames[frameId]
+
+	evictedPageId := frame.pageId
+	writeBack := evicted && frame.dirty
+
+	inFlight := make(chan struct{})
+
+	frame.inFlight = inFlight
+	frame.pageId = pageId
+	frame.dirty = false
+	frame.pinCount = 1
+
+	if readAhead {
+		frame.pinCount = 0
+	}
+
+	shard.pageTable[pageId] = frameId
+
+	shard.lookupMutex.Unlock()
+
+	// the background writer holds the page lock of the evicted page while it writes it, so its write finishes before the frame is overwritten.
+	frame.mutex.Lock()
+
+	var writeErr, readErr error
+
+	if writeBack {
+		writeErr = bufferPool.disk.write(int64(evictedPageId)*int64(bufferPool.pageSize), frame.data)
+	}
+
+	// the page is read straight into the frame, instead of into a temporary buffer that is then copied.
+	if writeErr == nil {
+		readErr = bufferPool.disk.readPages([]uint64{pageId}, [][]byte{frame.data})
+	}
+
+	frame.mutex.Unlock()
+
+	shard.lookupMutex.Lock()
+
+	frame.inFlight = nil
+	close(inFlight)
+
+	if writeErr != nil {
+
+		slog.Error("Failed to write evicted page to disk", "pageId", evictedPageId, "error", writeErr.Error(), "function", "loadPage", "at", "buffer Pool Manager")
+
+		// the evicted page stays in the buffer pool, so its changes aren't lost.
+		delete(shard.pageTable, pageId)
+
+		frame.pageId = evictedPageId
+		frame.dirty = true
+		frame.pinCount = 0
+		shard.replacer.insert(frameId)
+		shard.signalFrameReleased()
+
+		return nil, nil, writeErr
+	}
+
+	if evicted {
+		delete(shard.pageTable, evictedPageId)
+		bufferPool.counters.evictions.Add(1)
+	}
+
+	if writeBack {
+		bufferPool.counters.dirtyWrites.Add(1)
+	}
+
+	if readErr != nil {
+
+		slog.Error("Failed to read page from disk", "pageId", pageId, "error", readErr.Error(), "function", "loadPage", "at", "buffer Pool Manager")
+
+		// the frame no longer holds a valid page, so it is returned to the free frame list.
+		delete(shard.pageTable, pageId)
+
+		frame.pageId = 0
+		frame.pinCount = 0
+		shard.releaseFrame(frameId)
+
+		return nil, nil, readErr
+	}
+
+	if readAhead {
+		shard.replacer.insertCold(frameId)
+
+		// a waiting fetch can evict the new frame.
+		shard.signalFrameReleased()
+
+		bufferPool.counters.readAheadPages.Add(1)
+	} else {
+		bufferPool.counters.misses.Add(1)
+	}
+
+	return frame, nil, nil
+}
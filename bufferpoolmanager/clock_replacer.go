@@ -0,0 +1,149 @@
+package bufferpoolmanager
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// ClockReplacer approximates LRU using a reference bit per frame. Frames are arranged in a circle,
+// and a clock hand sweeps over them, clearing reference bits until it finds an evictable frame whose bit is already clear.
+type ClockReplacer struct {
+
+	// synchronizes access to the clock.
+	mutex *sync.Mutex
+
+	// set for frames that are currently managed by the replacer.
+	evictable []bool
+
+	// set when a frame is accessed, cleared when the clock hand passes over it.
+	referenced []bool
+
+	// position of the clock hand.
+	hand int
+
+	// number of evictable frames.
+	numEvictable int
+}
+
+func NewClockReplacer(poolSize int) *ClockReplacer {
+
+	slog.Info("Creating new ClockReplacer...", "poolSize", poolSize, "function", "NewClockReplacer", "at", "ClockReplacer")
+	return &ClockReplacer{
+		mutex:      &sync.Mutex{},
+		evictable:  make([]bool, poolSize),
+		referenced: make([]bool, poolSize),
+	}
+}
+
+// victim advances the clock hand until it finds an evictable frame that wasn't referenced since the hand last passed over it.
+// The hand makes at most two sweeps, since every reference bit is cleared during the first one.
+func (replacer *ClockReplacer) victim() (FrameID, bool) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if replacer.numEvictable == 0 {
+		slog.Warn("No evictable frames", "function", "victim", "at", "ClockReplacer")
+		return 0, false
+	}
+
+	for {
+		frameId := replacer.hand
+		replacer.hand = (replacer.hand + 1) % len(replacer.evictable)
+
+		if !replacer.evictable[frameId] {
+			continue
+		}
+
+		if replacer.referenced[frameId] {
+			replacer.referenced[frameId] = false
+			continue
+		}
+
+		replacer.evictable[frameId] = false
+		replacer.numEvictable--
+
+		slog.Info("Selecting victim frame...", "victim_frame", frameId, "function", "victim", "at", "ClockReplacer")
+		return FrameID(frameId), true
+	}
+}
+
+// insert marks the frame as evictable, and sets its reference bit since it was just accessed.
+func (replacer *ClockReplacer) insert(frameId FrameID) {
+
+	slog.Info("Inserting frame into ClockReplacer...", "frame_ID", frameId, "function", "insert", "at", "ClockReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if !replacer.evictable[frameId] {
+		replacer.evictable[frameId] = true
+		replacer.numEvictable++
+	}
+	replacer.referenced[frameId] = true
+}
+
+// insertCold marks the frame as evictable, but leaves its reference bit clear, so the clock hand evicts it the first time it passes over it.
+func (replacer *ClockReplacer) insertCold(frameId FrameID) {
+
+	slog.Info("Inserting cold frame into ClockReplacer...", "frame_ID", frameId, "function", "insertCold", "at", "ClockReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if !replacer.evictable[frameId] {
+		replacer.evictable[frameId] = true
+		replacer.numEvictable++
+	}
+	replacer.referenced[frameId] = false
+}
+
+// remove marks the frame as not evictable once its pin count > 0.
+func (replacer *ClockReplacer) remove(frameId FrameID) {
+
+	slog.Info("Removing frame from ClockReplacer...", "frame_ID", frameId, "function", "remove", "at", "ClockReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if replacer.evictable[frameId] {
+		replacer.evictable[frameId] = false
+		replacer.numEvictable--
+	}
+}
+
+// forget clears the reference bit of a frame whose page was deleted.
+func (replacer *ClockReplacer) forget(frameId FrameID) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.referenced[frameId] = false
+}
+
+// returns the number of frames currently managed by the replacer.
+func (replacer *ClockReplacer) size() int {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	return replacer.numEvictable
+}
+
+// resize grows or shrinks the clock. Frames beyond the new size are no longer evictable, so they can be cut off.
+func (replacer *ClockReplacer) resize(numFrames int) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if numFrames > len(replacer.evictable) {
+
+		replacer.evictable = append(replacer.evictable, make([]bool, numFrames-len(replacer.evictable))...)
+		replacer.referenced = append(replacer.referenced, make([]bool, numFrames-len(replacer.referenced))...)
+	} else {
+
+		replacer.evictable = replacer.evictable[:numFrames]
+		replacer.referenced = replacer.referenced[:numFrames]
+	}
+
+	if replacer.hand >= numFrames {
+		replacer.hand = 0
+	}
+}
@@ -0,0 +1,68 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ClockReplacerTestSuite struct {
+	suite.Suite
+	replacer *ClockReplacer
+}
+
+func (rs *ClockReplacerTestSuite) SetupTest() {
+
+	rs.replacer = NewClockReplacer(4)
+
+	for frameId := range 4 {
+		rs.replacer.insert(FrameID(frameId))
+	}
+}
+
+// assertVictim checks that the replacer evicts the expected frame.
+func (rs *ClockReplacerTestSuite) assertVictim(expectedFrameId FrameID) {
+
+	frameId, found := rs.replacer.victim()
+
+	rs.Require().True(found)
+	rs.Assert().Equal(expectedFrameId, frameId)
+}
+
+func (rs *ClockReplacerTestSuite) TestClockReplacerVictim() {
+
+	// every reference bit is set, so the hand sweeps the whole clock once and evicts the first frame
+	rs.assertVictim(FrameID(0))
+
+	// frame 1 is referenced again, so it gets a second chance
+	rs.replacer.insert(1)
+
+	rs.assertVictim(FrameID(2))
+	rs.Assert().Equal(2, rs.replacer.size())
+}
+
+func (rs *ClockReplacerTestSuite) TestClockReplacerRemove() {
+
+	rs.replacer.remove(0)
+	rs.replacer.remove(1)
+
+	rs.Assert().Equal(2, rs.replacer.size())
+	rs.assertVictim(FrameID(2))
+	rs.assertVictim(FrameID(3))
+	_, found := rs.replacer.victim()
+	rs.Assert().False(found)
+}
+
+func (rs *ClockReplacerTestSuite) TestClockReplacerInsertCold() {
+
+	rs.replacer.remove(2)
+	rs.replacer.insertCold(2)
+
+	// frames 0 and 1 get a second chance, frame 2 was never referenced
+	rs.assertVictim(FrameID(2))
+}
+
+func TestClockReplacer(t *testing.T) {
+
+	suite.Run(t, new(ClockReplacerTestSuite))
+}
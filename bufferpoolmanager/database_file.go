@@ -0,0 +1,581 @@
+package bufferpoolmanager
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+	"github.com/ncw/directio"
+)
+
+// databaseFile is the database file shared by the disk managers. It owns the file format: the superblock and metadata page,
+// page allocation, and syncing, so the same file can be opened with either Direct I/O or buffered I/O.
+type databaseFile struct {
+	file     *os.File
+	metadata *codec.MetaData
+	codec    codec.MetaDataCodec
+	mutex    *sync.Mutex
+
+	// size of every page in the file, recorded in the superblock when the file is created.
+	pageSize int
+
+	superblock      codec.Superblock
+	superblockCodec codec.SuperblockCodec
+
+	// encrypts the metadata page, nil if the database isn't encrypted.
+	metadataCipher *pageCipher
+
+	// the file was opened with Direct I/O, so buffers passed to the kernel must be aligned.
+	directIO bool
+
+	// every write is reported to the syncer, which syncs the file according to the sync mode.
+	syncer *fileSyncer
+
+	// extents of the file reserved by B+ trees, guarded by mutex.
+	extents *extentAllocator
+}
+
+// openDatabaseFile opens the database file, using Direct I/O if directIO is true, and the kernel page cache otherwise.
+// The metadata page is encrypted and decrypted using metadataCipher if it isn't nil.
+// pageSize is the page size of a new file, 0 to use the default page size. If it isn't 0, it must match the page size of an existing file.
+func openDatabaseFile(filePath string, pageSize int, directIO bool, metadataCipher *pageCipher) (disk *databaseFile, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	fmt.Println()
+
+	// flag represents whether a dragon.db file exists in the given file path or not.
+	newFileCreated := false
+
+	// check if a dragon.db file exists in the the current directory.
+	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
+		slog.Info("dragon.db file does not exist, creating new file...", "filePath", filePath, "function", "openDatabaseFile", "at", "databaseFile")
+		newFileCreated = true
+	}
+
+	slog.Info("Opening database file", "directIO", directIO, "function", "openDatabaseFile", "at", "databaseFile")
+
+	var file *os.File
+
+	// Create a dragon.db file if it does not exist, initialize a file descriptor with read/write permissions, and the Direct I/O flag if requested.
+	if directIO {
+		file, err = directio.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	} else {
+		file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	}
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	disk = &databaseFile{
+		file:            file,
+		codec:           codec.DefaultMetaDataCodec(),
+		superblockCodec: codec.DefaultSuperblockCodec(),
+		mutex:           &sync.Mutex{},
+
+		metadataCipher: metadataCipher,
+		directIO:       directIO,
+		syncer:         newFileSyncer(file),
+		extents:        newExtentAllocator(),
+	}
+
+	// if a new file had to be created, create a meta data page, and write it to disk.
+	if newFileCreated {
+
+		if pageSize == 0 {
+			pageSize = codec.DEFAULT_PAGE_SIZE
+		}
+		disk.pageSize = pageSize
+
+		if disk.superblock, err = codec.NewSuperblock(pageSize); err != nil {
+			disk.file.Close()
+			return nil, nil, false, err
+		}
+
+		disk.metadata = newMetaData(pageSize)
+
+		slog.Info("writing new metadata page", "function", "openDatabaseFile", "at", "databaseFile")
+
+		if err = disk.syncer.commit(disk.writeMetaDataPage); err != nil {
+
+			slog.Error("Failed to write metadata page", "error", err.Error(), "function", "openDatabaseFile", "at", "databaseFile")
+
+			// the file was created by this call and holds no metadata page, so it is removed instead of failing every later open.
+			disk.file.Close()
+			os.Remove(filePath)
+			return nil, nil, false, err
+		}
+
+		slog.Info("New metadata page written successfully", "function", "openDatabaseFile", "at", "databaseFile")
+
+		return disk, disk.metadata, true, nil
+
+	} else {
+
+		slog.Info("Reading metadata page from existing file", "function", "openDatabaseFile", "at", "databaseFile")
+
+		if disk.metadata, err = disk.readMetaDataPage(); err != nil {
+
+			slog.Error("Failed to read metadata page", "error", err.Error(), "function", "openDatabaseFile", "at", "databaseFile")
+			disk.file.Close()
+			return nil, nil, false, err
+		}
+
+		if pageSize != 0 && pageSize != disk.pageSize {
+
+			disk.file.Close()
+			return nil, nil, false, fmt.Errorf("database was created with page size %d, not %d", disk.pageSize, pageSize)
+		}
+
+		slog.Info("Metadata page read", "pageSize", disk.pageSize, "formatVersion", disk.superblock.FormatVersion, "databaseId", disk.superblock.DatabaseIdString(), "function", "openDatabaseFile", "at", "databaseFile")
+
+		return disk, disk.metadata, false, nil
+	}
+
+}
+
+// newMetaData returns the metadata of a new database, with pages of pageSize bytes.
+func newMetaData(pageSize int) *codec.MetaData {
+
+	return &codec.MetaData{
+		CurrBPlusTreeId:       0,
+		DeallocatedPageIdList: []uint64{},
+		MaxAllocatedPageId:    0,
+		FirstLeafNodePages:    make(map[uint64]uint64),
+		SecondaryIndexes:      []codec.SecondaryIndexMetaData{},
+		Comparators:           make(map[uint64]string),
+		CompressionTypes:      make(map[uint64]uint8),
+		Tablespaces:           make(map[uint64]uint64),
+		TablespaceFiles:       make(map[uint64]string),
+		// root node does not exist
+		RootPages: make(map[uint64]uint64),
+		PageSize:  uint32(pageSize),
+	}
+}
+
+// readMetaDataPage reads the metadata page of an existing file, validates the superblock at its start, and decodes the metadata stored after it.
+func (disk *databaseFile) readMetaDataPage() (*codec.MetaData, error) {
+
+	return disk.readMetaDataPageFromVersion(codec.CURRENT_FORMAT_VERSION)
+}
+
+// readMetaDataPageFromVersion reads the metadata page of an existing file like readMetaDataPage, but accepts files written in any format version
+// starting from minVersion. Migrations use it to read the metadata of files which haven't been upgraded to the current format yet.
+func (disk *databaseFile) readMetaDataPageFromVersion(minVersion uint32) (*codec.MetaData, error) {
+
+	// the superblock records the page size, and fits in the smallest page.
+	data, err := disk.read(METADATA_PAGE_ID, codec.MIN_PAGE_SIZE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !disk.superblockCodec.HasSuperblock(data) {
+		return nil, fmt.Errorf("%w: file has no superblock, it was either written in format version 0, or isn't a DragonDB database file", ErrOutdatedFormatVersion)
+	}
+
+	superblock, err := disk.superblockCodec.DecodeSuperblock(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if superblock.FormatVersion < minVersion {
+		return nil, fmt.Errorf("%w: file has format version %d, the current version is %d", ErrOutdatedFormatVersion, superblock.FormatVersion, codec.CURRENT_FORMAT_VERSION)
+	}
+
+	if superblock.Encrypted && disk.metadataCipher == nil {
+		return nil, fmt.Errorf("database file is encrypted, it must be opened with a key provider")
+	}
+
+	if !superblock.Encrypted && disk.metadataCipher != nil {
+		return nil, fmt.Errorf("database file isn't encrypted")
+	}
+
+	disk.superblock = superblock
+	disk.pageSize = int(superblock.PageSize)
+
+	metaDataPage, err := disk.read(METADATA_PAGE_ID, disk.pageSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encodedMetaData := metaDataPage[codec.SUPERBLOCK_SIZE:]
+
+	if disk.metadataCipher != nil {
+
+		if encodedMetaData, err = disk.metadataCipher.decryptPage(METADATA_PAGE_ID, encodedMetaData); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata, err := disk.codec.DecodeMetaDataPage(encodedMetaData)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata page: %w", err)
+	}
+
+	metadata.PageSize = superblock.PageSize
+
+	return metadata, nil
+}
+
+// writeMetaDataPage writes the superblock to the start of the metadata page, followed by the metadata, which is encrypted if the database is encrypted.
+func (disk *databaseFile) writeMetaDataPage() error {
+
+	metaDataSize := disk.pageSize - codec.SUPERBLOCK_SIZE
+
+	if disk.metadataCipher != nil {
+		metaDataSize -= ENCRYPTION_TRAILER_SIZE
+	}
+
+	// the unused pages of reserved extents aren't saved, see extentAllocator.
+	metadata := disk.extents.savedMetaData(disk.metadata)
+
+	if encodedSize := disk.codec.EncodedMetaDataSize(metadata); encodedSize > metaDataSize {
+		return fmt.Errorf("metadata needs %d bytes, but only %d bytes of the metadata page are available", encodedSize, metaDataSize)
+	}
+
+	disk.superblock.Encrypted = disk.metadataCipher != nil
+
+	metaDataPage := make([]byte, disk.pageSize)
+
+	copy(metaDataPage, disk.superblockCodec.EncodeSuperblock(disk.superblock))
+
+	encodedMetaData := disk.codec.EncodeMetaData(metadata, disk.pageSize-codec.SUPERBLOCK_SIZE)
+
+	if disk.metadataCipher != nil {
+
+		encryptedMetaData, err := disk.metadataCipher.encryptPage(METADATA_PAGE_ID, encodedMetaData)
+
+		if err != nil {
+			return err
+		}
+		encodedMetaData = encryptedMetaData
+	}
+
+	copy(metaDataPage[codec.SUPERBLOCK_SIZE:], encodedMetaData)
+
+	return disk.write(int64(METADATA_PAGE_ID*disk.pageSize), metaDataPage)
+}
+
+// Superblock returns the superblock of the database file, which describes its format and identifies the database.
+func (disk *databaseFile) Superblock() codec.Superblock {
+	return disk.superblock
+}
+
+// getPageSize returns the size of the pages in the file.
+func (disk *databaseFile) getPageSize() int {
+	return disk.pageSize
+}
+
+// write function writes data to a particular offset in the file.
+func (disk *databaseFile) write(offset int64, data []byte) error {
+
+	fmt.Println()
+	slog.Info("Writing data to offset", "offset", offset, "size", len(data), "function", "write", "at", "databaseFile")
+
+	// the WriteAt function internally calls the pwrite system call that writes data to the offset in a thread safe manner.
+	// The following set of operations are performed atomically:
+
+	// file.seek(new_offset)
+	// file.write(data)
+	// file.seek(original_offset)
+
+	// Direct I/O requires the user space buffer to be aligned to the logical block size of the disk,
+	// so unaligned data is copied into an aligned block before being written.
+	if disk.directIO && !isAligned(data) {
+		block := directio.AlignedBlock(len(data))
+		copy(block, data)
+		data = block
+	}
+
+	n, err := disk.file.WriteAt(data, offset)
+
+	if err != nil {
+		slog.Error("Failed to write data", "error", err.Error(), "function", "write", "at", "databaseFile")
+		return err
+	}
+
+	if n != len(data) {
+		return fmt.Errorf("incomplete write")
+	}
+
+	return disk.syncer.wrote()
+}
+
+// reads a specified amount of data starting from a particular offset in the file.
+func (disk *databaseFile) read(offset int64, size int) ([]byte, error) {
+
+	fmt.Println()
+	slog.Info("Reading data from offset", "offset", offset, "size", size, "function", "read", "at", "databaseFile")
+
+	slog.Info("allocating aligned block for read", "size", size, "function", "read", "at", "databaseFile")
+
+	data := directio.AlignedBlock(size)
+
+	// The readAt function internally calls the pread system call that reads data at the offset in a thread safe manner.
+	// The following set of operations are performed atomically:
+
+	// file.seek(new_offset)
+	// file.read(data)
+	// file.seek(original_offset)
+
+	n, err := disk.file.ReadAt(data, offset)
+
+	if err != nil {
+		slog.Error("Failed to read data", "error", err.Error(), "function", "read", "at", "databaseFile")
+		return nil, err
+	}
+	if n != size {
+		return nil, fmt.Errorf("incomplete read")
+	}
+	return data, nil
+
+}
+
+// readPages reads the pages with the given IDs directly into the given buffers, which must be aligned if the file was opened with Direct I/O.
+func (disk *databaseFile) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	fmt.Println()
+	slog.Info("Reading pages", "count", len(pageIds), "function", "readPages", "at", "databaseFile")
+
+	for _, buffer := range buffers {
+		if disk.directIO && !isAligned(buffer) {
+			return fmt.Errorf("buffers must be aligned for Direct I/O")
+		}
+	}
+
+	if err := readPagesVectored(disk.file, disk.pageSize, pageIds, buffers); err != nil {
+		slog.Error("Failed to read pages", "error", err.Error(), "function", "readPages", "at", "databaseFile")
+		return err
+	}
+
+	return nil
+}
+
+// writePages writes the given buffers to the pages with the given IDs. Unaligned buffers are copied into aligned blocks first.
+func (disk *databaseFile) writePages(pageIds []uint64, buffers [][]byte) error {
+
+	fmt.Println()
+	slog.Info("Writing pages", "count", len(pageIds), "function", "writePages", "at", "databaseFile")
+
+	alignedBuffers := make([][]byte, len(buffers))
+
+	for i, buffer := range buffers {
+
+		alignedBuffers[i] = buffer
+
+		if disk.directIO && !isAligned(buffer) {
+			alignedBuffers[i] = directio.AlignedBlock(len(buffer))
+			copy(alignedBuffers[i], buffer)
+		}
+	}
+
+	if err := writePagesVectored(disk.file, disk.pageSize, pageIds, alignedBuffers); err != nil {
+		slog.Error("Failed to write pages", "error", err.Error(), "function", "writePages", "at", "databaseFile")
+		return err
+	}
+
+	if len(pageIds) == 0 {
+		return nil
+	}
+
+	return disk.syncer.wrote()
+}
+
+// allocatePage allocates a page in the file and returns a new page ID for use.
+// It reuses a deallocated page ID outside the extents reserved by B+ trees if available, otherwise increments maxAllocatedPageId and returns a new page ID.
+func (disk *databaseFile) allocatePage() (uint64, error) {
+
+	fmt.Println()
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	pageId, err := disk.extents.allocatePage(disk.metadata, disk.grow)
+
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info(fmt.Sprintf("allocating page with page ID = %d", pageId), "function", "allocatePage", "at", "databaseFile")
+
+	return pageId, nil
+}
+
+// allocatePageNear allocates a page for a B+ tree close to hintPageId, in an extent reserved by the B+ tree.
+func (disk *databaseFile) allocatePageNear(hintPageId uint64, owner uint64) (uint64, error) {
+
+	fmt.Println()
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	pageId, err := disk.extents.allocatePageNear(disk.metadata, hintPageId, owner, disk.grow)
+
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info(fmt.Sprintf("allocating page with page ID = %d", pageId), "hintPageId", hintPageId, "owner", owner, "function", "allocatePageNear", "at", "databaseFile")
+
+	return pageId, nil
+}
+
+// grow adds empty pages to the end of the file until it holds the page with ID = maxPageId.
+// The file grows a whole extent at a time, so the pages of an extent are stored next to each other.
+func (disk *databaseFile) grow(maxPageId uint64) error {
+
+	fileStats, err := disk.file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	// number of pages in the file, including the metadata page.
+	numPages := uint64(fileStats.Size()) / uint64(disk.pageSize)
+
+	if maxPageId < numPages {
+		return nil
+	}
+
+	_, lastPageId := extentPages(extentOf(maxPageId))
+
+	if err := disk.write(int64(numPages)*int64(disk.pageSize), make([]byte, int(lastPageId+1-numPages)*disk.pageSize)); err != nil {
+		slog.Error("Failed to write new pages", "maxPageId", maxPageId, "error", err.Error(), "function", "grow", "at", "databaseFile")
+		return err
+	}
+
+	return nil
+}
+
+// deallocatePage marks a page ID as free and adds it to the free list, making it available for future allocation.
+func (disk *databaseFile) deallocatePage(pageId uint64) {
+
+	fmt.Println()
+	slog.Info(fmt.Sprintf("deallocating page with page ID = %d", pageId), "function", "deallocatePage", "at", "databaseFile")
+
+	disk.mutex.Lock()
+	disk.metadata.DeallocatedPageIdList = append(disk.metadata.DeallocatedPageIdList, pageId)
+	disk.mutex.Unlock()
+}
+
+// allocatePageBelow reuses the lowest deallocated page ID below limit, so a page can be moved towards the start of the file.
+func (disk *databaseFile) allocatePageBelow(limit uint64) (uint64, bool) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	disk.extents.freeUnusedPages(disk.metadata)
+
+	return takeDeallocatedPageIdBelow(disk.metadata, limit)
+}
+
+// allocatedPages returns the greatest allocated page ID, and the number of deallocated or unused page IDs below it.
+func (disk *databaseFile) allocatedPages() (uint64, int) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.metadata.MaxAllocatedPageId, len(disk.metadata.DeallocatedPageIdList) + len(disk.extents.unusedPages)
+}
+
+// shrink removes the deallocated pages at the end of the file, along with the pages added to the end of the file ahead of allocation.
+// The metadata page is committed before the file is truncated, so it never references pages past the end of the file.
+func (disk *databaseFile) shrink() (int, error) {
+
+	fmt.Println()
+	slog.Info("Shrinking database file...", "function", "shrink", "at", "databaseFile")
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	fileStats, err := disk.file.Stat()
+
+	if err != nil {
+		return 0, err
+	}
+
+	disk.extents.freeUnusedPages(disk.metadata)
+	releaseTrailingPages(disk.metadata)
+	disk.extents.release(disk.metadata)
+
+	if err := disk.syncer.commit(disk.writeMetaDataPage); err != nil {
+		slog.Error("Failed to commit metadata page", "error", err.Error(), "function", "shrink", "at", "databaseFile")
+		return 0, err
+	}
+
+	numPages := int64(disk.metadata.MaxAllocatedPageId + 1)
+
+	if err := disk.file.Truncate(numPages * int64(disk.pageSize)); err != nil {
+		slog.Error("Failed to truncate file", "error", err.Error(), "function", "shrink", "at", "databaseFile")
+		return 0, err
+	}
+
+	releasedPages := int(fileStats.Size()/int64(disk.pageSize) - numPages)
+
+	slog.Info("Shrunk database file", "releasedPages", releasedPages, "maxAllocatedPageId", disk.metadata.MaxAllocatedPageId, "function", "shrink", "at", "databaseFile")
+
+	return max(releasedPages, 0), nil
+}
+
+// sync writes the metadata page as a commit point. In SyncPerCommit and SyncFull mode, the pages written before it,
+// and the metadata page itself, are synced to stable storage before it returns.
+func (disk *databaseFile) sync() error {
+
+	fmt.Println()
+	slog.Info("Committing metadata page", "mode", disk.syncer.getConfig().Mode.String(), "function", "sync", "at", "databaseFile")
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.syncer.commit(disk.writeMetaDataPage)
+}
+
+// setSyncConfig changes when the file is synced to stable storage.
+func (disk *databaseFile) setSyncConfig(config SyncConfig) error {
+	return disk.syncer.setConfig(config)
+}
+
+// writes the serialized metadata page to file, syncs the file unless the sync mode is SyncNone, then closes the file.
+func (disk *databaseFile) close() error {
+
+	fmt.Println()
+	slog.Info("Closing database file...", "function", "close", "at", "databaseFile")
+
+	slog.Info("Writing metadata page before closing", "function", "close", "at", "databaseFile")
+
+	// the metadata is encoded under the mutex, like in sync, so a concurrent allocation can't change it while it is written.
+	disk.mutex.Lock()
+	err := disk.syncer.close(disk.writeMetaDataPage)
+	disk.mutex.Unlock()
+
+	if err != nil {
+
+		slog.Error("Failed to write metadata page", "error", err.Error(), "function", "close", "at", "databaseFile")
+
+		return err
+	}
+
+	if err := disk.file.Close(); err != nil {
+
+		slog.Error("Failed to close file", "error", err.Error(), "function", "close", "at", "databaseFile")
+
+		return err
+	}
+
+	return nil
+}
+
+// discard closes the file without writing the metadata page or syncing the file, leaving it the way a crash would.
+func (disk *databaseFile) discard() error {
+
+	fmt.Println()
+	slog.Warn("Discarding database file without writing metadata page", "function", "discard", "at", "databaseFile")
+
+	disk.syncer.stop()
+
+	return disk.file.Close()
+}
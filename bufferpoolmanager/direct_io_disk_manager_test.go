@@ -1,10 +1,13 @@
 package bufferpoolmanager
 
 import (
+	"bytes"
 	"encoding/binary"
 	"os"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -27,20 +30,15 @@ func setupPage() []byte {
 	return page
 }
 
-func setupFile(filePath string) {
-
-	f, _ := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-
-	f.Write(setupPage())
-
-	f.Close()
-}
 func (ds *DirectIODiskManagerTestSuite) SetupSuite() {
 
-	setupFile("test_file")
+	os.Remove("test_file")
 	diskManager, _, _, err := NewDirectIODiskManager("test_file")
-	ds.Suite.Assert().NoError(err)
+	ds.Suite.Require().NoError(err)
 	ds.diskManager = diskManager
+
+	// page 0 is the metadata page, the test page is stored at page 1.
+	ds.Suite.Require().NoError(diskManager.write(4096, setupPage()))
 }
 
 func (ds *DirectIODiskManagerTestSuite) TearDownSuite() {
@@ -59,7 +57,7 @@ func (ds *DirectIODiskManagerTestSuite) TestDiskManagerWrite() {
 }
 
 func (ds *DirectIODiskManagerTestSuite) TestDiskManagerRead() {
-	data, err := ds.diskManager.read(0, 4096)
+	data, err := ds.diskManager.read(4096, 4096)
 	ds.Assert().NoError(err)
 
 	pointer := 0
@@ -74,3 +72,58 @@ func (ds *DirectIODiskManagerTestSuite) TestDiskManagerRead() {
 func TestDiskManager(t *testing.T) {
 	suite.Run(t, new(DirectIODiskManagerTestSuite))
 }
+
+func TestDirectIODiskManagerPageSize(t *testing.T) {
+
+	filePath := "page_size_test_file"
+	defer os.Remove(filePath)
+
+	for _, pageSize := range []int{2048, 12288, 131072} {
+		_, _, _, err := NewDirectIODiskManagerWithPageSize(filePath, pageSize)
+		assert.Error(t, err)
+	}
+
+	disk, metadata, isNewDatabase, err := NewDirectIODiskManagerWithPageSize(filePath, 16384)
+	require.NoError(t, err)
+	assert.True(t, isNewDatabase)
+	assert.Equal(t, uint32(16384), metadata.PageSize)
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, 16384, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	pageId, err := bufferPool.NewPage()
+	require.NoError(t, err)
+
+	guard, err := bufferPool.NewWriteGuard(pageId)
+	require.NoError(t, err)
+	require.Len(t, guard.GetPageData(), 16384)
+
+	copy(guard.GetPageData(), bytes.Repeat([]byte{'a'}, 16384))
+	guard.SetDirtyFlag()
+	guard.Done()
+
+	require.NoError(t, bufferPool.Close())
+
+	// the page size recorded in the metadata page is used when the file is reopened.
+	disk, metadata, isNewDatabase, err = NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+	assert.False(t, isNewDatabase)
+	assert.Equal(t, 16384, disk.getPageSize())
+	assert.Equal(t, uint32(16384), metadata.PageSize)
+
+	_, err = NewSimpleBufferPoolManager(3, PAGE_SIZE, NewLRUReplacer(), disk)
+	assert.Error(t, err)
+
+	bufferPool, err = NewSimpleBufferPoolManager(3, 16384, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	readGuard, err := bufferPool.NewReadGuard(pageId)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{'a'}, 16384), readGuard.GetPageData())
+	readGuard.Done()
+
+	require.NoError(t, bufferPool.Close())
+
+	_, _, _, err = NewDirectIODiskManagerWithPageSize(filePath, 8192)
+	assert.Error(t, err)
+}
@@ -0,0 +1,577 @@
+package bufferpoolmanager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+const (
+	ENCRYPTION_KEY_ID_SIZE = 4
+	ENCRYPTION_NONCE_SIZE  = 12
+	ENCRYPTION_TAG_SIZE    = 16
+
+	// every encrypted page ends with a trailer storing the authentication tag, the nonce and the ID of the key the page was encrypted with.
+	ENCRYPTION_TRAILER_SIZE = ENCRYPTION_TAG_SIZE + ENCRYPTION_NONCE_SIZE + ENCRYPTION_KEY_ID_SIZE
+)
+
+// pageSpaceReserver is implemented by disk managers that store their own data at the end of every page.
+// The buffer pool manager hides the reserved space from page guards, so page codecs never write to it.
+type pageSpaceReserver interface {
+	reservedPageSpace() int
+}
+
+// KeyProvider supplies the keys used to encrypt pages. Keys are identified by a non zero key ID, which is stored in every encrypted page,
+// so pages encrypted with an older key can still be decrypted after the current key is rotated.
+type KeyProvider interface {
+
+	// CurrentKey returns the ID and contents of the key used to encrypt pages being written to disk.
+	CurrentKey() (keyId uint32, key []byte, err error)
+
+	// Key returns the contents of the key with the given ID.
+	Key(keyId uint32) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider that holds its keys in memory.
+type StaticKeyProvider struct {
+	mutex        *sync.RWMutex
+	keys         map[uint32][]byte
+	currentKeyId uint32
+}
+
+// NewStaticKeyProvider returns a key provider whose current key is the given AES-128, AES-192 or AES-256 key, with key ID 1.
+func NewStaticKeyProvider(key []byte) (*StaticKeyProvider, error) {
+
+	provider := &StaticKeyProvider{
+		mutex: &sync.RWMutex{},
+		keys:  make(map[uint32][]byte),
+	}
+
+	if _, err := provider.AddKey(key); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// AddKey adds a new key and makes it the current key, returning its key ID.
+// Older keys are kept, so pages encrypted with them can still be read, until they are re-encrypted with the new key.
+func (provider *StaticKeyProvider) AddKey(key []byte) (keyId uint32, err error) {
+
+	if _, err := aes.NewCipher(key); err != nil {
+		return 0, err
+	}
+
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	provider.currentKeyId++
+	provider.keys[provider.currentKeyId] = append([]byte{}, key...)
+
+	return provider.currentKeyId, nil
+}
+
+// RemoveKey forgets a key that is no longer in use. The current key cannot be removed.
+func (provider *StaticKeyProvider) RemoveKey(keyId uint32) error {
+
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if keyId == provider.currentKeyId {
+		return fmt.Errorf("key %d is the current key", keyId)
+	}
+
+	delete(provider.keys, keyId)
+	return nil
+}
+
+func (provider *StaticKeyProvider) CurrentKey() (keyId uint32, key []byte, err error) {
+
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	return provider.currentKeyId, provider.keys[provider.currentKeyId], nil
+}
+
+func (provider *StaticKeyProvider) Key(keyId uint32) ([]byte, error) {
+
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	key, exists := provider.keys[keyId]
+
+	if !exists {
+		return nil, fmt.Errorf("key %d not found", keyId)
+	}
+
+	return key, nil
+}
+
+// pageCipher encrypts pages using AES-GCM. The page ID is used as associated data, so an encrypted page copied to a different
+// location in the file fails authentication instead of being read as a valid page.
+type pageCipher struct {
+	keyProvider KeyProvider
+
+	// AES-GCM instances, cached by key ID.
+	aeadsMutex *sync.Mutex
+	aeads      map[uint32]cipher.AEAD
+}
+
+func newPageCipher(keyProvider KeyProvider) *pageCipher {
+
+	return &pageCipher{
+		keyProvider: keyProvider,
+		aeadsMutex:  &sync.Mutex{},
+		aeads:       make(map[uint32]cipher.AEAD),
+	}
+}
+
+// getAEAD returns the AES-GCM instance for the given key, creating it if required.
+func (pc *pageCipher) getAEAD(keyId uint32, key []byte) (cipher.AEAD, error) {
+
+	pc.aeadsMutex.Lock()
+	defer pc.aeadsMutex.Unlock()
+
+	if aead, exists := pc.aeads[keyId]; exists {
+		return aead, nil
+	}
+
+	var err error
+
+	if key == nil {
+		if key, err = pc.keyProvider.Key(keyId); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pc.aeads[keyId] = aead
+	return aead, nil
+}
+
+// encryptPage encrypts a page with the current key, and returns the encrypted page with the trailer filled in.
+// The space reserved for the trailer must be empty, otherwise page data would be overwritten by the trailer.
+func (pc *pageCipher) encryptPage(pageId uint64, page []byte) ([]byte, error) {
+
+	dataSize := len(page) - ENCRYPTION_TRAILER_SIZE
+
+	for _, b := range page[dataSize:] {
+		if b != 0 {
+			return nil, fmt.Errorf("page %d has data in the space reserved for the encryption trailer", pageId)
+		}
+	}
+
+	keyId, key, err := pc.keyProvider.CurrentKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := pc.getAEAD(keyId, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedPage := make([]byte, len(page))
+
+	// trailer layout: tag, nonce, key ID
+	nonce := encryptedPage[dataSize+ENCRYPTION_TAG_SIZE : dataSize+ENCRYPTION_TAG_SIZE+ENCRYPTION_NONCE_SIZE]
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	binary.LittleEndian.PutUint32(encryptedPage[len(page)-ENCRYPTION_KEY_ID_SIZE:], keyId)
+
+	// Seal appends the tag to the ciphertext, so the ciphertext fills the data region and the tag lands at the start of the trailer.
+	aead.Seal(encryptedPage[:0], nonce, page[:dataSize], encodePageIdAsAssociatedData(pageId))
+
+	return encryptedPage, nil
+}
+
+// decryptPage authenticates and decrypts an encrypted page. The trailer of the returned page is zeroed out.
+// Pages that were allocated but never written are returned as is, since they are empty.
+func (pc *pageCipher) decryptPage(pageId uint64, encryptedPage []byte) ([]byte, error) {
+
+	keyId := getPageKeyId(encryptedPage)
+
+	if keyId == 0 {
+
+		for _, b := range encryptedPage {
+			if b != 0 {
+				return nil, fmt.Errorf("page %d is not encrypted", pageId)
+			}
+		}
+
+		return encryptedPage, nil
+	}
+
+	aead, err := pc.getAEAD(keyId, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dataSize := len(encryptedPage) - ENCRYPTION_TRAILER_SIZE
+
+	nonce := encryptedPage[dataSize+ENCRYPTION_TAG_SIZE : dataSize+ENCRYPTION_TAG_SIZE+ENCRYPTION_NONCE_SIZE]
+	ciphertext := encryptedPage[:dataSize+ENCRYPTION_TAG_SIZE]
+
+	page := make([]byte, len(encryptedPage))
+
+	if _, err := aead.Open(page[:0], nonce, ciphertext, encodePageIdAsAssociatedData(pageId)); err != nil {
+		return nil, fmt.Errorf("failed to decrypt page %d: %w", pageId, err)
+	}
+
+	// Open writes the plaintext to the data region, the trailer still needs to be cleared.
+	clear(page[dataSize:])
+
+	return page, nil
+}
+
+// getPageKeyId returns the ID of the key an encrypted page was encrypted with, 0 if the page was never written.
+func getPageKeyId(encryptedPage []byte) uint32 {
+
+	return binary.LittleEndian.Uint32(encryptedPage[len(encryptedPage)-ENCRYPTION_KEY_ID_SIZE:])
+}
+
+func encodePageIdAsAssociatedData(pageId uint64) []byte {
+
+	associatedData := make([]byte, 8)
+	binary.LittleEndian.PutUint64(associatedData, pageId)
+	return associatedData
+}
+
+// EncryptedDiskManager sits between the buffer pool manager and a DirectIODiskManager, and encrypts every page written to disk.
+// The last ENCRYPTION_TRAILER_SIZE bytes of every page are reserved for the encryption trailer.
+// The metadata page is encrypted by the underlying disk manager, using the same keys.
+type EncryptedDiskManager struct {
+	disk   *DirectIODiskManager
+	cipher *pageCipher
+
+	// held in read mode while pages are read or written, and in write mode while a page is re-encrypted,
+	// so a page written by the buffer pool manager is never overwritten with its previous contents during key rotation.
+	rotationMutex *sync.RWMutex
+}
+
+// NewEncryptedDirectIODiskManager opens the database file using Direct I/O, encrypting all pages, including the metadata page, with keys supplied by keyProvider.
+func NewEncryptedDirectIODiskManager(filePath string, keyProvider KeyProvider) (disk *EncryptedDiskManager, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	return newEncryptedDirectIODiskManager(filePath, 0, keyProvider)
+}
+
+// NewEncryptedDirectIODiskManagerWithPageSize is NewEncryptedDirectIODiskManager for a database created with pages of pageSize bytes.
+func NewEncryptedDirectIODiskManagerWithPageSize(filePath string, pageSize int, keyProvider KeyProvider) (disk *EncryptedDiskManager, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	if err := codec.ValidatePageSize(pageSize); err != nil {
+		return nil, nil, false, err
+	}
+
+	return newEncryptedDirectIODiskManager(filePath, pageSize, keyProvider)
+}
+
+func newEncryptedDirectIODiskManager(filePath string, pageSize int, keyProvider KeyProvider) (disk *EncryptedDiskManager, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	pageCipher := newPageCipher(keyProvider)
+
+	directIODisk, metadata, isNewDatabase, err := newDirectIODiskManager(filePath, pageSize, pageCipher)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	disk = &EncryptedDiskManager{
+		disk:          directIODisk,
+		cipher:        pageCipher,
+		rotationMutex: &sync.RWMutex{},
+	}
+
+	return disk, metadata, isNewDatabase, nil
+}
+
+func (disk *EncryptedDiskManager) reservedPageSpace() int {
+	return ENCRYPTION_TRAILER_SIZE
+}
+
+// write encrypts each page in data, and writes the encrypted pages to the given offset in the file.
+func (disk *EncryptedDiskManager) write(offset int64, data []byte) error {
+
+	pageSize := disk.disk.pageSize
+
+	if offset%int64(pageSize) != 0 || len(data)%pageSize != 0 {
+		return fmt.Errorf("encrypted writes must be page aligned")
+	}
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	encryptedData := make([]byte, len(data))
+
+	for pointer := 0; pointer < len(data); pointer += pageSize {
+
+		pageId := uint64(offset/int64(pageSize)) + uint64(pointer/pageSize)
+
+		encryptedPage, err := disk.cipher.encryptPage(pageId, data[pointer:pointer+pageSize])
+
+		if err != nil {
+			slog.Error("Failed to encrypt page", "pageId", pageId, "error", err.Error(), "function", "write", "at", "EncryptedDiskManager")
+			return err
+		}
+
+		copy(encryptedData[pointer:], encryptedPage)
+	}
+
+	return disk.disk.write(offset, encryptedData)
+}
+
+// read reads pages starting from the given offset in the file, and decrypts them.
+func (disk *EncryptedDiskManager) read(offset int64, size int) ([]byte, error) {
+
+	pageSize := disk.disk.pageSize
+
+	if offset%int64(pageSize) != 0 || size%pageSize != 0 {
+		return nil, fmt.Errorf("encrypted reads must be page aligned")
+	}
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	data, err := disk.disk.read(offset, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for pointer := 0; pointer < len(data); pointer += pageSize {
+
+		pageId := uint64(offset/int64(pageSize)) + uint64(pointer/pageSize)
+
+		page, err := disk.cipher.decryptPage(pageId, data[pointer:pointer+pageSize])
+
+		if err != nil {
+			slog.Error("Failed to decrypt page", "pageId", pageId, "error", err.Error(), "function", "read", "at", "EncryptedDiskManager")
+			return nil, err
+		}
+
+		copy(data[pointer:], page)
+	}
+
+	return data, nil
+}
+
+// readPages reads the encrypted pages directly into the given buffers, and decrypts them in place.
+func (disk *EncryptedDiskManager) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	if err := disk.disk.readPages(pageIds, buffers); err != nil {
+		return err
+	}
+
+	for i, pageId := range pageIds {
+
+		page, err := disk.cipher.decryptPage(pageId, buffers[i])
+
+		if err != nil {
+			slog.Error("Failed to decrypt page", "pageId", pageId, "error", err.Error(), "function", "readPages", "at", "EncryptedDiskManager")
+			return err
+		}
+
+		copy(buffers[i], page)
+	}
+
+	return nil
+}
+
+// writePages encrypts the given buffers, and writes them to the pages with the given IDs.
+func (disk *EncryptedDiskManager) writePages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	encryptedPages := make([][]byte, len(buffers))
+
+	for i, pageId := range pageIds {
+
+		encryptedPage, err := disk.cipher.encryptPage(pageId, buffers[i])
+
+		if err != nil {
+			slog.Error("Failed to encrypt page", "pageId", pageId, "error", err.Error(), "function", "writePages", "at", "EncryptedDiskManager")
+			return err
+		}
+
+		encryptedPages[i] = encryptedPage
+	}
+
+	return disk.disk.writePages(pageIds, encryptedPages)
+}
+
+func (disk *EncryptedDiskManager) getPageSize() int {
+	return disk.disk.getPageSize()
+}
+
+func (disk *EncryptedDiskManager) allocatePage() (uint64, error) {
+	return disk.disk.allocatePage()
+}
+
+func (disk *EncryptedDiskManager) allocatePageNear(hintPageId uint64, owner uint64) (uint64, error) {
+	return disk.disk.allocatePageNear(hintPageId, owner)
+}
+
+func (disk *EncryptedDiskManager) deallocatePage(pageId uint64) {
+	disk.disk.deallocatePage(pageId)
+}
+
+func (disk *EncryptedDiskManager) allocatePageBelow(limit uint64) (uint64, bool) {
+	return disk.disk.allocatePageBelow(limit)
+}
+
+func (disk *EncryptedDiskManager) allocatedPages() (uint64, int) {
+	return disk.disk.allocatedPages()
+}
+
+// shrink commits the metadata page, encrypted with the current key, and truncates the file.
+func (disk *EncryptedDiskManager) shrink() (int, error) {
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	return disk.disk.shrink()
+}
+
+// sync writes the metadata page, encrypted with the current key, as a commit point.
+func (disk *EncryptedDiskManager) sync() error {
+
+	disk.rotationMutex.RLock()
+	defer disk.rotationMutex.RUnlock()
+
+	return disk.disk.sync()
+}
+
+func (disk *EncryptedDiskManager) setSyncConfig(config SyncConfig) error {
+	return disk.disk.setSyncConfig(config)
+}
+
+// close writes the metadata page, encrypted with the current key, and closes the file.
+func (disk *EncryptedDiskManager) close() error {
+
+	disk.rotationMutex.Lock()
+	defer disk.rotationMutex.Unlock()
+
+	return disk.disk.close()
+}
+
+func (disk *EncryptedDiskManager) discard() error {
+
+	disk.rotationMutex.Lock()
+	defer disk.rotationMutex.Unlock()
+
+	return disk.disk.discard()
+}
+
+// ReEncryptPages re-encrypts every page that isn't encrypted with the current key of the key provider, and returns the number of pages re-encrypted.
+// It is called after rotating the key, and can run while the database is in use, since only one page is locked at a time.
+// Once it returns, keys other than the current key are no longer needed to read the database.
+func (disk *EncryptedDiskManager) ReEncryptPages() (reEncryptedPages int, err error) {
+
+	fmt.Println()
+	slog.Info("Re-encrypting pages with the current key...", "function", "ReEncryptPages", "at", "EncryptedDiskManager")
+
+	currentKeyId, _, err := disk.cipher.keyProvider.CurrentKey()
+
+	if err != nil {
+		return 0, err
+	}
+
+	disk.disk.mutex.Lock()
+	maxAllocatedPageId := disk.disk.metadata.MaxAllocatedPageId
+	disk.disk.mutex.Unlock()
+
+	for pageId := uint64(METADATA_PAGE_ID); pageId <= maxAllocatedPageId; pageId++ {
+
+		reEncrypted, err := disk.reEncryptPage(pageId, currentKeyId)
+
+		if err != nil {
+			slog.Error("Failed to re-encrypt page", "pageId", pageId, "error", err.Error(), "function", "ReEncryptPages", "at", "EncryptedDiskManager")
+			return reEncryptedPages, err
+		}
+
+		if reEncrypted {
+			reEncryptedPages++
+		}
+	}
+
+	slog.Info("Re-encrypted pages", "count", reEncryptedPages, "function", "ReEncryptPages", "at", "EncryptedDiskManager")
+
+	return reEncryptedPages, nil
+}
+
+// reEncryptPage re-encrypts a single page with the current key, if it was encrypted with a different key.
+func (disk *EncryptedDiskManager) reEncryptPage(pageId uint64, currentKeyId uint32) (bool, error) {
+
+	pageSize := disk.disk.pageSize
+
+	disk.rotationMutex.Lock()
+	defer disk.rotationMutex.Unlock()
+
+	encryptedPage, err := disk.disk.read(int64(pageId)*int64(pageSize), pageSize)
+
+	if err != nil {
+		return false, err
+	}
+
+	keyId := getPageKeyId(encryptedPage)
+
+	// pages that were never written don't need to be encrypted
+	if keyId == 0 || keyId == currentKeyId {
+		return false, nil
+	}
+
+	// only the metadata stored after the superblock is encrypted, so the metadata page is re-encrypted by writing it again.
+	if pageId == METADATA_PAGE_ID {
+
+		disk.disk.mutex.Lock()
+		defer disk.disk.mutex.Unlock()
+
+		if err := disk.disk.writeMetaDataPage(); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	page, err := disk.cipher.decryptPage(pageId, encryptedPage)
+
+	if err != nil {
+		return false, err
+	}
+
+	if encryptedPage, err = disk.cipher.encryptPage(pageId, page); err != nil {
+		return false, err
+	}
+
+	if err := disk.disk.write(int64(pageId)*int64(pageSize), encryptedPage); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,206 @@
+package bufferpoolmanager
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const ENCRYPTED_TEST_FILE = "encrypted_test_file"
+
+type EncryptedDiskManagerTestSuite struct {
+	suite.Suite
+	keyProvider *StaticKeyProvider
+}
+
+func (es *EncryptedDiskManagerTestSuite) SetupTest() {
+
+	keyProvider, err := NewStaticKeyProvider(bytes.Repeat([]byte{1}, 32))
+	es.Require().NoError(err)
+
+	es.keyProvider = keyProvider
+}
+
+func (es *EncryptedDiskManagerTestSuite) TearDownTest() {
+	os.Remove(ENCRYPTED_TEST_FILE)
+}
+
+func (es *EncryptedDiskManagerTestSuite) openBufferPool() *SimpleBufferPoolManager {
+
+	disk, _, _, err := NewEncryptedDirectIODiskManager(ENCRYPTED_TEST_FILE, es.keyProvider)
+	es.Require().NoError(err)
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, PAGE_SIZE, NewLRUReplacer(), disk)
+	es.Require().NoError(err)
+
+	return bufferPool
+}
+
+// writePages allocates pages, and fills each of them with a repeated marker byte.
+func (es *EncryptedDiskManagerTestSuite) writePages(bufferPool *SimpleBufferPoolManager, markers []byte) []uint64 {
+
+	pageIds := make([]uint64, 0)
+
+	for _, marker := range markers {
+
+		pageId, err := bufferPool.NewPage()
+		es.Require().NoError(err)
+
+		guard, err := bufferPool.NewWriteGuard(pageId)
+		es.Require().NoError(err)
+
+		copy(guard.GetPageData(), bytes.Repeat([]byte{marker}, PAGE_SIZE))
+		guard.SetDirtyFlag()
+		guard.Done()
+
+		pageIds = append(pageIds, pageId)
+	}
+
+	return pageIds
+}
+
+func (es *EncryptedDiskManagerTestSuite) assertPages(bufferPool *SimpleBufferPoolManager, pageIds []uint64, markers []byte) {
+
+	for i, pageId := range pageIds {
+
+		guard, err := bufferPool.NewReadGuard(pageId)
+		es.Require().NoError(err)
+
+		es.Assert().Equal(bytes.Repeat([]byte{markers[i]}, PAGE_SIZE-ENCRYPTION_TRAILER_SIZE), guard.GetPageData())
+		guard.Done()
+	}
+}
+
+func (es *EncryptedDiskManagerTestSuite) TestPagesAreEncrypted() {
+
+	bufferPool := es.openBufferPool()
+
+	markers := []byte{'a', 'b', 'c', 'd', 'e'}
+	pageIds := es.writePages(bufferPool, markers)
+
+	es.Require().NoError(bufferPool.Close())
+
+	file, err := os.ReadFile(ENCRYPTED_TEST_FILE)
+	es.Require().NoError(err)
+
+	for _, marker := range markers {
+		es.Assert().False(bytes.Contains(file, bytes.Repeat([]byte{marker}, 64)), "page data stored in plaintext")
+	}
+
+	bufferPool = es.openBufferPool()
+	es.assertPages(bufferPool, pageIds, markers)
+	es.Require().NoError(bufferPool.Close())
+}
+
+func (es *EncryptedDiskManagerTestSuite) TestPageMovedToAnotherLocationFailsToDecrypt() {
+
+	bufferPool := es.openBufferPool()
+	pageIds := es.writePages(bufferPool, []byte{'a', 'b'})
+	es.Require().NoError(bufferPool.Close())
+
+	file, err := os.ReadFile(ENCRYPTED_TEST_FILE)
+	es.Require().NoError(err)
+
+	firstPage := file[pageIds[0]*PAGE_SIZE : (pageIds[0]+1)*PAGE_SIZE]
+	copy(file[pageIds[1]*PAGE_SIZE:], firstPage)
+	es.Require().NoError(os.WriteFile(ENCRYPTED_TEST_FILE, file, 0644))
+
+	bufferPool = es.openBufferPool()
+
+	_, err = bufferPool.NewReadGuard(pageIds[1])
+	es.Assert().Error(err)
+
+	es.Require().NoError(bufferPool.Close())
+}
+
+func (es *EncryptedDiskManagerTestSuite) TestMetaDataPageRequiresKey() {
+
+	bufferPool := es.openBufferPool()
+	es.Require().NoError(bufferPool.Close())
+
+	wrongKeyProvider, err := NewStaticKeyProvider(bytes.Repeat([]byte{2}, 32))
+	es.Require().NoError(err)
+
+	_, _, _, err = NewEncryptedDirectIODiskManager(ENCRYPTED_TEST_FILE, wrongKeyProvider)
+	es.Assert().Error(err)
+}
+
+func (es *EncryptedDiskManagerTestSuite) TestKeyRotation() {
+
+	bufferPool := es.openBufferPool()
+
+	markers := []byte{'a', 'b', 'c', 'd'}
+	pageIds := es.writePages(bufferPool, markers)
+
+	es.Require().NoError(bufferPool.Close())
+
+	bufferPool = es.openBufferPool()
+
+	newKeyId, err := es.keyProvider.AddKey(bytes.Repeat([]byte{3}, 32))
+	es.Require().NoError(err)
+
+	reEncryptedPages, err := bufferPool.disk.(*EncryptedDiskManager).ReEncryptPages()
+	es.Require().NoError(err)
+
+	// the data pages and the metadata page
+	es.Assert().Equal(len(pageIds)+1, reEncryptedPages)
+
+	reEncryptedPages, err = bufferPool.disk.(*EncryptedDiskManager).ReEncryptPages()
+	es.Require().NoError(err)
+	es.Assert().Equal(0, reEncryptedPages)
+
+	es.Require().NoError(es.keyProvider.RemoveKey(newKeyId - 1))
+
+	es.assertPages(bufferPool, pageIds, markers)
+	es.Require().NoError(bufferPool.Close())
+
+	bufferPool = es.openBufferPool()
+	es.assertPages(bufferPool, pageIds, markers)
+	es.Require().NoError(bufferPool.Close())
+}
+
+func (es *EncryptedDiskManagerTestSuite) TestPageSize() {
+
+	pageSize := 32768
+	pageDataSize := pageSize - ENCRYPTION_TRAILER_SIZE
+
+	disk, _, _, err := NewEncryptedDirectIODiskManagerWithPageSize(ENCRYPTED_TEST_FILE, pageSize, es.keyProvider)
+	es.Require().NoError(err)
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, pageSize, NewLRUReplacer(), disk)
+	es.Require().NoError(err)
+
+	pageId, err := bufferPool.NewPage()
+	es.Require().NoError(err)
+
+	guard, err := bufferPool.NewWriteGuard(pageId)
+	es.Require().NoError(err)
+	es.Require().Len(guard.GetPageData(), pageDataSize)
+
+	copy(guard.GetPageData(), bytes.Repeat([]byte{'a'}, pageDataSize))
+	guard.SetDirtyFlag()
+	guard.Done()
+
+	es.Require().NoError(bufferPool.Close())
+
+	// the page size of an encrypted file is read from the superblock, which isn't encrypted.
+	disk, metadata, _, err := NewEncryptedDirectIODiskManager(ENCRYPTED_TEST_FILE, es.keyProvider)
+	es.Require().NoError(err)
+	es.Assert().Equal(uint32(pageSize), metadata.PageSize)
+
+	bufferPool, err = NewSimpleBufferPoolManager(3, pageSize, NewLRUReplacer(), disk)
+	es.Require().NoError(err)
+
+	readGuard, err := bufferPool.NewReadGuard(pageId)
+	es.Require().NoError(err)
+	es.Assert().Equal(bytes.Repeat([]byte{'a'}, pageDataSize), readGuard.GetPageData())
+	readGuard.Done()
+
+	es.Require().NoError(bufferPool.Close())
+}
+
+func TestEncryptedDiskManager(t *testing.T) {
+	suite.Run(t, new(EncryptedDiskManagerTestSuite))
+}
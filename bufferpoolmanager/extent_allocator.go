@@ -0,0 +1,311 @@
+package bufferpoolmanager
+
+import (
+	"maps"
+	"slices"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+// EXTENT_SIZE is the number of consecutive pages in an extent, which is also the number of pages the database file grows by.
+// Page 0 is the metadata page, so extent x holds the pages with IDs x*EXTENT_SIZE+1 to (x+1)*EXTENT_SIZE.
+const EXTENT_SIZE = 16
+
+// extentAllocator reserves extents of the database file for B+ trees. Pages a B+ tree allocates near each other are taken
+// from its own extents, so a scan following its leaf chain reads the file mostly sequentially, even when B+ trees grow at the same time.
+// Reservations are only kept in memory. The pages added to the end of the file by a reservation, which aren't allocated yet,
+// are kept out of the free list, so they never fill up the metadata page. They are left out of the saved metadata,
+// and once the database is reopened, they are past the last allocated page, so they are reused as the file grows again.
+// The caller must hold the mutex guarding the metadata.
+type extentAllocator struct {
+
+	// B+ tree owning every reserved extent.
+	owners map[uint64]uint64
+
+	// extents reserved by every B+ tree, in increasing order.
+	extents map[uint64][]uint64
+
+	// pages added to the end of the file by a reservation, which were never allocated.
+	unusedPages map[uint64]bool
+}
+
+func newExtentAllocator() *extentAllocator {
+
+	return &extentAllocator{
+		owners:      make(map[uint64]uint64),
+		extents:     make(map[uint64][]uint64),
+		unusedPages: make(map[uint64]bool),
+	}
+}
+
+// extentOf returns the extent holding a page.
+func extentOf(pageId uint64) uint64 {
+	return (pageId - 1) / EXTENT_SIZE
+}
+
+// extentPages returns the first and last page IDs of an extent.
+func extentPages(extent uint64) (firstPageId uint64, lastPageId uint64) {
+	return extent*EXTENT_SIZE + 1, (extent + 1) * EXTENT_SIZE
+}
+
+// allocatePage reuses the first deallocated page outside the reserved extents, otherwise it adds a page after the last allocated page.
+// grow is called to make room for pages past the end of the file.
+func (allocator *extentAllocator) allocatePage(metadata *codec.MetaData, grow func(maxPageId uint64) error) (uint64, error) {
+
+	for i, pageId := range metadata.DeallocatedPageIdList {
+
+		if _, reserved := allocator.owners[extentOf(pageId)]; !reserved {
+
+			metadata.DeallocatedPageIdList = slices.Delete(metadata.DeallocatedPageIdList, i, i+1)
+			return pageId, nil
+		}
+	}
+
+	// pages skipped when an extent after the last allocated page was reserved.
+	if pageId, found := allocator.takeUnusedPageOutsideExtents(); found {
+		return pageId, nil
+	}
+
+	// reserving an extent allocates it up to its last page, so the page after the last allocated page is never in a reserved extent.
+	pageId := metadata.MaxAllocatedPageId + 1
+
+	if err := grow(pageId); err != nil {
+		return 0, err
+	}
+
+	metadata.MaxAllocatedPageId = pageId
+
+	return pageId, nil
+}
+
+// takeUnusedPageOutsideExtents removes the lowest unused page outside the reserved extents, and returns it.
+func (allocator *extentAllocator) takeUnusedPageOutsideExtents() (uint64, bool) {
+
+	pageId := uint64(0)
+
+	for unusedPageId := range allocator.unusedPages {
+
+		if _, reserved := allocator.owners[extentOf(unusedPageId)]; !reserved && (pageId == 0 || unusedPageId < pageId) {
+			pageId = unusedPageId
+		}
+	}
+
+	if pageId == 0 {
+		return 0, false
+	}
+
+	delete(allocator.unusedPages, pageId)
+
+	return pageId, true
+}
+
+// allocatePageNear allocates a page for a B+ tree as close as possible after hintPageId, in an extent reserved by the B+ tree.
+// The extent holding hintPageId is reserved for the B+ tree if no other B+ tree reserved it. If none of the extents of the B+ tree
+// have a deallocated page, a new extent is reserved. hintPageId = 0 allocates a page in any extent of the B+ tree, and if none of them
+// have a deallocated page, the page is allocated outside extents, so a B+ tree holding a few keys never reserves a whole extent.
+func (allocator *extentAllocator) allocatePageNear(metadata *codec.MetaData, hintPageId uint64, owner uint64, grow func(maxPageId uint64) error) (uint64, error) {
+
+	if hintPageId != 0 && hintPageId <= metadata.MaxAllocatedPageId {
+
+		extent := extentOf(hintPageId)
+
+		if _, reserved := allocator.owners[extent]; !reserved {
+
+			if err := allocator.reserve(metadata, extent, owner, grow); err != nil {
+				return 0, err
+			}
+		}
+
+		if allocator.owners[extent] == owner {
+
+			if pageId, found := allocator.takeDeallocatedPageInExtent(metadata, extent, hintPageId); found {
+				return pageId, nil
+			}
+		}
+	}
+
+	for _, extent := range allocator.extents[owner] {
+
+		if pageId, found := allocator.takeDeallocatedPageInExtent(metadata, extent, 0); found {
+			return pageId, nil
+		}
+	}
+
+	if hintPageId == 0 {
+		return allocator.allocatePage(metadata, grow)
+	}
+
+	extent, err := allocator.reserveNewExtent(metadata, owner, grow)
+
+	if err != nil {
+		return 0, err
+	}
+
+	pageId, _ := allocator.takeDeallocatedPageInExtent(metadata, extent, 0)
+
+	return pageId, nil
+}
+
+// takeDeallocatedPageInExtent removes the deallocated or unused page of an extent closest after hintPageId, and returns it.
+// If no deallocated or unused page of the extent comes after hintPageId, the first one of the extent is returned.
+func (allocator *extentAllocator) takeDeallocatedPageInExtent(metadata *codec.MetaData, extent uint64, hintPageId uint64) (uint64, bool) {
+
+	index := -1
+	pageId := uint64(0)
+
+	// pages after the hint are preferred, then lower page IDs.
+	isBetter := func(candidate uint64) bool {
+
+		if pageId == 0 {
+			return true
+		}
+
+		if (candidate > hintPageId) != (pageId > hintPageId) {
+			return candidate > hintPageId
+		}
+
+		return candidate < pageId
+	}
+
+	for i, deallocatedPageId := range metadata.DeallocatedPageIdList {
+
+		if extentOf(deallocatedPageId) == extent && isBetter(deallocatedPageId) {
+			index = i
+			pageId = deallocatedPageId
+		}
+	}
+
+	firstPageId, lastPageId := extentPages(extent)
+
+	for unusedPageId := firstPageId; unusedPageId <= lastPageId; unusedPageId++ {
+
+		if allocator.unusedPages[unusedPageId] && isBetter(unusedPageId) {
+			index = -1
+			pageId = unusedPageId
+		}
+	}
+
+	if pageId == 0 {
+		return 0, false
+	}
+
+	if index == -1 {
+		delete(allocator.unusedPages, pageId)
+	} else {
+		metadata.DeallocatedPageIdList = slices.Delete(metadata.DeallocatedPageIdList, index, index+1)
+	}
+
+	return pageId, true
+}
+
+// reserveNewExtent reserves an unreserved extent whose pages are all deallocated, otherwise it reserves the first extent after the last allocated page.
+func (allocator *extentAllocator) reserveNewExtent(metadata *codec.MetaData, owner uint64, grow func(maxPageId uint64) error) (uint64, error) {
+
+	deallocatedPages := make(map[uint64]int)
+
+	for _, pageId := range metadata.DeallocatedPageIdList {
+		deallocatedPages[extentOf(pageId)]++
+	}
+
+	freeExtents := make([]uint64, 0)
+
+	for extent, count := range deallocatedPages {
+
+		if _, reserved := allocator.owners[extent]; !reserved && count == EXTENT_SIZE {
+			freeExtents = append(freeExtents, extent)
+		}
+	}
+
+	if len(freeExtents) > 0 {
+
+		extent := slices.Min(freeExtents)
+
+		return extent, allocator.reserve(metadata, extent, owner, grow)
+	}
+
+	// the extent holding the last allocated page may hold pages of other B+ trees, so the next extent is reserved.
+	extent := (metadata.MaxAllocatedPageId + EXTENT_SIZE - 1) / EXTENT_SIZE
+
+	return extent, allocator.reserve(metadata, extent, owner, grow)
+}
+
+// reserve records an extent as reserved by a B+ tree. If the extent ends after the last allocated page, the file is grown to hold it,
+// and the pages up to the end of the extent are allocated, and recorded as unused. The unused pages before the extent
+// are reused by pages allocated outside extents.
+func (allocator *extentAllocator) reserve(metadata *codec.MetaData, extent uint64, owner uint64, grow func(maxPageId uint64) error) error {
+
+	_, lastPageId := extentPages(extent)
+
+	if lastPageId > metadata.MaxAllocatedPageId {
+
+		if err := grow(lastPageId); err != nil {
+			return err
+		}
+
+		for pageId := metadata.MaxAllocatedPageId + 1; pageId <= lastPageId; pageId++ {
+			allocator.unusedPages[pageId] = true
+		}
+
+		metadata.MaxAllocatedPageId = lastPageId
+	}
+
+	allocator.owners[extent] = owner
+
+	extents := allocator.extents[owner]
+	index, _ := slices.BinarySearch(extents, extent)
+	allocator.extents[owner] = slices.Insert(extents, index, extent)
+
+	return nil
+}
+
+// release drops the reservations of extents ending after the last allocated page, once the end of the file is truncated.
+func (allocator *extentAllocator) release(metadata *codec.MetaData) {
+
+	for extent, owner := range allocator.owners {
+
+		if _, lastPageId := extentPages(extent); lastPageId <= metadata.MaxAllocatedPageId {
+			continue
+		}
+
+		delete(allocator.owners, extent)
+
+		allocator.extents[owner] = slices.DeleteFunc(allocator.extents[owner], func(e uint64) bool {
+			return e == extent
+		})
+	}
+}
+
+// freeUnusedPages moves the unused pages of the reserved extents to the free list, before the end of the file is truncated,
+// or pages are taken from the free list regardless of their extent.
+func (allocator *extentAllocator) freeUnusedPages(metadata *codec.MetaData) {
+
+	metadata.DeallocatedPageIdList = append(metadata.DeallocatedPageIdList, slices.Sorted(maps.Keys(allocator.unusedPages))...)
+
+	clear(allocator.unusedPages)
+}
+
+// savedMetaData returns the metadata to write to the metadata page. The unused pages at the end of the file are left out,
+// lowering the max allocated page ID, and the other unused pages are saved in the free list.
+func (allocator *extentAllocator) savedMetaData(metadata *codec.MetaData) *codec.MetaData {
+
+	if len(allocator.unusedPages) == 0 {
+		return metadata
+	}
+
+	saved := *metadata
+
+	for saved.MaxAllocatedPageId > 0 && allocator.unusedPages[saved.MaxAllocatedPageId] {
+		saved.MaxAllocatedPageId--
+	}
+
+	saved.DeallocatedPageIdList = slices.Clone(metadata.DeallocatedPageIdList)
+
+	for _, pageId := range slices.Sorted(maps.Keys(allocator.unusedPages)) {
+
+		if pageId < saved.MaxAllocatedPageId {
+			saved.DeallocatedPageIdList = append(saved.DeallocatedPageIdList, pageId)
+		}
+	}
+
+	return &saved
+}
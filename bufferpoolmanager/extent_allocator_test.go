@@ -0,0 +1,104 @@
+package bufferpoolmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtentAllocation(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "extent_test_file")
+
+	disk, _, _, err := NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+
+	bufferPool, err := NewSimpleBufferPoolManager(4, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	newPageNear := func(hintPageId uint64, owner uint64) uint64 {
+
+		pageId, err := bufferPool.NewPageNear(hintPageId, owner)
+		require.NoError(t, err)
+		return pageId
+	}
+
+	// the first page of a B+ tree is allocated outside extents, so B+ trees holding a few keys don't reserve a whole extent each.
+	assert.Equal(t, uint64(1), newPageNear(0, 1))
+	assert.Equal(t, uint64(2), newPageNear(0, 2))
+
+	// the extent holding the hint is reserved by the first B+ tree, so the second B+ tree reserves the next extent, pages 17 to 32.
+	assert.Equal(t, uint64(3), newPageNear(1, 1))
+	assert.Equal(t, uint64(17), newPageNear(2, 2))
+
+	// pages allocated outside extents never come from a reserved extent.
+	pageId, err := bufferPool.NewPage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(33), pageId)
+
+	for i := uint64(4); i <= 16; i++ {
+		assert.Equal(t, i, newPageNear(i-1, 1))
+	}
+
+	// the extent of the first B+ tree is full, so the extent after the last allocated page is reserved,
+	// leaving pages 34 to 48 for pages allocated outside extents.
+	assert.Equal(t, uint64(49), newPageNear(16, 1))
+
+	fileStats, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(65*PAGE_SIZE), fileStats.Size())
+
+	pageId, err = bufferPool.NewPage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(34), pageId)
+
+	// a hint in the extent of another B+ tree allocates a page in an extent of the B+ tree.
+	assert.Equal(t, uint64(50), newPageNear(17, 1))
+
+	// the unused pages of the reserved extents aren't deallocated pages.
+	maxAllocatedPageId, deallocatedPages := bufferPool.AllocatedPages()
+	assert.Equal(t, uint64(64), maxAllocatedPageId)
+	assert.Equal(t, 64-21, deallocatedPages)
+
+	require.NoError(t, bufferPool.Close())
+
+	// reservations aren't persisted. The unused pages before the last allocated page are saved in the free list,
+	// the ones after it are left out of the metadata, but they are still in the file.
+	disk, metadata, _, err := NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(50), metadata.MaxAllocatedPageId)
+	assert.Len(t, metadata.DeallocatedPageIdList, 50-21)
+
+	bufferPool, err = NewSimpleBufferPoolManager(4, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	defer bufferPool.Close()
+
+	pageId, err = bufferPool.NewPage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(18), pageId)
+
+	// the deallocated page closest after the hint is allocated.
+	assert.Equal(t, uint64(41), newPageNear(40, 3))
+
+	// an extent whose pages are all deallocated is reserved before the file grows.
+	for pageId := uint64(1); pageId <= 16; pageId++ {
+		bufferPool.CleanupPage(pageId)
+	}
+
+	assert.Equal(t, uint64(1), newPageNear(41, 4))
+
+	// the pages left out of the metadata are reused when the extent holding them is reserved, without growing the file.
+	assert.Equal(t, uint64(51), newPageNear(50, 5))
+
+	fileStats, err = os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(65*PAGE_SIZE), fileStats.Size())
+
+	maxAllocatedPageId, _ = bufferPool.AllocatedPages()
+	assert.Equal(t, uint64(64), maxAllocatedPageId)
+}
@@ -0,0 +1,598 @@
+package bufferpoolmanager
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+)
+
+// size of the units a torn write is split into. A write interrupted by a crash leaves each sector either
+// completely written or not written at all, in no particular order.
+const TORN_WRITE_SECTOR_SIZE = 512
+
+// ErrInjectedFault is wrapped by the errors of reads and writes failed by a FaultInjectingDiskManager.
+var ErrInjectedFault = errors.New("injected fault")
+
+// ErrSimulatedCrash is returned by every operation of a FaultInjectingDiskManager once it has crashed.
+var ErrSimulatedCrash = errors.New("simulated crash")
+
+type FaultType int
+
+const (
+	// FaultReadError fails a read without reading anything.
+	FaultReadError FaultType = iota
+
+	// FaultWriteError fails a write without writing anything.
+	FaultWriteError
+
+	// FaultShortWrite writes the first few sectors of the data, then fails the write.
+	FaultShortWrite
+
+	// FaultTornWrite crashes the disk while the data is being written, leaving a random subset of its sectors written.
+	FaultTornWrite
+
+	// FaultCrash crashes the disk before the data is written.
+	FaultCrash
+)
+
+func (faultType FaultType) String() string {
+
+	switch faultType {
+	case FaultReadError:
+		return "read error"
+	case FaultWriteError:
+		return "write error"
+	case FaultShortWrite:
+		return "short write"
+	case FaultTornWrite:
+		return "torn write"
+	case FaultCrash:
+		return "crash"
+	default:
+		return fmt.Sprintf("FaultType(%d)", int(faultType))
+	}
+}
+
+// Fault schedules a fault on a particular read or write. Reads and writes are numbered separately, starting from 1,
+// and every page read by readPages or written by writePages is numbered as a separate read or write.
+type Fault struct {
+	Type FaultType
+
+	// number of the read that fails for FaultReadError, or of the write that fails for every other fault type.
+	Operation uint64
+}
+
+// FaultConfig sets the probability of a read or write failing, on top of the scheduled faults.
+type FaultConfig struct {
+	ReadErrorRate  float64
+	WriteErrorRate float64
+	ShortWriteRate float64
+}
+
+// discarder is implemented by disk managers that can be closed without writing anything, the way a crash would leave them.
+type discarder interface {
+	discard() error
+}
+
+// undoRecord stores the contents of a region of the disk before it was first written after the last sync.
+type undoRecord struct {
+	offset int64
+
+	// nil if the region couldn't be read, because it was past the end of the disk.
+	data []byte
+	size int
+}
+
+// FaultInjectingDiskManager wraps a disk manager, failing reads and writes at scheduled points, or at random.
+// Random faults, and the sectors left by short and torn writes, are chosen by a random number generator created from a seed,
+// so a test performing the same operations with the same seed sees the same faults.
+//
+// Writes are durable once sync returns. A crash undoes every write since the last sync, then closes the wrapped disk manager
+// without writing its metadata page if it is file based, so the database file can be reopened to test recovery.
+// Operations are serialized, so faults are injected in the order the operations are performed.
+type FaultInjectingDiskManager struct {
+	disk DiskManager
+
+	mutex *sync.Mutex
+
+	random *rand.Rand
+	config FaultConfig
+
+	// scheduled faults, by the number of the read or write they fail.
+	readFaults  map[uint64]FaultType
+	writeFaults map[uint64]FaultType
+
+	// number of reads and writes performed so far.
+	reads  uint64
+	writes uint64
+
+	// contents of the regions written since the last sync, in the order they were written.
+	undoLog []undoRecord
+
+	crashed bool
+}
+
+// NewFaultInjectingDiskManager wraps disk, injecting faults chosen using seed. No faults are injected until they are scheduled or configured.
+func NewFaultInjectingDiskManager(disk DiskManager, seed int64) *FaultInjectingDiskManager {
+
+	return &FaultInjectingDiskManager{
+		disk:        disk,
+		mutex:       &sync.Mutex{},
+		random:      rand.New(rand.NewSource(seed)),
+		readFaults:  make(map[uint64]FaultType),
+		writeFaults: make(map[uint64]FaultType),
+	}
+}
+
+// ScheduleFault makes a particular read or write fail. FaultReadError is the only fault type that can be scheduled on a read.
+func (disk *FaultInjectingDiskManager) ScheduleFault(fault Fault) error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if fault.Type < FaultReadError || fault.Type > FaultCrash {
+		return fmt.Errorf("unknown fault type %d", int(fault.Type))
+	}
+
+	if fault.Type == FaultReadError {
+		disk.readFaults[fault.Operation] = fault.Type
+	} else {
+		disk.writeFaults[fault.Operation] = fault.Type
+	}
+
+	return nil
+}
+
+// SetFaultConfig changes the probability of a read or write failing.
+func (disk *FaultInjectingDiskManager) SetFaultConfig(config FaultConfig) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	disk.config = config
+}
+
+// ClearFaults removes the scheduled faults, and stops random faults from being injected.
+func (disk *FaultInjectingDiskManager) ClearFaults() {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	disk.config = FaultConfig{}
+	clear(disk.readFaults)
+	clear(disk.writeFaults)
+}
+
+// Operations returns the number of reads and writes performed so far, used to schedule faults on the next few operations.
+func (disk *FaultInjectingDiskManager) Operations() (reads uint64, writes uint64) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.reads, disk.writes
+}
+
+// Crashed returns true once the disk has crashed.
+func (disk *FaultInjectingDiskManager) Crashed() bool {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.crashed
+}
+
+// Crash undoes every write since the last sync, and closes the wrapped disk manager without writing its metadata page.
+func (disk *FaultInjectingDiskManager) Crash() error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return nil
+	}
+
+	return disk.crash(0, nil)
+}
+
+// crash undoes every write since the last sync, then writes tornData, the part of the write interrupted by the crash that reached the disk.
+// Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) crash(tornOffset int64, tornData []byte) error {
+
+	fmt.Println()
+	slog.Warn("Simulating crash", "undoneWrites", len(disk.undoLog), "tornWrite", tornData != nil, "function", "crash", "at", "FaultInjectingDiskManager")
+
+	disk.crashed = true
+
+	undoLog := disk.undoLog
+	disk.undoLog = nil
+
+	for i := len(undoLog) - 1; i >= 0; i-- {
+
+		record := undoLog[i]
+
+		data := record.data
+
+		if data == nil {
+			data = AllocateAlignedBuffer(record.size)
+		}
+
+		if err := disk.disk.write(record.offset, data); err != nil {
+			return err
+		}
+	}
+
+	if tornData != nil {
+		if err := disk.disk.write(tornOffset, tornData); err != nil {
+			return err
+		}
+	}
+
+	if discarder, ok := disk.disk.(discarder); ok {
+		return discarder.discard()
+	}
+
+	return nil
+}
+
+// nextReadFault returns the fault injected into the next read, if any. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) nextReadFault() (FaultType, bool) {
+
+	disk.reads++
+
+	// a random number is drawn for every read, so the faults chosen for later reads don't depend on the scheduled faults.
+	random := disk.random.Float64()
+
+	if faultType, scheduled := disk.readFaults[disk.reads]; scheduled {
+		delete(disk.readFaults, disk.reads)
+		return faultType, true
+	}
+
+	return FaultReadError, random < disk.config.ReadErrorRate
+}
+
+// nextWriteFault returns the fault injected into the next write, if any. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) nextWriteFault() (FaultType, bool) {
+
+	disk.writes++
+
+	random := disk.random.Float64()
+
+	if faultType, scheduled := disk.writeFaults[disk.writes]; scheduled {
+		delete(disk.writeFaults, disk.writes)
+		return faultType, true
+	}
+
+	if random < disk.config.WriteErrorRate {
+		return FaultWriteError, true
+	}
+
+	return FaultShortWrite, random < disk.config.WriteErrorRate+disk.config.ShortWriteRate
+}
+
+func (disk *FaultInjectingDiskManager) write(offset int64, data []byte) error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.writeLocked(offset, data)
+}
+
+// writeLocked writes data to the wrapped disk manager, unless a fault is injected. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) writeLocked(offset int64, data []byte) error {
+
+	if disk.crashed {
+		return ErrSimulatedCrash
+	}
+
+	faultType, injected := disk.nextWriteFault()
+
+	if injected {
+		fmt.Println()
+		slog.Warn("Injecting fault", "fault", faultType.String(), "write", disk.writes, "offset", offset, "function", "write", "at", "FaultInjectingDiskManager")
+	}
+
+	if !injected {
+
+		disk.recordUndo(offset, len(data))
+		return disk.disk.write(offset, data)
+	}
+
+	switch faultType {
+
+	case FaultWriteError:
+		return fmt.Errorf("%w: write of %d bytes at offset %d failed", ErrInjectedFault, len(data), offset)
+
+	case FaultShortWrite:
+
+		numSectors := (len(data) + TORN_WRITE_SECTOR_SIZE - 1) / TORN_WRITE_SECTOR_SIZE
+
+		// at least the last sector is left unwritten.
+		writtenSectors := disk.random.Intn(numSectors)
+
+		written := func(sector int) bool { return sector < writtenSectors }
+
+		partialData, err := disk.partialWrite(offset, data, written)
+
+		if err != nil {
+			return err
+		}
+
+		disk.recordUndo(offset, len(data))
+
+		if err := disk.disk.write(offset, partialData); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: short write of %d out of %d bytes at offset %d", ErrInjectedFault, min(writtenSectors*TORN_WRITE_SECTOR_SIZE, len(data)), len(data), offset)
+
+	case FaultTornWrite:
+
+		numSectors := (len(data) + TORN_WRITE_SECTOR_SIZE - 1) / TORN_WRITE_SECTOR_SIZE
+
+		// a random subset of the sectors reaches the disk, leaving at least one sector written and one unwritten if there are two or more.
+		writtenSectors := make(map[int]bool)
+
+		for i, sector := range disk.random.Perm(numSectors) {
+			writtenSectors[sector] = i < max(numSectors/2, 1) && numSectors > 1
+		}
+
+		tornData, err := disk.partialWrite(offset, data, func(sector int) bool { return writtenSectors[sector] })
+
+		if err != nil {
+			return err
+		}
+
+		if err := disk.crash(offset, tornData); err != nil {
+			return err
+		}
+
+		return ErrSimulatedCrash
+
+	default:
+
+		if err := disk.crash(0, nil); err != nil {
+			return err
+		}
+
+		return ErrSimulatedCrash
+	}
+}
+
+// partialWrite returns the region being written, with the sectors for which written returns true replaced by the sectors of data.
+// The whole region is written, since disk managers using Direct I/O can only write whole pages. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) partialWrite(offset int64, data []byte, written func(sector int) bool) ([]byte, error) {
+
+	partialData := AllocateAlignedBuffer(len(data))
+
+	if previous, err := disk.disk.read(offset, len(data)); err == nil {
+		copy(partialData, previous)
+	}
+
+	for start := 0; start < len(data); start += TORN_WRITE_SECTOR_SIZE {
+
+		if written(start / TORN_WRITE_SECTOR_SIZE) {
+
+			end := min(start+TORN_WRITE_SECTOR_SIZE, len(data))
+			copy(partialData[start:end], data[start:end])
+		}
+	}
+
+	return partialData, nil
+}
+
+// recordUndo saves the contents of a region before it is written, so a crash can undo the write. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) recordUndo(offset int64, size int) {
+
+	record := undoRecord{offset: offset, size: size}
+
+	if previous, err := disk.disk.read(offset, size); err == nil {
+		record.data = previous
+	}
+
+	disk.undoLog = append(disk.undoLog, record)
+}
+
+func (disk *FaultInjectingDiskManager) read(offset int64, size int) ([]byte, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.readLocked(offset, size)
+}
+
+// readLocked reads from the wrapped disk manager, unless a fault is injected. Caller must hold the mutex.
+func (disk *FaultInjectingDiskManager) readLocked(offset int64, size int) ([]byte, error) {
+
+	if disk.crashed {
+		return nil, ErrSimulatedCrash
+	}
+
+	if _, injected := disk.nextReadFault(); injected {
+
+		fmt.Println()
+		slog.Warn("Injecting fault", "fault", FaultReadError.String(), "read", disk.reads, "offset", offset, "function", "read", "at", "FaultInjectingDiskManager")
+
+		return nil, fmt.Errorf("%w: read of %d bytes at offset %d failed", ErrInjectedFault, size, offset)
+	}
+
+	return disk.disk.read(offset, size)
+}
+
+// readPages reads the pages one at a time, so a fault can be injected into the read of any page.
+func (disk *FaultInjectingDiskManager) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	pageSize := disk.disk.getPageSize()
+
+	for i, pageId := range pageIds {
+
+		data, err := disk.readLocked(int64(pageId)*int64(pageSize), len(buffers[i]))
+
+		if err != nil {
+			return err
+		}
+
+		copy(buffers[i], data)
+	}
+
+	return nil
+}
+
+// writePages writes the pages one at a time, so a fault can be injected into the write of any page.
+func (disk *FaultInjectingDiskManager) writePages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	pageSize := disk.disk.getPageSize()
+
+	for i, pageId := range pageIds {
+
+		if err := disk.writeLocked(int64(pageId)*int64(pageSize), buffers[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (disk *FaultInjectingDiskManager) getPageSize() int {
+	return disk.disk.getPageSize()
+}
+
+// reservedPageSpace hides the same space at the end of every page as the wrapped disk manager.
+func (disk *FaultInjectingDiskManager) reservedPageSpace() int {
+
+	if reserver, ok := disk.disk.(pageSpaceReserver); ok {
+		return reserver.reservedPageSpace()
+	}
+
+	return 0
+}
+
+func (disk *FaultInjectingDiskManager) allocatePage() (uint64, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return 0, ErrSimulatedCrash
+	}
+
+	return disk.disk.allocatePage()
+}
+
+func (disk *FaultInjectingDiskManager) allocatePageNear(hintPageId uint64, owner uint64) (uint64, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return 0, ErrSimulatedCrash
+	}
+
+	return disk.disk.allocatePageNear(hintPageId, owner)
+}
+
+func (disk *FaultInjectingDiskManager) deallocatePage(pageId uint64) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return
+	}
+
+	disk.disk.deallocatePage(pageId)
+}
+
+func (disk *FaultInjectingDiskManager) allocatePageBelow(limit uint64) (uint64, bool) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return 0, false
+	}
+
+	return disk.disk.allocatePageBelow(limit)
+}
+
+func (disk *FaultInjectingDiskManager) allocatedPages() (uint64, int) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.disk.allocatedPages()
+}
+
+// shrink commits the metadata page like sync, so the writes made before it are no longer undone by a crash.
+func (disk *FaultInjectingDiskManager) shrink() (int, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return 0, ErrSimulatedCrash
+	}
+
+	releasedPages, err := disk.disk.shrink()
+
+	if err != nil {
+		return 0, err
+	}
+
+	disk.undoLog = nil
+
+	return releasedPages, nil
+}
+
+// sync commits the writes made since the last sync, so they are no longer undone by a crash.
+func (disk *FaultInjectingDiskManager) sync() error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return ErrSimulatedCrash
+	}
+
+	if err := disk.disk.sync(); err != nil {
+		return err
+	}
+
+	disk.undoLog = nil
+
+	return nil
+}
+
+func (disk *FaultInjectingDiskManager) setSyncConfig(config SyncConfig) error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return ErrSimulatedCrash
+	}
+
+	return disk.disk.setSyncConfig(config)
+}
+
+// close closes the wrapped disk manager. Once the disk has crashed, the wrapped disk manager has already been closed.
+func (disk *FaultInjectingDiskManager) close() error {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if disk.crashed {
+		return nil
+	}
+
+	disk.undoLog = nil
+
+	return disk.disk.close()
+}
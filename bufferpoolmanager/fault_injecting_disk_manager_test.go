@@ -0,0 +1,238 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FaultInjectionTestSuite struct {
+	suite.Suite
+	bufferPool *SimpleBufferPoolManager
+	disk       *FaultInjectingDiskManager
+
+	// disk manager wrapped by the fault injecting disk manager, used to check what reached the disk.
+	memoryDisk *MemoryDiskManager
+}
+
+func (fs *FaultInjectionTestSuite) SetupTest() {
+
+	fs.memoryDisk, _ = NewMemoryDiskManager()
+
+	// pages 1 to 6 store createPage(100), createPage(200) and so on.
+	for i := 1; i <= 6; i++ {
+
+		pageId, err := fs.memoryDisk.allocatePage()
+		fs.Require().NoError(err)
+		fs.Require().NoError(fs.memoryDisk.write(int64(pageId)*PAGE_SIZE, createPage(i*100)))
+	}
+
+	fs.disk = NewFaultInjectingDiskManager(fs.memoryDisk, 1)
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, PAGE_SIZE, NewLRUReplacer(), fs.disk)
+	fs.Require().NoError(err)
+
+	fs.bufferPool = bufferPool
+}
+
+func (fs *FaultInjectionTestSuite) TearDownTest() {
+
+	fs.disk.ClearFaults()
+	_ = fs.bufferPool.Close()
+}
+
+// scheduleNext schedules a fault on the next read or write.
+func (fs *FaultInjectionTestSuite) scheduleNext(faultType FaultType) {
+
+	reads, writes := fs.disk.Operations()
+
+	operation := writes + 1
+
+	if faultType == FaultReadError {
+		operation = reads + 1
+	}
+
+	fs.Require().NoError(fs.disk.ScheduleFault(Fault{Type: faultType, Operation: operation}))
+}
+
+func (fs *FaultInjectionTestSuite) dirtyPage(pageId uint64, start int) {
+
+	guard, err := fs.bufferPool.NewWriteGuard(pageId)
+	fs.Require().NoError(err)
+
+	copy(guard.GetPageData(), createPage(start))
+	guard.SetDirtyFlag()
+	guard.Done()
+}
+
+func (fs *FaultInjectionTestSuite) pageOnDisk(pageId uint64) []byte {
+
+	data, err := fs.memoryDisk.read(int64(pageId)*PAGE_SIZE, PAGE_SIZE)
+	fs.Require().NoError(err)
+
+	return data
+}
+
+// writtenSectors returns the number of sectors of a page on disk that match the sectors of newPage.
+func (fs *FaultInjectionTestSuite) writtenSectors(pageId uint64, newPage []byte) int {
+
+	page := fs.pageOnDisk(pageId)
+	written := 0
+
+	for start := 0; start < PAGE_SIZE; start += TORN_WRITE_SECTOR_SIZE {
+
+		if string(page[start:start+TORN_WRITE_SECTOR_SIZE]) == string(newPage[start:start+TORN_WRITE_SECTOR_SIZE]) {
+			written++
+		}
+	}
+
+	return written
+}
+
+func (fs *FaultInjectionTestSuite) TestReadError() {
+
+	fs.scheduleNext(FaultReadError)
+
+	_, err := fs.bufferPool.NewReadGuard(1)
+	fs.Assert().ErrorIs(err, ErrInjectedFault)
+
+	// the frame the page was being read into is released, so every frame can still be used.
+	guards := make([]*ReadGuard, 0)
+
+	for pageId := uint64(1); pageId <= 3; pageId++ {
+
+		guard, err := fs.bufferPool.NewReadGuard(pageId)
+		fs.Require().NoError(err)
+		fs.Assert().True(checkPage(int(pageId)*100, guard.GetPageData()))
+
+		guards = append(guards, guard)
+	}
+
+	for _, guard := range guards {
+		guard.Done()
+	}
+}
+
+func (fs *FaultInjectionTestSuite) TestEvictionWriteError() {
+
+	for pageId := uint64(1); pageId <= 3; pageId++ {
+		fs.dirtyPage(pageId, int(pageId)*1000)
+	}
+
+	// page 1 is evicted to make room for page 4, but can't be written back.
+	fs.scheduleNext(FaultWriteError)
+
+	_, err := fs.bufferPool.NewReadGuard(4)
+	fs.Assert().ErrorIs(err, ErrInjectedFault)
+	fs.Assert().True(checkPage(100, fs.pageOnDisk(1)))
+
+	// the changes to the evicted page are kept in the buffer pool, and written by the next sync.
+	fs.Require().NoError(fs.bufferPool.Sync())
+
+	for pageId := uint64(1); pageId <= 3; pageId++ {
+		fs.Assert().True(checkPage(int(pageId)*1000, fs.pageOnDisk(pageId)))
+	}
+}
+
+func (fs *FaultInjectionTestSuite) TestShortWrite() {
+
+	fs.dirtyPage(1, 1000)
+
+	fs.scheduleNext(FaultShortWrite)
+
+	fs.Assert().ErrorIs(fs.bufferPool.Sync(), ErrInjectedFault)
+	fs.Assert().Less(fs.writtenSectors(1, createPage(1000)), PAGE_SIZE/TORN_WRITE_SECTOR_SIZE)
+
+	// the page stays dirty, so it is written again by the next sync.
+	fs.Require().NoError(fs.bufferPool.Sync())
+	fs.Assert().True(checkPage(1000, fs.pageOnDisk(1)))
+}
+
+func (fs *FaultInjectionTestSuite) TestCrash() {
+
+	fs.dirtyPage(1, 1000)
+	fs.Require().NoError(fs.bufferPool.Sync())
+
+	// page 2 is written to disk when it is evicted, after the sync.
+	fs.dirtyPage(2, 2000)
+	fs.readPages(4, 5, 6)
+
+	fs.Require().True(checkPage(2000, fs.pageOnDisk(2)))
+
+	fs.Require().NoError(fs.disk.Crash())
+	fs.Assert().True(fs.disk.Crashed())
+
+	// writes made before the sync survive the crash, writes made after it are undone.
+	fs.Assert().True(checkPage(1000, fs.pageOnDisk(1)))
+	fs.Assert().True(checkPage(200, fs.pageOnDisk(2)))
+
+	_, err := fs.bufferPool.NewReadGuard(1)
+	fs.Assert().ErrorIs(err, ErrSimulatedCrash)
+	fs.Assert().ErrorIs(fs.bufferPool.Sync(), ErrSimulatedCrash)
+}
+
+func (fs *FaultInjectionTestSuite) TestTornWrite() {
+
+	fs.dirtyPage(1, 1000)
+
+	fs.scheduleNext(FaultTornWrite)
+
+	fs.Assert().ErrorIs(fs.bufferPool.Sync(), ErrSimulatedCrash)
+	fs.Assert().True(fs.disk.Crashed())
+
+	// part of the page interrupted by the crash reached the disk.
+	writtenSectors := fs.writtenSectors(1, createPage(1000))
+
+	fs.Assert().Greater(writtenSectors, 0)
+	fs.Assert().Less(writtenSectors, PAGE_SIZE/TORN_WRITE_SECTOR_SIZE)
+}
+
+func (fs *FaultInjectionTestSuite) readPages(pageIds ...uint64) {
+
+	for _, pageId := range pageIds {
+
+		guard, err := fs.bufferPool.NewReadGuard(pageId)
+		fs.Require().NoError(err)
+		guard.Done()
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	suite.Run(t, new(FaultInjectionTestSuite))
+}
+
+func TestRandomFaultsAreDeterministic(t *testing.T) {
+
+	// failedOperations returns the outcome of a fixed sequence of reads and writes to a disk injecting faults chosen using seed.
+	failedOperations := func(seed int64) []bool {
+
+		memoryDisk, _ := NewMemoryDiskManager()
+
+		disk := NewFaultInjectingDiskManager(memoryDisk, seed)
+		disk.SetFaultConfig(FaultConfig{ReadErrorRate: 0.2, WriteErrorRate: 0.2, ShortWriteRate: 0.1})
+
+		failed := make([]bool, 0)
+
+		for i := range 50 {
+
+			err := disk.write(PAGE_SIZE, createPage(i))
+			failed = append(failed, err != nil)
+
+			_, err = disk.read(PAGE_SIZE, PAGE_SIZE)
+			failed = append(failed, err != nil)
+		}
+
+		return failed
+	}
+
+	assert.Equal(t, failedOperations(7), failedOperations(7))
+	assert.NotEqual(t, failedOperations(7), failedOperations(8))
+	assert.Contains(t, failedOperations(7), true)
+
+	memoryDisk, _ := NewMemoryDiskManager()
+	disk := NewFaultInjectingDiskManager(memoryDisk, 7)
+
+	require.Error(t, disk.ScheduleFault(Fault{Type: FaultCrash + 1, Operation: 1}))
+}
@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package bufferpoolmanager
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncFileData flushes the data of the file to stable storage. fdatasync also persists the file size,
+// but skips metadata, like the modification time, that isn't needed to read the data back.
+func syncFileData(file *os.File) error {
+
+	return unix.Fdatasync(int(file.Fd()))
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package bufferpoolmanager
+
+import "os"
+
+// syncFileData flushes the data of the file to stable storage. Platforms without fdatasync sync the file's metadata as well.
+func syncFileData(file *os.File) error {
+
+	return file.Sync()
+}
@@ -0,0 +1,154 @@
+package bufferpoolmanager
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// default number of accesses tracked per frame by the LRU-K replacer.
+const DEFAULT_LRU_K = 2
+
+// LRUKReplacer evicts the frame whose K-th most recent access is the oldest (the frame with the largest backward K-distance).
+// Frames accessed fewer than K times have an infinite backward K-distance, and are evicted first, in LRU order.
+// Pages touched once by a full scan are therefore evicted before pages that are accessed repeatedly, such as internal nodes.
+type LRUKReplacer struct {
+
+	// synchronizes access to the access history.
+	mutex *sync.Mutex
+
+	k int
+
+	// logical timestamp, incremented on every access.
+	currentTimestamp uint64
+
+	// timestamps of the last k accesses of each frame, oldest first.
+	// The history of a frame is kept while it is pinned, and discarded when it is evicted.
+	history map[FrameID][]uint64
+
+	// frames that are currently managed by the replacer.
+	evictable map[FrameID]struct{}
+}
+
+func NewLRUKReplacer(k int) *LRUKReplacer {
+
+	slog.Info("Creating new LRUKReplacer...", "k", k, "function", "NewLRUKReplacer", "at", "LRUKReplacer")
+	return &LRUKReplacer{
+		mutex:     &sync.Mutex{},
+		k:         k,
+		history:   make(map[FrameID][]uint64),
+		evictable: make(map[FrameID]struct{}),
+	}
+}
+
+// victim removes and returns the evictable frame with the largest backward K-distance.
+// Evictable frames are scanned linearly, which is cheap compared to the disk read that follows an eviction.
+func (replacer *LRUKReplacer) victim() (FrameID, bool) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	victimFrameId := FrameID(-1)
+	victimHasInfiniteDistance := false
+	victimTimestamp := uint64(0)
+
+	for frameId := range replacer.evictable {
+
+		history := replacer.history[frameId]
+
+		hasInfiniteDistance := len(history) < replacer.k
+
+		// history[0] is the k-th most recent access for frames with k accesses, and the least recent access for the others.
+		// Frames inserted cold have no history, and are treated as the least recently accessed.
+		timestamp := uint64(0)
+
+		if len(history) > 0 {
+			timestamp = history[0]
+		}
+
+		if victimFrameId == -1 ||
+			(hasInfiniteDistance && !victimHasInfiniteDistance) ||
+			(hasInfiniteDistance == victimHasInfiniteDistance && timestamp < victimTimestamp) {
+
+			victimFrameId = frameId
+			victimHasInfiniteDistance = hasInfiniteDistance
+			victimTimestamp = timestamp
+		}
+	}
+
+	if victimFrameId == -1 {
+		slog.Warn("No evictable frames", "function", "victim", "at", "LRUKReplacer")
+		return 0, false
+	}
+
+	delete(replacer.evictable, victimFrameId)
+	delete(replacer.history, victimFrameId)
+
+	slog.Info("Selecting victim frame...", "victim_frame", victimFrameId, "function", "victim", "at", "LRUKReplacer")
+	return victimFrameId, true
+}
+
+// insert records an access to the frame, and marks it as evictable.
+func (replacer *LRUKReplacer) insert(frameId FrameID) {
+
+	slog.Info("Inserting frame into LRUKReplacer...", "frame_ID", frameId, "function", "insert", "at", "LRUKReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.currentTimestamp++
+
+	history := append(replacer.history[frameId], replacer.currentTimestamp)
+
+	if len(history) > replacer.k {
+		history = history[len(history)-replacer.k:]
+	}
+
+	replacer.history[frameId] = history
+	replacer.evictable[frameId] = struct{}{}
+}
+
+// insertCold marks the frame as evictable without recording an access, so it has an infinite backward K-distance
+// and is evicted before every frame that has been accessed.
+func (replacer *LRUKReplacer) insertCold(frameId FrameID) {
+
+	slog.Info("Inserting cold frame into LRUKReplacer...", "frame_ID", frameId, "function", "insertCold", "at", "LRUKReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	if _, exists := replacer.history[frameId]; !exists {
+		replacer.history[frameId] = []uint64{}
+	}
+	replacer.evictable[frameId] = struct{}{}
+}
+
+// remove marks the frame as not evictable once its pin count > 0, its access history is kept.
+func (replacer *LRUKReplacer) remove(frameId FrameID) {
+
+	slog.Info("Removing frame from LRUKReplacer...", "frame_ID", frameId, "function", "remove", "at", "LRUKReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	delete(replacer.evictable, frameId)
+}
+
+// forget discards the access history of a frame whose page was deleted.
+func (replacer *LRUKReplacer) forget(frameId FrameID) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	delete(replacer.evictable, frameId)
+	delete(replacer.history, frameId)
+}
+
+// returns the number of frames currently managed by the replacer.
+func (replacer *LRUKReplacer) size() int {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	return len(replacer.evictable)
+}
+
+// the access history is kept per frame, so it doesn't depend on the pool size.
+func (replacer *LRUKReplacer) resize(numFrames int) {
+}
@@ -0,0 +1,79 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LRUKReplacerTestSuite struct {
+	suite.Suite
+	replacer *LRUKReplacer
+}
+
+func (rs *LRUKReplacerTestSuite) SetupTest() {
+
+	rs.replacer = NewLRUKReplacer(2)
+}
+
+func (rs *LRUKReplacerTestSuite) assertVictim(expectedFrameId FrameID) {
+
+	frameId, found := rs.replacer.victim()
+
+	rs.Require().True(found)
+	rs.Assert().Equal(expectedFrameId, frameId)
+}
+
+func (rs *LRUKReplacerTestSuite) TestLRUKReplacerPrefersFramesWithFewerThanKAccesses() {
+
+	// frames 1 and 2 are accessed twice, frame 3 is accessed once, after all of them
+	for _, frameId := range []FrameID{1, 2, 1, 2, 3} {
+		rs.replacer.remove(frameId)
+		rs.replacer.insert(frameId)
+	}
+
+	rs.assertVictim(FrameID(3))
+
+	// frame 1's second most recent access is older than frame 2's
+	rs.assertVictim(FrameID(1))
+	rs.assertVictim(FrameID(2))
+}
+
+func (rs *LRUKReplacerTestSuite) TestLRUKReplacerKeepsHistoryWhilePinned() {
+
+	rs.replacer.insert(1)
+	rs.replacer.insert(2)
+
+	rs.replacer.remove(1)
+	rs.replacer.insert(1)
+
+	rs.assertVictim(FrameID(2))
+
+	rs.replacer.forget(1)
+
+	rs.Assert().Equal(0, rs.replacer.size())
+	_, found := rs.replacer.victim()
+	rs.Assert().False(found)
+}
+
+func (rs *LRUKReplacerTestSuite) TestLRUKReplacerInsertCold() {
+
+	rs.replacer.insert(1)
+	rs.replacer.insert(2)
+	rs.replacer.insertCold(3)
+
+	rs.assertVictim(FrameID(3))
+
+	// the first access of a cold frame is recorded like any other access
+	rs.replacer.insertCold(4)
+	rs.replacer.remove(4)
+	rs.replacer.insert(4)
+
+	rs.Assert().Len(rs.replacer.history[4], 1)
+	rs.assertVictim(FrameID(1))
+}
+
+func TestLRUKReplacer(t *testing.T) {
+
+	suite.Run(t, new(LRUKReplacerTestSuite))
+}
@@ -2,6 +2,7 @@ package bufferpoolmanager
 
 import (
 	"container/list"
+	"fmt"
 	"log/slog"
 	"sync"
 )
@@ -10,16 +11,61 @@ import (
 type Replacer interface {
 
 	// victim selects a frame to evict based on the replacement policy.
-	victim() FrameID
+	// It returns false if the replacer doesn't manage any frames, which happens when all frames are pinned.
+	victim() (FrameID, bool)
 
 	// insert adds a frame to the replacer, marking it as a candidate for eviction.
 	insert(frameId FrameID)
 
+	// insertCold adds a frame holding a prefetched page that hasn't been accessed yet.
+	// The frame is placed where it is evicted first, and the insertion doesn't count as an access,
+	// so pages read ahead by a scan don't push out frequently accessed pages.
+	insertCold(frameId FrameID)
+
 	// remove eliminates a frame from the replacer, typically when the frame is pinned.
 	remove(frameId FrameID)
 
 	// size returns the current number of frames managed by the replacer.
 	size() int
+
+	// forget discards the access history of a frame, when the page stored in it is deleted.
+	forget(frameId FrameID)
+
+	// resize adapts the replacer to a pool of numFrames frames, with frame IDs 0 to numFrames - 1.
+	// Frames removed by shrinking the pool have already been removed from the replacer and forgotten.
+	resize(numFrames int)
+}
+
+// ReplacementPolicy names a Replacer implementation.
+type ReplacementPolicy string
+
+const (
+	LRUReplacementPolicy      ReplacementPolicy = "lru"
+	ClockReplacementPolicy    ReplacementPolicy = "clock"
+	LRUKReplacementPolicy     ReplacementPolicy = "lru-k"
+	TwoQueueReplacementPolicy ReplacementPolicy = "2q"
+)
+
+// NewReplacer creates a replacer implementing the given policy, for a buffer pool with poolSize frames.
+func NewReplacer(policy ReplacementPolicy, poolSize int) (Replacer, error) {
+
+	switch policy {
+
+	case LRUReplacementPolicy:
+		return NewLRUReplacer(), nil
+
+	case ClockReplacementPolicy:
+		return NewClockReplacer(poolSize), nil
+
+	case LRUKReplacementPolicy:
+		return NewLRUKReplacer(DEFAULT_LRU_K), nil
+
+	case TwoQueueReplacementPolicy:
+		return NewTwoQueueReplacer(poolSize), nil
+
+	default:
+		return nil, fmt.Errorf("unknown replacement policy %s", policy)
+	}
 }
 
 type LRUReplacer struct {
@@ -45,17 +91,22 @@ func NewLRUReplacer() *LRUReplacer {
 }
 
 // removes and returns the ID of the frame at the back of the list, which is the least recently accessed frame.
-func (replacer *LRUReplacer) victim() FrameID {
+func (replacer *LRUReplacer) victim() (FrameID, bool) {
 
 	replacer.mutex.Lock()
 	defer replacer.mutex.Unlock()
 
 	frameElement := replacer.list.Back()
+
+	if frameElement == nil {
+		slog.Warn("No evictable frames", "function", "victim", "at", "LRUReplacer")
+		return 0, false
+	}
 	frameId := FrameID(replacer.list.Remove(frameElement).(FrameID))
 
 	delete(replacer.frameMap, frameId)
 	slog.Info("Selecting victim frame...", "victim_frame", frameId, "function", "victim", "at", "LRUReplacer")
-	return frameId
+	return frameId, true
 }
 
 // inserts the frame ID at the front of the list, it becomes the most recently accessed frame.
@@ -69,6 +120,17 @@ func (replacer *LRUReplacer) insert(frameId FrameID) {
 	replacer.frameMap[frameId] = frameElement
 }
 
+// inserts the frame ID at the back of the list, it becomes the next victim.
+func (replacer *LRUReplacer) insertCold(frameId FrameID) {
+
+	slog.Info("Inserting cold frame into LRUReplacer...", "frame_ID", frameId, "function", "insertCold", "at", "LRUReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	frameElement := replacer.list.PushBack(frameId)
+	replacer.frameMap[frameId] = frameElement
+}
+
 // removes frame from the list once its pin count > 0.
 func (replacer *LRUReplacer) remove(frameId FrameID) {
 
@@ -89,3 +151,11 @@ func (replacer *LRUReplacer) size() int {
 
 	return len(replacer.frameMap)
 }
+
+// LRU keeps no access history for frames outside the list, so there is nothing to forget.
+func (replacer *LRUReplacer) forget(frameId FrameID) {
+}
+
+// the list grows and shrinks with the number of evictable frames, so it doesn't depend on the pool size.
+func (replacer *LRUReplacer) resize(numFrames int) {
+}
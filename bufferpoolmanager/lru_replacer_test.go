@@ -58,9 +58,19 @@ func (rs *LRUReplacerTestSuite) TestLRUReplacerInsert() {
 
 func (rs *LRUReplacerTestSuite) TestLRUReplacerVictim() {
 
-	victim := rs.replacer.victim()
+	victim, found := rs.replacer.victim()
 
+	rs.Suite.Assert().Equal(true, found)
 	rs.Suite.Assert().Equal(FrameID(5), victim)
+
+	rs.replacer.victim()
+	rs.replacer.victim()
+	rs.replacer.victim()
+
+	// all frames have been evicted
+	_, found = rs.replacer.victim()
+
+	rs.Suite.Assert().Equal(false, found)
 }
 
 func (rs *LRUReplacerTestSuite) TestLRUReplacerRemove() {
@@ -72,6 +82,17 @@ func (rs *LRUReplacerTestSuite) TestLRUReplacerRemove() {
 	rs.Suite.Assert().Equal(false, exists)
 }
 
+func (rs *LRUReplacerTestSuite) TestLRUReplacerInsertCold() {
+
+	rs.replacer.insertCold(9)
+
+	// frames inserted cold are evicted before every accessed frame
+	victim, found := rs.replacer.victim()
+
+	rs.Suite.Assert().Equal(true, found)
+	rs.Suite.Assert().Equal(FrameID(9), victim)
+}
+
 func TestLRUReplacer(t *testing.T) {
 
 	suite.Run(t, new(LRUReplacerTestSuite))
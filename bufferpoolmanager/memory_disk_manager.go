@@ -0,0 +1,244 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+// MemoryDiskManager keeps the pages of an ephemeral database in memory, nothing is written to disk.
+// The database is lost when it is closed, so it is used by tests, and by databases acting as caches.
+type MemoryDiskManager struct {
+
+	// pages of the database, the page with ID = x starts at offset (page size * x), like in a database file.
+	data      []byte
+	dataMutex *sync.RWMutex
+
+	// guards the free list in the metadata, and the extents reserved by B+ trees.
+	metadata *codec.MetaData
+	extents  *extentAllocator
+	mutex    *sync.Mutex
+
+	pageSize int
+
+	// set once the database is closed, and its pages are released.
+	closed bool
+}
+
+// NewMemoryDiskManager creates an empty in-memory database with the default page size.
+func NewMemoryDiskManager() (disk *MemoryDiskManager, metadata *codec.MetaData) {
+
+	disk, metadata, _ = NewMemoryDiskManagerWithPageSize(codec.DEFAULT_PAGE_SIZE)
+	return disk, metadata
+}
+
+// NewMemoryDiskManagerWithPageSize creates an empty in-memory database with pages of pageSize bytes.
+func NewMemoryDiskManagerWithPageSize(pageSize int) (disk *MemoryDiskManager, metadata *codec.MetaData, err error) {
+
+	if err := codec.ValidatePageSize(pageSize); err != nil {
+		return nil, nil, err
+	}
+
+	disk = &MemoryDiskManager{
+		// page 0 is reserved for the metadata page, which is never written, since the metadata is kept in memory.
+		data:      make([]byte, pageSize),
+		dataMutex: &sync.RWMutex{},
+		metadata:  newMetaData(pageSize),
+		extents:   newExtentAllocator(),
+		mutex:     &sync.Mutex{},
+		pageSize:  pageSize,
+	}
+
+	return disk, disk.metadata, nil
+}
+
+// write copies data to a particular offset, growing the database if data ends past its last page.
+func (disk *MemoryDiskManager) write(offset int64, data []byte) error {
+
+	disk.dataMutex.Lock()
+	defer disk.dataMutex.Unlock()
+
+	if disk.closed {
+		return fmt.Errorf("memory disk manager is closed")
+	}
+
+	if end := int(offset) + len(data); end > len(disk.data) {
+		disk.data = append(disk.data, make([]byte, end-len(disk.data))...)
+	}
+
+	copy(disk.data[offset:], data)
+
+	return nil
+}
+
+// read returns a copy of size bytes starting from a particular offset.
+func (disk *MemoryDiskManager) read(offset int64, size int) ([]byte, error) {
+
+	disk.dataMutex.RLock()
+	defer disk.dataMutex.RUnlock()
+
+	if disk.closed {
+		return nil, fmt.Errorf("memory disk manager is closed")
+	}
+
+	if int(offset)+size > len(disk.data) {
+		return nil, fmt.Errorf("incomplete read")
+	}
+
+	data := make([]byte, size)
+	copy(data, disk.data[offset:])
+
+	return data, nil
+}
+
+// readPages copies the pages with the given IDs into the given buffers, one page per buffer.
+func (disk *MemoryDiskManager) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.dataMutex.RLock()
+	defer disk.dataMutex.RUnlock()
+
+	if disk.closed {
+		return fmt.Errorf("memory disk manager is closed")
+	}
+
+	for i, pageId := range pageIds {
+
+		offset := int(pageId) * disk.pageSize
+
+		if offset+len(buffers[i]) > len(disk.data) {
+			return fmt.Errorf("incomplete read of page %d", pageId)
+		}
+
+		copy(buffers[i], disk.data[offset:])
+	}
+
+	return nil
+}
+
+// writePages copies the given buffers to the pages with the given IDs, one page per buffer.
+func (disk *MemoryDiskManager) writePages(pageIds []uint64, buffers [][]byte) error {
+
+	for i, pageId := range pageIds {
+
+		if err := disk.write(int64(pageId)*int64(disk.pageSize), buffers[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPageSize returns the size of the pages in the database.
+func (disk *MemoryDiskManager) getPageSize() int {
+	return disk.pageSize
+}
+
+// allocatePage reuses a deallocated page ID outside the extents reserved by B+ trees if available, otherwise it adds an empty page after the last allocated page.
+func (disk *MemoryDiskManager) allocatePage() (uint64, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.extents.allocatePage(disk.metadata, disk.grow)
+}
+
+// allocatePageNear allocates a page for a B+ tree close to hintPageId, in an extent reserved by the B+ tree.
+func (disk *MemoryDiskManager) allocatePageNear(hintPageId uint64, owner uint64) (uint64, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.extents.allocatePageNear(disk.metadata, hintPageId, owner, disk.grow)
+}
+
+// grow adds empty pages to the end of the database until it holds the page with ID = maxPageId.
+func (disk *MemoryDiskManager) grow(maxPageId uint64) error {
+
+	disk.dataMutex.RLock()
+	numPages := uint64(len(disk.data) / disk.pageSize)
+	disk.dataMutex.RUnlock()
+
+	if maxPageId < numPages {
+		return nil
+	}
+
+	return disk.write(int64(numPages)*int64(disk.pageSize), make([]byte, int(maxPageId+1-numPages)*disk.pageSize))
+}
+
+// deallocatePage adds the page ID to the free list, making it available for future allocation.
+func (disk *MemoryDiskManager) deallocatePage(pageId uint64) {
+
+	disk.mutex.Lock()
+	disk.metadata.DeallocatedPageIdList = append(disk.metadata.DeallocatedPageIdList, pageId)
+	disk.mutex.Unlock()
+}
+
+// allocatePageBelow reuses the lowest deallocated page ID below limit.
+func (disk *MemoryDiskManager) allocatePageBelow(limit uint64) (uint64, bool) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	disk.extents.freeUnusedPages(disk.metadata)
+
+	return takeDeallocatedPageIdBelow(disk.metadata, limit)
+}
+
+// allocatedPages returns the greatest allocated page ID, and the number of deallocated or unused page IDs below it.
+func (disk *MemoryDiskManager) allocatedPages() (uint64, int) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	return disk.metadata.MaxAllocatedPageId, len(disk.metadata.DeallocatedPageIdList) + len(disk.extents.unusedPages)
+}
+
+// shrink releases the memory of the deallocated pages at the end of the database.
+func (disk *MemoryDiskManager) shrink() (int, error) {
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	disk.extents.freeUnusedPages(disk.metadata)
+	releasedPages := releaseTrailingPages(disk.metadata)
+	disk.extents.release(disk.metadata)
+
+	disk.dataMutex.Lock()
+	defer disk.dataMutex.Unlock()
+
+	if disk.closed {
+		return 0, fmt.Errorf("memory disk manager is closed")
+	}
+
+	size := int(disk.metadata.MaxAllocatedPageId+1) * disk.pageSize
+
+	if size < len(disk.data) {
+		disk.data = slices.Clip(disk.data[:size])
+	}
+
+	return releasedPages, nil
+}
+
+// sync does nothing, an in-memory database has nothing to make durable.
+func (disk *MemoryDiskManager) sync() error {
+	return nil
+}
+
+// setSyncConfig accepts any sync mode, since an in-memory database is never synced.
+func (disk *MemoryDiskManager) setSyncConfig(config SyncConfig) error {
+	return nil
+}
+
+// close releases the pages of the database. They can't be read or written afterwards.
+func (disk *MemoryDiskManager) close() error {
+
+	disk.dataMutex.Lock()
+	defer disk.dataMutex.Unlock()
+
+	disk.data = nil
+	disk.closed = true
+
+	return nil
+}
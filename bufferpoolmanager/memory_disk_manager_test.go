@@ -0,0 +1,95 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDiskManager(t *testing.T) {
+
+	_, _, err := NewMemoryDiskManagerWithPageSize(1000)
+	assert.Error(t, err)
+
+	disk, metadata := NewMemoryDiskManager()
+	assert.Equal(t, uint32(PAGE_SIZE), metadata.PageSize)
+
+	pageIds := make([]uint64, 0)
+
+	for range 3 {
+		pageId, err := disk.allocatePage()
+		require.NoError(t, err)
+		pageIds = append(pageIds, pageId)
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3}, pageIds)
+	assert.Equal(t, uint64(3), metadata.MaxAllocatedPageId)
+
+	// allocated pages are empty until they are written.
+	data, err := disk.read(3*PAGE_SIZE, PAGE_SIZE)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, PAGE_SIZE), data)
+
+	require.NoError(t, disk.writePages([]uint64{1, 2}, [][]byte{createPage(100), createPage(200)}))
+
+	buffers := [][]byte{make([]byte, PAGE_SIZE), make([]byte, PAGE_SIZE)}
+	require.NoError(t, disk.readPages([]uint64{2, 1}, buffers))
+
+	assert.True(t, checkPage(200, buffers[0]))
+	assert.True(t, checkPage(100, buffers[1]))
+
+	// pages past the last allocated page can't be read.
+	_, err = disk.read(4*PAGE_SIZE, PAGE_SIZE)
+	assert.Error(t, err)
+
+	disk.deallocatePage(2)
+
+	pageId, err := disk.allocatePage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), pageId)
+
+	require.NoError(t, disk.setSyncConfig(SyncConfig{Mode: SyncFull}))
+	require.NoError(t, disk.sync())
+
+	require.NoError(t, disk.close())
+
+	_, err = disk.read(PAGE_SIZE, PAGE_SIZE)
+	assert.Error(t, err)
+}
+
+func TestMemoryBufferPool(t *testing.T) {
+
+	disk, _ := NewMemoryDiskManager()
+
+	bufferPool, err := NewSimpleBufferPoolManager(3, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	pageIds := make([]uint64, 0)
+
+	// more pages than frames, so pages are evicted to memory, and read back from it.
+	for i := range 6 {
+
+		pageId, err := bufferPool.NewPage()
+		require.NoError(t, err)
+
+		guard, err := bufferPool.NewWriteGuard(pageId)
+		require.NoError(t, err)
+
+		copy(guard.GetPageData(), createPage(i))
+		guard.SetDirtyFlag()
+		guard.Done()
+
+		pageIds = append(pageIds, pageId)
+	}
+
+	for i, pageId := range pageIds {
+
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+		assert.True(t, checkPage(i, guard.GetPageData()))
+		guard.Done()
+	}
+
+	require.NoError(t, bufferPool.Close())
+}
@@ -0,0 +1,565 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+	"github.com/ncw/directio"
+)
+
+// migration upgrades a database file from one on-disk format version to the next.
+type migration struct {
+	fromVersion uint32
+	description string
+	migrate     func(disk *databaseFile) error
+}
+
+// migrations are applied in order of format version, each one upgrading the files written in the format of the previous one.
+// Changing the on-disk format means incrementing CURRENT_FORMAT_VERSION, and adding a migration from the previous version here.
+var migrations = []migration{
+	{
+		fromVersion: 0,
+		description: "store a superblock at the start of the metadata page",
+		migrate:     addSuperblock,
+	},
+	{
+		fromVersion: 1,
+		description: "store an expiry timestamp and a compression type in every leaf node element",
+		migrate:     upgradeLeafElements,
+	},
+}
+
+// MigrateDatabaseFile upgrades a database file written in an older on-disk format to CURRENT_FORMAT_VERSION, one version at a time.
+// keyProvider supplies the keys of an encrypted database, and is nil if the database isn't encrypted. The file must not be open.
+// It returns the format version of the file before it was upgraded, files already in the current format are left untouched.
+func MigrateDatabaseFile(filePath string, keyProvider KeyProvider) (fromVersion uint32, err error) {
+
+	fmt.Println()
+	slog.Info("Checking database file format version...", "filePath", filePath, "function", "MigrateDatabaseFile", "at", "databaseFile")
+
+	file, err := directio.OpenFile(filePath, os.O_RDWR, 0644)
+
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	disk := &databaseFile{
+		file:            file,
+		codec:           codec.DefaultMetaDataCodec(),
+		superblockCodec: codec.DefaultSuperblockCodec(),
+		mutex:           &sync.Mutex{},
+		directIO:        true,
+		syncer:          newFileSyncer(file),
+		extents:         newExtentAllocator(),
+	}
+
+	if keyProvider != nil {
+		disk.metadataCipher = newPageCipher(keyProvider)
+	}
+
+	if fromVersion, err = disk.readFormatVersion(); err != nil {
+		return 0, err
+	}
+
+	for version := fromVersion; version < codec.CURRENT_FORMAT_VERSION; {
+
+		step, found := findMigration(version)
+
+		if !found {
+			return fromVersion, fmt.Errorf("no migration from format version %d", version)
+		}
+
+		slog.Info("Migrating database file", "fromVersion", version, "migration", step.description, "function", "MigrateDatabaseFile", "at", "databaseFile")
+
+		if err := step.migrate(disk); err != nil {
+			return fromVersion, fmt.Errorf("failed to migrate database file from format version %d: %w", version, err)
+		}
+
+		if err := file.Sync(); err != nil {
+			return fromVersion, err
+		}
+
+		newVersion, err := disk.readFormatVersion()
+
+		if err != nil {
+			return fromVersion, err
+		}
+
+		if newVersion <= version {
+			return fromVersion, fmt.Errorf("migration from format version %d didn't upgrade the database file", version)
+		}
+
+		version = newVersion
+	}
+
+	slog.Info("Database file is in the current format", "fromVersion", fromVersion, "formatVersion", codec.CURRENT_FORMAT_VERSION, "function", "MigrateDatabaseFile", "at", "databaseFile")
+
+	return fromVersion, nil
+}
+
+func findMigration(fromVersion uint32) (migration, bool) {
+
+	for _, step := range migrations {
+		if step.fromVersion == fromVersion {
+			return step, true
+		}
+	}
+
+	return migration{}, false
+}
+
+// readFormatVersion returns the format version of the file, 0 if it doesn't start with a superblock.
+func (disk *databaseFile) readFormatVersion() (uint32, error) {
+
+	data, err := disk.read(METADATA_PAGE_ID, codec.MIN_PAGE_SIZE)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !disk.superblockCodec.HasSuperblock(data) {
+		return 0, nil
+	}
+
+	superblock, err := disk.superblockCodec.DecodeSuperblock(data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return superblock.FormatVersion, nil
+}
+
+// addSuperblock upgrades a version 0 file, whose metadata page starts with the metadata, by moving the metadata after a new superblock.
+// Version 0 files don't record when they were created, so the creation time in the superblock is the time of the upgrade.
+func addSuperblock(disk *databaseFile) error {
+
+	metadata, err := disk.readVersion0MetaDataPage()
+
+	if err != nil {
+		return err
+	}
+
+	// a file without a superblock may not be a database file at all, it is only rewritten if its metadata describes the file.
+	if err := disk.checkVersion0MetaData(metadata); err != nil {
+		return fmt.Errorf("file isn't a version 0 database file: %w", err)
+	}
+
+	if disk.superblock, err = codec.NewSuperblock(disk.pageSize); err != nil {
+		return err
+	}
+
+	// the pages of a version 0 file are in the version 1 format, so they are upgraded by the next migration.
+	disk.superblock.FormatVersion = 1
+	disk.metadata = metadata
+
+	return disk.writeMetaDataPage()
+}
+
+// readVersion0MetaDataPage reads and decodes the metadata page of a version 0 file, which starts with the metadata,
+// and sets the page size to the one recorded in it. The page size isn't known until the metadata page is decoded,
+// so up to MAX_PAGE_SIZE bytes are read from the start of the file.
+func (disk *databaseFile) readVersion0MetaDataPage() (*codec.MetaData, error) {
+
+	fileStats, err := disk.file.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the file holds whole pages, so a file smaller than MAX_PAGE_SIZE can be read entirely.
+	size := min(int(fileStats.Size()), codec.MAX_PAGE_SIZE)
+
+	if size < codec.MIN_PAGE_SIZE {
+		return nil, fmt.Errorf("database file is too small to hold a metadata page")
+	}
+
+	data, err := disk.read(METADATA_PAGE_ID, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if disk.metadataCipher != nil {
+		return disk.decryptVersion0MetaDataPage(data)
+	}
+
+	metadata, err := disk.codec.DecodeMetaDataPage(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata page: %w", err)
+	}
+
+	pageSize := int(metadata.PageSize)
+
+	if err := codec.ValidatePageSize(pageSize); err != nil {
+		return nil, fmt.Errorf("invalid metadata page: %w", err)
+	}
+
+	if pageSize > size {
+		return nil, fmt.Errorf("database file is smaller than its page size %d", pageSize)
+	}
+
+	disk.pageSize = pageSize
+
+	if metadata, err = disk.codec.DecodeMetaDataPage(data[:pageSize]); err != nil {
+		return nil, fmt.Errorf("invalid metadata page: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// decryptVersion0MetaDataPage finds the page size of an encrypted version 0 file by decrypting the start of the file with each possible page size,
+// since the metadata page only passes authentication when it is decrypted with the size it was encrypted with.
+func (disk *databaseFile) decryptVersion0MetaDataPage(data []byte) (*codec.MetaData, error) {
+
+	var err error
+
+	for pageSize := codec.MIN_PAGE_SIZE; pageSize <= len(data); pageSize *= 2 {
+
+		var metaDataPage []byte
+
+		if metaDataPage, err = disk.metadataCipher.decryptPage(METADATA_PAGE_ID, data[:pageSize]); err != nil {
+			continue
+		}
+
+		var metadata *codec.MetaData
+
+		if metadata, err = disk.codec.DecodeMetaDataPage(metaDataPage); err != nil {
+			continue
+		}
+
+		if int(metadata.PageSize) != pageSize {
+			err = fmt.Errorf("metadata page records page size %d, but was encrypted as a %d byte page", metadata.PageSize, pageSize)
+			continue
+		}
+
+		disk.pageSize = pageSize
+
+		return metadata, nil
+	}
+
+	slog.Error("Failed to decrypt metadata page", "error", err.Error(), "function", "decryptVersion0MetaDataPage", "at", "databaseFile")
+
+	return nil, err
+}
+
+// checkVersion0MetaData checks that the metadata of a version 0 file describes the file. Version 0 files grow 16 pages at a time,
+// once every page is allocated, so they hold between MaxAllocatedPageId+1 and MaxAllocatedPageId+17 pages,
+// and the pages referenced by the metadata are allocated pages.
+func (disk *databaseFile) checkVersion0MetaData(metadata *codec.MetaData) error {
+
+	fileStats, err := disk.file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	numPages := uint64(fileStats.Size()) / uint64(disk.pageSize)
+
+	if metadata.MaxAllocatedPageId >= numPages || numPages > metadata.MaxAllocatedPageId+17 {
+		return fmt.Errorf("max allocated page ID %d doesn't match a file of %d pages", metadata.MaxAllocatedPageId, numPages)
+	}
+
+	for _, pages := range []map[uint64]uint64{metadata.RootPages, metadata.FirstLeafNodePages} {
+
+		for BPlusTreeId, pageId := range pages {
+
+			if pageId > metadata.MaxAllocatedPageId {
+				return fmt.Errorf("B+ tree %d is stored in page %d, past max allocated page ID %d", BPlusTreeId, pageId, metadata.MaxAllocatedPageId)
+			}
+		}
+	}
+
+	for _, pageId := range metadata.DeallocatedPageIdList {
+
+		if pageId == METADATA_PAGE_ID || pageId > metadata.MaxAllocatedPageId {
+			return fmt.Errorf("deallocated page ID %d isn't an allocated page", pageId)
+		}
+	}
+
+	return nil
+}
+
+// upgradeLeafElements upgrades a version 1 file, whose leaf node elements end with the value, by rebuilding every B+ tree stored in it.
+// Leaf node elements grow by the expiry timestamp and compression type fields, so a rebuilt B+ tree may not fit in the pages it was stored in,
+// these are reused before new pages are allocated at the end of the file. Pages are rewritten in place, so a database file should be copied before it is upgraded.
+func upgradeLeafElements(disk *databaseFile) error {
+
+	metadata, err := disk.readMetaDataPageFromVersion(1)
+
+	if err != nil {
+		return err
+	}
+
+	disk.metadata = metadata
+
+	for _, BPlusTreeId := range slices.Sorted(maps.Keys(metadata.RootPages)) {
+
+		// B+ trees which were created but never written to have no root node.
+		if metadata.RootPages[BPlusTreeId] == 0 {
+			continue
+		}
+
+		if err := disk.rebuildVersion1BPlusTree(BPlusTreeId); err != nil {
+			return fmt.Errorf("failed to rebuild B+ tree %d: %w", BPlusTreeId, err)
+		}
+	}
+
+	// the metadata page refers to the rebuilt nodes, so it is written once they are stored.
+	if err := disk.file.Sync(); err != nil {
+		return err
+	}
+
+	disk.superblock.FormatVersion = 2
+
+	return disk.writeMetaDataPage()
+}
+
+// rebuildVersion1BPlusTree reads the elements stored in the version 1 leaf nodes of a B+ tree, and writes the B+ tree again in the current format.
+func (disk *databaseFile) rebuildVersion1BPlusTree(BPlusTreeId uint64) error {
+
+	rebuilder := &bplusTreeRebuilder{
+		disk:          disk,
+		leafCodec:     codec.NewLeafNodeCodec(),
+		internalCodec: codec.NewInternalNodeCodec(),
+	}
+
+	elements := make([]codec.LeafNodeElement, 0)
+
+	if err := rebuilder.readVersion1Node(disk.metadata.RootPages[BPlusTreeId], make(map[uint64]bool), &elements); err != nil {
+		return err
+	}
+
+	slices.Sort(rebuilder.pageIds)
+
+	slog.Info("Rebuilding B+ tree", "BPlusTreeId", BPlusTreeId, "elements", len(elements), "pages", len(rebuilder.pageIds), "function", "rebuildVersion1BPlusTree", "at", "databaseFile")
+
+	nodes, err := rebuilder.writeLeafNodes(elements)
+
+	if err != nil {
+		return err
+	}
+
+	disk.metadata.FirstLeafNodePages[BPlusTreeId] = nodes[0].pageId
+
+	for len(nodes) > 1 {
+
+		if nodes, err = rebuilder.writeInternalNodes(nodes); err != nil {
+			return err
+		}
+	}
+
+	disk.metadata.RootPages[BPlusTreeId] = nodes[0].pageId
+
+	// the rebuilt B+ tree may fit in fewer pages than before.
+	disk.metadata.DeallocatedPageIdList = append(disk.metadata.DeallocatedPageIdList, rebuilder.pageIds...)
+
+	return nil
+}
+
+// bplusTreeRebuilder writes the nodes of a B+ tree bottom up from its elements in sorted order, filling every node before writing the next one.
+type bplusTreeRebuilder struct {
+	disk          *databaseFile
+	leafCodec     codec.LeafNodeCodec
+	internalCodec codec.InternalNodeCodec
+
+	// pages the B+ tree was stored in, which are reused in ascending order before new pages are allocated.
+	pageIds []uint64
+}
+
+// rebuiltNode is a node written by the rebuilder, along with the smallest key stored in its subtree.
+type rebuiltNode struct {
+	pageId   uint64
+	firstKey []byte
+}
+
+// readVersion1Node appends the elements stored in the subtree of a version 1 node to elements in sorted order, and records the pages of the subtree.
+// The first child of an internal node may be a copy of the last child of the previous internal node, so visited children are skipped.
+func (rebuilder *bplusTreeRebuilder) readVersion1Node(pageId uint64, visited map[uint64]bool, elements *[]codec.LeafNodeElement) error {
+
+	if visited[pageId] {
+		return nil
+	}
+	visited[pageId] = true
+
+	page, err := rebuilder.disk.readPageForMigration(pageId)
+
+	if err != nil {
+		return err
+	}
+
+	rebuilder.pageIds = append(rebuilder.pageIds, pageId)
+
+	headerCodec := codec.DefaultHeaderCodec()
+
+	if headerCodec.IsLeafNode(page) {
+		*elements = append(*elements, rebuilder.leafCodec.GetAllVersion1Elements(page)...)
+		return nil
+	}
+
+	childNodePageIds, _ := rebuilder.internalCodec.GetChildNodePageIds(page)
+
+	for _, childNodePageId := range childNodePageIds {
+
+		if err := rebuilder.readVersion1Node(childNodePageId, visited, elements); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allocatePage returns the next page the B+ tree was stored in, or a new page at the end of the file once these are used up.
+func (rebuilder *bplusTreeRebuilder) allocatePage() uint64 {
+
+	if len(rebuilder.pageIds) > 0 {
+
+		pageId := rebuilder.pageIds[0]
+		rebuilder.pageIds = rebuilder.pageIds[1:]
+
+		return pageId
+	}
+
+	rebuilder.disk.metadata.MaxAllocatedPageId++
+
+	return rebuilder.disk.metadata.MaxAllocatedPageId
+}
+
+// writeLeafNodes writes the elements to a chain of leaf nodes, and returns the leaf nodes in order. An empty B+ tree is written as a single empty leaf node.
+func (rebuilder *bplusTreeRebuilder) writeLeafNodes(elements []codec.LeafNodeElement) ([]rebuiltNode, error) {
+
+	nodes := []rebuiltNode{{pageId: rebuilder.allocatePage()}}
+
+	page := rebuilder.disk.newPageForMigration()
+	rebuilder.leafCodec.SetNodeType(page)
+
+	for _, element := range elements {
+
+		if rebuilder.leafCodec.InsertElement(page, element.Key, element.Value, element.ExpiresAt, element.Compression) {
+			continue
+		}
+
+		// the leaf node is full, the element is stored in the next one.
+		nextLeafNodePageId := rebuilder.allocatePage()
+		rebuilder.leafCodec.SetNextLeafNodePageId(page, nextLeafNodePageId)
+
+		if err := rebuilder.disk.writePageForMigration(nodes[len(nodes)-1].pageId, page); err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, rebuiltNode{pageId: nextLeafNodePageId, firstKey: element.Key})
+
+		page = rebuilder.disk.newPageForMigration()
+		rebuilder.leafCodec.SetNodeType(page)
+
+		if !rebuilder.leafCodec.InsertElement(page, element.Key, element.Value, element.ExpiresAt, element.Compression) {
+			return nil, fmt.Errorf("element with key %q doesn't fit in a leaf node", element.Key)
+		}
+	}
+
+	if err := rebuilder.disk.writePageForMigration(nodes[len(nodes)-1].pageId, page); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// writeInternalNodes writes the internal nodes of the level above the given nodes, and returns them in order.
+// The first key of every child other than the first child of an internal node separates it from the previous child.
+func (rebuilder *bplusTreeRebuilder) writeInternalNodes(childNodes []rebuiltNode) ([]rebuiltNode, error) {
+
+	nodes := make([]rebuiltNode, 0)
+
+	for start := 0; start < len(childNodes); {
+
+		page := rebuilder.disk.newPageForMigration()
+		rebuilder.internalCodec.SetNodeType(page)
+
+		end := start + 1
+
+		for end < len(childNodes) && rebuilder.internalCodec.InsertElement(page, childNodes[end].firstKey, childNodes[end-1].pageId, childNodes[end].pageId) {
+			end++
+		}
+
+		// an internal node needs at least two children, so the last child of this node is moved to the next one if it would be left with a single child.
+		if end == len(childNodes)-1 && end-start > 2 {
+
+			rebuilder.internalCodec.DeleteElement(page, childNodes[end-1].firstKey)
+			rebuilder.internalCodec.Compact(page)
+			end--
+		}
+
+		if end == start+1 {
+			return nil, fmt.Errorf("key %q doesn't fit in an internal node", childNodes[start].firstKey)
+		}
+
+		node := rebuiltNode{pageId: rebuilder.allocatePage(), firstKey: childNodes[start].firstKey}
+
+		if err := rebuilder.disk.writePageForMigration(node.pageId, page); err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+		start = end
+	}
+
+	return nodes, nil
+}
+
+// newPageForMigration returns an empty page, without the space reserved for the encryption trailer if the database is encrypted.
+func (disk *databaseFile) newPageForMigration() []byte {
+
+	if disk.metadataCipher != nil {
+		return make([]byte, disk.pageSize-ENCRYPTION_TRAILER_SIZE)
+	}
+
+	return make([]byte, disk.pageSize)
+}
+
+// readPageForMigration reads a page of the file, and decrypts it if the database is encrypted.
+func (disk *databaseFile) readPageForMigration(pageId uint64) ([]byte, error) {
+
+	data, err := disk.read(int64(pageId)*int64(disk.pageSize), disk.pageSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if disk.metadataCipher == nil {
+		return data, nil
+	}
+
+	page, err := disk.metadataCipher.decryptPage(pageId, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return page[:disk.pageSize-ENCRYPTION_TRAILER_SIZE], nil
+}
+
+// writePageForMigration writes a page to the file, and encrypts it if the database is encrypted.
+func (disk *databaseFile) writePageForMigration(pageId uint64, page []byte) error {
+
+	data := make([]byte, disk.pageSize)
+	copy(data, page)
+
+	if disk.metadataCipher != nil {
+
+		encryptedPage, err := disk.metadataCipher.encryptPage(pageId, data)
+
+		if err != nil {
+			return err
+		}
+		data = encryptedPage
+	}
+
+	return disk.write(int64(pageId)*int64(disk.pageSize), data)
+}
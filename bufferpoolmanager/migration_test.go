@@ -0,0 +1,364 @@
+package bufferpoolmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+	"github.com/stretchr/testify/suite"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	filePath string
+}
+
+func (ms *MigrationTestSuite) SetupTest() {
+	ms.filePath = filepath.Join(ms.T().TempDir(), "dragon.db")
+}
+
+func legacyMetaData(pageSize int) *codec.MetaData {
+
+	return &codec.MetaData{
+		CurrBPlusTreeId:       2,
+		RootPages:             map[uint64]uint64{1: 3},
+		MaxAllocatedPageId:    6,
+		DeallocatedPageIdList: []uint64{5},
+		FirstLeafNodePages:    map[uint64]uint64{1: 3},
+		PageSize:              uint32(pageSize),
+	}
+}
+
+// writeLegacyFile writes a version 0 database file, whose metadata page starts with the metadata, followed by the allocated pages.
+func (ms *MigrationTestSuite) writeLegacyFile(metaDataPage []byte, pageSize int, numPages int) {
+
+	data := make([]byte, pageSize*numPages)
+	copy(data, metaDataPage)
+
+	ms.Require().NoError(os.WriteFile(ms.filePath, data, 0644))
+}
+
+func (ms *MigrationTestSuite) assertMigratedMetaData(metadata *codec.MetaData, pageSize int) {
+
+	ms.Assert().Equal(uint64(2), metadata.CurrBPlusTreeId)
+	ms.Assert().Equal(map[uint64]uint64{1: 3}, metadata.RootPages)
+	ms.Assert().Equal(uint64(6), metadata.MaxAllocatedPageId)
+	ms.Assert().Equal([]uint64{5}, metadata.DeallocatedPageIdList)
+	ms.Assert().Equal(map[uint64]uint64{1: 3}, metadata.FirstLeafNodePages)
+	ms.Assert().Equal(uint32(pageSize), metadata.PageSize)
+}
+
+func (ms *MigrationTestSuite) TestMigrateLegacyFile() {
+
+	for _, pageSize := range []int{codec.DEFAULT_PAGE_SIZE, 16384} {
+
+		ms.writeLegacyFile(codec.DefaultMetaDataCodec().EncodeMetaDataPage(legacyMetaData(pageSize)), pageSize, 7)
+
+		_, _, _, err := NewDirectIODiskManager(ms.filePath)
+		ms.Require().ErrorIs(err, ErrOutdatedFormatVersion)
+
+		fromVersion, err := MigrateDatabaseFile(ms.filePath, nil)
+		ms.Require().NoError(err)
+		ms.Assert().Equal(uint32(0), fromVersion)
+
+		disk, metadata, _, err := NewDirectIODiskManager(ms.filePath)
+		ms.Require().NoError(err)
+
+		ms.assertMigratedMetaData(metadata, pageSize)
+
+		superblock := disk.Superblock()
+		ms.Assert().Equal(uint32(codec.CURRENT_FORMAT_VERSION), superblock.FormatVersion)
+		ms.Assert().Equal(uint32(pageSize), superblock.PageSize)
+		ms.Assert().Equal(codec.CHECKSUM_ALGORITHM_CRC32_IEEE, superblock.ChecksumAlgorithm)
+		ms.Assert().False(superblock.Encrypted)
+		ms.Assert().NotEqual([16]byte{}, superblock.DatabaseId)
+
+		ms.Require().NoError(disk.close())
+
+		// files in the current format are left untouched.
+		fromVersion, err = MigrateDatabaseFile(ms.filePath, nil)
+		ms.Require().NoError(err)
+		ms.Assert().Equal(uint32(codec.CURRENT_FORMAT_VERSION), fromVersion)
+
+		ms.Require().NoError(os.Remove(ms.filePath))
+	}
+}
+
+func (ms *MigrationTestSuite) TestMigrateEncryptedLegacyFile() {
+
+	keyProvider, err := NewStaticKeyProvider(bytes.Repeat([]byte{1}, 32))
+	ms.Require().NoError(err)
+
+	pageSize := 8192
+
+	metaDataPage, err := newPageCipher(keyProvider).encryptPage(METADATA_PAGE_ID, codec.DefaultMetaDataCodec().EncodeMetaDataPage(legacyMetaData(pageSize)))
+	ms.Require().NoError(err)
+
+	ms.writeLegacyFile(metaDataPage, pageSize, 7)
+
+	_, _, _, err = NewEncryptedDirectIODiskManager(ms.filePath, keyProvider)
+	ms.Require().ErrorIs(err, ErrOutdatedFormatVersion)
+
+	fromVersion, err := MigrateDatabaseFile(ms.filePath, keyProvider)
+	ms.Require().NoError(err)
+	ms.Assert().Equal(uint32(0), fromVersion)
+
+	disk, metadata, _, err := NewEncryptedDirectIODiskManager(ms.filePath, keyProvider)
+	ms.Require().NoError(err)
+
+	ms.assertMigratedMetaData(metadata, pageSize)
+	ms.Require().NoError(disk.close())
+
+	// the superblock is never encrypted, but the metadata following it is.
+	data, err := os.ReadFile(ms.filePath)
+	ms.Require().NoError(err)
+
+	superblock, err := codec.DefaultSuperblockCodec().DecodeSuperblock(data)
+	ms.Require().NoError(err)
+	ms.Assert().True(superblock.Encrypted)
+
+	_, _, _, err = NewDirectIODiskManager(ms.filePath)
+	ms.Assert().ErrorContains(err, "encrypted")
+}
+
+func (ms *MigrationTestSuite) TestInvalidSuperblock() {
+
+	disk, _, _, err := NewDirectIODiskManager(ms.filePath)
+	ms.Require().NoError(err)
+	ms.Require().NoError(disk.close())
+
+	data, err := os.ReadFile(ms.filePath)
+	ms.Require().NoError(err)
+
+	superblockCodec := codec.DefaultSuperblockCodec()
+
+	superblock, err := superblockCodec.DecodeSuperblock(data)
+	ms.Require().NoError(err)
+
+	// a single flipped bit fails the checksum.
+	corrupted := bytes.Clone(data)
+	corrupted[13] ^= 1
+
+	_, err = superblockCodec.DecodeSuperblock(corrupted)
+	ms.Assert().ErrorContains(err, "checksum")
+
+	ms.Require().NoError(os.WriteFile(ms.filePath, corrupted, 0644))
+
+	_, _, _, err = NewDirectIODiskManager(ms.filePath)
+	ms.Assert().Error(err)
+
+	_, err = MigrateDatabaseFile(ms.filePath, nil)
+	ms.Assert().Error(err)
+
+	// files written by a newer version can't be opened or migrated.
+	superblock.FormatVersion = codec.CURRENT_FORMAT_VERSION + 1
+	newer := bytes.Clone(data)
+	copy(newer, superblockCodec.EncodeSuperblock(superblock))
+
+	ms.Require().NoError(os.WriteFile(ms.filePath, newer, 0644))
+
+	_, _, _, err = NewDirectIODiskManager(ms.filePath)
+	ms.Assert().ErrorContains(err, "newer")
+
+	_, err = MigrateDatabaseFile(ms.filePath, nil)
+	ms.Assert().ErrorContains(err, "newer")
+}
+
+func (ms *MigrationTestSuite) TestFilesThatArentDatabasesAreNotMigrated() {
+
+	random := rand.New(rand.NewSource(1))
+
+	randomFile := make([]byte, 16*codec.DEFAULT_PAGE_SIZE)
+	random.Read(randomFile)
+
+	// metadata of a B+ tree stored past the last allocated page.
+	metadata := legacyMetaData(codec.DEFAULT_PAGE_SIZE)
+	metadata.RootPages[1] = 9
+
+	invalidMetaDataFile := make([]byte, 7*codec.DEFAULT_PAGE_SIZE)
+	copy(invalidMetaDataFile, codec.DefaultMetaDataCodec().EncodeMetaDataPage(metadata))
+
+	files := map[string][]byte{
+		"zero filled":      make([]byte, 64*codec.DEFAULT_PAGE_SIZE),
+		"random":           randomFile,
+		"invalid metadata": invalidMetaDataFile,
+	}
+
+	for name, data := range files {
+
+		ms.Require().NoError(os.WriteFile(ms.filePath, data, 0644))
+
+		_, err := MigrateDatabaseFile(ms.filePath, nil)
+		ms.Assert().Error(err, name)
+
+		// the file is left untouched.
+		migrated, err := os.ReadFile(ms.filePath)
+		ms.Require().NoError(err)
+		ms.Assert().True(bytes.Equal(data, migrated), name)
+	}
+
+	// every length in a corrupted metadata page is checked, instead of reading past the end of the page.
+	for seed := range int64(100) {
+
+		page := make([]byte, codec.DEFAULT_PAGE_SIZE)
+		rand.New(rand.NewSource(seed)).Read(page)
+
+		ms.Assert().NotPanics(func() {
+			codec.DefaultMetaDataCodec().DecodeMetaDataPage(page)
+		})
+	}
+}
+
+// writeVersion0LeafNode returns a leaf node in the version 0 format, whose elements end with the value.
+func writeVersion0LeafNode(keys [][]byte, values [][]byte, nextLeafNodePageId uint64) []byte {
+
+	page := make([]byte, codec.DEFAULT_PAGE_SIZE)
+
+	// header layout: crc, node type, is page filled, number of slots, free space begin, free space end, garbage size, unused, next leaf node
+	page[5] = 1
+	binary.LittleEndian.PutUint16(page[6:], uint16(len(keys)))
+	binary.LittleEndian.PutUint64(page[16:], nextLeafNodePageId)
+
+	freeSpaceBegin := 24
+	freeSpaceEnd := len(page)
+
+	for i := range keys {
+
+		element := binary.LittleEndian.AppendUint16(nil, uint16(len(keys[i])))
+		element = append(element, keys[i]...)
+		element = binary.LittleEndian.AppendUint16(element, uint16(len(values[i])))
+		element = append(element, values[i]...)
+
+		freeSpaceEnd -= len(element)
+		copy(page[freeSpaceEnd:], element)
+
+		// slot layout: element size, element pointer
+		binary.LittleEndian.PutUint16(page[freeSpaceBegin:], uint16(len(element)))
+		binary.LittleEndian.PutUint16(page[freeSpaceBegin+2:], uint16(freeSpaceEnd))
+		freeSpaceBegin += 4
+	}
+
+	binary.LittleEndian.PutUint16(page[8:], uint16(freeSpaceBegin))
+	binary.LittleEndian.PutUint16(page[10:], uint16(freeSpaceEnd))
+
+	return page
+}
+
+func (ms *MigrationTestSuite) TestMigrateLegacyFileWithData() {
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("k%03d", i))
+	}
+
+	value := func(i int) []byte {
+		return []byte{byte(i)}
+	}
+
+	// a B+ tree with two full leaf nodes, whose elements no longer fit in two pages once they store an expiry timestamp and a compression type.
+	leafNodes := make([][]byte, 0)
+
+	for start := 0; start < 600; start += 300 {
+
+		keys := make([][]byte, 0)
+		values := make([][]byte, 0)
+
+		for i := start; i < start+300; i++ {
+			keys = append(keys, key(i))
+			values = append(values, value(i))
+		}
+
+		leafNodes = append(leafNodes, writeVersion0LeafNode(keys, values, uint64(2*(start/300))))
+	}
+
+	internalCodec := codec.NewInternalNodeCodec()
+
+	rootNode := make([]byte, codec.DEFAULT_PAGE_SIZE)
+	internalCodec.SetNodeType(rootNode)
+	ms.Require().True(internalCodec.InsertElement(rootNode, key(300), 1, 2))
+
+	metadata := &codec.MetaData{
+		CurrBPlusTreeId:       2,
+		RootPages:             map[uint64]uint64{1: 3},
+		MaxAllocatedPageId:    3,
+		DeallocatedPageIdList: []uint64{},
+		FirstLeafNodePages:    map[uint64]uint64{1: 1},
+	}
+
+	data := bytes.Join([][]byte{codec.DefaultMetaDataCodec().EncodeMetaDataPage(metadata), leafNodes[0], leafNodes[1], rootNode}, nil)
+	ms.Require().NoError(os.WriteFile(ms.filePath, data, 0644))
+
+	fromVersion, err := MigrateDatabaseFile(ms.filePath, nil)
+	ms.Require().NoError(err)
+	ms.Assert().Equal(uint32(0), fromVersion)
+
+	disk, metadata, _, err := NewDirectIODiskManager(ms.filePath)
+	ms.Require().NoError(err)
+
+	bufferPool, err := NewSimpleBufferPoolManager(4, codec.DEFAULT_PAGE_SIZE, NewLRUReplacer(), disk)
+	ms.Require().NoError(err)
+
+	defer bufferPool.Close()
+
+	headerCodec := codec.DefaultHeaderCodec()
+	leafCodec := codec.NewLeafNodeCodec()
+
+	// every key is found by searching the rebuilt B+ tree from its root node.
+	for i := range 600 {
+
+		pageId := metadata.RootPages[1]
+
+		for {
+			guard, err := bufferPool.NewReadGuard(pageId)
+			ms.Require().NoError(err)
+
+			page := guard.GetPageData()
+
+			if headerCodec.IsLeafNode(page) {
+
+				element, found := leafCodec.FindElement(page, key(i))
+				guard.Done()
+
+				ms.Require().True(found, "key %s", key(i))
+				ms.Assert().Equal(value(i), element.Value)
+				ms.Assert().Equal(uint64(0), element.ExpiresAt)
+				ms.Assert().Equal(codec.CompressionNone, element.Compression)
+				break
+			}
+
+			pageId = internalCodec.FindNextChildNodePageId(page, key(i))
+			guard.Done()
+		}
+	}
+
+	// the leaf node chain holds every key in order, spread over more leaf nodes than before.
+	leafNodeCount := 0
+	count := 0
+
+	for pageId := metadata.FirstLeafNodePages[1]; pageId != 0; leafNodeCount++ {
+
+		guard, err := bufferPool.NewReadGuard(pageId)
+		ms.Require().NoError(err)
+
+		elements, _ := leafCodec.GetElementsInRange(guard.GetPageData(), nil, nil, 0)
+
+		for _, element := range elements {
+			ms.Assert().Equal(key(count), element.Key)
+			count++
+		}
+
+		pageId = leafCodec.GetNextLeafNodePageId(guard.GetPageData())
+		guard.Done()
+	}
+
+	ms.Assert().Equal(600, count)
+	ms.Assert().Greater(leafNodeCount, 2)
+}
+
+func TestMigration(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
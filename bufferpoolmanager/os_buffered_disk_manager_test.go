@@ -0,0 +1,60 @@
+package bufferpoolmanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSBufferedDiskManager(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "buffered_test_file")
+
+	directIODisk, _, isNewDatabase, err := NewDirectIODiskManagerWithPageSize(filePath, 8192)
+	require.NoError(t, err)
+	require.True(t, isNewDatabase)
+
+	directIODisk.metadata.RootPages[1] = 2
+
+	pageId, err := directIODisk.allocatePage()
+	require.NoError(t, err)
+	require.NoError(t, directIODisk.write(int64(pageId)*8192, createPage(100)))
+
+	databaseId := directIODisk.Superblock().DatabaseId
+	require.NoError(t, directIODisk.close())
+
+	// the page size and tree roots are read from the file written with Direct I/O.
+	bufferedDisk, metadata, isNewDatabase, err := NewOSBufferedDiskManager(filePath)
+	require.NoError(t, err)
+	assert.False(t, isNewDatabase)
+
+	assert.Equal(t, 8192, bufferedDisk.getPageSize())
+	assert.Equal(t, uint64(2), metadata.RootPages[1])
+	assert.Equal(t, pageId, metadata.MaxAllocatedPageId)
+	assert.Equal(t, databaseId, bufferedDisk.Superblock().DatabaseId)
+
+	data, err := bufferedDisk.read(int64(pageId)*8192, 8192)
+	require.NoError(t, err)
+	assert.True(t, checkPage(100, data))
+
+	// buffered I/O doesn't need aligned buffers.
+	unalignedPage := make([]byte, 8192+1)[1:]
+	copy(unalignedPage, createPage(200))
+
+	bufferedPageId, err := bufferedDisk.allocatePage()
+	require.NoError(t, err)
+	require.NoError(t, bufferedDisk.writePages([]uint64{bufferedPageId}, [][]byte{unalignedPage}))
+	require.NoError(t, bufferedDisk.close())
+
+	directIODisk, metadata, _, err = NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, bufferedPageId, metadata.MaxAllocatedPageId)
+
+	data, err = directIODisk.read(int64(bufferedPageId)*8192, 8192)
+	require.NoError(t, err)
+	assert.True(t, checkPage(200, data))
+
+	require.NoError(t, directIODisk.close())
+}
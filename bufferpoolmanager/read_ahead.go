@@ -0,0 +1,221 @@
+package bufferpoolmanager
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+const (
+	// number of pages read ahead of a sequential scan.
+	DEFAULT_READ_AHEAD_PAGES = 8
+
+	// number of pages a scan must access in chain order before pages are read ahead of it.
+	SEQUENTIAL_ACCESS_THRESHOLD = 2
+)
+
+// NextPageIdFunc returns the ID of the page following the given page in a chain of pages, or 0 at the end of the chain.
+// It is used to follow chains whose layout the buffer pool manager doesn't know about, such as the leaf chain of a B+ tree.
+type NextPageIdFunc func(page []byte) uint64
+
+// readAheadState tracks the goroutines loading pages ahead of scans, so Close can wait for them before releasing the frames.
+type readAheadState struct {
+	mutex     *sync.Mutex
+	closed    bool
+	waitGroup *sync.WaitGroup
+}
+
+func newReadAheadState() *readAheadState {
+
+	return &readAheadState{
+		mutex:     &sync.Mutex{},
+		waitGroup: &sync.WaitGroup{},
+	}
+}
+
+// ReadAhead asynchronously loads up to numPages pages of a page chain into the buffer pool, starting at pageId.
+// Pages are loaded into free or evictable frames, and inserted into the replacer as cold frames, so they are evicted first
+// if the scan never reaches them. Read ahead stops early when every frame is pinned.
+func (bufferPool *SimpleBufferPoolManager) ReadAhead(pageId uint64, numPages int, nextPageId NextPageIdFunc) {
+
+	state := bufferPool.readAhead
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.closed {
+		return
+	}
+
+	state.waitGroup.Add(1)
+
+	go func() {
+
+		defer state.waitGroup.Done()
+
+		loadedPages, err := bufferPool.readAheadPageChain(pageId, numPages, nextPageId)
+
+		if err != nil {
+			slog.Error("Failed to read ahead", "pageId", pageId, "error", err.Error(), "function", "ReadAhead", "at", "buffer Pool Manager")
+			return
+		}
+
+		slog.Info("Read ahead complete", "pageId", pageId, "loadedPages", loadedPages, "function", "ReadAhead", "at", "buffer Pool Manager")
+	}()
+}
+
+// stopReadAhead prevents new read aheads from starting, and waits for the running ones to finish.
+func (bufferPool *SimpleBufferPoolManager) stopReadAhead() {
+
+	state := bufferPool.readAhead
+
+	state.mutex.Lock()
+	state.closed = true
+	state.mutex.Unlock()
+
+	state.waitGroup.Wait()
+}
+
+// readAheadPageChain follows a page chain for numPages pages, loading the pages that aren't in the buffer pool.
+// It returns the number of pages loaded from disk.
+func (bufferPool *SimpleBufferPoolManager) readAheadPageChain(pageId uint64, numPages int, nextPageId NextPageIdFunc) (int, error) {
+
+	loadedPages := 0
+
+	for range numPages {
+
+		if pageId == 0 {
+			break
+		}
+
+		next, loaded, err := bufferPool.readAheadPage(pageId, nextPageId)
+
+		if err != nil {
+			return loadedPages, err
+		}
+
+		if loaded {
+			loadedPages++
+		}
+
+		// the next page ID couldn't be determined without waiting, so the rest of the chain is left to the scan.
+		if next == 0 {
+			break
+		}
+
+		pageId = next
+	}
+
+	return loadedPages, nil
+}
+
+// readAheadPage loads a page into the buffer pool as a cold frame if it isn't already there, and returns the ID of the next page in the chain.
+// The page isn't pinned, so it is evicted before any accessed page if it is never used.
+func (bufferPool *SimpleBufferPoolManager) readAheadPage(pageId uint64, nextPageId NextPageIdFunc) (next uint64, loaded bool, err error) {
+
+	shard := bufferPool.getShard(pageId)
+
+	shard.lookupMutex.RLock()
+
+	if frameId, exists := shard.pageTable[pageId]; exists {
+
+		defer shard.lookupMutex.RUnlock()
+
+		// the page is already in the buffer pool, and can't be evicted while the lookup mutex is held.
+		// waiting for the page lock while holding the lookup mutex could deadlock with a guard being released.
+		frame := shard.frames[frameId]
+
+		// the frame is being loaded, the rest of the chain is left to the scan.
+		if frame.inFlight != nil || !frame.mutex.TryRLock() {
+			return 0, false, nil
+		}
+		defer frame.mutex.RUnlock()
+
+		return nextPageId(frame.data), false, nil
+	}
+
+	shard.lookupMutex.RUnlock()
+
+	shard.lookupMutex.Lock()
+	defer shard.lookupMutex.Unlock()
+
+	// the page was loaded by another fetch in the meantime.
+	if _, exists := shard.pageTable[pageId]; exists {
+		return 0, false, nil
+	}
+
+	frame, _, err := bufferPool.loadPage(shard, pageId, true)
+
+	// every frame of the shard is pinned.
+	if errors.Is(err, ErrBufferPoolExhausted) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read page %d ahead: %w", pageId, err)
+	}
+
+	// the frame is unpinned, but it can't be evicted while the lookup mutex is held.
+	return nextPageId(frame.data), true, nil
+}
+
+// SequentialReadDetector detects scans that access a page chain in order, and reads the following pages ahead of the scan.
+// Each scan uses its own detector. A detector is not safe for concurrent use.
+type SequentialReadDetector struct {
+	bufferPool BufferPoolManager
+	nextPageId NextPageIdFunc
+
+	// number of pages read ahead at once.
+	numPages int
+
+	// ID of the page following the last accessed page in the chain.
+	expectedPageId uint64
+
+	// number of consecutive accesses that followed the chain.
+	sequentialAccesses int
+
+	// number of pages read ahead that the scan hasn't reached yet.
+	pagesAhead int
+}
+
+func NewSequentialReadDetector(bufferPool BufferPoolManager, nextPageId NextPageIdFunc, numPages int) *SequentialReadDetector {
+
+	return &SequentialReadDetector{
+		bufferPool: bufferPool,
+		nextPageId: nextPageId,
+		numPages:   numPages,
+	}
+}
+
+// Access records that the scan accessed a page. Once the scan has followed the chain SEQUENTIAL_ACCESS_THRESHOLD times,
+// the next numPages pages are read ahead, and more pages are read ahead each time the scan gets through half of them.
+func (detector *SequentialReadDetector) Access(pageId uint64, page []byte) {
+
+	if detector.numPages <= 0 {
+		return
+	}
+
+	if pageId == detector.expectedPageId {
+
+		detector.sequentialAccesses++
+
+		if detector.pagesAhead > 0 {
+			detector.pagesAhead--
+		}
+	} else {
+
+		detector.sequentialAccesses = 0
+		detector.pagesAhead = 0
+	}
+
+	detector.expectedPageId = detector.nextPageId(page)
+
+	if detector.expectedPageId == 0 || detector.sequentialAccesses < SEQUENTIAL_ACCESS_THRESHOLD || detector.pagesAhead > detector.numPages/2 {
+		return
+	}
+
+	// pages already in the buffer pool are skipped over, so only the pages past the previous read ahead are loaded.
+	detector.bufferPool.ReadAhead(detector.expectedPageId, detector.numPages, detector.nextPageId)
+	detector.pagesAhead = detector.numPages
+}
@@ -0,0 +1,81 @@
+package bufferpoolmanager
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// nextTestPageId chains the pages written by fileSetup, page i links to page i + 1, and page 4 ends the chain.
+func nextTestPageId(page []byte) uint64 {
+
+	next := binary.LittleEndian.Uint64(page[:8]) + 1
+
+	if next > 4 {
+		return 0
+	}
+	return next
+}
+
+// isPageInBufferPool checks if a page is currently stored in a frame.
+func (bs *BufferPoolManagerTestSuite) isPageInBufferPool(pageId uint64) bool {
+
+	bs.bufferPool.shards[0].lookupMutex.RLock()
+	defer bs.bufferPool.shards[0].lookupMutex.RUnlock()
+
+	_, exists := bs.bufferPool.shards[0].pageTable[pageId]
+	return exists
+}
+
+func (bs *BufferPoolManagerTestSuite) TestReadAheadPageChain() {
+
+	guard, err := bs.bufferPool.NewReadGuard(0)
+	bs.Require().NoError(err)
+	guard.Done()
+
+	loadedPages, err := bs.bufferPool.readAheadPageChain(1, 2, nextTestPageId)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(2, loadedPages)
+
+	// pages read ahead are unpinned
+	bs.Assert().Equal(0, bs.bufferPool.shards[0].frames[bs.bufferPool.shards[0].pageTable[1]].pinCount)
+	bs.Assert().Equal(3, bs.bufferPool.shards[0].replacer.size())
+
+	// pages 1 and 2 are already in the buffer pool, so only page 3 is read, evicting a page that was read ahead instead of page 0
+	loadedPages, err = bs.bufferPool.readAheadPageChain(1, 3, nextTestPageId)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(1, loadedPages)
+
+	bs.Assert().True(bs.isPageInBufferPool(0))
+	bs.Assert().True(bs.isPageInBufferPool(3))
+
+	guard, err = bs.bufferPool.NewReadGuard(3)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(true, checkPage(3, guard.GetPageData()))
+	guard.Done()
+}
+
+func (bs *BufferPoolManagerTestSuite) TestSequentialReadDetector() {
+
+	detector := NewSequentialReadDetector(bs.bufferPool, nextTestPageId, 2)
+
+	// a random access doesn't trigger read ahead
+	guard, err := bs.bufferPool.NewReadGuard(6)
+	bs.Require().NoError(err)
+	detector.Access(6, guard.GetPageData())
+	guard.Done()
+
+	for pageId := range uint64(3) {
+
+		guard, err := bs.bufferPool.NewReadGuard(pageId + 1)
+		bs.Require().NoError(err)
+		detector.Access(pageId+1, guard.GetPageData())
+		guard.Done()
+
+		bs.Assert().False(bs.isPageInBufferPool(4))
+	}
+
+	// the scan followed the chain from page 1 to page 3, so page 4 is read ahead
+	bs.Assert().Eventually(func() bool {
+		return bs.isPageInBufferPool(4)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -1,6 +1,7 @@
 package bufferpoolmanager
 
 import (
+	"context"
 	"log/slog"
 )
 
@@ -9,6 +10,9 @@ type ReadGuard struct {
 	active     bool
 	page       *Frame
 	bufferPool BufferPoolManager
+
+	// size of the page data exposed by the guard, space reserved by the disk manager at the end of the page is hidden.
+	pageDataSize int
 }
 
 // NewReadGuard returns an active read guard.
@@ -22,16 +26,34 @@ func (bufferPool *SimpleBufferPoolManager) NewReadGuard(pageId uint64) (*ReadGua
 		return nil, err
 	}
 
+	return bufferPool.newReadGuard(page), nil
+}
+
+// NewReadGuardWithContext returns an active read guard. If all frames are pinned, it waits for a frame to be unpinned until the context is done.
+func (bufferPool *SimpleBufferPoolManager) NewReadGuardWithContext(ctx context.Context, pageId uint64) (*ReadGuard, error) {
+
+	page, err := bufferPool.fetchPageWithContext(ctx, pageId)
+
+	if err != nil {
+		slog.Error("Failed to fetch page for read guard", "pageId", pageId, "error", err.Error())
+		return nil, err
+	}
+
+	return bufferPool.newReadGuard(page), nil
+}
+
+// newReadGuard locks a fetched page, and wraps it in a read guard.
+func (bufferPool *SimpleBufferPoolManager) newReadGuard(page *Frame) *ReadGuard {
+
 	page.mutex.RLock()
 
-	guard := &ReadGuard{
+	return &ReadGuard{
 		active:     true,
 		page:       page,
 		bufferPool: bufferPool,
-	}
-
-	return guard, nil
 
+		pageDataSize: bufferPool.pageDataSize,
+	}
 }
 
 // GetPageId returns the page ID of the page corresponding to the read guard.
@@ -49,7 +71,8 @@ func (guard *ReadGuard) GetPageData() []byte {
 	if !guard.active {
 		return nil
 	}
-	return guard.page.data
+	// the capacity is limited as well, so codecs can't grow the slice into the reserved space
+	return guard.page.data[:guard.pageDataSize:guard.pageDataSize]
 }
 
 func (guard *ReadGuard) IsActive() bool {
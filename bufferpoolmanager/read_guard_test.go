@@ -10,9 +10,8 @@ type ReadGuardTestSuite struct {
 func (rs *ReadGuardTestSuite) SetupTest() {
 
 	replacer := NewLRUReplacer()
-	disk, err := NewOSBufferedDiskManager("/test")
+	disk, _ := NewMemoryDiskManager()
 
-	rs.Suite.Assert().NoError(err)
 	bpm, err := NewSimpleBufferPoolManager(5, 4096, replacer, disk)
 
 	rs.Suite.Assert().NoError(err)
@@ -0,0 +1,190 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// getPoolSize returns the current number of frames in the buffer pool.
+func (bufferPool *SimpleBufferPoolManager) getPoolSize() int {
+
+	bufferPool.poolSizeMutex.RLock()
+	defer bufferPool.poolSizeMutex.RUnlock()
+
+	return bufferPool.poolSize
+}
+
+// Resize grows or shrinks the buffer pool to poolSize frames while it is in use. Frames stay evenly divided between the shards.
+// Growing allocates and locks new frames in memory. Shrinking removes the frames with the highest frame IDs of every shard,
+// writing the pages stored in them to disk first if they are dirty, and unlocks their memory.
+//
+// Every shard is locked while the pool is resized, so fetches wait for Resize to finish.
+// Shrinking fails without changing the pool if a frame to be removed is pinned or being loaded, and can be retried once it is unpinned.
+func (bufferPool *SimpleBufferPoolManager) Resize(poolSize int) error {
+
+	numShards := len(bufferPool.shards)
+
+	if poolSize < numShards {
+		return fmt.Errorf("pool size must be at least the number of shards %d, got %d", numShards, poolSize)
+	}
+
+	// serializes resizes, and keeps the pool size seen by the background writer consistent with the frames.
+	bufferPool.poolSizeMutex.Lock()
+	defer bufferPool.poolSizeMutex.Unlock()
+
+	fmt.Println()
+	slog.Info("Resizing buffer pool", "currentPoolSize", bufferPool.poolSize, "newPoolSize", poolSize, "function", "Resize", "at", "buffer Pool Manager")
+
+	for _, shard := range bufferPool.shards {
+		shard.lookupMutex.Lock()
+		defer shard.lookupMutex.Unlock()
+	}
+
+	// 1. Make sure every frame to be removed can be evicted.
+	for i, shard := range bufferPool.shards {
+
+		newNumFrames := shardPoolSize(poolSize, numShards, i)
+
+		for frameId := newNumFrames; frameId < len(shard.frames); frameId++ {
+
+			frame := shard.frames[frameId]
+
+			if frame.inFlight != nil || frame.pinCount > 0 {
+				return fmt.Errorf("cannot shrink buffer pool to %d frames, frame %d of shard %d is in use", poolSize, frameId, i)
+			}
+
+			// the background writer holds the page lock of an unpinned frame while it writes the page, without holding the lookup mutex.
+			if !frame.mutex.TryLock() {
+				return fmt.Errorf("cannot shrink buffer pool to %d frames, frame %d of shard %d is being written", poolSize, frameId, i)
+			}
+			frame.mutex.Unlock()
+		}
+	}
+
+	// 2. Allocate the frames added to every shard, so a failed allocation leaves the pool unchanged.
+	newFrames := make([][]*Frame, numShards)
+
+	for i, shard := range bufferPool.shards {
+
+		for range shardPoolSize(poolSize, numShards, i) - len(shard.frames) {
+
+			frame, err := newFrame(bufferPool.pageSize)
+
+			if err != nil {
+				releaseFrames(newFrames)
+				return err
+			}
+			newFrames[i] = append(newFrames[i], frame)
+		}
+	}
+
+	// 3. Write the dirty pages stored in the frames to be removed.
+	if err := bufferPool.flushRemovedFrames(poolSize); err != nil {
+		releaseFrames(newFrames)
+		return err
+	}
+
+	// 4. Remove and add frames.
+	for i, shard := range bufferPool.shards {
+
+		newNumFrames := shardPoolSize(poolSize, numShards, i)
+
+		if newNumFrames < len(shard.frames) {
+
+			evictedPages := shard.removeFrames(newNumFrames)
+			bufferPool.counters.evictions.Add(uint64(evictedPages))
+			continue
+		}
+
+		for _, frame := range newFrames[i] {
+
+			shard.freeFrames = append(shard.freeFrames, FrameID(len(shard.frames)))
+			shard.frames = append(shard.frames, frame)
+		}
+
+		shard.replacer.resize(len(shard.frames))
+
+		// fetches waiting for a frame can use the new frames.
+		shard.signalFrameReleased()
+	}
+
+	bufferPool.poolSize = poolSize
+
+	slog.Info("Buffer pool resized", "poolSize", poolSize, "function", "Resize", "at", "buffer Pool Manager")
+
+	return nil
+}
+
+// flushRemovedFrames writes the dirty pages stored in the frames removed by shrinking the pool to poolSize frames.
+// Every shard must be locked exclusively.
+func (bufferPool *SimpleBufferPoolManager) flushRemovedFrames(poolSize int) error {
+
+	dirtyPageIds := make([]uint64, 0)
+	buffers := make([][]byte, 0)
+
+	for i, shard := range bufferPool.shards {
+
+		for frameId := shardPoolSize(poolSize, len(bufferPool.shards), i); frameId < len(shard.frames); frameId++ {
+
+			frame := shard.frames[frameId]
+
+			if frame.dirty {
+				dirtyPageIds = append(dirtyPageIds, frame.pageId)
+				buffers = append(buffers, frame.data)
+			}
+		}
+	}
+
+	if err := bufferPool.disk.writePages(dirtyPageIds, buffers); err != nil {
+		slog.Error("Failed to write pages of removed frames", "error", err.Error(), "function", "flushRemovedFrames", "at", "buffer Pool Manager")
+		return err
+	}
+
+	bufferPool.counters.dirtyWrites.Add(uint64(len(dirtyPageIds)))
+
+	return nil
+}
+
+// removeFrames evicts the pages stored in the frames with frame IDs >= numFrames, and removes those frames from the shard.
+// The frames must be unpinned and clean, and the lookup mutex must be held exclusively. It returns the number of pages evicted.
+func (shard *bufferPoolShard) removeFrames(numFrames int) (evictedPages int) {
+
+	shard.frameAllocationMutex.Lock()
+	defer shard.frameAllocationMutex.Unlock()
+
+	for frameId := FrameID(numFrames); int(frameId) < len(shard.frames); frameId++ {
+
+		frame := shard.frames[frameId]
+
+		if index := slices.Index(shard.freeFrames, frameId); index != -1 {
+
+			shard.freeFrames = slices.Delete(shard.freeFrames, index, index+1)
+		} else {
+
+			delete(shard.pageTable, frame.pageId)
+			shard.replacer.remove(frameId)
+			shard.replacer.forget(frameId)
+			evictedPages++
+		}
+
+		if err := releaseFrameBuffer(frame.data); err != nil {
+			slog.Warn("Failed to unlock frame buffer", "error", err.Error(), "function", "removeFrames", "at", "buffer Pool Manager")
+		}
+	}
+
+	shard.frames = shard.frames[:numFrames]
+	shard.replacer.resize(numFrames)
+
+	return evictedPages
+}
+
+// releaseFrames unlocks the buffers of frames that were allocated, but never added to the buffer pool.
+func releaseFrames(frames [][]*Frame) {
+
+	for _, shardFrames := range frames {
+		for _, frame := range shardFrames {
+			_ = releaseFrameBuffer(frame.data)
+		}
+	}
+}
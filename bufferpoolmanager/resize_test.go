@@ -0,0 +1,86 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (bs *BufferPoolManagerTestSuite) TestResizeGrowAndShrink() {
+
+	shard := bs.bufferPool.shards[0]
+
+	for pageId := range uint64(3) {
+		bs.dirtyPage(pageId, 100+int(pageId))
+	}
+
+	bs.Require().NoError(bs.bufferPool.Resize(5))
+	bs.Assert().Len(shard.frames, 5)
+	bs.Assert().Equal([]FrameID{3, 4}, shard.freeFrames)
+
+	// the new frames are used before any page is evicted
+	for pageId := range uint64(5) {
+		guard, err := bs.bufferPool.NewReadGuard(pageId)
+		bs.Require().NoError(err)
+		guard.Done()
+	}
+	bs.Assert().Len(shard.pageTable, 5)
+
+	// pages 0, 1 and 2 are stored in frames 0, 1 and 2, so shrinking evicts pages 3 and 4, which are clean
+	guard, err := bs.bufferPool.NewReadGuard(1)
+	bs.Require().NoError(err)
+
+	bs.Assert().Error(bs.bufferPool.Resize(1))
+	bs.Assert().Len(shard.frames, 5)
+
+	guard.Done()
+
+	bs.Require().NoError(bs.bufferPool.Resize(2))
+	bs.Assert().Len(shard.frames, 2)
+	bs.Assert().Len(shard.pageTable, 2)
+	bs.Assert().Equal(2, bs.bufferPool.getPoolSize())
+
+	// page 2 was dirty, so it was written to disk before its frame was removed
+	bs.assertPageOnDisk(2, 102)
+
+	for pageId := range uint64(3) {
+		guard, err := bs.bufferPool.NewReadGuard(pageId)
+		bs.Require().NoError(err)
+		bs.Assert().Equal(true, checkPage(100+int(pageId), guard.GetPageData()))
+		guard.Done()
+	}
+}
+
+func TestResizeShardedBufferPool(t *testing.T) {
+
+	disk := newTestDiskManager(t, "resize_test_file", 16)
+
+	bufferPool, err := NewShardedBufferPoolManager(8, PAGE_SIZE, 4, ClockReplacementPolicy, disk)
+	require.NoError(t, err)
+
+	assert.Error(t, bufferPool.Resize(3))
+
+	require.NoError(t, bufferPool.Resize(10))
+
+	for i, expectedSize := range []int{3, 3, 2, 2} {
+		assert.Len(t, bufferPool.shards[i].frames, expectedSize)
+		assert.Len(t, bufferPool.shards[i].replacer.(*ClockReplacer).evictable, expectedSize)
+	}
+
+	for pageId := range uint64(16) {
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+		assert.Equal(t, true, checkPage(int(pageId), guard.GetPageData()))
+		guard.Done()
+	}
+
+	require.NoError(t, bufferPool.Resize(4))
+
+	for pageId := range uint64(16) {
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+		assert.Equal(t, true, checkPage(int(pageId), guard.GetPageData()))
+		guard.Done()
+	}
+}
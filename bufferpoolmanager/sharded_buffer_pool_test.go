@@ -0,0 +1,200 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+	"github.com/ncw/directio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDiskManager counts the pages read from disk.
+type countingDiskManager struct {
+	*DirectIODiskManager
+	pagesRead *atomic.Int64
+}
+
+func (disk *countingDiskManager) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	disk.pagesRead.Add(int64(len(pageIds)))
+	return disk.DirectIODiskManager.readPages(pageIds, buffers)
+}
+
+// newTestDiskManager creates a file with numPages pages, page i containing createPage(i).
+func newTestDiskManager(t testing.TB, path string, numPages int) *DirectIODiskManager {
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+
+	for i := range numPages {
+		_, err := f.Write(createPage(i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	file, err := directio.OpenFile(path, os.O_RDWR, 0644)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		file.Close()
+		os.Remove(path)
+	})
+
+	return &DirectIODiskManager{databaseFile: &databaseFile{
+		file:     file,
+		mutex:    &sync.Mutex{},
+		pageSize: PAGE_SIZE,
+		directIO: true,
+		syncer:   newFileSyncer(file),
+		extents:  newExtentAllocator(),
+		metadata: &codec.MetaData{
+			DeallocatedPageIdList: make([]uint64, 0),
+			MaxAllocatedPageId:    uint64(numPages - 1),
+		},
+	}}
+}
+
+func TestShardedBufferPoolManager(t *testing.T) {
+
+	disk := newTestDiskManager(t, "sharded_test_file", 16)
+
+	_, err := NewShardedBufferPoolManager(4, PAGE_SIZE, 5, LRUReplacementPolicy, disk)
+	assert.Error(t, err)
+
+	bufferPool, err := NewShardedBufferPoolManager(10, PAGE_SIZE, 4, ClockReplacementPolicy, disk)
+	require.NoError(t, err)
+
+	// 10 frames are split into shards of 3, 3, 2 and 2 frames
+	for i, expectedSize := range []int{3, 3, 2, 2} {
+		assert.Len(t, bufferPool.shards[i].frames, expectedSize)
+	}
+
+	for pageId := range uint64(16) {
+
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+		assert.Equal(t, true, checkPage(int(pageId), guard.GetPageData()))
+		guard.Done()
+
+		// every page is stored in the shard it hashes to
+		shard := bufferPool.shards[pageId%4]
+		_, exists := shard.pageTable[pageId]
+		assert.True(t, exists)
+	}
+
+	// shard 3 only has 2 frames, so it is exhausted even though other shards have unpinned frames
+	guards := make([]*ReadGuard, 0)
+
+	for _, pageId := range []uint64{3, 7} {
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+		guards = append(guards, guard)
+	}
+
+	_, err = bufferPool.NewReadGuard(11)
+	assert.ErrorIs(t, err, ErrBufferPoolExhausted)
+
+	for _, guard := range guards {
+		guard.Done()
+	}
+}
+
+func TestConcurrentFetchesShareInFlightRead(t *testing.T) {
+
+	disk := &countingDiskManager{
+		DirectIODiskManager: newTestDiskManager(t, "in_flight_test_file", 4),
+		pagesRead:           &atomic.Int64{},
+	}
+
+	bufferPool, err := NewShardedBufferPoolManager(4, PAGE_SIZE, 2, LRUReplacementPolicy, disk)
+	require.NoError(t, err)
+
+	waitGroup := &sync.WaitGroup{}
+
+	for range 32 {
+
+		waitGroup.Add(1)
+
+		go func() {
+
+			defer waitGroup.Done()
+
+			guard, err := bufferPool.NewReadGuard(2)
+			if assert.NoError(t, err) {
+				assert.Equal(t, true, checkPage(2, guard.GetPageData()))
+				guard.Done()
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	// concurrent fetches of a page being read wait for the read instead of reading the page again
+	assert.Equal(t, int64(1), disk.pagesRead.Load())
+}
+
+// BenchmarkBufferPoolFetch measures random page fetches from a working set twice the size of the buffer pool,
+// with the buffer pool split into 1 and DEFAULT_NUM_SHARDS shards.
+func BenchmarkBufferPoolFetch(b *testing.B) {
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer slog.SetDefault(logger)
+
+	const poolSize = 256
+	const numPages = 2 * poolSize
+
+	disk := newTestDiskManager(b, "benchmark_test_file", numPages)
+
+	for _, numShards := range []int{1, DEFAULT_NUM_SHARDS} {
+
+		for _, numGoroutines := range []int{1, 2, 4, 8, 16, 32, 64} {
+
+			b.Run(fmt.Sprintf("shards=%d/goroutines=%d", numShards, numGoroutines), func(b *testing.B) {
+
+				bufferPool, err := NewShardedBufferPoolManager(poolSize, PAGE_SIZE, numShards, LRUReplacementPolicy, disk)
+				require.NoError(b, err)
+				bufferPool.SetPinWaitTimeout(DEFAULT_PIN_WAIT_TIMEOUT)
+
+				defer bufferPool.releaseAllFrameBuffers()
+
+				waitGroup := &sync.WaitGroup{}
+
+				b.ResetTimer()
+
+				for g := range numGoroutines {
+
+					waitGroup.Add(1)
+
+					go func() {
+
+						defer waitGroup.Done()
+
+						random := rand.New(rand.NewSource(int64(g)))
+
+						for range b.N / numGoroutines {
+
+							guard, err := bufferPool.NewReadGuard(uint64(random.Intn(numPages)))
+
+							if err != nil {
+								b.Error(err)
+								return
+							}
+							guard.Done()
+						}
+					}()
+				}
+
+				waitGroup.Wait()
+			})
+		}
+	}
+}
@@ -1,18 +1,32 @@
 package bufferpoolmanager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
 	"golang.org/x/sys/unix"
 )
 
 const (
-	PAGE_SIZE        = 4096
+	// page size of databases created without choosing one.
+	PAGE_SIZE        = codec.DEFAULT_PAGE_SIZE
 	METADATA_PAGE_ID = 0
+
+	// time a fetch waits for a frame to be unpinned before giving up, when the buffer pool is used by the storage engine and server.
+	// B+ tree operations pin several pages at once, so waiting without a timeout could deadlock concurrent operations.
+	DEFAULT_PIN_WAIT_TIMEOUT = 1 * time.Second
 )
 
+// ErrBufferPoolExhausted is returned when a page has to be loaded into the buffer pool, but every frame is pinned.
+var ErrBufferPoolExhausted = errors.New("buffer pool exhausted: all frames are pinned")
+
 type FrameID int
 
 type BufferPoolManager interface {
@@ -22,12 +36,49 @@ type BufferPoolManager interface {
 	// NewPage allocates a new page in the file and returns its page ID.
 	NewPage() (uint64, error)
 
+	// NewPageNear allocates a new page for the B+ tree with ID = owner close to hintPageId, in an extent of the file reserved by the B+ tree.
+	NewPageNear(hintPageId uint64, owner uint64) (uint64, error)
+
+	// NewPageInTablespace allocates a new page in the data file of a tablespace and returns its page ID.
+	NewPageInTablespace(tablespaceId uint64) (uint64, error)
+
 	// If page is allocated in the file, but guard couldn't be acquired, then the allocated page must be added to the deallocatedPageId list.
 	CleanupPage(pageID uint64)
 
 	NewWriteGuard(pageId uint64) (*WriteGuard, error)
 	NewReadGuard(pageId uint64) (*ReadGuard, error)
 
+	// NewWriteGuardWithContext and NewReadGuardWithContext wait for a frame to be unpinned if all frames are pinned,
+	// until the context is done.
+	NewWriteGuardWithContext(ctx context.Context, pageId uint64) (*WriteGuard, error)
+	NewReadGuardWithContext(ctx context.Context, pageId uint64) (*ReadGuard, error)
+
+	// ReadAhead asynchronously loads up to numPages pages of a page chain into the buffer pool, starting at pageId,
+	// so a scan following the chain finds them in memory.
+	ReadAhead(pageId uint64, numPages int, nextPageId NextPageIdFunc)
+
+	// Resize grows or shrinks the buffer pool to poolSize frames while it is in use.
+	Resize(poolSize int) error
+
+	// Stats returns a snapshot of the buffer pool's counters, such as hits, misses and evictions.
+	Stats() BufferPoolStats
+
+	// Sync is a commit point. It writes every dirty page and the metadata page to disk,
+	// and syncs them to stable storage if the sync mode syncs on commit.
+	Sync() error
+
+	// SetSyncConfig changes when the database file is synced to stable storage.
+	SetSyncConfig(config SyncConfig) error
+
+	// NewPageBelow reuses the lowest deallocated page below limit, so a page can be moved towards the start of the file.
+	NewPageBelow(limit uint64) (pageId uint64, found bool)
+
+	// AllocatedPages returns the greatest allocated page ID, and the number of deallocated pages below it.
+	AllocatedPages() (maxAllocatedPageId uint64, deallocatedPages int)
+
+	// Shrink writes every dirty page to disk, then truncates the deallocated pages at the end of the file.
+	Shrink() (releasedPages int, err error)
+
 	// Close is called during shutdown to ensure data durability.
 	// It flushes all dirty pages to disk, writes the free list metadata page,
 	// and closes the underlying file.
@@ -43,6 +94,9 @@ type BufferPoolManager interface {
 	// it returns the cached frame.
 	fetchPage(pageID uint64) (*Frame, error)
 
+	// fetchPageWithContext is similar to fetchPage, but waits for a frame to be unpinned if all frames are pinned, until the context is done.
+	fetchPageWithContext(ctx context.Context, pageID uint64) (*Frame, error)
+
 	// deletePage removes a page with the given page ID from both memory and disk.
 	// Returns true if the deletion was successful.
 	deletePage(pageID uint64) (bool, error)
@@ -73,88 +127,158 @@ type Frame struct {
 
 	// used to synchronize access to the page and its metadata stored in the frame.
 	mutex *sync.RWMutex
+
+	// set while a page is being read into the frame, and the evicted page is being written back. Closed once the frame is usable.
+	inFlight chan struct{}
 }
 
 type SimpleBufferPoolManager struct {
 
-	// Replacer is a component used by the Buffer Pool Manager to decide which page to evict
-	// when there are no free frames available.
-	// It tracks unpinned pages and provides a policy (e.g., LRU, Clock)
-	// for selecting a victim frame for replacement.
-	replacer Replacer
-
 	// DiskManager handles all interactions with the disk.
 	// It is responsible for allocating and deallocating page IDs,
 	// reading pages from disk into memory, and writing pages from memory back to disk.
 	// It also manages metadata such as the list of deallocated page IDs and the next available page ID.
 	disk DiskManager
 
-	lookupMutex *sync.RWMutex
+	// partitions of the buffer pool, each with its own page table, frames, free frame list and replacer.
+	// A page is always stored in the shard chosen by getShard.
+	//
+	// Each shard's Replacer is a component used to decide which page to evict
+	// when there are no free frames available.
+	// It tracks unpinned pages and provides a policy (e.g., LRU, Clock)
+	// for selecting a victim frame for replacement.
+	shards []*bufferPoolShard
+
+	// size of each page in the file
+	pageSize int
 
-	// pageTable is used to map page IDs to frame IDs.
-	// It is used to keep track of which page is currently stored in which frame.
-	pageTable map[uint64]FrameID
+	// size of the part of each page handed out to guards, smaller than pageSize if the disk manager reserves space at the end of every page.
+	pageDataSize int
 
-	// fixed size array of frames.
-	frames []*Frame
+	// total number of frames in all shards, changed by Resize.
+	poolSizeMutex *sync.RWMutex
+	poolSize      int
 
-	// used to keep track of empty frames.
-	freeFrames []FrameID
+	// time fetchPage waits for a frame to be unpinned when all frames are pinned, 0 to return ErrBufferPoolExhausted immediately.
+	pinWaitTimeoutMutex *sync.RWMutex
+	pinWaitTimeout      time.Duration
 
-	// used to synchronize access to the list of free frames.
-	frameAllocationMutex *sync.Mutex
+	// goroutine flushing dirty pages ahead of eviction, nil if it isn't running.
+	backgroundWriterMutex *sync.Mutex
+	backgroundWriter      *backgroundWriter
 
-	// size of each page in the file
-	pageSize int
+	// goroutines loading pages ahead of sequential scans.
+	readAhead *readAheadState
 
-	// size of the frames array
-	poolSize int
+	// counters returned by Stats.
+	counters *bufferPoolCounters
+
+	// trace of page accesses, nil unless StartAccessTrace was called. The mutex serializes starting and stopping the trace.
+	accessTraceMutex *sync.Mutex
+	accessTrace      *atomic.Pointer[accessTrace]
 }
 
+// NewSimpleBufferPoolManager creates a buffer pool with a single shard, using the given replacer.
 func NewSimpleBufferPoolManager(poolSize int, pageSize int, replacer Replacer, disk DiskManager) (*SimpleBufferPoolManager, error) {
 
-	frames := make([]*Frame, poolSize)
+	return newSimpleBufferPoolManager(poolSize, pageSize, []Replacer{replacer}, disk)
+}
+
+// NewShardedBufferPoolManager creates a buffer pool split into numShards shards, each using its own replacer implementing the given policy.
+// Frames are divided evenly between the shards. A shard only evicts its own frames, so a fetch can find every frame of its shard pinned
+// while other shards have free frames.
+func NewShardedBufferPoolManager(poolSize int, pageSize int, numShards int, policy ReplacementPolicy, disk DiskManager) (*SimpleBufferPoolManager, error) {
+
+	if numShards <= 0 || numShards > poolSize {
+		return nil, fmt.Errorf("number of shards must be between 1 and the pool size %d, got %d", poolSize, numShards)
+	}
 
-	for i := range frames {
+	replacers := make([]Replacer, numShards)
 
-		buf, err := createFrameBuffer(pageSize)
+	for i := range replacers {
+
+		replacer, err := NewReplacer(policy, shardPoolSize(poolSize, numShards, i))
 
 		if err != nil {
 			return nil, err
 		}
-		frames[i] = &Frame{
-			mutex:         &sync.RWMutex{},
-			pinCountMutex: &sync.Mutex{},
-			data:          buf,
+		replacers[i] = replacer
+	}
+
+	return newSimpleBufferPoolManager(poolSize, pageSize, replacers, disk)
+}
+
+// shardPoolSize returns the number of frames owned by a shard, the first poolSize % numShards shards own an extra frame.
+func shardPoolSize(poolSize int, numShards int, shardIndex int) int {
+
+	numFrames := poolSize / numShards
+
+	if shardIndex < poolSize%numShards {
+		numFrames++
+	}
+
+	return numFrames
+}
+
+func newSimpleBufferPoolManager(poolSize int, pageSize int, replacers []Replacer, disk DiskManager) (*SimpleBufferPoolManager, error) {
+
+	// frames are read from and written to the file as whole pages, so they must be the size of the pages in the file.
+	if pageSize != disk.getPageSize() {
+		return nil, fmt.Errorf("page size %d doesn't match the page size %d of the database file", pageSize, disk.getPageSize())
+	}
+
+	shards := make([]*bufferPoolShard, len(replacers))
+
+	for i, replacer := range replacers {
+
+		shard, err := newBufferPoolShard(shardPoolSize(poolSize, len(replacers), i), pageSize, replacer)
+
+		if err != nil {
+			return nil, err
 		}
+		shards[i] = shard
 	}
 
-	freeFrames := make([]FrameID, 0)
+	pageDataSize := pageSize
 
-	for i := range poolSize {
-		freeFrames = append(freeFrames, FrameID(i))
+	if reserver, ok := disk.(pageSpaceReserver); ok {
+		pageDataSize -= reserver.reservedPageSpace()
 	}
 
 	return &SimpleBufferPoolManager{
-		replacer: replacer,
-		disk:     disk,
+		disk:   disk,
+		shards: shards,
+
+		poolSizeMutex: &sync.RWMutex{},
+		poolSize:      poolSize,
+		pageSize:      pageSize,
+		pageDataSize:  pageDataSize,
+
+		pinWaitTimeoutMutex: &sync.RWMutex{},
 
-		lookupMutex: &sync.RWMutex{},
-		pageTable:   make(map[uint64]FrameID),
-		frames:      frames,
+		backgroundWriterMutex: &sync.Mutex{},
 
-		frameAllocationMutex: &sync.Mutex{},
-		freeFrames:           freeFrames,
-		poolSize:             poolSize,
-		pageSize:             pageSize,
+		readAhead: newReadAheadState(),
+
+		counters: &bufferPoolCounters{},
+
+		accessTraceMutex: &sync.Mutex{},
+		accessTrace:      &atomic.Pointer[accessTrace]{},
 	}, nil
 }
 
 func (bufferPool *SimpleBufferPoolManager) PrintAllPages() {
 
-	for pageId, frameId := range bufferPool.pageTable {
+	for _, shard := range bufferPool.shards {
+
+		shard.lookupMutex.RLock()
+
+		for pageId, frameId := range shard.pageTable {
+
+			slog.Info(fmt.Sprintf("page-id %d frame-id %d data = %v", pageId, frameId, shard.frames[frameId]))
+		}
 
-		slog.Info(fmt.Sprintf("page-id %d frame-id %d data = %v", pageId, frameId, bufferPool.frames[frameId]))
+		shard.lookupMutex.RUnlock()
 	}
 }
 
@@ -164,115 +288,161 @@ func (bufferPool *SimpleBufferPoolManager) NewPage() (uint64, error) {
 	return bufferPool.disk.allocatePage()
 }
 
+// NewPageNear is a thread-safe function that allocates a new page for a B+ tree close to hintPageId, and returns its page ID.
+// Leaf nodes split from the same leaf node are stored in the same extents, so range scans read the file mostly sequentially.
+func (bufferPool *SimpleBufferPoolManager) NewPageNear(hintPageId uint64, owner uint64) (uint64, error) {
+
+	return bufferPool.disk.allocatePageNear(hintPageId, owner)
+}
+
+// NewPageInTablespace is a thread-safe function that allocates a new page in the data file of a tablespace, and returns its page ID.
+// Disk managers storing the database in a single file only have the primary tablespace.
+func (bufferPool *SimpleBufferPoolManager) NewPageInTablespace(tablespaceId uint64) (uint64, error) {
+
+	if tablespaceId == PRIMARY_TABLESPACE_ID {
+		return bufferPool.disk.allocatePage()
+	}
+
+	if allocator, ok := bufferPool.disk.(tablespaceAllocator); ok {
+		return allocator.allocatePageInTablespace(tablespaceId)
+	}
+
+	return 0, fmt.Errorf("tablespace %d doesn't exist", tablespaceId)
+}
+
 // If page is allocated in the file, but guard couldn't be acquired, then the allocated page must be added to the deallocatedPageId list.
 func (bufferPool *SimpleBufferPoolManager) CleanupPage(pageID uint64) {
 
 	bufferPool.disk.deallocatePage(pageID)
 }
 
+// SetPinWaitTimeout sets how long page guards created without a context wait for a frame to be unpinned when all frames are pinned.
+// A timeout of 0 makes them return ErrBufferPoolExhausted immediately.
+func (bufferPool *SimpleBufferPoolManager) SetPinWaitTimeout(timeout time.Duration) {
+
+	bufferPool.pinWaitTimeoutMutex.Lock()
+	defer bufferPool.pinWaitTimeoutMutex.Unlock()
+
+	bufferPool.pinWaitTimeout = timeout
+}
+
 // fetchPage returns a pointer to the frame storing the page with a given page ID.
+// If all frames are pinned, it waits for the pin wait timeout before returning ErrBufferPoolExhausted.
 // DO NOT call fetchPage directly, as it is not thread-safe.
 // Always use a page guard to access page data.
 func (bufferPool *SimpleBufferPoolManager) fetchPage(pageId uint64) (*Frame, error) {
 
-	bufferPool.lookupMutex.RLock()
-	slog.Info(fmt.Sprintf("fetching page %d", pageId), "function", "fetchPage", "at", "buffer Pool Manager")
-	slog.Info(fmt.Sprintf("page table => %v", bufferPool.pageTable), "function", "fetchPage", "at", "buffer Pool Manager")
-	frameId, exists := bufferPool.pageTable[pageId]
-	if exists {
+	bufferPool.pinWaitTimeoutMutex.RLock()
+	pinWaitTimeout := bufferPool.pinWaitTimeout
+	bufferPool.pinWaitTimeoutMutex.RUnlock()
 
-		slog.Info(fmt.Sprintf("page %d found in memory", pageId), "function", "fetchPage", "at", "buffer Pool Manager")
-		frame := bufferPool.frames[frameId]
+	if pinWaitTimeout == 0 {
+		frame, _, err := bufferPool.tryFetchPage(pageId)
+		return frame, err
+	}
 
-		frame.pinCountMutex.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), pinWaitTimeout)
+	defer cancel()
 
-		frame.pinCount++
+	return bufferPool.fetchPageWithContext(ctx, pageId)
+}
 
-		if frame.pinCount == 1 {
+// fetchPageWithContext returns a pointer to the frame storing the page with a given page ID.
+// If all frames are pinned, it waits for a frame to be unpinned until the context is done.
+func (bufferPool *SimpleBufferPoolManager) fetchPageWithContext(ctx context.Context, pageId uint64) (*Frame, error) {
 
-			bufferPool.replacer.remove(frameId)
-		}
+	for {
 
-		frame.pinCountMutex.Unlock()
+		frame, frameReleased, err := bufferPool.tryFetchPage(pageId)
 
-		bufferPool.lookupMutex.RUnlock()
+		if !errors.Is(err, ErrBufferPoolExhausted) {
+			return frame, err
+		}
 
-		return frame, nil
-	}
+		slog.Info("All frames of the shard are pinned, waiting for a frame to be released...", "pageId", pageId, "function", "fetchPageWithContext", "at", "buffer Pool Manager")
 
-	bufferPool.lookupMutex.RUnlock()
+		bufferPool.counters.pinWaits.Add(1)
 
-	bufferPool.lookupMutex.Lock()
-	defer bufferPool.lookupMutex.Unlock()
+		select {
 
-	frameId, exists = bufferPool.pageTable[pageId]
+		case <-frameReleased:
 
-	if exists {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrBufferPoolExhausted, ctx.Err())
+		}
+	}
+}
 
-		frame := bufferPool.frames[frameId]
+// tryFetchPage returns a pointer to the frame storing the page with a given page ID.
+// If all frames of the page's shard are pinned, it returns ErrBufferPoolExhausted, along with a channel that is closed once a frame is released.
+func (bufferPool *SimpleBufferPoolManager) tryFetchPage(pageId uint64) (frame *Frame, frameReleased <-chan struct{}, err error) {
 
-		frame.pinCountMutex.Lock()
+	shard := bufferPool.getShard(pageId)
 
-		frame.pinCount++
+	slog.Info(fmt.Sprintf("fetching page %d", pageId), "function", "fetchPage", "at", "buffer Pool Manager")
 
-		if frame.pinCount == 1 {
-			bufferPool.replacer.remove(frameId)
-		}
-		frame.pinCountMutex.Unlock()
+	for {
 
-		return frame, nil
+		shard.lookupMutex.RLock()
 
-	}
+		frameId, exists := shard.pageTable[pageId]
 
-	data, err := bufferPool.disk.read(int64(pageId)*int64(bufferPool.pageSize), bufferPool.pageSize)
+		if exists {
 
-	if err != nil {
-		slog.Error("Failed to read page from disk", "pageId", pageId, "error", err.Error(), "function", "fetchPage", "at", "buffer Pool Manager")
-		return nil, err
-	}
+			// the page, or the page being evicted from the frame, is being loaded. Wait for the load to finish and look the page up again.
+			if inFlight := shard.frames[frameId].inFlight; inFlight != nil {
 
-	bufferPool.frameAllocationMutex.Lock()
+				shard.lookupMutex.RUnlock()
+				<-inFlight
+				continue
+			}
 
-	var newFrameId FrameID
-	if len(bufferPool.freeFrames) > 0 {
+			slog.Info(fmt.Sprintf("page %d found in memory", pageId), "function", "fetchPage", "at", "buffer Pool Manager")
+			frame := shard.pin(frameId)
 
-		newFrameId = bufferPool.freeFrames[0]
+			shard.lookupMutex.RUnlock()
 
-		slog.Info(fmt.Sprintf("free frame chosen => %d", newFrameId), "function", "fetchPage", "at", "buffer Pool Manager")
+			bufferPool.counters.hits.Add(1)
+			bufferPool.recordAccess(pageId)
 
-		bufferPool.freeFrames = bufferPool.freeFrames[1:]
+			return frame, nil, nil
+		}
+
+		shard.lookupMutex.RUnlock()
 
-		slog.Info(fmt.Sprintf("free frame list => %v", bufferPool.freeFrames), "function", "fetchPage", "at", "buffer Pool Manager")
-	} else {
-		newFrameId = bufferPool.replacer.victim()
+		shard.lookupMutex.Lock()
 
-		frame := bufferPool.frames[newFrameId]
+		frameId, exists = shard.pageTable[pageId]
 
-		delete(bufferPool.pageTable, frame.pageId)
+		if exists {
 
-		if frame.dirty {
+			if inFlight := shard.frames[frameId].inFlight; inFlight != nil {
 
-			// handle error correctly.
-			if err := bufferPool.disk.write(int64(frame.pageId)*int64(bufferPool.pageSize), frame.data); err != nil {
-				return nil, err
+				shard.lookupMutex.Unlock()
+				<-inFlight
+				continue
 			}
-		}
 
-	}
+			frame := shard.pin(frameId)
 
-	bufferPool.frameAllocationMutex.Unlock()
+			shard.lookupMutex.Unlock()
 
-	frame := bufferPool.frames[newFrameId]
+			bufferPool.counters.hits.Add(1)
+			bufferPool.recordAccess(pageId)
 
-	copy(frame.data, data)
-	frame.pinCount = 1
-	frame.pageId = pageId
-	frame.dirty = false
+			return frame, nil, nil
+		}
+
+		frame, frameReleased, err := bufferPool.loadPage(shard, pageId, false)
 
-	bufferPool.pageTable[pageId] = newFrameId
+		shard.lookupMutex.Unlock()
 
-	return frame, nil
+		if err == nil {
+			bufferPool.recordAccess(pageId)
+		}
 
+		return frame, frameReleased, err
+	}
 }
 
 // deletePage is used to deallocate a page which contains data that is no longer useful.
@@ -280,11 +450,13 @@ func (bufferPool *SimpleBufferPoolManager) fetchPage(pageId uint64) (*Frame, err
 // always call the DeletePage function of the write guard corresponding to a page, to safely delete it.
 func (bufferPool *SimpleBufferPoolManager) deletePage(pageId uint64) (bool, error) {
 
-	bufferPool.lookupMutex.Lock()
-	defer bufferPool.lookupMutex.Unlock()
+	shard := bufferPool.getShard(pageId)
+
+	shard.lookupMutex.Lock()
+	defer shard.lookupMutex.Unlock()
 
 	// 1. Fetch frameId corresponding to pageId.
-	frameId, exists := bufferPool.pageTable[pageId]
+	frameId, exists := shard.pageTable[pageId]
 
 	// 2. If page not in memory, return false.
 	if !exists {
@@ -292,7 +464,7 @@ func (bufferPool *SimpleBufferPoolManager) deletePage(pageId uint64) (bool, erro
 	}
 
 	// 3. Fetch frame.
-	frame := bufferPool.frames[frameId]
+	frame := shard.frames[frameId]
 
 	frame.pinCountMutex.Lock()
 
@@ -304,13 +476,11 @@ func (bufferPool *SimpleBufferPoolManager) deletePage(pageId uint64) (bool, erro
 	}
 	frame.pinCountMutex.Unlock()
 
-	bufferPool.frameAllocationMutex.Lock()
-	// 5. Add frameId to freeFrames.
-	bufferPool.freeFrames = append(bufferPool.freeFrames, frameId)
-	bufferPool.frameAllocationMutex.Unlock()
+	// 5. Delete page table entry.
+	delete(shard.pageTable, pageId)
 
-	// 6. Delete page table entry.
-	delete(bufferPool.pageTable, pageId)
+	// 6. Add frameId to freeFrames, and discard the access history of the page.
+	shard.releaseFrame(frameId)
 
 	// 7. Deallocate page in file.
 	bufferPool.disk.deallocatePage(pageId)
@@ -325,11 +495,13 @@ func (bufferPool *SimpleBufferPoolManager) deletePage(pageId uint64) (bool, erro
 // unpinPage is used to decrement the pin count of a page.
 func (bufferPool *SimpleBufferPoolManager) unpinPage(pageId uint64) bool {
 
-	bufferPool.lookupMutex.RLock()
-	defer bufferPool.lookupMutex.RUnlock()
+	shard := bufferPool.getShard(pageId)
+
+	shard.lookupMutex.RLock()
+	defer shard.lookupMutex.RUnlock()
 
 	// 1. Fetch frameId corresponding to pageId.
-	frameId, exists := bufferPool.pageTable[pageId]
+	frameId, exists := shard.pageTable[pageId]
 
 	// 2. If page not in memory, return false.
 	if !exists {
@@ -337,16 +509,17 @@ func (bufferPool *SimpleBufferPoolManager) unpinPage(pageId uint64) bool {
 	}
 
 	// 3. Fetch frame.
-	frame := bufferPool.frames[frameId]
+	frame := shard.frames[frameId]
 
 	frame.pinCountMutex.Lock()
 
 	// 4. Decrement pin count.
 	frame.pinCount--
 
-	// 5. If pin count = 0, add frame to replacer.
+	// 5. If pin count = 0, add frame to replacer, and wake up fetches waiting for a frame.
 	if frame.pinCount == 0 {
-		bufferPool.replacer.insert(frameId)
+		shard.replacer.insert(frameId)
+		shard.signalFrameReleased()
 	}
 
 	frame.pinCountMutex.Unlock()
@@ -357,27 +530,147 @@ func (bufferPool *SimpleBufferPoolManager) unpinPage(pageId uint64) bool {
 // flushAllPages is used to write all dirty pages to disk, currently used during database shutdown.
 func (bufferPool *SimpleBufferPoolManager) flushAllPages() error {
 
-	bufferPool.lookupMutex.RLock()
-	defer bufferPool.lookupMutex.RUnlock()
+	for _, shard := range bufferPool.shards {
+		shard.lookupMutex.RLock()
+		defer shard.lookupMutex.RUnlock()
+	}
 
-	for pageId, frameId := range bufferPool.pageTable {
+	dirtyPageIds := make([]uint64, 0)
+	buffersByPageId := make(map[uint64][]byte)
 
-		frame := bufferPool.frames[frameId]
+	for _, shard := range bufferPool.shards {
 
-		if frame.dirty {
+		for pageId, frameId := range shard.pageTable {
 
-			if err := bufferPool.disk.write(int64(pageId)*int64(bufferPool.pageSize), frame.data); err != nil {
-				return err
+			frame := shard.frames[frameId]
+
+			// frames being loaded are skipped, their evicted page is written back by the load.
+			if frame.dirty && frame.inFlight == nil {
+				dirtyPageIds = append(dirtyPageIds, pageId)
+				buffersByPageId[pageId] = frame.data
 			}
 		}
 	}
 
+	// sorting the pages lets runs of consecutive pages be written with a single vectored write.
+	slices.Sort(dirtyPageIds)
+
+	buffers := make([][]byte, len(dirtyPageIds))
+
+	for i, pageId := range dirtyPageIds {
+		buffers[i] = buffersByPageId[pageId]
+	}
+
+	if err := bufferPool.disk.writePages(dirtyPageIds, buffers); err != nil {
+		return err
+	}
+
+	bufferPool.counters.dirtyWrites.Add(uint64(len(dirtyPageIds)))
+
 	return nil
 }
 
+// Sync writes every dirty page in the buffer pool to disk, followed by the metadata page, and syncs the file if the sync mode syncs on commit.
+// Pages are flushed one at a time while the buffer pool is in use, so pages modified by operations still in progress
+// are written in whatever state they are in. Callers wanting a consistent commit must stop writes to the B+ trees first.
+func (bufferPool *SimpleBufferPoolManager) Sync() error {
+
+	fmt.Println()
+	slog.Info("Syncing buffer pool...", "function", "Sync", "at", "buffer Pool Manager")
+
+	if err := bufferPool.flushDirtyPages(); err != nil {
+		return err
+	}
+
+	return bufferPool.disk.sync()
+}
+
+// flushDirtyPages writes every dirty page in the buffer pool to disk one at a time, while the buffer pool is in use.
+func (bufferPool *SimpleBufferPoolManager) flushDirtyPages() error {
+
+	// the dirty flag can only be read under the page lock, so every page in the buffer pool is checked by flushPage.
+	pageIds := make([]uint64, 0)
+
+	for _, shard := range bufferPool.shards {
+
+		shard.lookupMutex.RLock()
+
+		for pageId := range shard.pageTable {
+			pageIds = append(pageIds, pageId)
+		}
+
+		shard.lookupMutex.RUnlock()
+	}
+
+	slices.Sort(pageIds)
+
+	for _, pageId := range pageIds {
+
+		if err := bufferPool.flushPage(pageId); err != nil {
+			slog.Error("Failed to flush page", "pageId", pageId, "error", err.Error(), "function", "flushDirtyPages", "at", "buffer Pool Manager")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushPage writes a page to disk if it is in the buffer pool and dirty, waiting for write guards holding it to be released.
+// Pages evicted since they were found in the page table were written back when they were evicted.
+func (bufferPool *SimpleBufferPoolManager) flushPage(pageId uint64) error {
+
+	shard := bufferPool.getShard(pageId)
+
+	shard.lookupMutex.RLock()
+
+	frameId, exists := shard.pageTable[pageId]
+
+	// a frame being loaded is clean, its evicted page is written back by the load.
+	if !exists || shard.frames[frameId].inFlight != nil {
+		shard.lookupMutex.RUnlock()
+		return nil
+	}
+
+	// pinning the frame prevents it from being reused for another page while the lookup mutex is released.
+	frame := shard.pin(frameId)
+
+	shard.lookupMutex.RUnlock()
+
+	defer bufferPool.unpinPage(pageId)
+
+	// waiting for the page lock while holding the lookup mutex could deadlock with a guard being released.
+	frame.mutex.Lock()
+	defer frame.mutex.Unlock()
+
+	if !frame.dirty {
+		return nil
+	}
+
+	if err := bufferPool.disk.write(int64(pageId)*int64(bufferPool.pageSize), frame.data); err != nil {
+		return err
+	}
+
+	frame.dirty = false
+	bufferPool.counters.dirtyWrites.Add(1)
+
+	return nil
+}
+
+// SetSyncConfig changes when the database file is synced to stable storage.
+func (bufferPool *SimpleBufferPoolManager) SetSyncConfig(config SyncConfig) error {
+	return bufferPool.disk.setSyncConfig(config)
+}
+
 // Close must be executed to ensure correct shutdown of buffer pool manager.
 func (bufferPool *SimpleBufferPoolManager) Close() error {
 
+	bufferPool.stopBackgroundWriter()
+	bufferPool.stopReadAhead()
+
+	if err := bufferPool.StopAccessTrace(); err != nil {
+		return err
+	}
+
 	if err := bufferPool.flushAllPages(); err != nil {
 		return err
 	}
@@ -396,9 +689,11 @@ func (bufferPool *SimpleBufferPoolManager) Close() error {
 
 func (bufferPool *SimpleBufferPoolManager) releaseAllFrameBuffers() error {
 
-	for _, frame := range bufferPool.frames {
-		if err := releaseFrameBuffer(frame.data); err != nil {
-			return err
+	for _, shard := range bufferPool.shards {
+		for _, frame := range shard.frames {
+			if err := releaseFrameBuffer(frame.data); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -411,11 +706,7 @@ func releaseFrameBuffer(buffer []byte) error {
 
 func createFrameBuffer(size int) ([]byte, error) {
 
-	data := AllocateAlignedBuffer()
-
-	if len(data) < size {
-		return nil, fmt.Errorf("buffer size is less than requested size")
-	}
+	data := AllocateAlignedBuffer(size)
 
 	if err := unix.Mlock(data); err != nil {
 		return nil, err
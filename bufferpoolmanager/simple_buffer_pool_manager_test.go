@@ -1,11 +1,13 @@
 package bufferpoolmanager
 
 import (
+	"context"
 	"encoding/binary"
 	"log"
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
 	"github.com/ncw/directio"
@@ -74,14 +76,18 @@ func (bs *BufferPoolManagerTestSuite) SetupTest() {
 
 	bs.Require().NoError(err)
 
-	disk := &DirectIODiskManager{
-		file:  file,
-		mutex: &sync.Mutex{},
+	disk := &DirectIODiskManager{databaseFile: &databaseFile{
+		file:     file,
+		mutex:    &sync.Mutex{},
+		pageSize: PAGE_SIZE,
+		directIO: true,
+		syncer:   newFileSyncer(file),
+		extents:  newExtentAllocator(),
 		metadata: &codec.MetaData{
 			DeallocatedPageIdList: make([]uint64, 0),
 			MaxAllocatedPageId:    7,
 		},
-	}
+	}}
 
 	bs.disk = disk
 
@@ -116,10 +122,10 @@ func (bs *BufferPoolManagerTestSuite) TesthMultiplePageFetch() {
 
 	bs.Suite.Assert().Equal(true, checkPage(1, frame.data))
 
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
-	log.Printf("free frames => %v", bs.bufferPool.freeFrames)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
+	log.Printf("free frames => %v", bs.bufferPool.shards[0].freeFrames)
 
-	bs.Suite.Assert().Equal(FrameID(1), bs.bufferPool.freeFrames[0])
+	bs.Suite.Assert().Equal(FrameID(1), bs.bufferPool.shards[0].freeFrames[0])
 
 	//------------------------------------------
 
@@ -134,10 +140,10 @@ func (bs *BufferPoolManagerTestSuite) TesthMultiplePageFetch() {
 
 	bs.Suite.Assert().Equal(true, checkPage(0, frame.data))
 
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
-	log.Printf("free frames => %v", bs.bufferPool.freeFrames)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
+	log.Printf("free frames => %v", bs.bufferPool.shards[0].freeFrames)
 
-	//bs.Suite.Assert().Equal(0, len(bs.bufferPool.freeFrames))
+	//bs.Suite.Assert().Equal(0, len(bs.bufferPool.shards[0].freeFrames))
 
 	// unpin page 0
 	bs.bufferPool.unpinPage(0)
@@ -159,10 +165,10 @@ func (bs *BufferPoolManagerTestSuite) TesthMultiplePageFetch() {
 
 	bs.Suite.Assert().Equal(true, checkPage(5, frame.data))
 
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
-	log.Printf("free frames => %v", bs.bufferPool.freeFrames)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
+	log.Printf("free frames => %v", bs.bufferPool.shards[0].freeFrames)
 
-	bs.Suite.Assert().Equal(0, len(bs.bufferPool.freeFrames))
+	bs.Suite.Assert().Equal(0, len(bs.bufferPool.shards[0].freeFrames))
 
 	// unpin page 5
 	bs.bufferPool.unpinPage(5)
@@ -183,10 +189,10 @@ func (bs *BufferPoolManagerTestSuite) TesthMultiplePageFetch() {
 
 	bs.Suite.Assert().Equal(true, checkPage(7, frame.data))
 
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
-	log.Printf("free frames => %v", bs.bufferPool.freeFrames)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
+	log.Printf("free frames => %v", bs.bufferPool.shards[0].freeFrames)
 
-	bs.Suite.Assert().Equal(0, len(bs.bufferPool.freeFrames))
+	bs.Suite.Assert().Equal(0, len(bs.bufferPool.shards[0].freeFrames))
 
 	//------------------------------------------
 
@@ -225,13 +231,13 @@ func (bs *BufferPoolManagerTestSuite) TestDeletePage() {
 
 	bs.Suite.Assert().NoError(err)
 
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
-	log.Printf("free frames => %v", bs.bufferPool.freeFrames)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
+	log.Printf("free frames => %v", bs.bufferPool.shards[0].freeFrames)
 
 	_, err = bs.bufferPool.deletePage(0)
 
 	bs.Suite.Assert().NoError(err)
-	log.Printf("page table => %v", bs.bufferPool.pageTable)
+	log.Printf("page table => %v", bs.bufferPool.shards[0].pageTable)
 	log.Printf("deallocated page id list => %v", bs.disk.metadata.DeallocatedPageIdList)
 	bs.Suite.Assert().Equal(uint64(0), bs.disk.metadata.DeallocatedPageIdList[0])
 
@@ -291,6 +297,77 @@ func (bs *BufferPoolManagerTestSuite) TestDirtyPageEviction() {
 	bs.Suite.Assert().Equal(true, checkPage(10, frame.data))
 
 }
+
+// pinAllFrames fetches as many pages as there are frames, without unpinning them.
+func (bs *BufferPoolManagerTestSuite) pinAllFrames() {
+
+	for pageId := range bs.bufferPool.poolSize {
+		_, err := bs.bufferPool.fetchPage(uint64(pageId))
+		bs.Require().NoError(err)
+	}
+}
+
+func (bs *BufferPoolManagerTestSuite) TestBufferPoolExhausted() {
+
+	bs.pinAllFrames()
+
+	_, err := bs.bufferPool.fetchPage(5)
+	bs.Assert().ErrorIs(err, ErrBufferPoolExhausted)
+
+	_, err = bs.bufferPool.NewReadGuard(5)
+	bs.Assert().ErrorIs(err, ErrBufferPoolExhausted)
+
+	// pages already in the buffer pool can still be fetched
+	_, err = bs.bufferPool.fetchPage(0)
+	bs.Assert().NoError(err)
+
+	// once a frame is unpinned, its page can be evicted
+	bs.bufferPool.unpinPage(1)
+
+	frame, err := bs.bufferPool.fetchPage(5)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(true, checkPage(5, frame.data))
+}
+
+func (bs *BufferPoolManagerTestSuite) TestWaitForUnpinnedFrame() {
+
+	bs.pinAllFrames()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bs.bufferPool.unpinPage(2)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	guard, err := bs.bufferPool.NewReadGuardWithContext(ctx, 5)
+	bs.Require().NoError(err)
+	bs.Assert().Equal(true, checkPage(5, guard.GetPageData()))
+
+	guard.Done()
+}
+
+func (bs *BufferPoolManagerTestSuite) TestWaitForUnpinnedFrameTimesOut() {
+
+	bs.pinAllFrames()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := bs.bufferPool.NewWriteGuardWithContext(ctx, 5)
+	bs.Assert().ErrorIs(err, ErrBufferPoolExhausted)
+	bs.Assert().ErrorIs(err, context.DeadlineExceeded)
+
+	bs.bufferPool.SetPinWaitTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+
+	_, err = bs.bufferPool.NewWriteGuard(5)
+	bs.Assert().ErrorIs(err, ErrBufferPoolExhausted)
+	bs.Assert().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+}
+
 func TestBufferPoolManager(t *testing.T) {
 
 	suite.Run(t, new(BufferPoolManagerTestSuite))
@@ -0,0 +1,191 @@
+package bufferpoolmanager
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferPoolStats is a snapshot of the buffer pool's counters, returned by Stats.
+// Hits, Misses, Evictions, DirtyWrites, ReadAheadPages and PinWaits are cumulative since the buffer pool was created,
+// the remaining fields describe the buffer pool at the time of the snapshot.
+type BufferPoolStats struct {
+
+	// fetches that found the page in the buffer pool.
+	Hits uint64
+
+	// fetches that read the page from disk.
+	Misses uint64
+
+	// pages evicted from their frame to make room for another page, or because their frame was removed by Resize.
+	Evictions uint64
+
+	// dirty pages written to disk, by evictions, the background writer, Resize and Close.
+	DirtyWrites uint64
+
+	// pages loaded ahead of sequential scans.
+	ReadAheadPages uint64
+
+	// number of times a fetch waited for a frame to be unpinned, because every frame of the page's shard was pinned.
+	PinWaits uint64
+
+	PoolSize     int
+	FramesPinned int
+	FreeFrames   int
+
+	// number of frames that can currently be evicted.
+	ReplacerSize int
+}
+
+// HitRate returns the fraction of fetches that found the page in the buffer pool.
+func (stats BufferPoolStats) HitRate() float64 {
+
+	if stats.Hits+stats.Misses == 0 {
+		return 0
+	}
+
+	return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+}
+
+// bufferPoolCounters are updated without locks, since they are incremented on every fetch.
+type bufferPoolCounters struct {
+	hits           atomic.Uint64
+	misses         atomic.Uint64
+	evictions      atomic.Uint64
+	dirtyWrites    atomic.Uint64
+	readAheadPages atomic.Uint64
+	pinWaits       atomic.Uint64
+}
+
+// Stats returns a snapshot of the buffer pool's counters.
+func (bufferPool *SimpleBufferPoolManager) Stats() BufferPoolStats {
+
+	stats := BufferPoolStats{
+		Hits:           bufferPool.counters.hits.Load(),
+		Misses:         bufferPool.counters.misses.Load(),
+		Evictions:      bufferPool.counters.evictions.Load(),
+		DirtyWrites:    bufferPool.counters.dirtyWrites.Load(),
+		ReadAheadPages: bufferPool.counters.readAheadPages.Load(),
+		PinWaits:       bufferPool.counters.pinWaits.Load(),
+		PoolSize:       bufferPool.getPoolSize(),
+	}
+
+	for _, shard := range bufferPool.shards {
+
+		shard.lookupMutex.RLock()
+
+		for _, frame := range shard.frames {
+
+			frame.pinCountMutex.Lock()
+			if frame.pinCount > 0 {
+				stats.FramesPinned++
+			}
+			frame.pinCountMutex.Unlock()
+		}
+
+		shard.frameAllocationMutex.Lock()
+		stats.FreeFrames += len(shard.freeFrames)
+		shard.frameAllocationMutex.Unlock()
+
+		stats.ReplacerSize += shard.replacer.size()
+
+		shard.lookupMutex.RUnlock()
+	}
+
+	return stats
+}
+
+// accessTrace records the ID of every page fetched through a page guard, in the format read by ReadPageAccessTrace,
+// so the access pattern of a workload can be replayed against different replacers with ReplayPageAccessTrace.
+type accessTrace struct {
+	mutex  *sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+
+	// set once the trace file is closed, accesses that raced with StopAccessTrace are dropped.
+	closed bool
+}
+
+// StartAccessTrace starts recording page accesses to a new file at filePath. Read ahead is not recorded, since it isn't an access.
+func (bufferPool *SimpleBufferPoolManager) StartAccessTrace(filePath string) error {
+
+	bufferPool.accessTraceMutex.Lock()
+	defer bufferPool.accessTraceMutex.Unlock()
+
+	if bufferPool.accessTrace.Load() != nil {
+		return fmt.Errorf("access trace is already being recorded")
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	trace := &accessTrace{
+		mutex:  &sync.Mutex{},
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}
+
+	if _, err := fmt.Fprintf(trace.writer, "# page access trace, pool size %d\n", bufferPool.getPoolSize()); err != nil {
+		file.Close()
+		return err
+	}
+
+	bufferPool.accessTrace.Store(trace)
+
+	slog.Info("Started recording page accesses", "filePath", filePath, "function", "StartAccessTrace", "at", "buffer Pool Manager")
+
+	return nil
+}
+
+// StopAccessTrace stops recording page accesses, and closes the trace file. It does nothing if no trace is being recorded.
+func (bufferPool *SimpleBufferPoolManager) StopAccessTrace() error {
+
+	bufferPool.accessTraceMutex.Lock()
+	defer bufferPool.accessTraceMutex.Unlock()
+
+	trace := bufferPool.accessTrace.Swap(nil)
+
+	if trace == nil {
+		return nil
+	}
+
+	// wait for accesses that loaded the trace before it was swapped out.
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+
+	trace.closed = true
+
+	if err := trace.writer.Flush(); err != nil {
+		trace.file.Close()
+		return err
+	}
+
+	return trace.file.Close()
+}
+
+// recordAccess appends a page access to the trace, if one is being recorded.
+func (bufferPool *SimpleBufferPoolManager) recordAccess(pageId uint64) {
+
+	trace := bufferPool.accessTrace.Load()
+
+	if trace == nil {
+		return
+	}
+
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+
+	if trace.closed {
+		return
+	}
+
+	if _, err := fmt.Fprintln(trace.writer, pageId); err != nil {
+		slog.Error("Failed to record page access", "pageId", pageId, "error", err.Error(), "function", "recordAccess", "at", "buffer Pool Manager")
+	}
+}
@@ -0,0 +1,94 @@
+package bufferpoolmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// readPages fetches each page through a read guard, releasing it straight away.
+func (bs *BufferPoolManagerTestSuite) readPages(pageIds ...uint64) {
+
+	for _, pageId := range pageIds {
+		guard, err := bs.bufferPool.NewReadGuard(pageId)
+		bs.Require().NoError(err)
+		guard.Done()
+	}
+}
+
+func (bs *BufferPoolManagerTestSuite) TestStats() {
+
+	bs.dirtyPage(0, 100)
+
+	// page 1 is a hit, page 3 evicts page 0, which is the least recently used page.
+	bs.readPages(1, 2, 1, 3)
+
+	guard, err := bs.bufferPool.NewReadGuard(3)
+	bs.Require().NoError(err)
+
+	stats := bs.bufferPool.Stats()
+
+	bs.Assert().Equal(uint64(2), stats.Hits)
+	bs.Assert().Equal(uint64(4), stats.Misses)
+	bs.Assert().Equal(uint64(1), stats.Evictions)
+	bs.Assert().Equal(uint64(1), stats.DirtyWrites)
+	bs.Assert().Equal(uint64(0), stats.PinWaits)
+	bs.Assert().Equal(3, stats.PoolSize)
+	bs.Assert().Equal(1, stats.FramesPinned)
+	bs.Assert().Equal(0, stats.FreeFrames)
+	bs.Assert().Equal(2, stats.ReplacerSize)
+	bs.Assert().InDelta(1.0/3, stats.HitRate(), 0.001)
+
+	guard.Done()
+
+	bs.assertPageOnDisk(0, 100)
+
+	bs.pinAllFrames()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = bs.bufferPool.NewReadGuardWithContext(ctx, 5)
+	bs.Assert().ErrorIs(err, ErrBufferPoolExhausted)
+
+	stats = bs.bufferPool.Stats()
+
+	bs.Assert().GreaterOrEqual(stats.PinWaits, uint64(1))
+	bs.Assert().Equal(3, stats.FramesPinned)
+	bs.Assert().Equal(0, stats.ReplacerSize)
+}
+
+func (bs *BufferPoolManagerTestSuite) TestAccessTrace() {
+
+	traceFilePath := filepath.Join(bs.T().TempDir(), "trace")
+
+	bs.Require().NoError(bs.bufferPool.StartAccessTrace(traceFilePath))
+	bs.Assert().Error(bs.bufferPool.StartAccessTrace(traceFilePath))
+
+	bs.readPages(0, 1, 2, 1, 3, 0, 4)
+
+	bs.Require().NoError(bs.bufferPool.StopAccessTrace())
+
+	// accesses after the trace is stopped aren't recorded.
+	bs.readPages(5)
+
+	file, err := os.Open(traceFilePath)
+	bs.Require().NoError(err)
+	defer file.Close()
+
+	trace, err := ReadPageAccessTrace(file)
+	bs.Require().NoError(err)
+	bs.Assert().Equal([]uint64{0, 1, 2, 1, 3, 0, 4}, trace)
+
+	// the trace file already exists.
+	bs.Assert().Error(bs.bufferPool.StartAccessTrace(traceFilePath))
+
+	// replaying the trace against the same replacer and pool size reproduces the buffer pool's counters.
+	stats := bs.bufferPool.Stats()
+	result := ReplayPageAccessTrace(NewLRUReplacer(), 3, trace)
+
+	bs.Assert().Equal(uint64(result.Hits), stats.Hits)
+	bs.Assert().Equal(uint64(result.Misses), stats.Misses-1)
+	bs.Assert().Equal(uint64(result.Evictions), stats.Evictions-1)
+}
@@ -0,0 +1,266 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncMode controls when a disk manager asks the operating system to flush written pages to stable storage.
+// Writing a page, even with Direct I/O, only hands it to the disk, which may keep it in its volatile cache,
+// and pages written past the end of the file aren't readable after a crash until the new file size is persisted.
+type SyncMode uint8
+
+const (
+
+	// the file is never synced, the operating system and the disk decide when written pages become durable.
+	SyncNone SyncMode = iota
+
+	// the file is synced at every commit, which is a call to Sync on the buffer pool manager, or closing the disk manager.
+	// Pages written before a commit are synced before the metadata page referring to them is written.
+	SyncPerCommit
+
+	// the file is synced every SyncConfig.Interval if pages were written since the last sync, and when the disk manager is closed.
+	// Commits don't wait for a sync, so writes made up to an interval before a crash may be lost.
+	SyncPeriodic
+
+	// the file is synced after every write, including the writes extending the file when pages are allocated.
+	SyncFull
+)
+
+// interval between syncs in SyncPeriodic mode, if none is configured.
+const DEFAULT_SYNC_INTERVAL = 1 * time.Second
+
+type SyncConfig struct {
+	Mode SyncMode
+
+	// time between syncs in SyncPeriodic mode, ignored in other modes.
+	Interval time.Duration
+}
+
+func DefaultSyncConfig() SyncConfig {
+
+	return SyncConfig{
+		Mode:     SyncPerCommit,
+		Interval: DEFAULT_SYNC_INTERVAL,
+	}
+}
+
+func (mode SyncMode) String() string {
+
+	switch mode {
+	case SyncNone:
+		return "none"
+	case SyncPerCommit:
+		return "per-commit"
+	case SyncPeriodic:
+		return "periodic"
+	case SyncFull:
+		return "full"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", uint8(mode))
+	}
+}
+
+// fileSyncer syncs a database file according to a SyncConfig. It is shared by the disk managers, which report every write to it.
+type fileSyncer struct {
+	file *os.File
+
+	// flushes the data of the file to stable storage, replaced by tests to observe syncs.
+	syncFile func(file *os.File) error
+
+	config atomic.Pointer[SyncConfig]
+
+	// set when data is written to the file, cleared when the file is synced.
+	unsyncedWrites *atomic.Bool
+
+	// serializes syncs, so a sync can't return while an earlier one that cleared unsyncedWrites is still flushing the writes it covers.
+	syncMutex *sync.Mutex
+
+	// serializes changes to the config, and starting and stopping the periodic sync goroutine.
+	mutex *sync.Mutex
+
+	// closed to signal the periodic sync goroutine to exit, nil if it isn't running.
+	shutdown  chan struct{}
+	waitGroup *sync.WaitGroup
+}
+
+func newFileSyncer(file *os.File) *fileSyncer {
+
+	syncer := &fileSyncer{
+		file:           file,
+		syncFile:       syncFileData,
+		unsyncedWrites: &atomic.Bool{},
+		syncMutex:      &sync.Mutex{},
+		mutex:          &sync.Mutex{},
+		waitGroup:      &sync.WaitGroup{},
+	}
+
+	config := DefaultSyncConfig()
+	syncer.config.Store(&config)
+
+	return syncer
+}
+
+// setConfig changes the sync mode, starting or stopping the periodic sync goroutine.
+// Pages written before the change are synced, so switching to a stricter mode covers them too.
+func (syncer *fileSyncer) setConfig(config SyncConfig) error {
+
+	if config.Mode > SyncFull {
+		return fmt.Errorf("unknown sync mode %d", config.Mode)
+	}
+
+	if config.Mode == SyncPeriodic && config.Interval <= 0 {
+		return fmt.Errorf("sync interval must be positive")
+	}
+
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	syncer.stopPeriodicSync()
+
+	if config.Mode != SyncNone {
+
+		if err := syncer.sync(); err != nil {
+			return err
+		}
+	}
+
+	syncer.config.Store(&config)
+
+	if config.Mode == SyncPeriodic {
+		syncer.startPeriodicSync(config.Interval)
+	}
+
+	slog.Info("Sync mode set", "mode", config.Mode.String(), "interval", config.Interval, "function", "setConfig", "at", "fileSyncer")
+
+	return nil
+}
+
+func (syncer *fileSyncer) getConfig() SyncConfig {
+	return *syncer.config.Load()
+}
+
+// wrote is called after data is written to the file. In SyncFull mode, it syncs the file before returning.
+func (syncer *fileSyncer) wrote() error {
+
+	syncer.unsyncedWrites.Store(true)
+
+	if syncer.getConfig().Mode == SyncFull {
+		return syncer.sync()
+	}
+
+	return nil
+}
+
+// sync flushes the data written to the file to stable storage, if any was written since the last sync.
+func (syncer *fileSyncer) sync() error {
+
+	syncer.syncMutex.Lock()
+	defer syncer.syncMutex.Unlock()
+
+	// writes finishing after this point set the flag again, so they are synced by the next call even if this one covers them.
+	if !syncer.unsyncedWrites.Swap(false) {
+		return nil
+	}
+
+	if err := syncer.syncFile(syncer.file); err != nil {
+
+		syncer.unsyncedWrites.Store(true)
+		slog.Error("Failed to sync file", "error", err.Error(), "function", "sync", "at", "fileSyncer")
+
+		return err
+	}
+
+	return nil
+}
+
+// commit writes the metadata page using writeMetaDataPage. In SyncPerCommit and SyncFull mode, the pages written before the commit
+// are synced before the metadata page referring to them is written, and the metadata page is synced before commit returns.
+func (syncer *fileSyncer) commit(writeMetaDataPage func() error) error {
+
+	mode := syncer.getConfig().Mode
+
+	return syncer.syncAround(writeMetaDataPage, mode == SyncPerCommit || mode == SyncFull)
+}
+
+// close stops the periodic sync goroutine, and writes the metadata page using writeMetaDataPage as the last commit.
+// The file is synced in every mode except SyncNone.
+func (syncer *fileSyncer) close(writeMetaDataPage func() error) error {
+
+	syncer.stop()
+
+	return syncer.syncAround(writeMetaDataPage, syncer.getConfig().Mode != SyncNone)
+}
+
+// stop stops the periodic sync goroutine, if it is running, without syncing the file.
+func (syncer *fileSyncer) stop() {
+
+	syncer.mutex.Lock()
+	syncer.stopPeriodicSync()
+	syncer.mutex.Unlock()
+}
+
+func (syncer *fileSyncer) syncAround(writeMetaDataPage func() error, shouldSync bool) error {
+
+	if shouldSync {
+		if err := syncer.sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := writeMetaDataPage(); err != nil {
+		return err
+	}
+
+	if shouldSync {
+		return syncer.sync()
+	}
+
+	return nil
+}
+
+// startPeriodicSync starts a goroutine syncing the file every interval. Caller must hold the syncer mutex.
+func (syncer *fileSyncer) startPeriodicSync(interval time.Duration) {
+
+	shutdown := make(chan struct{})
+	syncer.shutdown = shutdown
+
+	syncer.waitGroup.Add(1)
+
+	go func() {
+
+		defer syncer.waitGroup.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+
+			case <-shutdown:
+				return
+
+			case <-ticker.C:
+				// sync logs its own errors, and the writes stay marked as unsynced so the next tick retries.
+				_ = syncer.sync()
+			}
+		}
+	}()
+}
+
+// stopPeriodicSync stops the periodic sync goroutine, if it is running, and waits for it to exit. Caller must hold the syncer mutex.
+func (syncer *fileSyncer) stopPeriodicSync() {
+
+	if syncer.shutdown == nil {
+		return
+	}
+
+	close(syncer.shutdown)
+	syncer.shutdown = nil
+
+	syncer.waitGroup.Wait()
+}
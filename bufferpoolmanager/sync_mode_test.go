@@ -0,0 +1,163 @@
+package bufferpoolmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncModes(t *testing.T) {
+
+	testCases := []struct {
+		mode SyncMode
+
+		// whether the file is left with unsynced writes after a page is written, and after a commit.
+		unsyncedAfterWrite  bool
+		unsyncedAfterCommit bool
+	}{
+		{mode: SyncNone, unsyncedAfterWrite: true, unsyncedAfterCommit: true},
+		{mode: SyncPerCommit, unsyncedAfterWrite: true, unsyncedAfterCommit: false},
+		{mode: SyncPeriodic, unsyncedAfterWrite: true, unsyncedAfterCommit: true},
+		{mode: SyncFull, unsyncedAfterWrite: false, unsyncedAfterCommit: false},
+	}
+
+	for _, testCase := range testCases {
+
+		t.Run(testCase.mode.String(), func(t *testing.T) {
+
+			disk, _, _, err := NewDirectIODiskManager(filepath.Join(t.TempDir(), "sync_test_file"))
+			require.NoError(t, err)
+
+			// a long interval keeps the periodic sync goroutine from running during the test.
+			require.NoError(t, disk.setSyncConfig(SyncConfig{Mode: testCase.mode, Interval: time.Hour}))
+
+			pageId, err := disk.allocatePage()
+			require.NoError(t, err)
+
+			require.NoError(t, disk.write(int64(pageId)*PAGE_SIZE, createPage(int(pageId))))
+			assert.Equal(t, testCase.unsyncedAfterWrite, disk.syncer.unsyncedWrites.Load())
+
+			require.NoError(t, disk.sync())
+			assert.Equal(t, testCase.unsyncedAfterCommit, disk.syncer.unsyncedWrites.Load())
+
+			require.NoError(t, disk.close())
+			assert.Equal(t, testCase.mode == SyncNone, disk.syncer.unsyncedWrites.Load())
+		})
+	}
+}
+
+func TestPeriodicSync(t *testing.T) {
+
+	disk, _, _, err := NewDirectIODiskManager(filepath.Join(t.TempDir(), "sync_test_file"))
+	require.NoError(t, err)
+
+	assert.Error(t, disk.setSyncConfig(SyncConfig{Mode: SyncPeriodic}))
+	assert.Error(t, disk.setSyncConfig(SyncConfig{Mode: SyncFull + 1}))
+
+	require.NoError(t, disk.setSyncConfig(SyncConfig{Mode: SyncPeriodic, Interval: 10 * time.Millisecond}))
+
+	require.NoError(t, disk.write(PAGE_SIZE, createPage(1)))
+
+	assert.Eventually(t, func() bool {
+		return !disk.syncer.unsyncedWrites.Load()
+	}, time.Second, 10*time.Millisecond)
+
+	// switching modes stops the periodic sync goroutine.
+	require.NoError(t, disk.setSyncConfig(SyncConfig{Mode: SyncNone}))
+	assert.Nil(t, disk.syncer.shutdown)
+
+	require.NoError(t, disk.write(PAGE_SIZE, createPage(1)))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, disk.syncer.unsyncedWrites.Load())
+
+	require.NoError(t, disk.close())
+}
+
+func TestConcurrentSync(t *testing.T) {
+
+	disk, _, _, err := NewDirectIODiskManager(filepath.Join(t.TempDir(), "sync_test_file"))
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	disk.syncer.syncFile = func(file *os.File) error {
+		close(started)
+		<-release
+		return syncFileData(file)
+	}
+
+	require.NoError(t, disk.write(PAGE_SIZE, createPage(1)))
+
+	firstSync := make(chan error)
+	go func() { firstSync <- disk.syncer.sync() }()
+
+	<-started
+
+	// the first sync cleared the unsynced writes flag, but the second one must not return before the writes are flushed.
+	secondSync := make(chan error)
+	go func() { secondSync <- disk.syncer.sync() }()
+
+	select {
+	case <-secondSync:
+		t.Fatal("sync returned while an earlier sync was still flushing the file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	require.NoError(t, <-firstSync)
+	require.NoError(t, <-secondSync)
+
+	disk.syncer.syncFile = syncFileData
+	require.NoError(t, disk.close())
+}
+
+func (bs *BufferPoolManagerTestSuite) TestSync() {
+
+	bs.dirtyPage(1, 101)
+	bs.dirtyPage(2, 102)
+
+	// pages that are only read aren't written back.
+	bs.readPages(3)
+
+	bs.Require().NoError(bs.bufferPool.Sync())
+
+	bs.assertPageOnDisk(1, 101)
+	bs.assertPageOnDisk(2, 102)
+	bs.Assert().Equal(uint64(2), bs.bufferPool.Stats().DirtyWrites)
+	bs.Assert().False(bs.disk.syncer.unsyncedWrites.Load())
+
+	// the pages are clean once they are synced.
+	bs.Require().NoError(bs.bufferPool.Sync())
+	bs.Assert().Equal(uint64(2), bs.bufferPool.Stats().DirtyWrites)
+
+	// Sync waits for the write guard holding a page to be released, so the page isn't written while it is being modified.
+	guard, err := bs.bufferPool.NewWriteGuard(1)
+	bs.Require().NoError(err)
+
+	synced := make(chan error)
+
+	go func() {
+		synced <- bs.bufferPool.Sync()
+	}()
+
+	copy(guard.GetPageData(), createPage(201))
+	guard.SetDirtyFlag()
+
+	select {
+	case <-synced:
+		bs.Fail("Sync returned while a write guard was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	guard.Done()
+
+	bs.Require().NoError(<-synced)
+	bs.assertPageOnDisk(1, 201)
+}
@@ -0,0 +1,481 @@
+package bufferpoolmanager
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+const (
+	// number of low bits of a page ID holding the ID of the page in the data file of its tablespace.
+	// The bits above them hold the tablespace ID, so a data file holds up to 2^32 pages.
+	TABLESPACE_PAGE_ID_BITS = 32
+
+	// tablespace stored in the primary database file, which holds the metadata of the database.
+	// Page IDs of the primary tablespace are the same as the IDs of the pages in the file.
+	PRIMARY_TABLESPACE_ID = 0
+
+	// tablespace IDs are stored in 8 bits, so page ID * page size fits in a file offset.
+	MAX_TABLESPACES = 256
+)
+
+// TablespacePageId returns the page ID of the page with ID = filePageId in the data file of a tablespace.
+func TablespacePageId(tablespaceId uint64, filePageId uint64) uint64 {
+	return tablespaceId<<TABLESPACE_PAGE_ID_BITS | filePageId
+}
+
+// SplitTablespacePageId returns the tablespace of a page, and the ID of the page in the data file of the tablespace.
+func SplitTablespacePageId(pageId uint64) (tablespaceId uint64, filePageId uint64) {
+	return pageId >> TABLESPACE_PAGE_ID_BITS, pageId & (1<<TABLESPACE_PAGE_ID_BITS - 1)
+}
+
+// tablespaceAllocator is implemented by disk managers storing pages in more than one tablespace.
+type tablespaceAllocator interface {
+	allocatePageInTablespace(tablespaceId uint64) (uint64, error)
+}
+
+// TablespaceDiskManager stores the database in a primary database file, and a data file for every other tablespace,
+// so B+ trees can be placed on different directories or disks. The tablespace of a page is encoded in its page ID,
+// and every data file has its own metadata page holding its free list. The data files are recorded in the metadata of the primary file,
+// and opened along with it. Every file is opened using Direct I/O.
+type TablespaceDiskManager struct {
+	primary  *DirectIODiskManager
+	metadata *codec.MetaData
+
+	// data files of the tablespaces other than the primary tablespace.
+	files      map[uint64]*DirectIODiskManager
+	filesMutex *sync.RWMutex
+}
+
+// NewTablespaceDiskManager opens the primary database file, creating it with the default page size if it doesn't exist,
+// then opens the data file of every tablespace recorded in it.
+func NewTablespaceDiskManager(filePath string) (disk *TablespaceDiskManager, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	primary, metadata, isNewDatabase, err := NewDirectIODiskManager(filePath)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return openTablespaces(primary, metadata, isNewDatabase)
+}
+
+// NewTablespaceDiskManagerWithPageSize opens the primary database file, creating it with pages of pageSize bytes if it doesn't exist,
+// then opens the data file of every tablespace recorded in it.
+func NewTablespaceDiskManagerWithPageSize(filePath string, pageSize int) (disk *TablespaceDiskManager, metadata *codec.MetaData, isNewDatabase bool, err error) {
+
+	primary, metadata, isNewDatabase, err := NewDirectIODiskManagerWithPageSize(filePath, pageSize)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return openTablespaces(primary, metadata, isNewDatabase)
+}
+
+// openTablespaces opens the data files recorded in the metadata of the primary database file.
+// A data file must have been created for the same database, with the same page size.
+func openTablespaces(primary *DirectIODiskManager, metadata *codec.MetaData, isNewDatabase bool) (*TablespaceDiskManager, *codec.MetaData, bool, error) {
+
+	disk := &TablespaceDiskManager{
+		primary:    primary,
+		metadata:   metadata,
+		files:      make(map[uint64]*DirectIODiskManager),
+		filesMutex: &sync.RWMutex{},
+	}
+
+	for tablespaceId, filePath := range metadata.TablespaceFiles {
+
+		fmt.Println()
+		slog.Info("Opening tablespace", "tablespaceId", tablespaceId, "filePath", filePath, "function", "openTablespaces", "at", "TablespaceDiskManager")
+
+		if _, err := os.Stat(filePath); err != nil {
+			disk.close()
+			return nil, nil, false, fmt.Errorf("data file of tablespace %d can't be opened: %w", tablespaceId, err)
+		}
+
+		file, _, _, err := NewDirectIODiskManagerWithPageSize(filePath, primary.getPageSize())
+
+		if err != nil {
+			disk.close()
+			return nil, nil, false, fmt.Errorf("data file of tablespace %d can't be opened: %w", tablespaceId, err)
+		}
+
+		disk.files[tablespaceId] = file
+
+		if file.Superblock().DatabaseId != primary.Superblock().DatabaseId {
+			disk.close()
+			return nil, nil, false, fmt.Errorf("data file %s of tablespace %d belongs to database %s", filePath, tablespaceId, file.Superblock().DatabaseIdString())
+		}
+	}
+
+	return disk, metadata, isNewDatabase, nil
+}
+
+// CreateTablespace creates a data file for a new tablespace, records it in the metadata page of the primary database file,
+// and returns the ID of the tablespace. The file must not exist.
+func (disk *TablespaceDiskManager) CreateTablespace(filePath string) (tablespaceId uint64, err error) {
+
+	fmt.Println()
+	slog.Info("Creating tablespace...", "filePath", filePath, "function", "CreateTablespace", "at", "TablespaceDiskManager")
+
+	disk.filesMutex.Lock()
+	defer disk.filesMutex.Unlock()
+
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("data file %s already exists", filePath)
+	}
+
+	tablespaceId = PRIMARY_TABLESPACE_ID + 1
+
+	for id := range disk.files {
+		tablespaceId = max(tablespaceId, id+1)
+	}
+
+	if tablespaceId >= MAX_TABLESPACES {
+		return 0, fmt.Errorf("database can't have more than %d tablespaces", MAX_TABLESPACES)
+	}
+
+	file, _, _, err := NewDirectIODiskManagerWithPageSize(filePath, disk.primary.getPageSize())
+
+	if err != nil {
+		return 0, err
+	}
+
+	// the data file records the ID of the database it belongs to, so it isn't opened with another database.
+	file.mutex.Lock()
+	file.superblock.DatabaseId = disk.primary.Superblock().DatabaseId
+	file.mutex.Unlock()
+
+	if err := file.sync(); err != nil {
+		file.close()
+		os.Remove(filePath)
+		return 0, err
+	}
+
+	disk.primary.mutex.Lock()
+
+	if disk.metadata.TablespaceFiles == nil {
+		disk.metadata.TablespaceFiles = make(map[uint64]string)
+	}
+	disk.metadata.TablespaceFiles[tablespaceId] = filePath
+
+	disk.primary.mutex.Unlock()
+
+	// the data file is recorded in the primary file before any page is stored in it.
+	if err := disk.primary.sync(); err != nil {
+
+		disk.primary.mutex.Lock()
+		delete(disk.metadata.TablespaceFiles, tablespaceId)
+		disk.primary.mutex.Unlock()
+
+		file.close()
+		os.Remove(filePath)
+		return 0, err
+	}
+
+	disk.files[tablespaceId] = file
+
+	slog.Info("Created tablespace", "tablespaceId", tablespaceId, "filePath", filePath, "function", "CreateTablespace", "at", "TablespaceDiskManager")
+
+	return tablespaceId, nil
+}
+
+// Tablespaces returns the path of the data file of every tablespace other than the primary tablespace.
+func (disk *TablespaceDiskManager) Tablespaces() map[uint64]string {
+
+	disk.primary.mutex.Lock()
+	defer disk.primary.mutex.Unlock()
+
+	return maps.Clone(disk.metadata.TablespaceFiles)
+}
+
+// file returns the disk manager of the data file of a tablespace.
+func (disk *TablespaceDiskManager) file(tablespaceId uint64) (*DirectIODiskManager, error) {
+
+	if tablespaceId == PRIMARY_TABLESPACE_ID {
+		return disk.primary, nil
+	}
+
+	disk.filesMutex.RLock()
+	defer disk.filesMutex.RUnlock()
+
+	file, exists := disk.files[tablespaceId]
+
+	if !exists {
+		return nil, fmt.Errorf("tablespace %d doesn't exist", tablespaceId)
+	}
+
+	return file, nil
+}
+
+// allFiles returns the disk managers of the data files, followed by the primary database file.
+func (disk *TablespaceDiskManager) allFiles() []*DirectIODiskManager {
+
+	disk.filesMutex.RLock()
+	defer disk.filesMutex.RUnlock()
+
+	files := make([]*DirectIODiskManager, 0, len(disk.files)+1)
+
+	for _, file := range disk.files {
+		files = append(files, file)
+	}
+
+	return append(files, disk.primary)
+}
+
+// fileOffset returns the data file holding the page at a particular offset, and the offset of the page in that file.
+func (disk *TablespaceDiskManager) fileOffset(offset int64) (*DirectIODiskManager, int64, error) {
+
+	pageSize := int64(disk.primary.getPageSize())
+
+	tablespaceId, filePageId := SplitTablespacePageId(uint64(offset / pageSize))
+
+	file, err := disk.file(tablespaceId)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return file, int64(filePageId)*pageSize + offset%pageSize, nil
+}
+
+// tablespacePageId returns the page ID of a page allocated in the data file of a tablespace,
+// deallocating it if it doesn't fit in the bits of a page ID holding the ID of the page in its data file.
+func (disk *TablespaceDiskManager) tablespacePageId(file *DirectIODiskManager, tablespaceId uint64, filePageId uint64) (uint64, error) {
+
+	if filePageId >= 1<<TABLESPACE_PAGE_ID_BITS {
+		file.deallocatePage(filePageId)
+		return 0, fmt.Errorf("data file of tablespace %d is full", tablespaceId)
+	}
+
+	return TablespacePageId(tablespaceId, filePageId), nil
+}
+
+func (disk *TablespaceDiskManager) write(offset int64, data []byte) error {
+
+	file, fileOffset, err := disk.fileOffset(offset)
+
+	if err != nil {
+		return err
+	}
+
+	return file.write(fileOffset, data)
+}
+
+func (disk *TablespaceDiskManager) read(offset int64, size int) ([]byte, error) {
+
+	file, fileOffset, err := disk.fileOffset(offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return file.read(fileOffset, size)
+}
+
+// readPages reads every run of pages in the same tablespace from the data file of the tablespace.
+func (disk *TablespaceDiskManager) readPages(pageIds []uint64, buffers [][]byte) error {
+
+	return disk.forEachTablespaceRun(pageIds, buffers, func(file *DirectIODiskManager, filePageIds []uint64, buffers [][]byte) error {
+		return file.readPages(filePageIds, buffers)
+	})
+}
+
+// writePages writes every run of pages in the same tablespace to the data file of the tablespace.
+func (disk *TablespaceDiskManager) writePages(pageIds []uint64, buffers [][]byte) error {
+
+	return disk.forEachTablespaceRun(pageIds, buffers, func(file *DirectIODiskManager, filePageIds []uint64, buffers [][]byte) error {
+		return file.writePages(filePageIds, buffers)
+	})
+}
+
+// forEachTablespaceRun splits the pages into runs of pages in the same tablespace, and calls fn with the IDs of the pages of every run in its data file.
+func (disk *TablespaceDiskManager) forEachTablespaceRun(pageIds []uint64, buffers [][]byte, fn func(file *DirectIODiskManager, filePageIds []uint64, buffers [][]byte) error) error {
+
+	for start := 0; start < len(pageIds); {
+
+		tablespaceId, _ := SplitTablespacePageId(pageIds[start])
+
+		file, err := disk.file(tablespaceId)
+
+		if err != nil {
+			return err
+		}
+
+		filePageIds := make([]uint64, 0)
+
+		end := start
+
+		for ; end < len(pageIds); end++ {
+
+			pageTablespaceId, filePageId := SplitTablespacePageId(pageIds[end])
+
+			if pageTablespaceId != tablespaceId {
+				break
+			}
+
+			filePageIds = append(filePageIds, filePageId)
+		}
+
+		if err := fn(file, filePageIds, buffers[start:end]); err != nil {
+			return err
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+func (disk *TablespaceDiskManager) getPageSize() int {
+	return disk.primary.getPageSize()
+}
+
+// allocatePage allocates a page in the primary database file.
+func (disk *TablespaceDiskManager) allocatePage() (uint64, error) {
+	return disk.primary.allocatePage()
+}
+
+// allocatePageInTablespace allocates a page in the data file of a tablespace.
+func (disk *TablespaceDiskManager) allocatePageInTablespace(tablespaceId uint64) (uint64, error) {
+
+	file, err := disk.file(tablespaceId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	filePageId, err := file.allocatePage()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return disk.tablespacePageId(file, tablespaceId, filePageId)
+}
+
+// allocatePageNear allocates a page in the data file of the tablespace holding hintPageId.
+// A hint whose page ID in the data file is 0 allocates a page in any extent of the B+ tree in that file.
+func (disk *TablespaceDiskManager) allocatePageNear(hintPageId uint64, owner uint64) (uint64, error) {
+
+	tablespaceId, filePageId := SplitTablespacePageId(hintPageId)
+
+	file, err := disk.file(tablespaceId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	filePageId, err = file.allocatePageNear(filePageId, owner)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return disk.tablespacePageId(file, tablespaceId, filePageId)
+}
+
+func (disk *TablespaceDiskManager) deallocatePage(pageId uint64) {
+
+	tablespaceId, filePageId := SplitTablespacePageId(pageId)
+
+	file, err := disk.file(tablespaceId)
+
+	if err != nil {
+		slog.Error("Failed to deallocate page", "pageId", pageId, "error", err.Error(), "function", "deallocatePage", "at", "TablespaceDiskManager")
+		return
+	}
+
+	file.deallocatePage(filePageId)
+}
+
+// allocatePageBelow reuses the lowest deallocated page below limit in the data file of the tablespace holding limit.
+func (disk *TablespaceDiskManager) allocatePageBelow(limit uint64) (uint64, bool) {
+
+	tablespaceId, fileLimit := SplitTablespacePageId(limit)
+
+	file, err := disk.file(tablespaceId)
+
+	if err != nil {
+		return 0, false
+	}
+
+	filePageId, found := file.allocatePageBelow(fileLimit)
+
+	if !found {
+		return 0, false
+	}
+
+	return TablespacePageId(tablespaceId, filePageId), true
+}
+
+// allocatedPages returns the greatest allocated page ID, and the number of deallocated page IDs below it, in the primary database file.
+func (disk *TablespaceDiskManager) allocatedPages() (uint64, int) {
+	return disk.primary.allocatedPages()
+}
+
+// shrink truncates the deallocated pages at the end of every data file, and the primary database file.
+func (disk *TablespaceDiskManager) shrink() (int, error) {
+
+	releasedPages := 0
+
+	for _, file := range disk.allFiles() {
+
+		released, err := file.shrink()
+
+		if err != nil {
+			return releasedPages, err
+		}
+
+		releasedPages += released
+	}
+
+	return releasedPages, nil
+}
+
+// sync commits the metadata page of every data file before the metadata page of the primary database file,
+// so the primary file never references pages that weren't committed.
+func (disk *TablespaceDiskManager) sync() error {
+
+	for _, file := range disk.allFiles() {
+
+		if err := file.sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (disk *TablespaceDiskManager) setSyncConfig(config SyncConfig) error {
+
+	for _, file := range disk.allFiles() {
+
+		if err := file.setSyncConfig(config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes every data file, then the primary database file. Every file is closed even if closing one of them fails.
+func (disk *TablespaceDiskManager) close() error {
+
+	var closeErr error
+
+	for _, file := range disk.allFiles() {
+
+		if err := file.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+
+	return closeErr
+}
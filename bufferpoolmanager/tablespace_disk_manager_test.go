@@ -0,0 +1,108 @@
+package bufferpoolmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTablespaceDiskManager(t *testing.T) {
+
+	primaryFilePath := filepath.Join(t.TempDir(), "primary_test_file")
+	dataFilePath := filepath.Join(t.TempDir(), "tablespace_test_file")
+
+	disk, _, _, err := NewTablespaceDiskManager(primaryFilePath)
+	require.NoError(t, err)
+
+	tablespaceId, err := disk.CreateTablespace(dataFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), tablespaceId)
+
+	bufferPool, err := NewSimpleBufferPoolManager(4, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	pageIds := make([]uint64, 0)
+
+	pageId, err := bufferPool.NewPage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), pageId)
+	pageIds = append(pageIds, pageId)
+
+	for i := uint64(1); i <= 3; i++ {
+
+		pageId, err := bufferPool.NewPageInTablespace(tablespaceId)
+		require.NoError(t, err)
+		assert.Equal(t, TablespacePageId(tablespaceId, i), pageId)
+		pageIds = append(pageIds, pageId)
+	}
+
+	// a hint without a page in the data file allocates the first page of a B+ tree in the data file, outside extents.
+	pageId, err = bufferPool.NewPageNear(TablespacePageId(tablespaceId, 0), 7)
+	require.NoError(t, err)
+	assert.Equal(t, TablespacePageId(tablespaceId, 4), pageId)
+	pageIds = append(pageIds, pageId)
+
+	_, err = bufferPool.NewPageInTablespace(2)
+	assert.Error(t, err)
+
+	splitTablespaceId, filePageId := SplitTablespacePageId(pageId)
+	assert.Equal(t, tablespaceId, splitTablespaceId)
+	assert.Equal(t, uint64(4), filePageId)
+
+	// more pages than frames are written, so pages are evicted to their data files.
+	for i, pageId := range pageIds {
+
+		guard, err := bufferPool.NewWriteGuard(pageId)
+		require.NoError(t, err)
+
+		copy(guard.GetPageData(), createPage(i*512))
+		guard.SetDirtyFlag()
+		guard.Done()
+	}
+
+	require.NoError(t, bufferPool.Close())
+
+	// the pages of the tablespace are stored in its data file, at their ID in the data file.
+	data, err := os.ReadFile(dataFilePath)
+	require.NoError(t, err)
+	assert.True(t, checkPage(2*512, data[2*PAGE_SIZE:3*PAGE_SIZE]))
+	assert.True(t, checkPage(4*512, data[4*PAGE_SIZE:5*PAGE_SIZE]))
+
+	primaryFileInfo, err := os.Stat(primaryFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(17*PAGE_SIZE), primaryFileInfo.Size())
+
+	disk, _, _, err = NewTablespaceDiskManager(primaryFilePath)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[uint64]string{tablespaceId: dataFilePath}, disk.Tablespaces())
+
+	bufferPool, err = NewSimpleBufferPoolManager(4, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	for i, pageId := range pageIds {
+
+		guard, err := bufferPool.NewReadGuard(pageId)
+		require.NoError(t, err)
+
+		assert.True(t, checkPage(i*512, guard.GetPageData()))
+		guard.Done()
+	}
+
+	require.NoError(t, bufferPool.Close())
+
+	// a data file of another database isn't opened as a tablespace.
+	otherFilePath := filepath.Join(t.TempDir(), "other_test_file")
+
+	otherDisk, _, _, err := NewDirectIODiskManager(otherFilePath)
+	require.NoError(t, err)
+	require.NoError(t, otherDisk.close())
+
+	require.NoError(t, os.Rename(otherFilePath, dataFilePath))
+
+	_, _, _, err = NewTablespaceDiskManager(primaryFilePath)
+	assert.ErrorContains(t, err, "belongs to database")
+}
@@ -0,0 +1,111 @@
+package bufferpoolmanager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A page access trace is a text file with the ID of each accessed page on its own line, in the order the pages were accessed.
+// Blank lines and lines starting with '#' are ignored.
+
+// ReadPageAccessTrace parses a page access trace.
+func ReadPageAccessTrace(reader io.Reader) ([]uint64, error) {
+
+	trace := make([]uint64, 0)
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pageId, err := strconv.ParseUint(line, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid page ID on line %d of trace: %w", lineNumber, err)
+		}
+
+		trace = append(trace, pageId)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return trace, nil
+}
+
+// TraceReplayResult summarizes how a replacer performed on a page access trace.
+type TraceReplayResult struct {
+	Accesses  int
+	Hits      int
+	Misses    int
+	Evictions int
+}
+
+// HitRate returns the fraction of accesses that found the page in the buffer pool.
+func (result TraceReplayResult) HitRate() float64 {
+
+	if result.Accesses == 0 {
+		return 0
+	}
+
+	return float64(result.Hits) / float64(result.Accesses)
+}
+
+// ReplayPageAccessTrace simulates a buffer pool with poolSize frames using the given replacer, without performing any I/O.
+// Each access pins the page and unpins it immediately, the way a page guard is used by the B+ tree.
+func ReplayPageAccessTrace(replacer Replacer, poolSize int, trace []uint64) TraceReplayResult {
+
+	result := TraceReplayResult{}
+
+	pageTable := make(map[uint64]FrameID)
+	framePages := make([]uint64, poolSize)
+	nextFreeFrame := 0
+
+	for _, pageId := range trace {
+
+		result.Accesses++
+
+		if frameId, exists := pageTable[pageId]; exists {
+
+			result.Hits++
+
+			replacer.remove(frameId)
+			replacer.insert(frameId)
+			continue
+		}
+
+		result.Misses++
+
+		var frameId FrameID
+
+		if nextFreeFrame < poolSize {
+
+			frameId = FrameID(nextFreeFrame)
+			nextFreeFrame++
+		} else {
+
+			// every frame is unpinned between accesses, so a victim always exists
+			frameId, _ = replacer.victim()
+			delete(pageTable, framePages[frameId])
+			result.Evictions++
+		}
+
+		pageTable[pageId] = frameId
+		framePages[frameId] = pageId
+
+		replacer.insert(frameId)
+	}
+
+	return result
+}
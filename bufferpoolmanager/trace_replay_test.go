@@ -0,0 +1,160 @@
+package bufferpoolmanager
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const TRACE_REPLAY_POOL_SIZE = 64
+
+var replacementPolicies = []ReplacementPolicy{LRUReplacementPolicy, ClockReplacementPolicy, LRUKReplacementPolicy, TwoQueueReplacementPolicy}
+
+// generateLookupsWithScansTrace generates a trace of point lookups, each reading the root, an internal node and a leaf,
+// interrupted by periodic full scans of the leaf chain.
+func generateLookupsWithScansTrace() []uint64 {
+
+	random := rand.New(rand.NewSource(1))
+
+	numInternalNodes, numLeafNodes := 32, 2000
+	firstLeafNodePageId := uint64(numInternalNodes + 2)
+
+	trace := make([]uint64, 0)
+
+	for round := 0; round < 5; round++ {
+
+		for lookup := 0; lookup < 2000; lookup++ {
+			trace = append(trace, 1, uint64(2+random.Intn(numInternalNodes)), firstLeafNodePageId+uint64(random.Intn(numLeafNodes)))
+		}
+
+		for leaf := range numLeafNodes {
+			trace = append(trace, firstLeafNodePageId+uint64(leaf))
+		}
+	}
+
+	return trace
+}
+
+// loadTraces returns the generated trace, along with any recorded traces stored in testdata/*.trace.
+func loadTraces(tb testing.TB) map[string][]uint64 {
+
+	traces := map[string][]uint64{
+		"lookups-with-scans": generateLookupsWithScansTrace(),
+	}
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.trace"))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, path := range paths {
+
+		file, err := os.Open(path)
+
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		trace, err := ReadPageAccessTrace(file)
+		file.Close()
+
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		traces[strings.TrimSuffix(filepath.Base(path), ".trace")] = trace
+	}
+
+	return traces
+}
+
+// silenceLogs discards the logs written by the replacers on every access, until the returned function is called.
+func silenceLogs() (restore func()) {
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	return func() {
+		slog.SetDefault(logger)
+	}
+}
+
+type TraceReplayTestSuite struct {
+	suite.Suite
+}
+
+func (ts *TraceReplayTestSuite) TestReadPageAccessTrace() {
+
+	trace, err := ReadPageAccessTrace(strings.NewReader("# recorded trace\n1\n2\n\n 3 \n"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]uint64{1, 2, 3}, trace)
+
+	_, err = ReadPageAccessTrace(strings.NewReader("1\nroot\n"))
+	ts.Assert().Error(err)
+}
+
+func (ts *TraceReplayTestSuite) TestScanResistance() {
+
+	defer silenceLogs()()
+
+	trace := generateLookupsWithScansTrace()
+
+	hitRates := make(map[ReplacementPolicy]float64)
+
+	for _, policy := range replacementPolicies {
+
+		replacer, err := NewReplacer(policy, TRACE_REPLAY_POOL_SIZE)
+		ts.Require().NoError(err)
+
+		result := ReplayPageAccessTrace(replacer, TRACE_REPLAY_POOL_SIZE, trace)
+
+		ts.Assert().Equal(len(trace), result.Hits+result.Misses)
+		hitRates[policy] = result.HitRate()
+	}
+
+	ts.Assert().Greater(hitRates[LRUKReplacementPolicy], hitRates[LRUReplacementPolicy])
+	ts.Assert().Greater(hitRates[TwoQueueReplacementPolicy], hitRates[LRUReplacementPolicy])
+}
+
+func TestTraceReplay(t *testing.T) {
+
+	suite.Run(t, new(TraceReplayTestSuite))
+}
+
+// BenchmarkReplacementPolicies replays each trace using every replacement policy, and reports the hit rate.
+// Recorded traces can be compared by placing them in testdata/<name>.trace.
+func BenchmarkReplacementPolicies(b *testing.B) {
+
+	defer silenceLogs()()
+
+	for name, trace := range loadTraces(b) {
+
+		for _, policy := range replacementPolicies {
+
+			b.Run(name+"/"+string(policy), func(b *testing.B) {
+
+				result := TraceReplayResult{}
+
+				for range b.N {
+
+					replacer, err := NewReplacer(policy, TRACE_REPLAY_POOL_SIZE)
+
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					result = ReplayPageAccessTrace(replacer, TRACE_REPLAY_POOL_SIZE, trace)
+				}
+
+				b.ReportMetric(result.HitRate(), "hit-rate")
+			})
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package bufferpoolmanager
+
+import (
+	"container/list"
+	"log/slog"
+	"sync"
+)
+
+type twoQueueMembership int
+
+const (
+	notQueued twoQueueMembership = iota
+	inFirstAccessQueue
+	inFrequentAccessQueue
+
+	// the frame was inserted cold, and waits at the back of A1 until it is accessed for the first time.
+	prefetchedIntoFirstAccessQueue
+)
+
+// belongsToFirstAccessQueue returns true for frames counted towards the size of A1.
+func (membership twoQueueMembership) belongsToFirstAccessQueue() bool {
+
+	return membership == inFirstAccessQueue || membership == prefetchedIntoFirstAccessQueue
+}
+
+// TwoQueueReplacer implements the simplified 2Q algorithm. Frames accessed once since their page was loaded wait in a FIFO queue (A1),
+// and frames accessed again are promoted to an LRU queue (Am). Frames are evicted from A1 while it holds more than its share of the pool,
+// so a full scan only cycles through A1 instead of evicting the hot pages in Am.
+type TwoQueueReplacer struct {
+
+	// synchronizes access to the queues.
+	mutex *sync.Mutex
+
+	// evictable frames accessed once, in the order they were inserted.
+	firstAccessQueue *list.List
+
+	// evictable frames accessed more than once, most recently accessed at the front.
+	frequentAccessQueue *list.List
+
+	// used to remove evictable frames from the middle of a queue.
+	frameMap map[FrameID]*list.Element
+
+	// queue each frame belongs to, kept while the frame is pinned, and discarded when it is evicted.
+	membership map[FrameID]twoQueueMembership
+
+	// number of frames (pinned or evictable) belonging to A1.
+	firstAccessQueueSize int
+
+	// maximum number of frames A1 may hold before frames are evicted from it.
+	firstAccessQueueCapacity int
+}
+
+// NewTwoQueueReplacer creates a 2Q replacer for a pool of the given size, a quarter of which is reserved for pages accessed once.
+func NewTwoQueueReplacer(poolSize int) *TwoQueueReplacer {
+
+	slog.Info("Creating new TwoQueueReplacer...", "poolSize", poolSize, "function", "NewTwoQueueReplacer", "at", "TwoQueueReplacer")
+	return &TwoQueueReplacer{
+		mutex:                    &sync.Mutex{},
+		firstAccessQueue:         list.New(),
+		frequentAccessQueue:      list.New(),
+		frameMap:                 make(map[FrameID]*list.Element),
+		membership:               make(map[FrameID]twoQueueMembership),
+		firstAccessQueueCapacity: max(1, poolSize/4),
+	}
+}
+
+// victim evicts the oldest frame of A1 if A1 exceeds its capacity, otherwise the least recently accessed frame of Am.
+// If the chosen queue has no evictable frames, the other queue is used.
+func (replacer *TwoQueueReplacer) victim() (FrameID, bool) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	queues := []*list.List{replacer.frequentAccessQueue, replacer.firstAccessQueue}
+
+	if replacer.firstAccessQueueSize > replacer.firstAccessQueueCapacity {
+		queues = []*list.List{replacer.firstAccessQueue, replacer.frequentAccessQueue}
+	}
+
+	for _, queue := range queues {
+
+		if queue.Len() == 0 {
+			continue
+		}
+
+		frameId := queue.Remove(queue.Back()).(FrameID)
+
+		delete(replacer.frameMap, frameId)
+
+		if replacer.membership[frameId].belongsToFirstAccessQueue() {
+			replacer.firstAccessQueueSize--
+		}
+		delete(replacer.membership, frameId)
+
+		slog.Info("Selecting victim frame...", "victim_frame", frameId, "function", "victim", "at", "TwoQueueReplacer")
+		return frameId, true
+	}
+
+	slog.Warn("No evictable frames", "function", "victim", "at", "TwoQueueReplacer")
+	return 0, false
+}
+
+// insert records an access to the frame. A frame accessed for the first time joins A1, and a frame accessed again is moved to the front of Am.
+func (replacer *TwoQueueReplacer) insert(frameId FrameID) {
+
+	slog.Info("Inserting frame into TwoQueueReplacer...", "frame_ID", frameId, "function", "insert", "at", "TwoQueueReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.removeFromQueue(frameId)
+
+	switch replacer.membership[frameId] {
+
+	case notQueued:
+		replacer.membership[frameId] = inFirstAccessQueue
+		replacer.firstAccessQueueSize++
+		replacer.frameMap[frameId] = replacer.firstAccessQueue.PushFront(frameId)
+
+	case inFirstAccessQueue:
+		replacer.membership[frameId] = inFrequentAccessQueue
+		replacer.firstAccessQueueSize--
+		replacer.frameMap[frameId] = replacer.frequentAccessQueue.PushFront(frameId)
+
+	case inFrequentAccessQueue:
+		replacer.frameMap[frameId] = replacer.frequentAccessQueue.PushFront(frameId)
+
+	case prefetchedIntoFirstAccessQueue:
+		// the first access of a prefetched frame, it stays in A1.
+		replacer.membership[frameId] = inFirstAccessQueue
+		replacer.frameMap[frameId] = replacer.firstAccessQueue.PushFront(frameId)
+	}
+}
+
+// insertCold adds a frame that hasn't been accessed yet to the back of A1, where it is evicted first.
+func (replacer *TwoQueueReplacer) insertCold(frameId FrameID) {
+
+	slog.Info("Inserting cold frame into TwoQueueReplacer...", "frame_ID", frameId, "function", "insertCold", "at", "TwoQueueReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.removeFromQueue(frameId)
+
+	if !replacer.membership[frameId].belongsToFirstAccessQueue() {
+		replacer.firstAccessQueueSize++
+	}
+	replacer.membership[frameId] = prefetchedIntoFirstAccessQueue
+	replacer.frameMap[frameId] = replacer.firstAccessQueue.PushBack(frameId)
+}
+
+// remove takes the frame out of its queue once its pin count > 0, the queue it belongs to is remembered.
+func (replacer *TwoQueueReplacer) remove(frameId FrameID) {
+
+	slog.Info("Removing frame from TwoQueueReplacer...", "frame_ID", frameId, "function", "remove", "at", "TwoQueueReplacer")
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.removeFromQueue(frameId)
+}
+
+// forget discards the queue membership of a frame whose page was deleted.
+func (replacer *TwoQueueReplacer) forget(frameId FrameID) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.removeFromQueue(frameId)
+
+	if replacer.membership[frameId].belongsToFirstAccessQueue() {
+		replacer.firstAccessQueueSize--
+	}
+	delete(replacer.membership, frameId)
+}
+
+// removeFromQueue removes an evictable frame from the queue it is in, if any.
+func (replacer *TwoQueueReplacer) removeFromQueue(frameId FrameID) {
+
+	frameElement, exists := replacer.frameMap[frameId]
+
+	if !exists {
+		return
+	}
+
+	if replacer.membership[frameId].belongsToFirstAccessQueue() {
+		replacer.firstAccessQueue.Remove(frameElement)
+	} else {
+		replacer.frequentAccessQueue.Remove(frameElement)
+	}
+	delete(replacer.frameMap, frameId)
+}
+
+// returns the number of frames currently managed by the replacer.
+func (replacer *TwoQueueReplacer) size() int {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	return len(replacer.frameMap)
+}
+
+// resize keeps A1's capacity at a quarter of the pool. If A1 ends up above its new capacity, frames are evicted from it first until it shrinks back.
+func (replacer *TwoQueueReplacer) resize(numFrames int) {
+
+	replacer.mutex.Lock()
+	defer replacer.mutex.Unlock()
+
+	replacer.firstAccessQueueCapacity = max(1, numFrames/4)
+}
@@ -0,0 +1,85 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TwoQueueReplacerTestSuite struct {
+	suite.Suite
+	replacer *TwoQueueReplacer
+}
+
+func (rs *TwoQueueReplacerTestSuite) SetupTest() {
+
+	// A1 holds at most 2 frames
+	rs.replacer = NewTwoQueueReplacer(8)
+}
+
+func (rs *TwoQueueReplacerTestSuite) assertVictim(expectedFrameId FrameID) {
+
+	frameId, found := rs.replacer.victim()
+
+	rs.Require().True(found)
+	rs.Assert().Equal(expectedFrameId, frameId)
+}
+
+func (rs *TwoQueueReplacerTestSuite) TestTwoQueueReplacerPromotesFramesAccessedTwice() {
+
+	rs.replacer.insert(1)
+	rs.replacer.remove(1)
+	rs.replacer.insert(1)
+
+	rs.Assert().Equal(inFrequentAccessQueue, rs.replacer.membership[1])
+
+	// frames 2, 3 and 4 are accessed once, as they would be by a scan
+	rs.replacer.insert(2)
+	rs.replacer.insert(3)
+	rs.replacer.insert(4)
+
+	// A1 exceeds its capacity, so its oldest frame is evicted instead of the older frame 1
+	rs.assertVictim(FrameID(2))
+
+	// A1 is within its capacity, so frames are evicted from Am
+	rs.assertVictim(FrameID(1))
+
+	// Am is empty, so frames are evicted from A1
+	rs.assertVictim(FrameID(3))
+	rs.Assert().Equal(1, rs.replacer.size())
+}
+
+func (rs *TwoQueueReplacerTestSuite) TestTwoQueueReplacerForget() {
+
+	rs.replacer.insert(1)
+	rs.replacer.remove(1)
+	rs.replacer.forget(1)
+
+	rs.replacer.insert(1)
+
+	rs.Assert().Equal(inFirstAccessQueue, rs.replacer.membership[1])
+	rs.Assert().Equal(1, rs.replacer.firstAccessQueueSize)
+}
+
+func (rs *TwoQueueReplacerTestSuite) TestTwoQueueReplacerInsertCold() {
+
+	rs.replacer.insert(1)
+	rs.replacer.insertCold(2)
+	rs.replacer.insert(3)
+
+	// A1 exceeds its capacity, and the cold frame is at the back of A1, even though frame 1 was inserted before it
+	rs.assertVictim(FrameID(2))
+
+	// the first access of a cold frame keeps it in A1
+	rs.replacer.insertCold(4)
+	rs.replacer.remove(4)
+	rs.replacer.insert(4)
+
+	rs.Assert().Equal(inFirstAccessQueue, rs.replacer.membership[4])
+	rs.Assert().Equal(3, rs.replacer.firstAccessQueueSize)
+}
+
+func TestTwoQueueReplacer(t *testing.T) {
+
+	suite.Run(t, new(TwoQueueReplacerTestSuite))
+}
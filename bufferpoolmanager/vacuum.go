@@ -0,0 +1,86 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+// takeDeallocatedPageIdBelow removes the lowest deallocated page ID below limit from the free list, and returns it.
+func takeDeallocatedPageIdBelow(metadata *codec.MetaData, limit uint64) (uint64, bool) {
+
+	index := -1
+
+	for i, pageId := range metadata.DeallocatedPageIdList {
+
+		if pageId < limit && (index == -1 || pageId < metadata.DeallocatedPageIdList[index]) {
+			index = i
+		}
+	}
+
+	if index == -1 {
+		return 0, false
+	}
+
+	pageId := metadata.DeallocatedPageIdList[index]
+	metadata.DeallocatedPageIdList = slices.Delete(metadata.DeallocatedPageIdList, index, index+1)
+
+	return pageId, true
+}
+
+// releaseTrailingPages removes the deallocated page IDs at the end of the file from the free list, lowering the max allocated page ID,
+// and returns the number of page IDs removed.
+func releaseTrailingPages(metadata *codec.MetaData) (releasedPages int) {
+
+	deallocated := make(map[uint64]bool, len(metadata.DeallocatedPageIdList))
+
+	for _, pageId := range metadata.DeallocatedPageIdList {
+		deallocated[pageId] = true
+	}
+
+	for metadata.MaxAllocatedPageId > 0 && deallocated[metadata.MaxAllocatedPageId] {
+
+		delete(deallocated, metadata.MaxAllocatedPageId)
+		metadata.MaxAllocatedPageId--
+		releasedPages++
+	}
+
+	if releasedPages > 0 {
+
+		metadata.DeallocatedPageIdList = slices.DeleteFunc(metadata.DeallocatedPageIdList, func(pageId uint64) bool {
+			return pageId > metadata.MaxAllocatedPageId
+		})
+	}
+
+	return releasedPages
+}
+
+// NewPageBelow reuses the lowest deallocated page below limit, so a page can be moved towards the start of the file.
+// It returns false if no deallocated page is below limit.
+func (bufferPool *SimpleBufferPoolManager) NewPageBelow(limit uint64) (uint64, bool) {
+
+	return bufferPool.disk.allocatePageBelow(limit)
+}
+
+// AllocatedPages returns the greatest allocated page ID, and the number of deallocated pages below it.
+// The pages in use would fit in the first maxAllocatedPageId - deallocatedPages pages following the metadata page.
+func (bufferPool *SimpleBufferPoolManager) AllocatedPages() (maxAllocatedPageId uint64, deallocatedPages int) {
+
+	return bufferPool.disk.allocatedPages()
+}
+
+// Shrink writes every dirty page to disk, then truncates the deallocated pages at the end of the file, and returns the number of pages removed.
+// The metadata page is committed before the file is truncated, so the B+ trees must already be recorded in the metadata.
+func (bufferPool *SimpleBufferPoolManager) Shrink() (releasedPages int, err error) {
+
+	fmt.Println()
+	slog.Info("Shrinking database file...", "function", "Shrink", "at", "buffer Pool Manager")
+
+	if err := bufferPool.flushDirtyPages(); err != nil {
+		return 0, err
+	}
+
+	return bufferPool.disk.shrink()
+}
@@ -0,0 +1,112 @@
+package bufferpoolmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShrink(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "shrink_test_file")
+
+	disk, _, _, err := NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+
+	bufferPool, err := NewSimpleBufferPoolManager(4, PAGE_SIZE, NewLRUReplacer(), disk)
+	require.NoError(t, err)
+
+	for range 20 {
+		_, err := bufferPool.NewPage()
+		require.NoError(t, err)
+	}
+
+	for pageId := uint64(20); pageId > 10; pageId-- {
+		bufferPool.CleanupPage(pageId)
+	}
+
+	bufferPool.CleanupPage(7)
+	bufferPool.CleanupPage(5)
+
+	maxAllocatedPageId, deallocatedPages := bufferPool.AllocatedPages()
+	assert.Equal(t, uint64(20), maxAllocatedPageId)
+	assert.Equal(t, 12, deallocatedPages)
+
+	// a page written before the file is shrunk is kept.
+	guard, err := bufferPool.NewWriteGuard(10)
+	require.NoError(t, err)
+
+	copy(guard.GetPageData(), createPage(10))
+	guard.SetDirtyFlag()
+	guard.Done()
+
+	releasedPages, err := bufferPool.Shrink()
+	require.NoError(t, err)
+
+	// pages 11 to 20 are released, along with pages 21 to 32, added to the end of the file ahead of allocation.
+	assert.Equal(t, 33-11, releasedPages)
+
+	fileStats, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11*PAGE_SIZE), fileStats.Size())
+
+	maxAllocatedPageId, deallocatedPages = bufferPool.AllocatedPages()
+	assert.Equal(t, uint64(10), maxAllocatedPageId)
+	assert.Equal(t, 2, deallocatedPages)
+
+	// the lowest deallocated page is reused first.
+	pageId, found := bufferPool.NewPageBelow(10)
+	assert.True(t, found)
+	assert.Equal(t, uint64(5), pageId)
+
+	_, found = bufferPool.NewPageBelow(7)
+	assert.False(t, found)
+
+	require.NoError(t, bufferPool.Close())
+
+	disk, metadata, _, err := NewDirectIODiskManager(filePath)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(10), metadata.MaxAllocatedPageId)
+	assert.Equal(t, []uint64{7}, metadata.DeallocatedPageIdList)
+
+	data, err := disk.read(10*PAGE_SIZE, PAGE_SIZE)
+	require.NoError(t, err)
+	assert.True(t, checkPage(10, data))
+
+	// the file grows again once every page is allocated.
+	for range 2 {
+		_, err := disk.allocatePage()
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, disk.write(11*PAGE_SIZE, createPage(11)))
+	require.NoError(t, disk.close())
+}
+
+func TestShrinkMemoryDiskManager(t *testing.T) {
+
+	disk, metadata := NewMemoryDiskManager()
+
+	for range 5 {
+		_, err := disk.allocatePage()
+		require.NoError(t, err)
+	}
+
+	disk.deallocatePage(4)
+	disk.deallocatePage(5)
+	disk.deallocatePage(2)
+
+	releasedPages, err := disk.shrink()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, releasedPages)
+	assert.Equal(t, uint64(3), metadata.MaxAllocatedPageId)
+	assert.Equal(t, []uint64{2}, metadata.DeallocatedPageIdList)
+
+	_, err = disk.read(4*PAGE_SIZE, PAGE_SIZE)
+	assert.Error(t, err)
+}
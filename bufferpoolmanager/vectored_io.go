@@ -0,0 +1,123 @@
+package bufferpoolmanager
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maximum number of pages transferred by a single vectored read or write, kept well below IOV_MAX.
+const MAX_PAGES_PER_VECTORED_IO = 256
+
+// pageRun is a range of indexes into a list of page IDs, whose page IDs are consecutive.
+type pageRun struct {
+	start int
+	end   int
+}
+
+// groupConsecutivePages splits a list of page IDs into runs of consecutive page IDs, which are contiguous in the file.
+func groupConsecutivePages(pageIds []uint64) []pageRun {
+
+	runs := make([]pageRun, 0)
+
+	for i := range pageIds {
+
+		if i > 0 && pageIds[i] == pageIds[i-1]+1 && i-runs[len(runs)-1].start < MAX_PAGES_PER_VECTORED_IO {
+			runs[len(runs)-1].end = i + 1
+			continue
+		}
+
+		runs = append(runs, pageRun{start: i, end: i + 1})
+	}
+
+	return runs
+}
+
+// readPagesVectored reads each page into its buffer, using a single preadv system call per run of consecutive pages.
+// Buffers are read into directly, so they must be aligned if the file was opened with Direct I/O.
+func readPagesVectored(file *os.File, pageSize int, pageIds []uint64, buffers [][]byte) error {
+
+	if len(pageIds) != len(buffers) {
+		return fmt.Errorf("got %d page IDs but %d buffers", len(pageIds), len(buffers))
+	}
+
+	for _, run := range groupConsecutivePages(pageIds) {
+
+		offset := int64(pageIds[run.start]) * int64(pageSize)
+
+		if err := transferFull(file, buffers[run.start:run.end], offset, unix.Preadv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePagesVectored writes each buffer to its page, using a single pwritev system call per run of consecutive pages.
+func writePagesVectored(file *os.File, pageSize int, pageIds []uint64, buffers [][]byte) error {
+
+	if len(pageIds) != len(buffers) {
+		return fmt.Errorf("got %d page IDs but %d buffers", len(pageIds), len(buffers))
+	}
+
+	for _, run := range groupConsecutivePages(pageIds) {
+
+		offset := int64(pageIds[run.start]) * int64(pageSize)
+
+		if err := transferFull(file, buffers[run.start:run.end], offset, unix.Pwritev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transferFull calls preadv/pwritev until every buffer has been transferred, since either may transfer fewer bytes than requested.
+func transferFull(file *os.File, buffers [][]byte, offset int64, transfer func(fd int, iovs [][]byte, offset int64) (int, error)) error {
+
+	rawConn, err := file.SyscallConn()
+
+	if err != nil {
+		return err
+	}
+
+	// copy the outer slice, since it is advanced after partial transfers
+	remaining := append([][]byte{}, buffers...)
+
+	for len(remaining) > 0 {
+
+		var n int
+		var transferErr error
+
+		if err := rawConn.Control(func(fd uintptr) {
+			n, transferErr = transfer(int(fd), remaining, offset)
+		}); err != nil {
+			return err
+		}
+
+		if transferErr != nil {
+			return transferErr
+		}
+
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+
+		offset += int64(n)
+
+		for n > 0 {
+
+			if n < len(remaining[0]) {
+				remaining[0] = remaining[0][n:]
+				break
+			}
+
+			n -= len(remaining[0])
+			remaining = remaining[1:]
+		}
+	}
+
+	return nil
+}
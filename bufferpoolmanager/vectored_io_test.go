@@ -0,0 +1,53 @@
+package bufferpoolmanager
+
+import (
+	"testing"
+
+	"github.com/ncw/directio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupConsecutivePages(t *testing.T) {
+
+	runs := groupConsecutivePages([]uint64{3, 4, 5, 8, 10, 11})
+	assert.Equal(t, []pageRun{{start: 0, end: 3}, {start: 3, end: 4}, {start: 4, end: 6}}, runs)
+
+	assert.Empty(t, groupConsecutivePages([]uint64{}))
+
+	// runs longer than MAX_PAGES_PER_VECTORED_IO are split
+	pageIds := make([]uint64, MAX_PAGES_PER_VECTORED_IO+1)
+	for i := range pageIds {
+		pageIds[i] = uint64(i)
+	}
+
+	runs = groupConsecutivePages(pageIds)
+	assert.Equal(t, []pageRun{{start: 0, end: MAX_PAGES_PER_VECTORED_IO}, {start: MAX_PAGES_PER_VECTORED_IO, end: MAX_PAGES_PER_VECTORED_IO + 1}}, runs)
+}
+
+func (ds *DirectIODiskManagerTestSuite) TestDiskManagerReadWritePages() {
+
+	pageIds := []uint64{5, 6, 7, 9}
+
+	buffers := make([][]byte, len(pageIds))
+	for i := range buffers {
+		buffers[i] = createPage(i * 1000)
+	}
+
+	ds.Require().NoError(ds.diskManager.writePages(pageIds, buffers))
+
+	readBuffers := make([][]byte, len(pageIds))
+	for i := range readBuffers {
+		readBuffers[i] = directio.AlignedBlock(PAGE_SIZE)
+	}
+
+	ds.Require().NoError(ds.diskManager.readPages(pageIds, readBuffers))
+
+	for i := range pageIds {
+		ds.Assert().Equal(true, checkPage(i*1000, readBuffers[i]))
+	}
+
+	// Direct I/O reads go straight into the buffers, so they must be aligned.
+	ds.Assert().Error(ds.diskManager.readPages([]uint64{5}, [][]byte{make([]byte, PAGE_SIZE+1)[1:]}))
+
+	ds.Assert().Error(ds.diskManager.readPages([]uint64{5, 6}, readBuffers[:1]))
+}
@@ -1,6 +1,7 @@
 package bufferpoolmanager
 
 import (
+	"context"
 	"log/slog"
 )
 
@@ -11,6 +12,9 @@ type WriteGuard struct {
 	active     bool
 	page       *Frame
 	bufferPool BufferPoolManager
+
+	// size of the page data exposed by the guard, space reserved by the disk manager at the end of the page is hidden.
+	pageDataSize int
 }
 
 // NewWriteGuard returns an active write guard.
@@ -24,15 +28,34 @@ func (bufferPool *SimpleBufferPoolManager) NewWriteGuard(pageId uint64) (*WriteG
 		return nil, err
 	}
 
+	return bufferPool.newWriteGuard(page), nil
+}
+
+// NewWriteGuardWithContext returns an active write guard. If all frames are pinned, it waits for a frame to be unpinned until the context is done.
+func (bufferPool *SimpleBufferPoolManager) NewWriteGuardWithContext(ctx context.Context, pageId uint64) (*WriteGuard, error) {
+
+	page, err := bufferPool.fetchPageWithContext(ctx, pageId)
+
+	if err != nil {
+		slog.Error("Failed to fetch page for write guard", "pageId", pageId, "error", err.Error())
+		return nil, err
+	}
+
+	return bufferPool.newWriteGuard(page), nil
+}
+
+// newWriteGuard locks a fetched page, and wraps it in a write guard.
+func (bufferPool *SimpleBufferPoolManager) newWriteGuard(page *Frame) *WriteGuard {
+
 	page.mutex.Lock()
 
-	guard := &WriteGuard{
+	return &WriteGuard{
 		active:     true,
 		page:       page,
 		bufferPool: bufferPool,
-	}
 
-	return guard, nil
+		pageDataSize: bufferPool.pageDataSize,
+	}
 }
 
 // DeletePage is used to call the delete function of the buffer pool manager in a thread-safe manner.
@@ -52,7 +75,7 @@ func (guard *WriteGuard) DeletePage() bool {
 		guard.page = nil
 		guard.bufferPool = nil
 	}
-	return false
+	return ok
 }
 
 // GetPageId returns the page ID of the page corresponding to the read guard.
@@ -70,7 +93,8 @@ func (guard *WriteGuard) GetPageData() []byte {
 	if !guard.active {
 		return nil
 	}
-	return guard.page.data
+	// the capacity is limited as well, so codecs can't grow the slice into the reserved space
+	return guard.page.data[:guard.pageDataSize:guard.pageDataSize]
 }
 
 func (guard *WriteGuard) IsActive() bool {
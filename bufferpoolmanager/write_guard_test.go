@@ -10,9 +10,8 @@ type WriteGuardTestSuite struct {
 func (ws *WriteGuardTestSuite) SetupTest() {
 
 	replacer := NewLRUReplacer()
-	disk, err := NewOSBufferedDiskManager("/test")
+	disk, _ := NewMemoryDiskManager()
 
-	ws.Suite.Assert().NoError(err)
 	bpm, err := NewSimpleBufferPoolManager(5, 4096, replacer, disk)
 
 	ws.Suite.Assert().NoError(err)
@@ -1,33 +1,53 @@
 package main
 
 import (
-	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
 	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
 	"github.com/Adarsh-Kmt/DragonDB/server"
+	"github.com/Adarsh-Kmt/DragonDB/storageengine"
 )
 
 func main() {
 
-	cache := bpm.NewLRUReplacer()
-	disk, metadata, _, err := bpm.NewDirectIODiskManager("dragon.db")
-
-	if err != nil {
-		panic(err)
+	// the data files of the tablespaces are recorded in the primary database file, so only its path is needed.
+	filePath := flag.String("db", "dragon.db", "path of the primary database file")
+	maxBufferPoolSize := flag.Int("max-buffer-pool-size", server.DEFAULT_MAX_BUFFER_POOL_SIZE, "largest number of frames a resize request can ask for")
+	migrate := flag.Bool("migrate", false, "upgrade a database file written by an older version to the current on-disk format before opening it")
+	flag.Parse()
+
+	// migrations rewrite the file in place, so they only run when asked to, once the file has been backed up.
+	if *migrate {
+		if _, err := bpm.MigrateDatabaseFile(*filePath, nil); err != nil {
+			panic(err)
+		}
 	}
 
-	bufferPoolManager, err := bpm.NewSimpleBufferPoolManager(5, 4096, cache, disk)
+	engine, _, err := storageengine.NewStorageEngineAt(*filePath)
+
+	if errors.Is(err, bpm.ErrOutdatedFormatVersion) {
+		panic(fmt.Errorf("%w, back up the database file and run with -migrate to upgrade it", err))
+	}
 
 	if err != nil {
 		panic(err)
 	}
 
-	btree := bplustree.NewBPlusTree(0, bufferPoolManager, metadata)
-
-	server, err := server.NewServer(":8080", btree)
+	// the server serves B+ tree 0, which holds the keys of databases written before the storage engine was used here.
+	// Secondary index and buffer pool resize requests go through the storage engine.
+	server, err := server.NewStorageEngineServer(":8080", engine, 0)
 
 	if err != nil {
 		panic(err)
 	}
 
+	server.SetMaxBufferPoolSize(*maxBufferPoolSize)
 	server.Run()
+
+	if err := engine.Close(); err != nil {
+		slog.Error("Failed to close storage engine", "error", err.Error(), "function", "main")
+	}
 }
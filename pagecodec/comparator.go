@@ -0,0 +1,197 @@
+package pagecodec
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Comparator defines the order of keys in a B+ tree. Compare returns a negative number if a < b, 0 if a == b, and a positive number if a > b.
+// The name of a B+ tree's comparator is recorded in the metadata page, and checked when the B+ tree is opened,
+// since opening a B+ tree with a different comparator would make its nodes appear unsorted.
+type Comparator struct {
+	Name    string
+	Compare func(a []byte, b []byte) int
+
+	// set if keys are ordered by their bytes, which allows separator keys promoted during leaf splits to be truncated.
+	bytewise bool
+}
+
+// NewComparator creates a custom comparator. It must be registered using RegisterComparator before B+ trees using it are reopened.
+func NewComparator(name string, compare func(a []byte, b []byte) int) Comparator {
+
+	return Comparator{
+		Name:    name,
+		Compare: compare,
+	}
+}
+
+// IsBytewise checks whether the comparator orders keys by their bytes.
+func (comparator Comparator) IsBytewise() bool {
+
+	return comparator.bytewise
+}
+
+var (
+	// BytewiseComparator orders keys lexicographically by their bytes. It is the default comparator.
+	BytewiseComparator = Comparator{
+		Name:     "bytewise",
+		Compare:  bytes.Compare,
+		bytewise: true,
+	}
+
+	// BigEndianUint64Comparator orders keys as big-endian unsigned integers.
+	// Keys with the same numeric value but a different number of leading zero bytes are ordered by length.
+	BigEndianUint64Comparator = NewComparator("uint64-be", compareBigEndianUint64)
+
+	// LittleEndianInt64Comparator orders keys of up to 8 bytes as little-endian two's complement signed integers.
+	// Keys longer than 8 bytes are ordered after all integer keys, by their bytes.
+	LittleEndianInt64Comparator = NewComparator("int64-le", compareLittleEndianInt64)
+
+	// UTF8CollationComparator orders UTF-8 keys rune by rune ignoring case, and orders keys that only differ in case by their bytes.
+	UTF8CollationComparator = NewComparator("utf8-collation", compareUTF8Collation)
+
+	// ReverseBytewiseComparator orders keys in reverse lexicographic order.
+	ReverseBytewiseComparator = ReverseComparator(BytewiseComparator)
+)
+
+// ReverseComparator returns a comparator that orders keys in the reverse order of the given comparator.
+func ReverseComparator(comparator Comparator) Comparator {
+
+	return NewComparator("reverse-"+comparator.Name, func(a []byte, b []byte) int {
+		return comparator.Compare(b, a)
+	})
+}
+
+var (
+	comparatorsMutex = &sync.RWMutex{}
+	comparators      = map[string]Comparator{
+		BytewiseComparator.Name:          BytewiseComparator,
+		BigEndianUint64Comparator.Name:   BigEndianUint64Comparator,
+		LittleEndianInt64Comparator.Name: LittleEndianInt64Comparator,
+		UTF8CollationComparator.Name:     UTF8CollationComparator,
+		ReverseBytewiseComparator.Name:   ReverseBytewiseComparator,
+	}
+)
+
+// RegisterComparator makes a comparator available by name, so B+ trees created with it can be reopened.
+func RegisterComparator(comparator Comparator) error {
+
+	comparatorsMutex.Lock()
+	defer comparatorsMutex.Unlock()
+
+	if _, exists := comparators[comparator.Name]; exists {
+		return fmt.Errorf("comparator %s is already registered", comparator.Name)
+	}
+
+	comparators[comparator.Name] = comparator
+	return nil
+}
+
+// GetComparator returns the registered comparator with the given name.
+func GetComparator(name string) (comparator Comparator, exists bool) {
+
+	comparatorsMutex.RLock()
+	defer comparatorsMutex.RUnlock()
+
+	comparator, exists = comparators[name]
+	return comparator, exists
+}
+
+func compareBigEndianUint64(a []byte, b []byte) int {
+
+	trimmedA := bytes.TrimLeft(a, "\x00")
+	trimmedB := bytes.TrimLeft(b, "\x00")
+
+	// without leading zeros, a longer integer is a larger integer
+	if len(trimmedA) != len(trimmedB) {
+		return compareInts(len(trimmedA), len(trimmedB))
+	}
+
+	if result := bytes.Compare(trimmedA, trimmedB); result != 0 {
+		return result
+	}
+
+	return compareInts(len(a), len(b))
+}
+
+func compareLittleEndianInt64(a []byte, b []byte) int {
+
+	aIsInt, bIsInt := len(a) <= 8, len(b) <= 8
+
+	if !aIsInt || !bIsInt {
+
+		if aIsInt != bIsInt {
+			// integer keys are ordered before other keys
+			if aIsInt {
+				return -1
+			}
+			return 1
+		}
+		return bytes.Compare(a, b)
+	}
+
+	if result := compareInts(decodeLittleEndianInt64(a), decodeLittleEndianInt64(b)); result != 0 {
+		return result
+	}
+
+	return compareInts(len(a), len(b))
+}
+
+// decodeLittleEndianInt64 decodes a little-endian two's complement integer of up to 8 bytes, sign extending it to 64 bits.
+func decodeLittleEndianInt64(b []byte) int64 {
+
+	if len(b) == 0 {
+		return 0
+	}
+
+	value := uint64(0)
+
+	for i := len(b) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(b[i])
+	}
+
+	shift := 64 - 8*len(b)
+
+	return int64(value<<shift) >> shift
+}
+
+func compareUTF8Collation(a []byte, b []byte) int {
+
+	pointerA, pointerB := 0, 0
+
+	for pointerA < len(a) && pointerB < len(b) {
+
+		runeA, sizeA := utf8.DecodeRune(a[pointerA:])
+		runeB, sizeB := utf8.DecodeRune(b[pointerB:])
+
+		if result := compareInts(unicode.ToLower(runeA), unicode.ToLower(runeB)); result != 0 {
+			return result
+		}
+
+		pointerA += sizeA
+		pointerB += sizeB
+	}
+
+	if result := compareInts(len(a)-pointerA, len(b)-pointerB); result != 0 {
+		return result
+	}
+
+	// keys that only differ in case are ordered by their bytes, so distinct keys never compare equal
+	return bytes.Compare(a, b)
+}
+
+func compareInts[T int | int32 | int64](a T, b T) int {
+
+	if a < b {
+		return -1
+	}
+
+	if a > b {
+		return 1
+	}
+
+	return 0
+}
@@ -21,6 +21,9 @@ type Header struct {
 	freeSpaceEnd       uint16
 	garbageSize        uint16
 	nextLeafNodePageId uint64
+
+	// length of the key prefix shared by all elements in a leaf node, stored at the end of the page
+	prefixLength uint16
 }
 
 type HeaderConfig struct {
@@ -33,6 +36,7 @@ type HeaderConfig struct {
 	garbageSizeOffset        int
 	freeSpaceBeginOffset     int
 	freeSpaceEndOffset       int
+	prefixLengthOffset       int
 	nextLeafNodePageIdOffset int
 
 	// constants
@@ -53,6 +57,7 @@ func defaultHeaderConfig() HeaderConfig {
 		freeSpaceBeginOffset:     8,
 		freeSpaceEndOffset:       10,
 		garbageSizeOffset:        12,
+		prefixLengthOffset:       14,
 		nextLeafNodePageIdOffset: 16,
 
 		headerSize:       24,
@@ -83,8 +88,11 @@ func (codec HeaderCodec) getInternalNodeType() uint8 {
 	return codec.config.internalNodeType
 }
 
-// decodePageHeader takes a slice of bytes representing a slotted page header, and returns a deserialized header object
-func (codec HeaderCodec) decodePageHeader(headerBytes []byte) *Header {
+// decodePageHeader takes a slotted page, and returns its deserialized header object.
+// The whole page is required, since the free space of an empty page ends at the end of the slotted region of the page.
+func (codec HeaderCodec) decodePageHeader(page []byte) *Header {
+
+	headerBytes := page[:codec.config.headerSize]
 
 	fmt.Println()
 
@@ -95,8 +103,9 @@ func (codec HeaderCodec) decodePageHeader(headerBytes []byte) *Header {
 		// If the page is empty, return an empty header
 		h.numSlots = 0
 		h.freeSpaceBegin = uint16(codec.config.headerSize)
-		h.freeSpaceEnd = 4096
+		h.freeSpaceEnd = uint16(slottedPageSize(page))
 		h.garbageSize = 0
+		h.prefixLength = 0
 		h.isLeafNode = true // Default to leaf node type for empty pages
 		h.crc = 0
 
@@ -116,6 +125,7 @@ func (codec HeaderCodec) decodePageHeader(headerBytes []byte) *Header {
 	h.freeSpaceEnd = binary.LittleEndian.Uint16(headerBytes[codec.config.freeSpaceEndOffset:])
 	h.garbageSize = binary.LittleEndian.Uint16(headerBytes[codec.config.garbageSizeOffset:])
 	h.nextLeafNodePageId = binary.LittleEndian.Uint64(headerBytes[codec.config.nextLeafNodePageIdOffset:])
+	h.prefixLength = binary.LittleEndian.Uint16(headerBytes[codec.config.prefixLengthOffset:])
 
 	slog.Info("Decoded Page Header", "is leaf node", h.isLeafNode, "number of slots", h.numSlots, "free space begin", h.freeSpaceBegin, "free space end", h.freeSpaceEnd, "garbage size", h.garbageSize, "function", "decodePageHeader", "at", "HeaderCodec")
 	return h
@@ -191,6 +201,12 @@ func (codec HeaderCodec) setNextLeafNodePageId(headerBytes []byte, nextLeafNodeP
 	binary.LittleEndian.PutUint64(headerBytes[codec.config.nextLeafNodePageIdOffset:], nextLeafNodePageId)
 }
 
+// setPrefixLength is used to set the value of the prefix length field in the header
+func (codec HeaderCodec) setPrefixLength(headerBytes []byte, prefixLength uint16) {
+
+	binary.LittleEndian.PutUint16(headerBytes[codec.config.prefixLengthOffset:], prefixLength)
+}
+
 func generateCRC(data []byte) uint32 {
 	return crc32.ChecksumIEEE(data)
 }
@@ -210,11 +226,7 @@ func (codec HeaderCodec) updateCRC(page []byte) {
 
 func (codec *HeaderCodec) IsLeafNode(page []byte) bool {
 
-	headerBytes := page[:codec.config.headerSize]
-	// slog.Info("header size", "size", codec.config.headerSize)
-	// slog.Info(fmt.Sprintf("extracted header %v", headerBytes))
-	// slog.Info(fmt.Sprintf("header size %d", len(headerBytes)))
-	header := codec.decodePageHeader(headerBytes)
+	header := codec.decodePageHeader(page)
 
 	return header.isLeafNode
 }
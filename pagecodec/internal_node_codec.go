@@ -1,7 +1,6 @@
 package pagecodec
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"log/slog"
@@ -10,6 +9,7 @@ import (
 type InternalNodeCodec struct {
 	headerCodec HeaderCodec
 	slotCodec   SlotCodec
+	comparator  Comparator
 }
 type InternalNodeElement struct {
 	Key                  []byte
@@ -19,9 +19,16 @@ type InternalNodeElement struct {
 
 func NewInternalNodeCodec() InternalNodeCodec {
 
+	return NewInternalNodeCodecWithComparator(BytewiseComparator)
+}
+
+// NewInternalNodeCodecWithComparator creates an internal node codec that orders keys using the given comparator.
+func NewInternalNodeCodecWithComparator(comparator Comparator) InternalNodeCodec {
+
 	return InternalNodeCodec{
 		headerCodec: DefaultHeaderCodec(),
 		slotCodec:   defaultSlotCodec(),
+		comparator:  comparator,
 	}
 }
 
@@ -113,12 +120,12 @@ func (codec InternalNodeCodec) FindNextChildNodePageId(page []byte, key []byte)
 
 	for _, element := range elements {
 
-		result := bytes.Compare(element.Key, key)
+		result := codec.comparator.Compare(element.Key, key)
 
 		if result == 0 {
 			return element.RightChildNodePageId
 
-		} else if result == 1 {
+		} else if result > 0 {
 			return element.LeftChildNodePageId
 		}
 
@@ -128,6 +135,57 @@ func (codec InternalNodeCodec) FindNextChildNodePageId(page []byte, key []byte)
 	return nextChildNodePageId
 }
 
+// GetChildNodePageIds returns the page IDs of the children of the internal node in key order,
+// and the keys of its elements, where keys[i] separates child i from child i+1.
+func (codec InternalNodeCodec) GetChildNodePageIds(page []byte) (childNodePageIds []uint64, keys [][]byte) {
+
+	_, elements := codec.getAllSlotsAndElements(page)
+
+	childNodePageIds = make([]uint64, 0, len(elements)+1)
+	keys = make([][]byte, 0, len(elements))
+
+	for i, element := range elements {
+
+		// adjacent elements share a child, the right child of an element is the left child of the next element.
+		if i == 0 {
+			childNodePageIds = append(childNodePageIds, element.LeftChildNodePageId)
+		}
+
+		childNodePageIds = append(childNodePageIds, element.RightChildNodePageId)
+		keys = append(keys, element.Key)
+	}
+
+	return childNodePageIds, keys
+}
+
+// ReplaceChildNodePageId replaces every reference to a child node with a reference to the page it was moved to.
+// It returns false if the internal node doesn't reference the child node.
+func (codec InternalNodeCodec) ReplaceChildNodePageId(page []byte, oldChildNodePageId uint64, newChildNodePageId uint64) (replaced bool) {
+
+	slots, elements := codec.getAllSlotsAndElements(page)
+
+	for i, element := range elements {
+
+		elementBytes := page[slots[i].elementPointer : slots[i].elementPointer+slots[i].elementSize]
+
+		if element.LeftChildNodePageId == oldChildNodePageId {
+			codec.setLeftChildNodePageId(elementBytes, newChildNodePageId)
+			replaced = true
+		}
+
+		if element.RightChildNodePageId == oldChildNodePageId {
+			codec.setRightChildNodePageId(elementBytes, newChildNodePageId)
+			replaced = true
+		}
+	}
+
+	if replaced {
+		codec.headerCodec.updateCRC(page)
+	}
+
+	return replaced
+}
+
 // InsertElement is used to insert a key value pair in a page
 func (codec InternalNodeCodec) InsertElement(page []byte, key []byte, leftChildNodePageId uint64, rightChildNodePageId uint64) bool {
 
@@ -140,7 +198,7 @@ func (codec InternalNodeCodec) InsertElement(page []byte, key []byte, leftChildN
 	// slog.Info(fmt.Sprintf("extracted header %v of size %d", headerBytes, codec.headerCodec.getHeaderSize()))
 	// slog.Info(fmt.Sprintf("header size %d", len(headerBytes)))
 	// decode header
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 
 	// calculate space required to store element
 	elementSpaceRequired := 2 + len(key) + 8 + 8
@@ -167,7 +225,7 @@ func (codec InternalNodeCodec) InsertElement(page []byte, key []byte, leftChildN
 
 			// update the header after compaction
 			headerBytes = page[:codec.headerCodec.getHeaderSize()]
-			header = codec.headerCodec.decodePageHeader(headerBytes)
+			header = codec.headerCodec.decodePageHeader(page)
 		}
 	}
 
@@ -230,7 +288,7 @@ func (codec InternalNodeCodec) getAllSlotsAndElements(page []byte) ([]Slot, []In
 func (codec InternalNodeCodec) putAllSlotsAndElements(page []byte, slots []Slot, elements []InternalNodeElement) {
 
 	freeSpaceBegin := uint16(codec.headerCodec.getHeaderSize())
-	freeSpaceEnd := uint16(4096)
+	freeSpaceEnd := uint16(slottedPageSize(page))
 
 	for i := range slots {
 
@@ -264,13 +322,62 @@ func (codec InternalNodeCodec) DeleteElement(page []byte, key []byte) bool {
 
 	// update garbage size
 	headerBytes := page[:codec.headerCodec.getHeaderSize()]
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 
 	codec.headerCodec.setGarbageSize(headerBytes, header.garbageSize+uint16(len(elementBytes)+codec.slotCodec.getSlotSize()))
 
 	return true
 }
 
+// Compact removes the garbage left in the page by deleted elements, and returns the number of bytes of free space reclaimed.
+func (codec InternalNodeCodec) Compact(page []byte) (reclaimedBytes int) {
+
+	header := codec.headerCodec.decodePageHeader(page)
+
+	if header.garbageSize == 0 {
+		return 0
+	}
+
+	freeSpace := int(header.freeSpaceEnd) - int(header.freeSpaceBegin)
+
+	codec.compact(page)
+	codec.headerCodec.updateCRC(page)
+
+	header = codec.headerCodec.decodePageHeader(page)
+
+	return int(header.freeSpaceEnd) - int(header.freeSpaceBegin) - freeSpace
+}
+
+// MergeChildNodes removes the element separating two adjacent children once the right child is merged into the left child,
+// pointing the next element to the left child. It returns false if no element separates the children,
+// or if it is the only element of the internal node, which can't be left without elements.
+func (codec InternalNodeCodec) MergeChildNodes(page []byte, leftChildNodePageId uint64, rightChildNodePageId uint64) bool {
+
+	slots, elements := codec.getAllSlotsAndElements(page)
+
+	if len(elements) < 2 {
+		return false
+	}
+
+	for i, element := range elements {
+
+		if element.LeftChildNodePageId != leftChildNodePageId || element.RightChildNodePageId != rightChildNodePageId {
+			continue
+		}
+
+		// the right child of an element is the left child of the next element.
+		if i+1 < len(elements) {
+
+			nextElementBytes := page[slots[i+1].elementPointer : slots[i+1].elementPointer+slots[i+1].elementSize]
+			codec.setLeftChildNodePageId(nextElementBytes, leftChildNodePageId)
+		}
+
+		return codec.DeleteElement(page, element.Key)
+	}
+
+	return false
+}
+
 // compact is used to remove all garbage that results from performing delete/update operations on the page
 func (codec InternalNodeCodec) compact(page []byte) {
 
@@ -285,7 +392,7 @@ func (codec InternalNodeCodec) SplitNode(leftNode []byte, rightNode []byte, righ
 	defer codec.headerCodec.updateCRC(rightNode)
 
 	leftNodeHeaderBytes := leftNode[:codec.headerCodec.getHeaderSize()]
-	leftNodeHeader := codec.headerCodec.decodePageHeader(leftNodeHeaderBytes)
+	leftNodeHeader := codec.headerCodec.decodePageHeader(leftNode)
 
 	rightNodeHeaderBytes := rightNode[:codec.headerCodec.getHeaderSize()]
 
@@ -322,7 +429,7 @@ func (codec InternalNodeCodec) SplitNode(leftNode []byte, rightNode []byte, righ
 
 func (codec InternalNodeCodec) linearSearch(page []byte, key []byte) (slotBytes []byte, elementBytes []byte, found int) {
 
-	header := codec.headerCodec.decodePageHeader(page[:codec.headerCodec.getHeaderSize()])
+	header := codec.headerCodec.decodePageHeader(page)
 
 	pointer := codec.headerCodec.getHeaderSize()
 
@@ -341,10 +448,10 @@ func (codec InternalNodeCodec) linearSearch(page []byte, key []byte) (slotBytes
 
 			elementBytes = currElementBytes
 
-			result := bytes.Compare(currElement.Key, key)
+			result := codec.comparator.Compare(currElement.Key, key)
 			if result == 0 {
 				return currSlotBytes, currElementBytes, result
-			} else if result == 1 {
+			} else if result > 0 {
 				return slotBytes, elementBytes, result
 			}
 		}
@@ -371,11 +478,8 @@ func (codec InternalNodeCodec) InsertSlot(page []byte, newSlot Slot, key []byte,
 	// initialize pointer to beginning of slot region
 	pointer := codec.headerCodec.config.headerSize
 
-	// extract header bytes from page
-	headerBytes := page[:codec.headerCodec.config.headerSize]
-
-	// decode header from header bytes
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	// decode header from page
+	header := codec.headerCodec.decodePageHeader(page)
 
 	// create a list to store all slots corresponding to elements with key greater than or equal to target key
 	greaterSlots := []Slot{newSlot}
@@ -404,16 +508,16 @@ func (codec InternalNodeCodec) InsertSlot(page []byte, newSlot Slot, key []byte,
 			existingElement := codec.decodeElement(elementBytes)
 
 			// compare element key and target key
-			result := bytes.Compare(existingElement.Key, key)
+			result := codec.comparator.Compare(existingElement.Key, key)
 
 			// if element.key > target key, append slot to greater slots list
-			if result == 1 {
+			if result > 0 {
 				if !greaterFound {
 					greaterElementBytes = elementBytes
 					greaterFound = true
 				}
 				greaterSlots = append(greaterSlots, existingSlot)
-			} else if result == -1 {
+			} else if result < 0 {
 				smallerElementBytes = elementBytes
 			}
 
@@ -483,7 +587,7 @@ func (codec InternalNodeCodec) appendAllSlotsAndElements(page []byte, slots []Sl
 
 	headerBytes := page[:codec.headerCodec.getHeaderSize()]
 
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 
 	for i := range slots {
 
@@ -540,7 +644,7 @@ func (codec InternalNodeCodec) appendAllSlotsAndElements(page []byte, slots []Sl
 
 // 	headerBytes := underflowNode[:codec.headerCodec.getHeaderSize()]
 
-// 	header := codec.headerCodec.decodePageHeader(headerBytes)
+// 	header := codec.headerCodec.decodePageHeader(page)
 
 // 	separatorSlot.elementPointer = header.freeSpaceEnd - separatorSlot.elementSize
 
@@ -5,27 +5,44 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log/slog"
+	"strconv"
 )
 
 type LeafNodeCodec struct {
 	slotCodec   SlotCodec
 	headerCodec HeaderCodec
+	comparator  Comparator
 }
 type LeafNodeElement struct {
 	Key   []byte
 	Value []byte
+
+	// ExpiresAt is the unix timestamp (in nanoseconds) after which the element is considered deleted.
+	// An ExpiresAt value of 0 means the element never expires.
+	ExpiresAt uint64
+
+	// Compression is the algorithm the value was compressed with, Value holds the compressed bytes.
+	Compression CompressionType
 }
 
 func NewLeafNodeCodec() LeafNodeCodec {
 
+	return NewLeafNodeCodecWithComparator(BytewiseComparator)
+}
+
+// NewLeafNodeCodecWithComparator creates a leaf node codec that orders keys using the given comparator.
+func NewLeafNodeCodecWithComparator(comparator Comparator) LeafNodeCodec {
+
 	return LeafNodeCodec{
 		headerCodec: DefaultHeaderCodec(),
 		slotCodec:   defaultSlotCodec(),
+		comparator:  comparator,
 	}
 }
 
-// decodeElement takes a slice of bytes representing a element in the data region, and returns a deserialized element object
-func (codec LeafNodeCodec) decodeElement(elementBytes []byte) LeafNodeElement {
+// decodeElement takes a slice of bytes representing a element in the data region, and returns a deserialized element object.
+// Elements only store the part of the key following the prefix shared by all keys in the page, so the prefix is prepended to it.
+func (codec LeafNodeCodec) decodeElement(elementBytes []byte, prefix []byte) LeafNodeElement {
 
 	e := LeafNodeElement{}
 
@@ -35,10 +52,11 @@ func (codec LeafNodeCodec) decodeElement(elementBytes []byte) LeafNodeElement {
 	keyLength := binary.LittleEndian.Uint16(elementBytes[pointer:])
 	pointer += 2
 
-	key := make([]byte, keyLength)
+	key := make([]byte, len(prefix)+int(keyLength))
 
 	// extract key
-	copy(key, elementBytes[pointer:pointer+keyLength])
+	copy(key, prefix)
+	copy(key[len(prefix):], elementBytes[pointer:pointer+keyLength])
 	e.Key = key
 
 	pointer += keyLength
@@ -53,25 +71,71 @@ func (codec LeafNodeCodec) decodeElement(elementBytes []byte) LeafNodeElement {
 	copy(value, elementBytes[pointer:pointer+valueLength])
 	e.Value = value
 
+	pointer += valueLength
+
+	// decode expiry timestamp field
+	e.ExpiresAt = binary.LittleEndian.Uint64(elementBytes[pointer:])
+	pointer += 8
+
+	// decode compression type field
+	e.Compression = CompressionType(elementBytes[pointer])
+
 	return e
 
 }
 
-// encodeSlot takes an element struct and returns an encoded slice of bytes representing this element
-func (codec LeafNodeCodec) encodeElement(element LeafNodeElement) []byte {
+// GetAllVersion1Elements returns the elements of a leaf node written in format version 1 or earlier in sorted order, skipping deleted elements.
+// Elements of these versions end with the value, the expiry timestamp and compression type fields were added in format version 2.
+func (codec LeafNodeCodec) GetAllVersion1Elements(page []byte) []LeafNodeElement {
+
+	header := codec.headerCodec.decodePageHeader(page)
+	pointer := codec.headerCodec.getHeaderSize()
+
+	elements := make([]LeafNodeElement, 0)
+
+	for range int(header.numSlots) {
+
+		slot := codec.slotCodec.decodeSlot(page[pointer : pointer+codec.slotCodec.getSlotSize()])
+		pointer += codec.slotCodec.getSlotSize()
+
+		if codec.slotCodec.isElementDeleted(slot) {
+			continue
+		}
+
+		elementBytes := page[slot.elementPointer : slot.elementPointer+slot.elementSize]
+
+		keyLength := binary.LittleEndian.Uint16(elementBytes)
+		key := bytes.Clone(elementBytes[2 : 2+keyLength])
+
+		valueLength := binary.LittleEndian.Uint16(elementBytes[2+keyLength:])
+		value := bytes.Clone(elementBytes[4+keyLength : 4+keyLength+valueLength])
+
+		elements = append(elements, LeafNodeElement{Key: key, Value: value, Compression: CompressionNone})
+	}
+
+	return elements
+}
+
+// encodeSlot takes an element struct and returns an encoded slice of bytes representing this element.
+// The key must start with the prefix shared by all keys in the page, only the part of the key following it is encoded.
+func (codec LeafNodeCodec) encodeElement(element LeafNodeElement, prefix []byte) []byte {
 
 	fmt.Println()
 	//slog.Info("Encoding element...", "function", "encodeElement", "at", "LeafNodeCodec")
 	b := make([]byte, 0)
 
-	b = binary.LittleEndian.AppendUint16(b, uint16(len(element.Key)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(element.Key)-len(prefix)))
 
-	b = append(b, element.Key...)
+	b = append(b, element.Key[len(prefix):]...)
 
 	b = binary.LittleEndian.AppendUint16(b, uint16(len(element.Value)))
 
 	b = append(b, element.Value...)
 
+	b = binary.LittleEndian.AppendUint64(b, element.ExpiresAt)
+
+	b = append(b, byte(element.Compression))
+
 	return b
 }
 
@@ -80,8 +144,56 @@ func (codec LeafNodeCodec) SetNodeType(page []byte) {
 	codec.headerCodec.SetNodeType(page[:codec.headerCodec.getHeaderSize()], true)
 }
 
-// setValue sets the value field in the element. only use if len(new_value) <= len(old_value)
-func (codec LeafNodeCodec) setValueInElement(elementBytes []byte, value []byte) {
+// getPrefix returns the key prefix shared by all elements in the page, which is stored at the end of the slotted region of the page.
+func (codec LeafNodeCodec) getPrefix(page []byte) []byte {
+
+	header := codec.headerCodec.decodePageHeader(page)
+	end := slottedPageSize(page)
+
+	return page[end-int(header.prefixLength) : end]
+}
+
+// longestCommonPrefix returns the longest prefix shared by the keys of all elements.
+func longestCommonPrefix(elements []LeafNodeElement) []byte {
+
+	if len(elements) == 0 {
+		return nil
+	}
+
+	prefix := elements[0].Key
+
+	for _, element := range elements[1:] {
+		prefix = prefix[:commonPrefixLength(prefix, element.Key)]
+	}
+
+	return prefix
+}
+
+// commonPrefixLength returns the length of the longest prefix shared by a and b.
+func commonPrefixLength(a []byte, b []byte) int {
+
+	length := 0
+
+	for length < len(a) && length < len(b) && a[length] == b[length] {
+		length++
+	}
+
+	return length
+}
+
+// shortestSeparator returns the shortest key s such that leftKey < s <= rightKey, given that leftKey < rightKey.
+// Promoting s instead of rightKey into the parent node leaves more space for separator keys in internal nodes.
+func shortestSeparator(leftKey []byte, rightKey []byte) []byte {
+
+	separator := make([]byte, commonPrefixLength(leftKey, rightKey)+1)
+
+	copy(separator, rightKey)
+
+	return separator
+}
+
+// setValue sets the value, expiry timestamp and compression type fields in the element. only use if len(new_value) <= len(old_value)
+func (codec LeafNodeCodec) setValueInElement(elementBytes []byte, value []byte, expiresAt uint64, compression CompressionType) {
 
 	fmt.Println()
 	//slog.Info("Setting value in element...", "function", "setValue", "at", "LeafNodeCodec")
@@ -96,50 +208,212 @@ func (codec LeafNodeCodec) setValueInElement(elementBytes []byte, value []byte)
 	pointer += 2
 
 	copy(elementBytes[pointer:], value)
+	pointer += len(value)
+
+	binary.LittleEndian.PutUint64(elementBytes[pointer:], expiresAt)
+	pointer += 8
 
+	elementBytes[pointer] = byte(compression)
 }
 
 // FindElement is used to return the value corresponding to a key, or the next page ID where this key could be found
 func (codec LeafNodeCodec) FindValue(page []byte, key []byte) (value []byte, found bool) {
 
+	element, found := codec.FindElement(page, key)
+
+	if !found {
+		return nil, false
+	}
+	return element.Value, true
+}
+
+// FindElement is used to return the element corresponding to a key, including its expiry timestamp
+func (codec LeafNodeCodec) FindElement(page []byte, key []byte) (element LeafNodeElement, found bool) {
+
 	_, elements := codec.getAllSlotsAndElements(page)
 
 	for _, element := range elements {
 
-		result := bytes.Compare(element.Key, key)
+		result := codec.comparator.Compare(element.Key, key)
 
 		if result == 0 {
-			return element.Value, true
+			return element, true
+
+		}
+	}
+
+	return LeafNodeElement{}, false
+}
+
+// IsExpired checks whether the element has expired at the given unix timestamp (in nanoseconds)
+func (element LeafNodeElement) IsExpired(now uint64) bool {
+
+	return element.ExpiresAt != 0 && element.ExpiresAt <= now
+}
+
+// decodeExpiresAt returns the expiry timestamp stored in the element, without decoding the key and value
+func (codec LeafNodeCodec) decodeExpiresAt(elementBytes []byte) uint64 {
+
+	pointer := 2 + int(binary.LittleEndian.Uint16(elementBytes))
+
+	pointer += 2 + int(binary.LittleEndian.Uint16(elementBytes[pointer:]))
+
+	return binary.LittleEndian.Uint64(elementBytes[pointer:])
+}
+
+// isElementExpired checks whether the element has expired at the given unix timestamp (in nanoseconds)
+func (codec LeafNodeCodec) isElementExpired(elementBytes []byte, now uint64) bool {
+
+	expiresAt := codec.decodeExpiresAt(elementBytes)
+
+	return expiresAt != 0 && expiresAt <= now
+}
+
+// decodeKey returns the key stored in the element, without decoding the value stored alongside it.
+func (codec LeafNodeCodec) decodeKey(elementBytes []byte, prefix []byte) []byte {
+
+	keyLength := binary.LittleEndian.Uint16(elementBytes)
+
+	key := make([]byte, len(prefix)+int(keyLength))
+
+	copy(key, prefix)
+	copy(key[len(prefix):], elementBytes[2:2+keyLength])
+
+	return key
+}
+
+// getAllKeys returns the keys of all elements in the page in sorted order. This function skips deleted elements,
+// as well as elements that have expired at the given unix timestamp (in nanoseconds).
+func (codec LeafNodeCodec) getAllKeys(page []byte, now uint64) [][]byte {
+
+	header := codec.headerCodec.decodePageHeader(page)
+	pointer := codec.headerCodec.getHeaderSize()
+	prefix := codec.getPrefix(page)
+
+	keys := make([][]byte, 0, header.numSlots)
+
+	for range int(header.numSlots) {
+
+		slot := codec.slotCodec.decodeSlot(page[pointer : pointer+codec.slotCodec.getSlotSize()])
+		pointer += codec.slotCodec.getSlotSize()
+
+		if codec.slotCodec.isElementDeleted(slot) {
+			continue
+		}
+
+		elementBytes := page[slot.elementPointer : slot.elementPointer+slot.elementSize]
+
+		if !codec.isElementExpired(elementBytes, now) {
+			keys = append(keys, codec.decodeKey(elementBytes, prefix))
+		}
+	}
+
+	return keys
+}
+
+// GetElementsInRange returns a copy of all unexpired elements in the page with keys in the range [startKey, endKey), in sorted order.
+// A nil endKey represents an unbounded range.
+// endReached is set to true if the page contains a key >= endKey, in which case no subsequent leaf node can contain keys in the range.
+func (codec LeafNodeCodec) GetElementsInRange(page []byte, startKey []byte, endKey []byte, now uint64) (elements []LeafNodeElement, endReached bool) {
+
+	_, allElements := codec.getAllSlotsAndElements(page)
+
+	elements = make([]LeafNodeElement, 0)
+
+	for _, element := range allElements {
+
+		if endKey != nil && codec.comparator.Compare(element.Key, endKey) >= 0 {
+			return elements, true
+		}
+
+		if codec.comparator.Compare(element.Key, startKey) >= 0 && !element.IsExpired(now) {
+			elements = append(elements, element)
+		}
+	}
+	return elements, false
+}
+
+// GetExpiredKeys returns a copy of the keys of all elements in the page that have expired at the given unix timestamp (in nanoseconds), in sorted order.
+func (codec LeafNodeCodec) GetExpiredKeys(page []byte, now uint64) [][]byte {
+
+	_, elements := codec.getAllSlotsAndElements(page)
 
+	keys := make([][]byte, 0)
+
+	for _, element := range elements {
+
+		if element.IsExpired(now) {
+			keys = append(keys, element.Key)
+		}
+	}
+	return keys
+}
+
+// ContainsKey is used to check whether an unexpired key exists in the page, without decoding the value stored alongside it.
+func (codec LeafNodeCodec) ContainsKey(page []byte, key []byte, now uint64) bool {
+
+	for _, currKey := range codec.getAllKeys(page, now) {
+
+		if codec.comparator.Compare(currKey, key) == 0 {
+			return true
 		}
 	}
+	return false
+}
+
+// CountKeysInRange returns the number of unexpired keys in the page that lie in the range [startKey, endKey).
+// A nil endKey represents an unbounded range.
+// endReached is set to true if the page contains a key >= endKey, in which case no subsequent leaf node can contain keys in the range.
+func (codec LeafNodeCodec) CountKeysInRange(page []byte, startKey []byte, endKey []byte, now uint64) (count int, endReached bool) {
+
+	for _, currKey := range codec.getAllKeys(page, now) {
+
+		if endKey != nil && codec.comparator.Compare(currKey, endKey) >= 0 {
+			return count, true
+		}
 
-	return nil, false
+		if codec.comparator.Compare(currKey, startKey) >= 0 {
+			count++
+		}
+	}
+	return count, false
 }
 
-func (codec LeafNodeCodec) SetValue(page []byte, key []byte, value []byte) bool {
+// SetValue is used to set the value of an existing key. compression is the algorithm the value was compressed with.
+func (codec LeafNodeCodec) SetValue(page []byte, key []byte, value []byte, expiresAt uint64, compression CompressionType) bool {
 	defer codec.headerCodec.updateCRC(page)
 
 	// search for slot, element corresponding to key
 	slotBytes, elementBytes, _ := codec.linearSearch(page, key)
 
+	// the key exists in the page, so it starts with the prefix shared by all keys in the page
+	prefix := codec.getPrefix(page)
+
 	// decode existing element
-	oldElement := codec.decodeElement(elementBytes)
+	oldElement := codec.decodeElement(elementBytes, prefix)
 
 	// extract header bytes from page
 	headerBytes := page[:codec.headerCodec.getHeaderSize()]
 
 	// decode header
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
+
+	// create element
+	newElement := LeafNodeElement{
+		Key:         key,
+		Value:       value,
+		ExpiresAt:   expiresAt,
+		Compression: compression,
+	}
 
 	// calculate space required to store element
-	elementSpaceRequired := 2 + len(key) + 2 + len(value)
+	elementSpaceRequired := int(codec.calculateElementSize(newElement, len(prefix)))
 
 	// if size(current_element_value) >= size(new_element_value)
 	if len(oldElement.Value) >= len(value) {
 
 		// update value in place
-		codec.setValueInElement(elementBytes, value)
+		codec.setValueInElement(elementBytes, value, expiresAt, compression)
 
 		// update garbage size field in the header region
 		codec.headerCodec.setGarbageSize(headerBytes, header.garbageSize+uint16(len(oldElement.Value)-len(value)))
@@ -164,18 +438,12 @@ func (codec LeafNodeCodec) SetValue(page []byte, key []byte, value []byte) bool
 
 				// update the header after compaction
 				headerBytes = page[:codec.headerCodec.getHeaderSize()]
-				header = codec.headerCodec.decodePageHeader(headerBytes)
+				header = codec.headerCodec.decodePageHeader(page)
 			}
 		}
 
-		// create element
-		newElement := LeafNodeElement{
-			Key:   key,
-			Value: value,
-		}
-
 		// append value to end of free space region
-		header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, newElement)
+		header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, newElement, prefix)
 
 		// update free space end value
 		codec.headerCodec.setFreeSpaceEnd(headerBytes, header.freeSpaceEnd)
@@ -184,17 +452,19 @@ func (codec LeafNodeCodec) SetValue(page []byte, key []byte, value []byte) bool
 		codec.slotCodec.setElementPointer(slotBytes, header.freeSpaceEnd)
 
 		// update element size field in existing slot
-		codec.slotCodec.setElementSize(slotBytes, codec.calculateElementSize(newElement))
+		codec.slotCodec.setElementSize(slotBytes, codec.calculateElementSize(newElement, len(prefix)))
 
 		// update garbage size field in header region
-		codec.headerCodec.setGarbageSize(headerBytes, header.garbageSize+codec.calculateElementSize(oldElement))
+		codec.headerCodec.setGarbageSize(headerBytes, header.garbageSize+codec.calculateElementSize(oldElement, len(prefix)))
 
 	}
 	return true
 }
 
-// InsertElement is used to insert a key value pair in a page
-func (codec LeafNodeCodec) InsertElement(page []byte, key []byte, value []byte) bool {
+// InsertElement is used to insert a key value pair in a page.
+// expiresAt is the unix timestamp (in nanoseconds) after which the element expires, 0 if it should never expire.
+// compression is the algorithm the value was compressed with.
+func (codec LeafNodeCodec) InsertElement(page []byte, key []byte, value []byte, expiresAt uint64, compression CompressionType) bool {
 
 	fmt.Println()
 
@@ -205,10 +475,35 @@ func (codec LeafNodeCodec) InsertElement(page []byte, key []byte, value []byte)
 	// slog.Info(fmt.Sprintf("extracted header %v of size %d", headerBytes, codec.headerCodec.getHeaderSize()))
 	// slog.Info(fmt.Sprintf("header size %d", len(headerBytes)))
 	// decode header
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 	//slog.Info("Inserting element in page...", "key", string(key), "slots", header.numSlots, "function", "InsertElement", "at", "LeafNodeCodec")
+
+	// create new element
+	newElement := LeafNodeElement{
+		Key:         key,
+		Value:       value,
+		ExpiresAt:   expiresAt,
+		Compression: compression,
+	}
+
+	prefix := codec.getPrefix(page)
+
+	// if the key doesn't start with the prefix shared by all keys in the page, the prefix must be shortened.
+	if !bytes.HasPrefix(key, prefix) {
+
+		prefix = prefix[:commonPrefixLength(prefix, key)]
+
+		if !codec.rebuildWithPrefix(page, prefix, newElement) {
+			return false
+		}
+
+		headerBytes = page[:codec.headerCodec.getHeaderSize()]
+		header = codec.headerCodec.decodePageHeader(page)
+		prefix = codec.getPrefix(page)
+	}
+
 	// calculate space required to store element
-	elementSpaceRequired := 2 + len(key) + 2 + len(value)
+	elementSpaceRequired := int(codec.calculateElementSize(newElement, len(prefix)))
 
 	// calculate space required to store new slot
 	slotSpaceRequired := codec.slotCodec.getSlotSize()
@@ -232,25 +527,19 @@ func (codec LeafNodeCodec) InsertElement(page []byte, key []byte, value []byte)
 
 			// update the header after compaction
 			headerBytes = page[:codec.headerCodec.getHeaderSize()]
-			header = codec.headerCodec.decodePageHeader(headerBytes)
+			header = codec.headerCodec.decodePageHeader(page)
 		}
 	}
 
-	// create new element
-	newElement := LeafNodeElement{
-		Key:   key,
-		Value: value,
-	}
-
 	// Debug: print page before append
 	//fmt.Printf("[DEBUG] page before appendElement: %v\n", page)
-	header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, newElement)
+	header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, newElement, prefix)
 	// Debug: print page after append
 	//fmt.Printf("[DEBUG] page after appendElement: %v\n", page)
 
 	// create new slot
 	newSlot := Slot{
-		elementSize:    codec.calculateElementSize(newElement),
+		elementSize:    codec.calculateElementSize(newElement, len(prefix)),
 		elementPointer: header.freeSpaceEnd,
 	}
 
@@ -261,7 +550,7 @@ func (codec LeafNodeCodec) InsertElement(page []byte, key []byte, value []byte)
 	codec.headerCodec.setFreeSpaceBegin(headerBytes, header.freeSpaceBegin)
 	// update number of slots field in header region
 
-	fmt.Println("number of slots after inserting key = " + string(key) + " = " + string(int(header.numSlots)))
+	fmt.Println("number of slots after inserting key = " + string(key) + " = " + strconv.Itoa(int(header.numSlots)))
 	codec.headerCodec.setNumSlots(headerBytes, int(header.numSlots)+1)
 	codec.headerCodec.SetIsPageFilled(headerBytes, true)
 	return true
@@ -272,6 +561,7 @@ func (codec LeafNodeCodec) getAllSlotsAndElements(page []byte) ([]Slot, []LeafNo
 
 	header := codec.headerCodec.decodePageHeader(page)
 	pointer := codec.headerCodec.getHeaderSize()
+	prefix := codec.getPrefix(page)
 
 	slots := make([]Slot, 0)
 	elements := make([]LeafNodeElement, 0)
@@ -286,7 +576,7 @@ func (codec LeafNodeCodec) getAllSlotsAndElements(page []byte) ([]Slot, []LeafNo
 		if !codec.slotCodec.isElementDeleted(slot) {
 
 			elementBytes := page[slot.elementPointer : slot.elementPointer+slot.elementSize]
-			element := codec.decodeElement(elementBytes)
+			element := codec.decodeElement(elementBytes, prefix)
 			slots = append(slots, slot)
 			elements = append(elements, element)
 		}
@@ -295,16 +585,23 @@ func (codec LeafNodeCodec) getAllSlotsAndElements(page []byte) ([]Slot, []LeafNo
 	return slots, elements
 }
 
-// putAllSlotsAndElements inserts slots and elements into the page, assuming it to be empty
-func (codec LeafNodeCodec) putAllSlotsAndElements(page []byte, slots []Slot, elements []LeafNodeElement) {
+// putAllSlotsAndElements inserts slots and elements into the page, assuming it to be empty.
+// The prefix is stored at the end of the page, and must be shared by the keys of all elements.
+func (codec LeafNodeCodec) putAllSlotsAndElements(page []byte, slots []Slot, elements []LeafNodeElement, prefix []byte) {
+
+	// the prefix may point into the page, so it is copied before the page is overwritten
+	prefix = bytes.Clone(prefix)
 
 	freeSpaceBegin := uint16(codec.headerCodec.getHeaderSize())
-	freeSpaceEnd := uint16(4096)
+	freeSpaceEnd := uint16(slottedPageSize(page) - len(prefix))
+
+	copy(page[freeSpaceEnd:], prefix)
 
 	for i := range slots {
 		//slog.Info(fmt.Sprintf("after split putting element key = %s", string(elements[i].Key)))
-		freeSpaceEnd = codec.appendElement(page, freeSpaceEnd, elements[i])
+		freeSpaceEnd = codec.appendElement(page, freeSpaceEnd, elements[i], prefix)
 		slots[i].elementPointer = freeSpaceEnd
+		slots[i].elementSize = codec.calculateElementSize(elements[i], len(prefix))
 		freeSpaceBegin = codec.slotCodec.appendSlot(page, freeSpaceBegin, slots[i])
 
 	}
@@ -316,9 +613,29 @@ func (codec LeafNodeCodec) putAllSlotsAndElements(page []byte, slots []Slot, ele
 	codec.headerCodec.setGarbageSize(headerBytes, 0)
 	codec.headerCodec.setFreeSpaceBegin(headerBytes, freeSpaceBegin)
 	codec.headerCodec.setFreeSpaceEnd(headerBytes, freeSpaceEnd)
+	codec.headerCodec.setPrefixLength(headerBytes, uint16(len(prefix)))
 	codec.headerCodec.SetIsPageFilled(headerBytes, true)
 }
 
+// rebuildWithPrefix rewrites all elements in the page using a shorter prefix, as long as the new element still fits in the page afterwards.
+func (codec LeafNodeCodec) rebuildWithPrefix(page []byte, prefix []byte, newElement LeafNodeElement) bool {
+
+	slots, elements := codec.getAllSlotsAndElements(page)
+
+	spaceRequired := codec.headerCodec.getHeaderSize() + len(prefix)
+
+	for _, element := range append(elements, newElement) {
+		spaceRequired += int(codec.calculateElementSize(element, len(prefix))) + codec.slotCodec.getSlotSize()
+	}
+
+	if spaceRequired > slottedPageSize(page) {
+		return false
+	}
+
+	codec.putAllSlotsAndElements(page, slots, elements, prefix)
+	return true
+}
+
 // DeleteElement is used to delete a key value pair, if it exists
 func (codec LeafNodeCodec) DeleteElement(page []byte, key []byte) bool {
 
@@ -334,19 +651,72 @@ func (codec LeafNodeCodec) DeleteElement(page []byte, key []byte) bool {
 
 	// update garbage size
 	headerBytes := page[:codec.headerCodec.getHeaderSize()]
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 
 	codec.headerCodec.setGarbageSize(headerBytes, header.garbageSize+uint16(len(elementBytes)+codec.slotCodec.getSlotSize()))
 
 	return true
 }
 
+// Compact removes the garbage left in the page by deleted and updated elements, and returns the number of bytes of free space reclaimed.
+func (codec LeafNodeCodec) Compact(page []byte) (reclaimedBytes int) {
+
+	header := codec.headerCodec.decodePageHeader(page)
+
+	if header.garbageSize == 0 {
+		return 0
+	}
+
+	freeSpace := int(header.freeSpaceEnd) - int(header.freeSpaceBegin)
+
+	codec.compact(page)
+	codec.headerCodec.updateCRC(page)
+
+	header = codec.headerCodec.decodePageHeader(page)
+
+	return int(header.freeSpaceEnd) - int(header.freeSpaceBegin) - freeSpace
+}
+
+// MergeNodes moves the elements of the right node into the left node, and links the left node to the node after the right node.
+// The nodes are only merged if the left node uses at most fillFactor of the page afterwards, otherwise it returns false and neither node is changed.
+func (codec LeafNodeCodec) MergeNodes(leftNode []byte, rightNode []byte, fillFactor float64) bool {
+
+	leftSlots, leftElements := codec.getAllSlotsAndElements(leftNode)
+	rightSlots, rightElements := codec.getAllSlotsAndElements(rightNode)
+
+	slots := append(leftSlots, rightSlots...)
+	elements := append(leftElements, rightElements...)
+
+	prefix := longestCommonPrefix(elements)
+
+	spaceRequired := codec.headerCodec.getHeaderSize() + len(prefix)
+
+	for _, element := range elements {
+		spaceRequired += int(codec.calculateElementSize(element, len(prefix))) + codec.slotCodec.getSlotSize()
+	}
+
+	pageSize := slottedPageSize(leftNode)
+
+	if spaceRequired > pageSize || float64(spaceRequired) > fillFactor*float64(pageSize) {
+		return false
+	}
+
+	nextLeafNodePageId := codec.GetNextLeafNodePageId(rightNode)
+
+	codec.putAllSlotsAndElements(leftNode, slots, elements, prefix)
+	codec.headerCodec.setNextLeafNodePageId(leftNode[:codec.headerCodec.getHeaderSize()], nextLeafNodePageId)
+	codec.headerCodec.updateCRC(leftNode)
+
+	return true
+}
+
 // compact is used to remove all garbage that results from performing delete/update operations on the page
 func (codec LeafNodeCodec) compact(page []byte) {
 
 	slots, elements := codec.getAllSlotsAndElements(page)
 
-	codec.putAllSlotsAndElements(page, slots, elements)
+	// the prefix is kept as is, since the caller may be about to insert a key that only shares the current prefix
+	codec.putAllSlotsAndElements(page, slots, elements, codec.getPrefix(page))
 }
 
 func (codec LeafNodeCodec) SplitNode(leftNode []byte, rightNode []byte, rightNodePageId uint64) (extraKey []byte) {
@@ -355,7 +725,7 @@ func (codec LeafNodeCodec) SplitNode(leftNode []byte, rightNode []byte, rightNod
 	defer codec.headerCodec.updateCRC(rightNode)
 
 	leftNodeHeaderBytes := leftNode[:codec.headerCodec.getHeaderSize()]
-	leftNodeHeader := codec.headerCodec.decodePageHeader(leftNodeHeaderBytes)
+	leftNodeHeader := codec.headerCodec.decodePageHeader(leftNode)
 
 	rightNodeHeaderBytes := rightNode[:codec.headerCodec.getHeaderSize()]
 
@@ -380,10 +750,16 @@ func (codec LeafNodeCodec) SplitNode(leftNode []byte, rightNode []byte, rightNod
 	rightElements := elements[index:]
 
 	extraKey = elements[index].Key
+
+	// the separator only needs to distinguish the last key in the left node from the first key in the right node,
+	// which can only be done by truncating it if keys are ordered by their bytes.
+	if codec.comparator.IsBytewise() {
+		extraKey = shortestSeparator(elements[index-1].Key, elements[index].Key)
+	}
 	slog.Info("moving elements to left node")
-	codec.putAllSlotsAndElements(leftNode, leftSlots, leftElements)
+	codec.putAllSlotsAndElements(leftNode, leftSlots, leftElements, longestCommonPrefix(leftElements))
 	slog.Info("moving elements to right node")
-	codec.putAllSlotsAndElements(rightNode, rightSlots, rightElements)
+	codec.putAllSlotsAndElements(rightNode, rightSlots, rightElements, longestCommonPrefix(rightElements))
 
 	codec.headerCodec.setNextLeafNodePageId(rightNodeHeaderBytes, leftNodeHeader.nextLeafNodePageId)
 	codec.headerCodec.setNextLeafNodePageId(leftNodeHeaderBytes, rightNodePageId)
@@ -394,7 +770,8 @@ func (codec LeafNodeCodec) SplitNode(leftNode []byte, rightNode []byte, rightNod
 
 func (codec LeafNodeCodec) linearSearch(page []byte, key []byte) (slotBytes []byte, elementBytes []byte, found int) {
 
-	header := codec.headerCodec.decodePageHeader(page[:codec.headerCodec.getHeaderSize()])
+	header := codec.headerCodec.decodePageHeader(page)
+	prefix := codec.getPrefix(page)
 
 	pointer := codec.headerCodec.getHeaderSize()
 
@@ -409,14 +786,14 @@ func (codec LeafNodeCodec) linearSearch(page []byte, key []byte) (slotBytes []by
 		if !codec.slotCodec.isElementDeleted(currSlot) {
 
 			currElementBytes := page[currSlot.elementPointer : currSlot.elementPointer+currSlot.elementSize]
-			currElement := codec.decodeElement(currElementBytes)
+			currElement := codec.decodeElement(currElementBytes, prefix)
 
 			elementBytes = currElementBytes
 
-			result := bytes.Compare(currElement.Key, key)
+			result := codec.comparator.Compare(currElement.Key, key)
 			if result == 0 {
 				return currSlotBytes, currElementBytes, result
-			} else if result == 1 {
+			} else if result > 0 {
 				return slotBytes, elementBytes, result
 			}
 		}
@@ -424,15 +801,17 @@ func (codec LeafNodeCodec) linearSearch(page []byte, key []byte) (slotBytes []by
 	return nil, nil, -1
 }
 
-// calculateElementSize returns the total size of the element in the data region
-func (codec LeafNodeCodec) calculateElementSize(element LeafNodeElement) (size uint16) {
+// calculateElementSize returns the total size of the element in the data region, given the length of the prefix shared by all keys in the page
+func (codec LeafNodeCodec) calculateElementSize(element LeafNodeElement, prefixLength int) (size uint16) {
 
 	keyLengthFieldSize := 2
-	keyFieldSize := len(element.Key)
+	keyFieldSize := len(element.Key) - prefixLength
 	valueLengthFieldSize := 2
 	valueFieldSize := len(element.Value)
+	expiresAtFieldSize := 8
+	compressionFieldSize := 1
 
-	return uint16(keyLengthFieldSize + keyFieldSize + valueLengthFieldSize + valueFieldSize)
+	return uint16(keyLengthFieldSize + keyFieldSize + valueLengthFieldSize + valueFieldSize + expiresAtFieldSize + compressionFieldSize)
 }
 
 // insertSlot inserts a slot into the slot region while maintaining the sorted nature of the slot region. It also returns the left and right child node page ID of the element after insertion
@@ -443,11 +822,10 @@ func (codec LeafNodeCodec) InsertSlot(page []byte, newSlot Slot, key []byte) (up
 	// initialize pointer to beginning of slot region
 	pointer := codec.headerCodec.config.headerSize
 
-	// extract header bytes from page
-	headerBytes := page[:codec.headerCodec.config.headerSize]
+	// decode header from page
+	header := codec.headerCodec.decodePageHeader(page)
 
-	// decode header from header bytes
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	prefix := codec.getPrefix(page)
 
 	// create a list to store all slots corresponding to elements with key greater than or equal to target key
 	greaterSlots := []Slot{newSlot}
@@ -470,13 +848,13 @@ func (codec LeafNodeCodec) InsertSlot(page []byte, newSlot Slot, key []byte) (up
 			elementBytes := page[existingSlot.elementPointer : existingSlot.elementPointer+existingSlot.elementSize]
 
 			// decode elment from element bytes
-			existingElement := codec.decodeElement(elementBytes)
+			existingElement := codec.decodeElement(elementBytes, prefix)
 
 			// compare element key and target key
-			result := bytes.Compare(existingElement.Key, key)
+			result := codec.comparator.Compare(existingElement.Key, key)
 
 			// if element.key > target key, append slot to greater slots list
-			if result == 1 {
+			if result > 0 {
 				if !greaterFound {
 
 					greaterFound = true
@@ -529,10 +907,10 @@ func (codec LeafNodeCodec) PrintElements(page []byte) {
 	}
 }
 
-func (codec LeafNodeCodec) appendElement(page []byte, freeSpaceEnd uint16, element LeafNodeElement) (updatedFreeSpaceEnd uint16) {
+func (codec LeafNodeCodec) appendElement(page []byte, freeSpaceEnd uint16, element LeafNodeElement, prefix []byte) (updatedFreeSpaceEnd uint16) {
 	fmt.Println()
 	slog.Info("Appending element to page", "key", string(element.Key), "function", "appendElement", "at", "SlottedPageCodec")
-	elementBytes := codec.encodeElement(element)
+	elementBytes := codec.encodeElement(element, prefix)
 	// Debug: print elementBytes
 	//fmt.Printf("[DEBUG] elementBytes: %v\n", elementBytes)
 	writeStart := int(freeSpaceEnd) - len(elementBytes)
@@ -551,11 +929,12 @@ func (codec LeafNodeCodec) appendAllSlotsAndElements(page []byte, slots []Slot,
 
 	headerBytes := page[:codec.headerCodec.getHeaderSize()]
 
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
+	prefix := codec.getPrefix(page)
 
 	for i := range slots {
 
-		header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, elements[i])
+		header.freeSpaceEnd = codec.appendElement(page, header.freeSpaceEnd, elements[i], prefix)
 		slots[i].elementPointer = header.freeSpaceEnd
 		header.freeSpaceBegin = codec.slotCodec.appendSlot(page, header.freeSpaceBegin, slots[i])
 	}
@@ -570,32 +949,56 @@ func (codec LeafNodeCodec) appendAllSlotsAndElements(page []byte, slots []Slot,
 
 func (codec LeafNodeCodec) GetNextLeafNodePageId(page []byte) uint64 {
 
-	headerBytes := page[:codec.headerCodec.getHeaderSize()]
-
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 	return header.nextLeafNodePageId
 }
 
+// SetNextLeafNodePageId links the leaf node to the next leaf node in the leaf chain.
+func (codec LeafNodeCodec) SetNextLeafNodePageId(page []byte, nextLeafNodePageId uint64) {
+
+	codec.headerCodec.setNextLeafNodePageId(page[:codec.headerCodec.getHeaderSize()], nextLeafNodePageId)
+	codec.headerCodec.updateCRC(page)
+}
+
+// getSlotCorrespondingToIndex decodes the slot at a particular index in the slot region, including slots of deleted elements
+func (codec LeafNodeCodec) getSlotCorrespondingToIndex(page []byte, index int) Slot {
+
+	pointer := codec.headerCodec.getHeaderSize() + index*codec.slotCodec.getSlotSize()
+
+	return codec.slotCodec.decodeSlot(page[pointer : pointer+codec.slotCodec.getSlotSize()])
+}
+
 func (codec LeafNodeCodec) IsSlotDeleted(page []byte, index int) bool {
 
-	slots, _ := codec.getAllSlotsAndElements(page)
+	return codec.slotCodec.isElementDeleted(codec.getSlotCorrespondingToIndex(page, index))
+}
+
+// IsSlotExpired checks whether the element corresponding to the slot has expired at the given unix timestamp (in nanoseconds).
+// Only use if the slot is not deleted.
+func (codec LeafNodeCodec) IsSlotExpired(page []byte, index int, now uint64) bool {
+
+	slot := codec.getSlotCorrespondingToIndex(page, index)
 
-	return codec.slotCodec.isElementDeleted(slots[index])
+	return codec.isElementExpired(page[slot.elementPointer:slot.elementPointer+slot.elementSize], now)
 }
 
 func (codec LeafNodeCodec) GetNumSlots(page []byte) uint16 {
 
-	headerBytes := page[:codec.headerCodec.getHeaderSize()]
-
-	header := codec.headerCodec.decodePageHeader(headerBytes)
+	header := codec.headerCodec.decodePageHeader(page)
 	return header.numSlots
 }
 
-func (codec LeafNodeCodec) GetValueCorrespondingToSlot(page []byte, index uint16) []byte {
+// GetElementCorrespondingToSlot returns the element corresponding to the slot at a particular index. Only use if the slot is not deleted.
+func (codec LeafNodeCodec) GetElementCorrespondingToSlot(page []byte, index uint16) LeafNodeElement {
 
-	_, elements := codec.getAllSlotsAndElements(page)
+	slot := codec.getSlotCorrespondingToIndex(page, int(index))
+
+	return codec.decodeElement(page[slot.elementPointer:slot.elementPointer+slot.elementSize], codec.getPrefix(page))
+}
+
+func (codec LeafNodeCodec) GetValueCorrespondingToSlot(page []byte, index uint16) []byte {
 
-	return elements[index].Value
+	return codec.GetElementCorrespondingToSlot(page, index).Value
 }
 
 // func (codec LeafNodeCodec) Merge(underflowNode []byte, separatorKey []byte, separatorValue []byte, siblingNode []byte, isLeftSibling bool) {
@@ -639,7 +1042,7 @@ func (codec LeafNodeCodec) GetValueCorrespondingToSlot(page []byte, index uint16
 
 // 	headerBytes := underflowNode[:codec.headerCodec.getHeaderSize()]
 
-// 	header := codec.headerCodec.decodePageHeader(headerBytes)
+// 	header := codec.headerCodec.decodePageHeader(page)
 
 // 	separatorSlot.elementPointer = header.freeSpaceEnd - separatorSlot.elementSize
 
@@ -1,6 +1,9 @@
 package pagecodec
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 // add currBPlusTreeId
 type MetaData struct {
@@ -9,6 +12,29 @@ type MetaData struct {
 	MaxAllocatedPageId    uint64
 	DeallocatedPageIdList []uint64
 	FirstLeafNodePages    map[uint64]uint64
+	SecondaryIndexes      []SecondaryIndexMetaData
+
+	// name of the comparator each B+ tree was created with, B+ trees without an entry use the bytewise comparator
+	Comparators map[uint64]string
+
+	// algorithm used to compress values written to each B+ tree, B+ trees without an entry don't compress values
+	CompressionTypes map[uint64]uint8
+
+	// size of every page in the file, including the metadata page. It is chosen when the database is created.
+	PageSize uint32
+
+	// tablespace each B+ tree is stored in, B+ trees without an entry are stored in the primary database file
+	Tablespaces map[uint64]uint64
+
+	// path of the data file of every tablespace other than the primary database file
+	TablespaceFiles map[uint64]string
+}
+
+// SecondaryIndexMetaData records the B+ tree backing a named secondary index over a primary B+ tree.
+type SecondaryIndexMetaData struct {
+	Name               string
+	PrimaryBPlusTreeId uint64
+	IndexBPlusTreeId   uint64
 }
 
 type MetaDataCodec struct {
@@ -20,9 +46,28 @@ func DefaultMetaDataCodec() MetaDataCodec {
 
 // encodeMetaDataPage encodes the list of deallocated page IDs and max allocated page ID into a byte slice
 // so it can be written to disk. This ensures persistence of the free list across restarts.
+// The byte slice is the size of a page, DEFAULT_PAGE_SIZE if the metadata has no page size.
 func (codec MetaDataCodec) EncodeMetaDataPage(metadata *MetaData) []byte {
 
-	data := make([]byte, 4096)
+	pageSize := metadata.PageSize
+
+	if pageSize == 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+
+	return codec.EncodeMetaData(metadata, int(pageSize))
+}
+
+// EncodeMetaData encodes the metadata into a byte slice of the given size, which is the part of the metadata page following the superblock.
+func (codec MetaDataCodec) EncodeMetaData(metadata *MetaData, size int) []byte {
+
+	pageSize := metadata.PageSize
+
+	if pageSize == 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+
+	data := make([]byte, size)
 
 	pointer := 0
 
@@ -59,21 +104,123 @@ func (codec MetaDataCodec) EncodeMetaDataPage(metadata *MetaData) []byte {
 		pointer += 8
 	}
 
+	binary.LittleEndian.PutUint64(data[pointer:pointer+8], uint64(len(metadata.SecondaryIndexes)))
+	pointer += 8
+	for _, index := range metadata.SecondaryIndexes {
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], index.PrimaryBPlusTreeId)
+		pointer += 8
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], index.IndexBPlusTreeId)
+		pointer += 8
+		binary.LittleEndian.PutUint16(data[pointer:pointer+2], uint16(len(index.Name)))
+		pointer += 2
+		copy(data[pointer:pointer+len(index.Name)], index.Name)
+		pointer += len(index.Name)
+	}
+
+	binary.LittleEndian.PutUint64(data[pointer:pointer+8], uint64(len(metadata.Comparators)))
+	pointer += 8
+	for BPlusTreeId, comparatorName := range metadata.Comparators {
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], BPlusTreeId)
+		pointer += 8
+		binary.LittleEndian.PutUint16(data[pointer:pointer+2], uint16(len(comparatorName)))
+		pointer += 2
+		copy(data[pointer:pointer+len(comparatorName)], comparatorName)
+		pointer += len(comparatorName)
+	}
+
+	binary.LittleEndian.PutUint64(data[pointer:pointer+8], uint64(len(metadata.CompressionTypes)))
+	pointer += 8
+	for BPlusTreeId, compressionType := range metadata.CompressionTypes {
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], BPlusTreeId)
+		pointer += 8
+		data[pointer] = compressionType
+		pointer += 1
+	}
+
+	binary.LittleEndian.PutUint32(data[pointer:pointer+4], pageSize)
+	pointer += 4
+
+	binary.LittleEndian.PutUint64(data[pointer:pointer+8], uint64(len(metadata.Tablespaces)))
+	pointer += 8
+	for BPlusTreeId, tablespaceId := range metadata.Tablespaces {
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], BPlusTreeId)
+		pointer += 8
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], tablespaceId)
+		pointer += 8
+	}
+
+	binary.LittleEndian.PutUint64(data[pointer:pointer+8], uint64(len(metadata.TablespaceFiles)))
+	pointer += 8
+	for tablespaceId, filePath := range metadata.TablespaceFiles {
+		binary.LittleEndian.PutUint64(data[pointer:pointer+8], tablespaceId)
+		pointer += 8
+		binary.LittleEndian.PutUint16(data[pointer:pointer+2], uint16(len(filePath)))
+		pointer += 2
+		copy(data[pointer:pointer+len(filePath)], filePath)
+		pointer += len(filePath)
+	}
+
 	return data
 }
 
-// decodeMetaDataPage decodes the byte slice from disk into the in-memory
-// list of deallocated page IDs. This restores the free list after a database restart.
-func (codec MetaDataCodec) DecodeMetaDataPage(data []byte) *MetaData {
+// EncodedMetaDataSize returns the number of bytes EncodeMetaData needs to encode the metadata.
+func (codec MetaDataCodec) EncodedMetaDataSize(metadata *MetaData) int {
+
+	size := 8 + 8 + 16*len(metadata.RootPages)
+	size += 8 + 8 + 8*len(metadata.DeallocatedPageIdList)
+	size += 8 + 16*len(metadata.FirstLeafNodePages)
+
+	size += 8
+	for _, index := range metadata.SecondaryIndexes {
+		size += 18 + len(index.Name)
+	}
+
+	size += 8
+	for _, comparatorName := range metadata.Comparators {
+		size += 10 + len(comparatorName)
+	}
+
+	size += 8 + 9*len(metadata.CompressionTypes)
+
+	// page size
+	size += 4
+
+	size += 8 + 16*len(metadata.Tablespaces)
+
+	size += 8
+	for _, filePath := range metadata.TablespaceFiles {
+		size += 10 + len(filePath)
+	}
+
+	return size
+}
+
+// DecodeMetaDataPage decodes the byte slice from disk into the in-memory metadata. This restores the free list after a database restart.
+// Every length is checked against the rest of the page, so a corrupted metadata page returns an error.
+func (codec MetaDataCodec) DecodeMetaDataPage(data []byte) (*MetaData, error) {
 
 	pointer := 0
 
+	// fits reports whether count entries of at least entrySize bytes fit in the rest of the page.
+	fits := func(count uint64, entrySize int) bool {
+		return pointer <= len(data) && count <= uint64(len(data)-pointer)/uint64(entrySize)
+	}
+
+	if !fits(2, 8) {
+		return nil, fmt.Errorf("metadata page is too small, got %d bytes", len(data))
+	}
+
 	currBPlusTreeId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
 	pointer += 8
 
 	BPlusTreeRootPagesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
 	pointer += 8
 
+	// the root pages are followed by the max allocated page ID and the length of the free list.
+	if !fits(BPlusTreeRootPagesLength, 16) || !fits(BPlusTreeRootPagesLength*16+16, 1) {
+		return nil, fmt.Errorf("metadata page records %d root pages, more than fit in the page", BPlusTreeRootPagesLength)
+	}
+
 	BPlusTreeRootPages := make(map[uint64]uint64, 0)
 
 	for range int(BPlusTreeRootPagesLength) {
@@ -91,6 +238,11 @@ func (codec MetaDataCodec) DecodeMetaDataPage(data []byte) *MetaData {
 	deallocatedPageListSize := binary.LittleEndian.Uint64(data[pointer : pointer+8])
 	pointer += 8
 
+	// the free list is followed by the length of the first leaf node pages.
+	if !fits(deallocatedPageListSize, 8) || !fits(deallocatedPageListSize*8+8, 1) {
+		return nil, fmt.Errorf("metadata page records %d deallocated pages, more than fit in the page", deallocatedPageListSize)
+	}
+
 	deallocatedPageIdList := make([]uint64, deallocatedPageListSize)
 
 	for i := range int(deallocatedPageListSize) {
@@ -103,6 +255,11 @@ func (codec MetaDataCodec) DecodeMetaDataPage(data []byte) *MetaData {
 	FirstLeafNodePagesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
 	pointer += 8
 
+	// the first leaf node pages are followed by the length of the secondary indexes.
+	if !fits(FirstLeafNodePagesLength, 16) || !fits(FirstLeafNodePagesLength*16+8, 1) {
+		return nil, fmt.Errorf("metadata page records %d first leaf node pages, more than fit in the page", FirstLeafNodePagesLength)
+	}
+
 	for range int(FirstLeafNodePagesLength) {
 		BPlusTreeId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
 		pointer += 8
@@ -111,11 +268,167 @@ func (codec MetaDataCodec) DecodeMetaDataPage(data []byte) *MetaData {
 
 		FirstLeafNodePages[BPlusTreeId] = rootPage
 	}
+
+	SecondaryIndexesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+	pointer += 8
+
+	if !fits(SecondaryIndexesLength, 18) {
+		return nil, fmt.Errorf("metadata page records %d secondary indexes, more than fit in the page", SecondaryIndexesLength)
+	}
+
+	SecondaryIndexes := make([]SecondaryIndexMetaData, 0)
+
+	for range SecondaryIndexesLength {
+
+		if !fits(1, 18) {
+			return nil, fmt.Errorf("secondary index list runs past the end of the metadata page")
+		}
+
+		index := SecondaryIndexMetaData{}
+
+		index.PrimaryBPlusTreeId = binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+		index.IndexBPlusTreeId = binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+		nameLength := int(binary.LittleEndian.Uint16(data[pointer : pointer+2]))
+		pointer += 2
+
+		if !fits(uint64(nameLength), 1) {
+			return nil, fmt.Errorf("secondary index name runs past the end of the metadata page")
+		}
+
+		index.Name = string(data[pointer : pointer+nameLength])
+		pointer += nameLength
+
+		SecondaryIndexes = append(SecondaryIndexes, index)
+	}
+
+	// the lists below were added to the metadata page later, metadata pages written before them end with zeroes, or end earlier.
+	Comparators := make(map[uint64]string)
+
+	if fits(1, 8) {
+
+		ComparatorsLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+
+		if !fits(ComparatorsLength, 10) {
+			return nil, fmt.Errorf("metadata page records %d comparators, more than fit in the page", ComparatorsLength)
+		}
+
+		for range ComparatorsLength {
+
+			if !fits(1, 10) {
+				return nil, fmt.Errorf("comparator list runs past the end of the metadata page")
+			}
+
+			BPlusTreeId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+			pointer += 8
+			nameLength := int(binary.LittleEndian.Uint16(data[pointer : pointer+2]))
+			pointer += 2
+
+			if !fits(uint64(nameLength), 1) {
+				return nil, fmt.Errorf("comparator name runs past the end of the metadata page")
+			}
+
+			Comparators[BPlusTreeId] = string(data[pointer : pointer+nameLength])
+			pointer += nameLength
+		}
+	}
+
+	CompressionTypes := make(map[uint64]uint8)
+
+	if fits(1, 8) {
+
+		CompressionTypesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+
+		if !fits(CompressionTypesLength, 9) {
+			return nil, fmt.Errorf("metadata page records %d compression types, more than fit in the page", CompressionTypesLength)
+		}
+
+		for range CompressionTypesLength {
+
+			BPlusTreeId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+			pointer += 8
+			CompressionTypes[BPlusTreeId] = data[pointer]
+			pointer += 1
+		}
+	}
+
+	// metadata pages written before the page size was recorded have zeroes here, and use the default page size.
+	PageSize := uint32(0)
+
+	if fits(1, 4) {
+		PageSize = binary.LittleEndian.Uint32(data[pointer : pointer+4])
+		pointer += 4
+	}
+
+	if PageSize == 0 {
+		PageSize = DEFAULT_PAGE_SIZE
+	}
+
+	Tablespaces := make(map[uint64]uint64)
+
+	if fits(1, 8) {
+
+		TablespacesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+
+		if !fits(TablespacesLength, 16) {
+			return nil, fmt.Errorf("metadata page records %d tablespaces, more than fit in the page", TablespacesLength)
+		}
+
+		for range TablespacesLength {
+
+			BPlusTreeId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+			pointer += 8
+			Tablespaces[BPlusTreeId] = binary.LittleEndian.Uint64(data[pointer : pointer+8])
+			pointer += 8
+		}
+	}
+
+	TablespaceFiles := make(map[uint64]string)
+
+	if fits(1, 8) {
+
+		TablespaceFilesLength := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+		pointer += 8
+
+		if !fits(TablespaceFilesLength, 10) {
+			return nil, fmt.Errorf("metadata page records %d tablespace files, more than fit in the page", TablespaceFilesLength)
+		}
+
+		for range TablespaceFilesLength {
+
+			if !fits(1, 10) {
+				return nil, fmt.Errorf("tablespace file list runs past the end of the metadata page")
+			}
+
+			tablespaceId := binary.LittleEndian.Uint64(data[pointer : pointer+8])
+			pointer += 8
+			pathLength := int(binary.LittleEndian.Uint16(data[pointer : pointer+2]))
+			pointer += 2
+
+			if !fits(uint64(pathLength), 1) {
+				return nil, fmt.Errorf("tablespace file path runs past the end of the metadata page")
+			}
+
+			TablespaceFiles[tablespaceId] = string(data[pointer : pointer+pathLength])
+			pointer += pathLength
+		}
+	}
+
 	return &MetaData{
 		CurrBPlusTreeId:       currBPlusTreeId,
 		RootPages:             BPlusTreeRootPages,
 		MaxAllocatedPageId:    maxAllocatedPageId,
 		DeallocatedPageIdList: deallocatedPageIdList,
 		FirstLeafNodePages:    FirstLeafNodePages,
-	}
+		SecondaryIndexes:      SecondaryIndexes,
+		Comparators:           Comparators,
+		CompressionTypes:      CompressionTypes,
+		PageSize:              PageSize,
+		Tablespaces:           Tablespaces,
+		TablespaceFiles:       TablespaceFiles,
+	}, nil
 }
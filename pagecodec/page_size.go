@@ -0,0 +1,34 @@
+package pagecodec
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// page size of databases created without choosing one, and of databases created before the page size was recorded in the metadata page.
+	DEFAULT_PAGE_SIZE = 4096
+
+	MIN_PAGE_SIZE = 4096
+	MAX_PAGE_SIZE = 65536
+
+	// slot pointers and the free space pointers in the header are 16 bit offsets, so the slotted region of a page ends at offset 65535.
+	// The last byte of a 64 KB page is never used.
+	MAX_SLOTTED_PAGE_SIZE = math.MaxUint16
+)
+
+// ValidatePageSize checks that a page size is a power of two between MIN_PAGE_SIZE and MAX_PAGE_SIZE.
+func ValidatePageSize(pageSize int) error {
+
+	if pageSize < MIN_PAGE_SIZE || pageSize > MAX_PAGE_SIZE || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("page size must be a power of two between %d and %d, got %d", MIN_PAGE_SIZE, MAX_PAGE_SIZE, pageSize)
+	}
+
+	return nil
+}
+
+// slottedPageSize returns the size of the region of a page used by the slotted page layout.
+func slottedPageSize(page []byte) int {
+
+	return min(len(page), MAX_SLOTTED_PAGE_SIZE)
+}
@@ -0,0 +1,174 @@
+package pagecodec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// version of the on-disk format written by this version of DragonDB.
+	// Version 0 files have no superblock, the metadata page starts at the beginning of the file.
+	// Version 1 files start with a superblock.
+	// Version 2 files store an expiry timestamp and a compression type after the value of every leaf node element.
+	CURRENT_FORMAT_VERSION = 2
+
+	// the superblock is stored at the start of the metadata page, the metadata is encoded after it.
+	SUPERBLOCK_SIZE = 64
+
+	// algorithm used to compute the checksum stored in the header of every page, and in the superblock.
+	CHECKSUM_ALGORITHM_CRC32_IEEE uint8 = 1
+)
+
+// identifies DragonDB database files.
+var SUPERBLOCK_MAGIC = [8]byte{'D', 'R', 'A', 'G', 'O', 'N', 'D', 'B'}
+
+// Superblock describes the layout of a database file. It is never encrypted, so the file can be validated before any key is used.
+type Superblock struct {
+	FormatVersion     uint32
+	PageSize          uint32
+	ChecksumAlgorithm uint8
+
+	// the metadata following the superblock, and every other page, is encrypted.
+	Encrypted bool
+
+	CreationTime time.Time
+
+	// random version 4 UUID, generated when the database is created.
+	DatabaseId [16]byte
+}
+
+type SuperblockConfig struct {
+
+	// superblock field offsets
+	magicOffset             int
+	formatVersionOffset     int
+	pageSizeOffset          int
+	checksumAlgorithmOffset int
+	encryptedOffset         int
+	creationTimeOffset      int
+	databaseIdOffset        int
+
+	// checksum of the preceding bytes of the superblock
+	checksumOffset int
+}
+
+type SuperblockCodec struct {
+	config SuperblockConfig
+}
+
+func DefaultSuperblockCodec() SuperblockCodec {
+
+	return SuperblockCodec{
+		config: SuperblockConfig{
+			magicOffset:             0,
+			formatVersionOffset:     8,
+			pageSizeOffset:          12,
+			checksumAlgorithmOffset: 16,
+			encryptedOffset:         17,
+			creationTimeOffset:      24,
+			databaseIdOffset:        32,
+			checksumOffset:          60,
+		},
+	}
+}
+
+// NewSuperblock returns the superblock of a database created now, with the given page size.
+func NewSuperblock(pageSize int) (Superblock, error) {
+
+	superblock := Superblock{
+		FormatVersion:     CURRENT_FORMAT_VERSION,
+		PageSize:          uint32(pageSize),
+		ChecksumAlgorithm: CHECKSUM_ALGORITHM_CRC32_IEEE,
+		CreationTime:      time.Now(),
+	}
+
+	if _, err := rand.Read(superblock.DatabaseId[:]); err != nil {
+		return Superblock{}, err
+	}
+
+	// version 4, variant 1
+	superblock.DatabaseId[6] = (superblock.DatabaseId[6] & 0x0f) | 0x40
+	superblock.DatabaseId[8] = (superblock.DatabaseId[8] & 0x3f) | 0x80
+
+	return superblock, nil
+}
+
+// DatabaseIdString formats the database ID as a UUID.
+func (superblock Superblock) DatabaseIdString() string {
+
+	id := superblock.DatabaseId
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// HasSuperblock returns true if the data starts with the superblock magic. Files without it were written before the superblock was added.
+func (codec SuperblockCodec) HasSuperblock(data []byte) bool {
+
+	offset := codec.config.magicOffset
+
+	return len(data) >= SUPERBLOCK_SIZE && bytes.Equal(data[offset:offset+len(SUPERBLOCK_MAGIC)], SUPERBLOCK_MAGIC[:])
+}
+
+// EncodeSuperblock encodes the superblock into SUPERBLOCK_SIZE bytes, followed by a checksum of the encoded fields.
+func (codec SuperblockCodec) EncodeSuperblock(superblock Superblock) []byte {
+
+	data := make([]byte, SUPERBLOCK_SIZE)
+
+	copy(data[codec.config.magicOffset:], SUPERBLOCK_MAGIC[:])
+	binary.LittleEndian.PutUint32(data[codec.config.formatVersionOffset:], superblock.FormatVersion)
+	binary.LittleEndian.PutUint32(data[codec.config.pageSizeOffset:], superblock.PageSize)
+	data[codec.config.checksumAlgorithmOffset] = superblock.ChecksumAlgorithm
+
+	if superblock.Encrypted {
+		data[codec.config.encryptedOffset] = 1
+	}
+
+	binary.LittleEndian.PutUint64(data[codec.config.creationTimeOffset:], uint64(superblock.CreationTime.UnixNano()))
+	copy(data[codec.config.databaseIdOffset:], superblock.DatabaseId[:])
+
+	binary.LittleEndian.PutUint32(data[codec.config.checksumOffset:], crc32.ChecksumIEEE(data[:codec.config.checksumOffset]))
+
+	return data
+}
+
+// DecodeSuperblock decodes and validates the superblock at the start of the data.
+// It fails if the data isn't a DragonDB file, the superblock is corrupted, or the file uses a format or algorithm this version doesn't support.
+func (codec SuperblockCodec) DecodeSuperblock(data []byte) (Superblock, error) {
+
+	if !codec.HasSuperblock(data) {
+		return Superblock{}, fmt.Errorf("not a DragonDB database file")
+	}
+
+	checksum := binary.LittleEndian.Uint32(data[codec.config.checksumOffset:])
+
+	if checksum != crc32.ChecksumIEEE(data[:codec.config.checksumOffset]) {
+		return Superblock{}, fmt.Errorf("superblock checksum mismatch")
+	}
+
+	superblock := Superblock{
+		FormatVersion:     binary.LittleEndian.Uint32(data[codec.config.formatVersionOffset:]),
+		PageSize:          binary.LittleEndian.Uint32(data[codec.config.pageSizeOffset:]),
+		ChecksumAlgorithm: data[codec.config.checksumAlgorithmOffset],
+		Encrypted:         data[codec.config.encryptedOffset] == 1,
+		CreationTime:      time.Unix(0, int64(binary.LittleEndian.Uint64(data[codec.config.creationTimeOffset:]))),
+	}
+
+	copy(superblock.DatabaseId[:], data[codec.config.databaseIdOffset:codec.config.databaseIdOffset+len(superblock.DatabaseId)])
+
+	if superblock.FormatVersion > CURRENT_FORMAT_VERSION {
+		return Superblock{}, fmt.Errorf("database file format version %d is newer than the supported version %d", superblock.FormatVersion, CURRENT_FORMAT_VERSION)
+	}
+
+	if err := ValidatePageSize(int(superblock.PageSize)); err != nil {
+		return Superblock{}, fmt.Errorf("invalid superblock: %w", err)
+	}
+
+	if superblock.ChecksumAlgorithm != CHECKSUM_ALGORITHM_CRC32_IEEE {
+		return Superblock{}, fmt.Errorf("unsupported checksum algorithm %d", superblock.ChecksumAlgorithm)
+	}
+
+	return superblock, nil
+}
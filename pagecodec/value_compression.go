@@ -0,0 +1,90 @@
+package pagecodec
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// CompressionType identifies the algorithm used to compress the value of a leaf node element.
+// It is stored in every element, so compressed and uncompressed values can coexist in the same page.
+type CompressionType uint8
+
+const (
+	CompressionNone  CompressionType = 0
+	CompressionFlate CompressionType = 1
+)
+
+func (compression CompressionType) String() string {
+
+	switch compression {
+
+	case CompressionNone:
+		return "none"
+
+	case CompressionFlate:
+		return "flate"
+
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(compression))
+	}
+}
+
+// CompressValue compresses the value using the given algorithm. If compression doesn't make the value smaller,
+// the value is returned as is, along with CompressionNone.
+func CompressValue(value []byte, compression CompressionType) (storedValue []byte, usedCompression CompressionType, err error) {
+
+	switch compression {
+
+	case CompressionNone:
+		return value, CompressionNone, nil
+
+	case CompressionFlate:
+
+		buffer := &bytes.Buffer{}
+
+		writer, err := flate.NewWriter(buffer, flate.DefaultCompression)
+
+		if err != nil {
+			return nil, CompressionNone, err
+		}
+
+		if _, err := writer.Write(value); err != nil {
+			return nil, CompressionNone, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, CompressionNone, err
+		}
+
+		if buffer.Len() >= len(value) {
+			return value, CompressionNone, nil
+		}
+
+		return buffer.Bytes(), CompressionFlate, nil
+
+	default:
+		return nil, CompressionNone, fmt.Errorf("unknown compression type %d", compression)
+	}
+}
+
+// DecompressValue restores a value stored in a leaf node element using the given algorithm.
+func DecompressValue(storedValue []byte, compression CompressionType) ([]byte, error) {
+
+	switch compression {
+
+	case CompressionNone:
+		return storedValue, nil
+
+	case CompressionFlate:
+
+		reader := flate.NewReader(bytes.NewReader(storedValue))
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", compression)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"slices"
+	"time"
 )
 
 var (
@@ -80,7 +81,9 @@ func readRequest(conn net.Conn) (*Request, error) {
 	return request, nil
 }
 
-func decodeInsertRequestBody(body []byte) (key []byte, value []byte) {
+// decodeInsertRequestBody extracts the key value pair from the request body.
+// The body may optionally end with an 8 byte TTL field (in milliseconds), a TTL of 0 means the key never expires.
+func decodeInsertRequestBody(body []byte) (key []byte, value []byte, ttl time.Duration) {
 
 	pointer := 0
 	keyLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
@@ -100,7 +103,16 @@ func decodeInsertRequestBody(body []byte) (key []byte, value []byte) {
 
 	copy(value, body[pointer:pointer+int(valueLength)])
 
-	return key, value
+	pointer += int(valueLength)
+
+	// TTL field is absent
+	if len(body) < pointer+8 {
+		return key, value, 0
+	}
+
+	ttl = time.Duration(binary.LittleEndian.Uint64(body[pointer:pointer+8])) * time.Millisecond
+
+	return key, value, ttl
 
 }
 
@@ -132,3 +144,96 @@ func decodeDeleteRequestBody(body []byte) (key []byte) {
 	return key
 
 }
+
+func decodeExistsRequestBody(body []byte) (key []byte) {
+
+	pointer := 0
+	keyLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+
+	pointer += 4
+
+	key = make([]byte, keyLength)
+
+	copy(key, body[pointer:pointer+int(keyLength)])
+
+	return key
+}
+
+// decodeCountRequestBody extracts the start and end key of the range from the request body.
+// An end key of length 0 represents an unbounded range.
+func decodeCountRequestBody(body []byte) (startKey []byte, endKey []byte) {
+
+	pointer := 0
+	startKeyLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+
+	pointer += 4
+
+	startKey = make([]byte, startKeyLength)
+
+	copy(startKey, body[pointer:pointer+int(startKeyLength)])
+
+	pointer += int(startKeyLength)
+
+	endKeyLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+	pointer += 4
+
+	if endKeyLength == 0 {
+		return startKey, nil
+	}
+
+	endKey = make([]byte, endKeyLength)
+
+	copy(endKey, body[pointer:pointer+int(endKeyLength)])
+
+	return startKey, endKey
+}
+
+// decodeIndexLookupRequestBody extracts the index name and secondary key from the request body.
+func decodeIndexLookupRequestBody(body []byte) (indexName string, secondaryKey []byte) {
+
+	pointer := 0
+	indexNameLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+
+	pointer += 4
+
+	indexName = string(body[pointer : pointer+int(indexNameLength)])
+
+	pointer += int(indexNameLength)
+
+	secondaryKeyLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+	pointer += 4
+
+	secondaryKey = make([]byte, secondaryKeyLength)
+
+	copy(secondaryKey, body[pointer:pointer+int(secondaryKeyLength)])
+
+	return indexName, secondaryKey
+}
+
+// decodeIndexRangeScanRequestBody extracts the index name, and the start and end secondary key of the range from the request body.
+// An end secondary key of length 0 represents an unbounded range.
+func decodeIndexRangeScanRequestBody(body []byte) (indexName string, startSecondaryKey []byte, endSecondaryKey []byte) {
+
+	pointer := 0
+	indexNameLength := binary.LittleEndian.Uint32(body[pointer : pointer+4])
+
+	pointer += 4
+
+	indexName = string(body[pointer : pointer+int(indexNameLength)])
+
+	pointer += int(indexNameLength)
+
+	startSecondaryKey, endSecondaryKey = decodeCountRequestBody(body[pointer:])
+
+	return indexName, startSecondaryKey, endSecondaryKey
+}
+
+// decodeResizeBufferPoolRequestBody extracts the new number of frames in the buffer pool from the request body.
+func decodeResizeBufferPoolRequestBody(body []byte) (poolSize int, err error) {
+
+	if len(body) != 4 {
+		return 0, fmt.Errorf("invalid resize buffer pool request body")
+	}
+
+	return int(binary.LittleEndian.Uint32(body)), nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -40,12 +41,29 @@ func (ts *RequestDecoderTestSuite) TestDecodeInsertRequest() {
 
 	request := createInsertRequestBody([]byte("hello"), []byte("world"))
 
-	key, value := decodeInsertRequestBody(request)
+	key, value, ttl := decodeInsertRequestBody(request)
 
 	ts.Suite.Assert().Equal([]byte("hello"), key)
 
 	ts.Suite.Assert().Equal([]byte("world"), value)
 
+	ts.Suite.Assert().Equal(time.Duration(0), ttl)
+
+}
+
+func (ts *RequestDecoderTestSuite) TestDecodeInsertRequestWithTTL() {
+
+	request := createInsertRequestBody([]byte("hello"), []byte("world"))
+
+	request = binary.LittleEndian.AppendUint64(request, 1500)
+
+	key, value, ttl := decodeInsertRequestBody(request)
+
+	ts.Suite.Assert().Equal([]byte("hello"), key)
+
+	ts.Suite.Assert().Equal([]byte("world"), value)
+
+	ts.Suite.Assert().Equal(1500*time.Millisecond, ttl)
 }
 
 func createDeleteRequestBody(key []byte) []byte {
@@ -72,6 +90,79 @@ func (ts *RequestDecoderTestSuite) TestDecodeDeleteRequest() {
 	ts.Suite.Assert().Equal([]byte("hello"), key)
 }
 
+func createCountRequestBody(startKey []byte, endKey []byte) []byte {
+
+	request := make([]byte, 4+len(startKey)+4+len(endKey))
+
+	pointer := 0
+
+	binary.LittleEndian.PutUint32(request[pointer:pointer+4], uint32(len(startKey)))
+
+	pointer += 4
+
+	copy(request[pointer:pointer+len(startKey)], startKey)
+
+	pointer += len(startKey)
+
+	binary.LittleEndian.PutUint32(request[pointer:pointer+4], uint32(len(endKey)))
+
+	pointer += 4
+
+	copy(request[pointer:pointer+len(endKey)], endKey)
+
+	return request
+}
+
+func (ts *RequestDecoderTestSuite) TestDecodeCountRequest() {
+
+	request := createCountRequestBody([]byte("hello"), []byte("world"))
+
+	startKey, endKey := decodeCountRequestBody(request)
+
+	ts.Suite.Assert().Equal([]byte("hello"), startKey)
+	ts.Suite.Assert().Equal([]byte("world"), endKey)
+
+	// empty end key represents an unbounded range
+	request = createCountRequestBody([]byte("hello"), []byte{})
+
+	startKey, endKey = decodeCountRequestBody(request)
+
+	ts.Suite.Assert().Equal([]byte("hello"), startKey)
+	ts.Suite.Assert().Nil(endKey)
+}
+
+func (ts *RequestDecoderTestSuite) TestDecodeIndexRangeScanRequest() {
+
+	indexName := "city"
+
+	request := make([]byte, 4+len(indexName))
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(indexName)))
+	copy(request[4:], indexName)
+
+	request = append(request, createCountRequestBody([]byte("berlin"), []byte("paris"))...)
+
+	name, startSecondaryKey, endSecondaryKey := decodeIndexRangeScanRequestBody(request)
+
+	ts.Suite.Assert().Equal(indexName, name)
+	ts.Suite.Assert().Equal([]byte("berlin"), startSecondaryKey)
+	ts.Suite.Assert().Equal([]byte("paris"), endSecondaryKey)
+}
+
+func (ts *RequestDecoderTestSuite) TestDecodeResizeBufferPoolRequest() {
+
+	request := make([]byte, 4)
+	binary.LittleEndian.PutUint32(request, 64)
+
+	poolSize, err := decodeResizeBufferPoolRequestBody(request)
+
+	ts.Suite.Require().NoError(err)
+	ts.Suite.Assert().Equal(64, poolSize)
+
+	_, err = decodeResizeBufferPoolRequestBody(request[:2])
+
+	ts.Suite.Assert().Error(err)
+}
+
 func TestRequestDecoder(t *testing.T) {
 
 	suite.Run(t, new(RequestDecoderTestSuite))
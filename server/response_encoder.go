@@ -1,6 +1,10 @@
 package server
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+
+	storageengine "github.com/Adarsh-Kmt/DragonDB/storageengine"
+)
 
 func encodeGetResponse(key []byte, value []byte) []byte {
 
@@ -87,3 +91,77 @@ func encodeInsertResponse() []byte {
 
 	return response
 }
+
+func encodeExistsResponse(exists bool) []byte {
+
+	responseBodyLength := 1
+
+	response := make([]byte, 1+4+responseBodyLength)
+
+	pointer := 0
+	response[pointer] = byte('O')
+	pointer += 1
+
+	binary.LittleEndian.PutUint32(response[pointer:pointer+4], uint32(responseBodyLength))
+	pointer += 4
+
+	if exists {
+		response[pointer] = byte(1)
+	}
+
+	return response
+}
+
+func encodeCountResponse(count uint64) []byte {
+
+	responseBodyLength := 8
+
+	response := make([]byte, 1+4+responseBodyLength)
+
+	pointer := 0
+	response[pointer] = byte('O')
+	pointer += 1
+
+	binary.LittleEndian.PutUint32(response[pointer:pointer+4], uint32(responseBodyLength))
+	pointer += 4
+
+	binary.LittleEndian.PutUint64(response[pointer:pointer+8], count)
+
+	return response
+}
+
+// encodeIndexEntriesResponse encodes the number of entries, followed by the secondary key, primary key and value of each entry.
+func encodeIndexEntriesResponse(entries []storageengine.IndexEntry) []byte {
+
+	responseBodyLength := 4
+
+	for _, entry := range entries {
+		responseBodyLength += 4 + len(entry.SecondaryKey) + 4 + len(entry.PrimaryKey) + 4 + len(entry.Value)
+	}
+
+	response := make([]byte, 1+4+responseBodyLength)
+
+	pointer := 0
+	response[pointer] = byte('O')
+	pointer += 1
+
+	binary.LittleEndian.PutUint32(response[pointer:pointer+4], uint32(responseBodyLength))
+	pointer += 4
+
+	binary.LittleEndian.PutUint32(response[pointer:pointer+4], uint32(len(entries)))
+	pointer += 4
+
+	for _, entry := range entries {
+
+		for _, field := range [][]byte{entry.SecondaryKey, entry.PrimaryKey, entry.Value} {
+
+			binary.LittleEndian.PutUint32(response[pointer:pointer+4], uint32(len(field)))
+			pointer += 4
+
+			copy(response[pointer:], field)
+			pointer += len(field)
+		}
+	}
+
+	return response
+}
@@ -9,14 +9,25 @@ import (
 	"time"
 
 	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+	storageengine "github.com/Adarsh-Kmt/DragonDB/storageengine"
 )
 
+// DEFAULT_MAX_BUFFER_POOL_SIZE is the largest number of frames a resize request can ask for, unless the server is configured otherwise.
+// It is 256 MiB of frames with the default page size.
+const DEFAULT_MAX_BUFFER_POOL_SIZE = 65536
+
 type Server struct {
 	addr     string
 	listener net.Listener
 
 	bPlusTree *bplustree.BPlusTree
 
+	// set when the server is backed by a storage engine, writes then go through the engine so secondary indexes stay up to date.
+	engine *storageengine.StorageEngine
+
+	// largest number of frames a resize request can ask for, since every frame allocates a page of memory.
+	maxBufferPoolSize int
+
 	shutdown     chan struct{}
 	shutdownOnce *sync.Once
 }
@@ -29,14 +40,40 @@ func NewServer(addr string, bPlusTree *bplustree.BPlusTree) (*Server, error) {
 		return nil, err
 	}
 	return &Server{
-		bPlusTree:    bPlusTree,
-		listener:     listener,
-		addr:         addr,
-		shutdown:     make(chan struct{}),
-		shutdownOnce: &sync.Once{},
+		bPlusTree:         bPlusTree,
+		listener:          listener,
+		addr:              addr,
+		maxBufferPoolSize: DEFAULT_MAX_BUFFER_POOL_SIZE,
+		shutdown:          make(chan struct{}),
+		shutdownOnce:      &sync.Once{},
 	}, nil
 }
 
+// SetMaxBufferPoolSize sets the largest number of frames a resize request can ask for. It must be called before Run.
+func (server *Server) SetMaxBufferPoolSize(poolSize int) {
+	server.maxBufferPoolSize = poolSize
+}
+
+// NewStorageEngineServer creates a server that serves the B+ tree with the given ID, along with the secondary indexes over it.
+func NewStorageEngineServer(addr string, engine *storageengine.StorageEngine, BPlusTreeId uint64) (*Server, error) {
+
+	bPlusTree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	server, err := NewServer(addr, bPlusTree)
+
+	if err != nil {
+		return nil, err
+	}
+
+	server.engine = engine
+
+	return server, nil
+}
+
 func handleShutdown(conn net.Conn) {
 
 	message := encodeShutdownMessage()
@@ -95,8 +132,8 @@ func (server *Server) handleRequest(conn net.Conn) {
 	// handle INSERT request
 	case "I":
 
-		// extract key value pair from request body
-		key, value := decodeInsertRequestBody(request.body)
+		// extract key value pair, and optional TTL from request body
+		key, value, ttl := decodeInsertRequestBody(request.body)
 
 		// handle error
 		if err != nil {
@@ -104,8 +141,8 @@ func (server *Server) handleRequest(conn net.Conn) {
 			return
 		}
 
-		// call insert function
-		err = server.bPlusTree.Insert(key, value)
+		// call insert function, keys inserted with a TTL expire once it elapses
+		err = server.insert(key, value, ttl)
 
 		// handle error
 		if err != nil {
@@ -135,7 +172,7 @@ func (server *Server) handleRequest(conn net.Conn) {
 		}
 
 		// call delete function
-		err = server.bPlusTree.Delete(key)
+		err = server.delete(key)
 
 		// handle error
 		if err != nil {
@@ -188,6 +225,156 @@ func (server *Server) handleRequest(conn net.Conn) {
 			slog.Error(err.Error(), "msg", "error while writing to conn")
 		}
 
+	// handle EXISTS request
+	case "X":
+
+		// extract key from request body
+		key := decodeExistsRequestBody(request.body)
+
+		// call exists function
+		exists, err := server.bPlusTree.Exists(key)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error occured in data structure layer")
+			return
+
+		}
+
+		// create success response
+		response := encodeExistsResponse(exists)
+
+		// send response
+		if _, err = conn.Write(response); err != nil {
+			slog.Error(err.Error(), "msg", "error while writing to conn")
+		}
+
+	// handle COUNT request
+	case "N":
+
+		// extract key range from request body
+		startKey, endKey := decodeCountRequestBody(request.body)
+
+		// call count function
+		count, err := server.bPlusTree.Count(startKey, endKey)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error occured in data structure layer")
+			return
+
+		}
+
+		// create success response
+		response := encodeCountResponse(count)
+
+		// send response
+		if _, err = conn.Write(response); err != nil {
+			slog.Error(err.Error(), "msg", "error while writing to conn")
+		}
+
+	// handle INDEX LOOKUP request
+	case "L":
+
+		// extract index name and secondary key from request body
+		indexName, secondaryKey := decodeIndexLookupRequestBody(request.body)
+
+		index, err := server.getSecondaryIndex(indexName)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error while finding secondary index")
+			return
+		}
+
+		// call lookup function
+		entries, err := index.Lookup(secondaryKey)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error occured in data structure layer")
+			return
+
+		}
+
+		// create success response
+		response := encodeIndexEntriesResponse(entries)
+
+		// send response
+		if _, err = conn.Write(response); err != nil {
+			slog.Error(err.Error(), "msg", "error while writing to conn")
+		}
+
+	// handle INDEX RANGE SCAN request
+	case "Q":
+
+		// extract index name and secondary key range from request body
+		indexName, startSecondaryKey, endSecondaryKey := decodeIndexRangeScanRequestBody(request.body)
+
+		index, err := server.getSecondaryIndex(indexName)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error while finding secondary index")
+			return
+		}
+
+		// call range scan function
+		entries, err := index.RangeScan(startSecondaryKey, endSecondaryKey)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error occured in data structure layer")
+			return
+
+		}
+
+		// create success response
+		response := encodeIndexEntriesResponse(entries)
+
+		// send response
+		if _, err = conn.Write(response); err != nil {
+			slog.Error(err.Error(), "msg", "error while writing to conn")
+		}
+
+	// handle RESIZE BUFFER POOL admin request
+	case "R":
+
+		// extract new pool size from request body
+		poolSize, err := decodeResizeBufferPoolRequestBody(request.body)
+
+		// handle error
+		if err != nil {
+			sendErrorResponse(conn, err, "error while decoding request")
+			return
+		}
+
+		// the buffer pool is only reachable through the storage engine
+		if server.engine == nil {
+			sendErrorResponse(conn, fmt.Errorf("server is not backed by a storage engine"), "cannot resize buffer pool")
+			return
+		}
+
+		// a client can't make the server allocate more memory than it is configured to.
+		if poolSize > server.maxBufferPoolSize {
+			sendErrorResponse(conn, fmt.Errorf("buffer pool size %d exceeds the maximum of %d frames", poolSize, server.maxBufferPoolSize), "cannot resize buffer pool")
+			return
+		}
+
+		// resize buffer pool
+		if err := server.engine.ResizeBufferPool(poolSize); err != nil {
+			sendErrorResponse(conn, err, "error while resizing buffer pool")
+			return
+		}
+
+		// create OK response
+		response := encodeOKResponse()
+
+		// send response
+		if _, err := conn.Write(response); err != nil {
+			slog.Error(err.Error(), "msg", "error while writing to conn")
+		}
+
 	// handle CLOSE request
 	case "C":
 
@@ -221,6 +408,44 @@ func (server *Server) handleRequest(conn net.Conn) {
 	}
 
 }
+
+// insert writes through the storage engine if the server has one, so secondary indexes are updated along with the B+ tree.
+func (server *Server) insert(key []byte, value []byte, ttl time.Duration) error {
+
+	if server.engine != nil {
+		return server.engine.InsertWithTTL(server.bPlusTree.BPlusTreeId, key, value, ttl)
+	}
+
+	if ttl > 0 {
+		return server.bPlusTree.InsertWithTTL(key, value, ttl)
+	}
+	return server.bPlusTree.Insert(key, value)
+}
+
+// delete writes through the storage engine if the server has one, so secondary indexes are updated along with the B+ tree.
+func (server *Server) delete(key []byte) error {
+
+	if server.engine != nil {
+		return server.engine.Delete(server.bPlusTree.BPlusTreeId, key)
+	}
+	return server.bPlusTree.Delete(key)
+}
+
+func (server *Server) getSecondaryIndex(name string) (*storageengine.SecondaryIndex, error) {
+
+	if server.engine == nil {
+		return nil, fmt.Errorf("secondary indexes require a storage engine")
+	}
+
+	index, exists := server.engine.GetSecondaryIndex(server.bPlusTree.BPlusTreeId, name)
+
+	if !exists {
+		return nil, fmt.Errorf("secondary index doesnt exist")
+	}
+
+	return index, nil
+}
+
 func (server *Server) handleClient(conn net.Conn, wg *sync.WaitGroup) {
 
 	defer wg.Done()
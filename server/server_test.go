@@ -6,11 +6,11 @@ import (
 	"log"
 	"log/slog"
 	"net"
-	"os"
 	"testing"
 
 	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
 	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+	"github.com/Adarsh-Kmt/DragonDB/storageengine"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -22,17 +22,16 @@ type DatabaseServerTestSuite struct {
 
 func (test *DatabaseServerTestSuite) SetupTest() {
 
-	testFile := "dragon.db"
-
-	disk, actualMetadata, _, err := bpm.NewDirectIODiskManager(testFile)
-
-	test.Require().NoError(err)
+	disk, actualMetadata := bpm.NewMemoryDiskManager()
 
 	replacer := bpm.NewLRUReplacer()
 	bufferPoolManager, err := bpm.NewSimpleBufferPoolManager(10, 4096, replacer, disk)
 	test.Require().NoError(err)
 
-	server, err := NewServer(":8080", bplustree.NewBPlusTree(0, bufferPoolManager, actualMetadata))
+	btree, err := bplustree.NewBPlusTree(0, bufferPoolManager, actualMetadata)
+	test.Suite.Require().NoError(err)
+
+	server, err := NewServer(":8080", btree)
 
 	test.Suite.Require().NoError(err)
 
@@ -68,9 +67,6 @@ func (test *DatabaseServerTestSuite) TearDownTest() {
 	slog.Info("received shutdown message")
 
 	test.conn.Close()
-
-	// Clean up test file
-	os.Remove("dragon.db")
 }
 
 func createInsertRequest(key uint16, value []byte) []byte {
@@ -198,6 +194,138 @@ func (test *DatabaseServerTestSuite) TestGet() {
 	test.Suite.Require().Equal([]byte("hello"), value)
 
 }
+func createExistsRequest(key uint16) []byte {
+
+	request := createGetRequest(key)
+
+	request[0] = byte('X')
+
+	return request
+}
+
+func (test *DatabaseServerTestSuite) TestExists() {
+
+	request := createInsertRequest(5, []byte("hello"))
+
+	n, err := test.conn.Write(request)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal(len(request), n)
+
+	responseOpCode, err := readNBytes(test.conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("O", string(responseOpCode[0]))
+
+	for key, expected := range map[uint16]byte{5: 1, 6: 0} {
+
+		request = createExistsRequest(key)
+
+		n, err = test.conn.Write(request)
+
+		test.Suite.Require().NoError(err)
+		test.Suite.Require().Equal(len(request), n)
+
+		// op code + body length + exists flag
+		response, err := readNBytes(test.conn, 1+4+1)
+
+		test.Suite.Require().NoError(err)
+		test.Suite.Require().Equal("O", string(response[0]))
+		test.Suite.Require().Equal(uint32(1), binary.LittleEndian.Uint32(response[1:5]))
+		test.Suite.Require().Equal(expected, response[5])
+	}
+}
+
+func (test *DatabaseServerTestSuite) TestResizeBufferPoolRequiresStorageEngine() {
+
+	request := make([]byte, 1+4+4)
+	request[0] = byte('R')
+	binary.LittleEndian.PutUint32(request[1:5], 4)
+	binary.LittleEndian.PutUint32(request[5:9], 20)
+
+	n, err := test.conn.Write(request)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal(len(request), n)
+
+	responseOpCode, err := readNBytes(test.conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("E", string(responseOpCode[0]))
+
+	messageLength, err := readUInt32(test.conn)
+	test.Suite.Require().NoError(err)
+
+	message, err := readNBytes(test.conn, int(messageLength))
+	test.Suite.Require().NoError(err)
+	test.Suite.Assert().Contains(string(message), "storage engine")
+}
+
+func (test *DatabaseServerTestSuite) TestResizeBufferPool() {
+
+	engine, err := storageengine.NewEphemeralStorageEngine()
+	test.Suite.Require().NoError(err)
+
+	server, err := NewStorageEngineServer(":8081", engine, 0)
+	test.Suite.Require().NoError(err)
+
+	go server.Run()
+
+	conn, err := net.Dial("tcp", "localhost:8081")
+	test.Suite.Require().NoError(err)
+
+	request := make([]byte, 1+4+4)
+	request[0] = byte('R')
+	binary.LittleEndian.PutUint32(request[1:5], 4)
+
+	// requests for more frames than the configured maximum are refused.
+	binary.LittleEndian.PutUint32(request[5:9], DEFAULT_MAX_BUFFER_POOL_SIZE+1)
+
+	_, err = conn.Write(request)
+	test.Suite.Require().NoError(err)
+
+	responseOpCode, err := readNBytes(conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("E", string(responseOpCode[0]))
+
+	messageLength, err := readUInt32(conn)
+	test.Suite.Require().NoError(err)
+
+	message, err := readNBytes(conn, int(messageLength))
+	test.Suite.Require().NoError(err)
+	test.Suite.Assert().Contains(string(message), "maximum")
+
+	binary.LittleEndian.PutUint32(request[5:9], 20)
+
+	_, err = conn.Write(request)
+	test.Suite.Require().NoError(err)
+
+	responseOpCode, err = readNBytes(conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("O", string(responseOpCode[0]))
+
+	// the B+ tree is still served from the resized buffer pool.
+	_, err = conn.Write(createInsertRequest(5, []byte("hello")))
+	test.Suite.Require().NoError(err)
+
+	responseOpCode, err = readNBytes(conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("O", string(responseOpCode[0]))
+
+	server.Shutdown()
+
+	shutdownMessage, err := readNBytes(conn, 1)
+
+	test.Suite.Require().NoError(err)
+	test.Suite.Require().Equal("S", string(shutdownMessage[0]))
+
+	conn.Close()
+	test.Suite.Require().NoError(engine.Close())
+}
+
 func TestDatabaseServer(t *testing.T) {
 
 	suite.Run(t, new(DatabaseServerTestSuite))
@@ -0,0 +1,97 @@
+package storageengine
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+)
+
+const (
+	// leaf nodes are merged as long as the merged leaf node uses at most this fraction of a page.
+	DEFAULT_DEFRAGMENT_FILL_FACTOR = 0.8
+
+	// maximum number of pages a defragmentation changes while a B+ tree is locked.
+	DEFAULT_DEFRAGMENT_BATCH_SIZE = 64
+
+	// pause between batches, letting operations waiting for the B+ tree run.
+	DEFAULT_DEFRAGMENT_BATCH_INTERVAL = 10 * time.Millisecond
+)
+
+// DefragmentConfig sets the target fill factor of a defragmentation, and bounds its impact on operations running alongside it.
+type DefragmentConfig struct {
+
+	// fraction of a page a merged leaf node may use, in (0, 1].
+	FillFactor float64
+
+	// maximum number of pages changed while a B+ tree is locked.
+	BatchSize int
+
+	// pause between batches.
+	BatchInterval time.Duration
+}
+
+func DefaultDefragmentConfig() DefragmentConfig {
+
+	return DefragmentConfig{
+		FillFactor:    DEFAULT_DEFRAGMENT_FILL_FACTOR,
+		BatchSize:     DEFAULT_DEFRAGMENT_BATCH_SIZE,
+		BatchInterval: DEFAULT_DEFRAGMENT_BATCH_INTERVAL,
+	}
+}
+
+// Defragment compacts the pages of every B+ tree, and merges adjacent underfull leaf nodes, while the storage engine is in use.
+// Merged leaf nodes are deallocated, a Vacuum afterwards shrinks the database file by the pages reclaimed.
+func (engine *StorageEngine) Defragment(config DefragmentConfig) (stats bplustree.DefragmentStats, err error) {
+
+	if config.FillFactor <= 0 || config.FillFactor > 1 {
+		return stats, fmt.Errorf("fill factor must be in (0, 1], got %v", config.FillFactor)
+	}
+
+	if config.BatchSize <= 0 {
+		return stats, fmt.Errorf("defragment batch size must be positive, got %d", config.BatchSize)
+	}
+
+	fmt.Println()
+	slog.Info("Defragmenting B+ trees...", "fillFactor", config.FillFactor, "function", "Defragment", "at", "StorageEngine")
+
+	// B+ tree 0 isn't handed out by NewBPlusTree, but it holds the keys served by the server, and those of older databases.
+	for BPlusTreeId := uint64(0); BPlusTreeId <= atomic.LoadUint64(&engine.currBPlusTreeId); BPlusTreeId++ {
+
+		btree, exists := engine.openRecordedBPlusTree(BPlusTreeId)
+
+		if !exists {
+			slog.Warn("Skipping B+ tree that can't be opened", "BPlusTreeId", BPlusTreeId, "function", "Defragment", "at", "StorageEngine")
+			continue
+		}
+
+		var startKey []byte
+
+		for {
+
+			batchStats, nextKey, err := btree.Defragment(startKey, config.FillFactor, config.BatchSize)
+
+			stats.CompactedPages += batchStats.CompactedPages
+			stats.ReclaimedBytes += batchStats.ReclaimedBytes
+			stats.ReclaimedPages += batchStats.ReclaimedPages
+
+			if err != nil {
+				slog.Error("Failed to defragment B+ tree", "BPlusTreeId", BPlusTreeId, "error", err.Error(), "function", "Defragment", "at", "StorageEngine")
+				return stats, err
+			}
+
+			if nextKey == nil {
+				break
+			}
+
+			startKey = nextKey
+			time.Sleep(config.BatchInterval)
+		}
+	}
+
+	slog.Info("Defragmented B+ trees", "compactedPages", stats.CompactedPages, "reclaimedBytes", stats.ReclaimedBytes, "reclaimedPages", stats.ReclaimedPages, "function", "Defragment", "at", "StorageEngine")
+
+	return stats, nil
+}
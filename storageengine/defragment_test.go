@@ -0,0 +1,101 @@
+package storageengine
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+func (ts *StorageEngineTestSuite) TestDefragment() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	index, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	numElements := 300
+	padding := bytes.Repeat([]byte("x"), 100)
+
+	value := func(i int) []byte {
+
+		city := "paris"
+		if i%2 == 1 {
+			city = "berlin"
+		}
+
+		return append([]byte(fmt.Sprintf("%s:user_%04d_", city, i)), padding...)
+	}
+
+	for i := range numElements {
+		ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), value(i)))
+	}
+
+	for i := range numElements {
+		if i%3 != 0 {
+			ts.Require().NoError(ts.engine.Delete(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i))))
+		}
+	}
+
+	_, err = ts.engine.Defragment(DefragmentConfig{FillFactor: 0, BatchSize: 8})
+	ts.Assert().Error(err)
+
+	stats, err := ts.engine.Defragment(DefragmentConfig{FillFactor: 0.9, BatchSize: 8, BatchInterval: time.Millisecond})
+	ts.Require().NoError(err)
+	ts.Assert().Greater(stats.ReclaimedBytes, 0)
+	ts.Assert().Greater(stats.ReclaimedPages, 0)
+
+	btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+	ts.Require().True(exists)
+
+	count, err := btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements/3), count)
+
+	for i := 0; i < numElements; i += 3 {
+
+		storedValue, err := btree.Get([]byte(fmt.Sprintf("user_%04d", i)))
+		ts.Require().NoError(err)
+		ts.Assert().Equal(value(i), storedValue)
+	}
+
+	// the secondary index is a B+ tree of its own, and is defragmented too.
+	entries, err := index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Assert().Len(entries, numElements/6)
+
+	// the pages reclaimed from merged leaf nodes can be released by a vacuum.
+	vacuumStats, err := ts.engine.Vacuum(DefaultVacuumConfig())
+	ts.Require().NoError(err)
+	ts.Assert().Greater(vacuumStats.ReleasedPages, 0)
+
+	count, err = btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements/3), count)
+}
+
+func (ts *StorageEngineTestSuite) TestDefragmentBPlusTreeZero() {
+
+	// B+ tree 0 holds the keys served by the server, it isn't handed out by NewBPlusTree.
+	padding := bytes.Repeat([]byte("x"), 100)
+
+	for i := range 300 {
+		ts.Require().NoError(ts.engine.Insert(0, []byte(fmt.Sprintf("user_%04d", i)), padding))
+	}
+
+	for i := range 300 {
+		if i%3 != 0 {
+			ts.Require().NoError(ts.engine.Delete(0, []byte(fmt.Sprintf("user_%04d", i))))
+		}
+	}
+
+	stats, err := ts.engine.Defragment(DefragmentConfig{FillFactor: 0.9, BatchSize: 8, BatchInterval: time.Millisecond})
+	ts.Require().NoError(err)
+	ts.Assert().Greater(stats.ReclaimedPages, 0)
+
+	btree, exists := ts.engine.OpenBPlusTree(0)
+	ts.Require().True(exists)
+
+	count, err := btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(100), count)
+}
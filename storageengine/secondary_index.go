@@ -0,0 +1,256 @@
+package storageengine
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+)
+
+// KeyExtractor derives the secondary key from the value of a primary B+ tree element.
+// ok is set to false if the value should not be indexed.
+type KeyExtractor func(value []byte) (secondaryKey []byte, ok bool)
+
+// IndexEntry is a primary B+ tree element found using a secondary index.
+type IndexEntry struct {
+	SecondaryKey []byte
+	PrimaryKey   []byte
+	Value        []byte
+}
+
+// SecondaryIndex maps secondary keys extracted from the values of a primary B+ tree to their primary keys.
+// It is stored in its own B+ tree, and kept up to date by the storage engine on every write to the primary B+ tree.
+//
+// Multiple primary keys can share a secondary key, so each secondary key is stored as a composite key
+// (escaped secondary key | terminator | primary key), with the primary key as the value.
+// The escaping preserves the byte order of secondary keys, so range scans over the index B+ tree are range scans over secondary keys.
+//
+// Index updates aren't atomic with the write to the primary B+ tree. The new index entry is inserted before the primary write,
+// and the old one is deleted after it, so a failure leaves stale entries in the index, but never a primary element missing from it.
+// Lookups skip stale entries, since they check that the value of the primary key still maps to the secondary key.
+type SecondaryIndex struct {
+	Name string
+
+	primaryBPlusTree *bplustree.BPlusTree
+	indexBPlusTree   *bplustree.BPlusTree
+
+	extractor KeyExtractor
+}
+
+const (
+	escapeByte           = 0x00
+	escapedEscapeByte    = 0xFF
+	terminatorByte       = 0x01
+	terminatorUpperBound = 0x02
+)
+
+// encodeSecondaryKey escapes every 0x00 byte in the secondary key as 0x00 0xFF, and terminates it with 0x00 0x01.
+// Since the terminator sorts below every escaped byte, a < b implies encodeSecondaryKey(a) + x < encodeSecondaryKey(b) + y.
+func encodeSecondaryKey(secondaryKey []byte) []byte {
+
+	encodedKey := make([]byte, 0, len(secondaryKey)+2)
+
+	for _, b := range secondaryKey {
+
+		if b == escapeByte {
+			encodedKey = append(encodedKey, escapeByte, escapedEscapeByte)
+			continue
+		}
+		encodedKey = append(encodedKey, b)
+	}
+
+	return append(encodedKey, escapeByte, terminatorByte)
+}
+
+// encodeIndexKey returns the composite key under which the primary key is stored in the index B+ tree.
+func encodeIndexKey(secondaryKey []byte, primaryKey []byte) []byte {
+
+	return append(encodeSecondaryKey(secondaryKey), primaryKey...)
+}
+
+// decodeIndexKey splits a composite key from the index B+ tree into the secondary key and primary key.
+func decodeIndexKey(indexKey []byte) (secondaryKey []byte, primaryKey []byte, err error) {
+
+	secondaryKey = make([]byte, 0)
+
+	for pointer := 0; pointer+1 < len(indexKey); pointer++ {
+
+		if indexKey[pointer] != escapeByte {
+			secondaryKey = append(secondaryKey, indexKey[pointer])
+			continue
+		}
+
+		switch indexKey[pointer+1] {
+
+		case escapedEscapeByte:
+			secondaryKey = append(secondaryKey, escapeByte)
+			pointer++
+
+		case terminatorByte:
+			primaryKey = make([]byte, len(indexKey)-(pointer+2))
+			copy(primaryKey, indexKey[pointer+2:])
+			return secondaryKey, primaryKey, nil
+
+		default:
+			return nil, nil, fmt.Errorf("invalid escape sequence in index key")
+		}
+	}
+
+	return nil, nil, fmt.Errorf("index key is not terminated")
+}
+
+// insertNewEntry inserts the index entry for the primary key, before its value is changed from oldValue to newValue.
+// hadOldValue and hasNewValue are set to false if the primary key didn't exist before, or doesn't exist after the write.
+func (index *SecondaryIndex) insertNewEntry(primaryKey []byte, oldValue []byte, hadOldValue bool, newValue []byte, hasNewValue bool) error {
+
+	_, _, newSecondaryKey, newIndexed, unchanged := index.extractSecondaryKeys(oldValue, hadOldValue, newValue, hasNewValue)
+
+	if unchanged || !newIndexed {
+		return nil
+	}
+
+	if err := index.indexBPlusTree.Insert(encodeIndexKey(newSecondaryKey, primaryKey), primaryKey); err != nil {
+		slog.Error("Failed to insert index entry", "index", index.Name, "primary_key", string(primaryKey), "error", err.Error(), "function", "insertNewEntry", "at", "SecondaryIndex")
+		return err
+	}
+
+	return nil
+}
+
+// deleteOldEntry deletes the index entry the primary key had before its value was changed from oldValue to newValue.
+func (index *SecondaryIndex) deleteOldEntry(primaryKey []byte, oldValue []byte, hadOldValue bool, newValue []byte, hasNewValue bool) error {
+
+	oldSecondaryKey, oldIndexed, _, _, unchanged := index.extractSecondaryKeys(oldValue, hadOldValue, newValue, hasNewValue)
+
+	if unchanged || !oldIndexed {
+		return nil
+	}
+
+	if err := index.indexBPlusTree.Delete(encodeIndexKey(oldSecondaryKey, primaryKey)); err != nil {
+		slog.Error("Failed to delete index entry", "index", index.Name, "primary_key", string(primaryKey), "error", err.Error(), "function", "deleteOldEntry", "at", "SecondaryIndex")
+		return err
+	}
+
+	return nil
+}
+
+// extractSecondaryKeys returns the secondary keys of the old and new value of a primary key, and whether the index entry is unchanged by the write.
+func (index *SecondaryIndex) extractSecondaryKeys(oldValue []byte, hadOldValue bool, newValue []byte, hasNewValue bool) (oldSecondaryKey []byte, oldIndexed bool, newSecondaryKey []byte, newIndexed bool, unchanged bool) {
+
+	if hadOldValue {
+		oldSecondaryKey, oldIndexed = index.extractor(oldValue)
+	}
+
+	if hasNewValue {
+		newSecondaryKey, newIndexed = index.extractor(newValue)
+	}
+
+	unchanged = oldIndexed && newIndexed && bytes.Equal(oldSecondaryKey, newSecondaryKey)
+
+	return oldSecondaryKey, oldIndexed, newSecondaryKey, newIndexed, unchanged
+}
+
+// backfill indexes every element already present in the primary B+ tree.
+func (index *SecondaryIndex) backfill() error {
+
+	entries := make([]IndexEntry, 0)
+
+	err := index.primaryBPlusTree.Scan([]byte{}, nil, func(key []byte, value []byte) bool {
+
+		if secondaryKey, ok := index.extractor(value); ok {
+			entries = append(entries, IndexEntry{SecondaryKey: secondaryKey, PrimaryKey: key})
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+
+		if err := index.indexBPlusTree.Insert(encodeIndexKey(entry.SecondaryKey, entry.PrimaryKey), entry.PrimaryKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns all elements of the primary B+ tree whose value maps to the given secondary key, ordered by primary key.
+func (index *SecondaryIndex) Lookup(secondaryKey []byte) ([]IndexEntry, error) {
+
+	startKey := encodeSecondaryKey(secondaryKey)
+
+	endKey := make([]byte, len(startKey))
+	copy(endKey, startKey)
+	endKey[len(endKey)-1] = terminatorUpperBound
+
+	return index.scan(startKey, endKey)
+}
+
+// RangeScan returns all elements of the primary B+ tree whose secondary key is in the range [startSecondaryKey, endSecondaryKey),
+// ordered by secondary key, then primary key. A nil endSecondaryKey represents an unbounded range.
+func (index *SecondaryIndex) RangeScan(startSecondaryKey []byte, endSecondaryKey []byte) ([]IndexEntry, error) {
+
+	var endKey []byte
+
+	if endSecondaryKey != nil {
+		endKey = encodeSecondaryKey(endSecondaryKey)
+	}
+
+	return index.scan(encodeSecondaryKey(startSecondaryKey), endKey)
+}
+
+// scan collects the index entries in the range [startKey, endKey) of the index B+ tree, and fetches their values from the primary B+ tree.
+// Entries whose primary key has expired, or whose value no longer maps to the secondary key, are skipped.
+func (index *SecondaryIndex) scan(startKey []byte, endKey []byte) ([]IndexEntry, error) {
+
+	indexKeys := make([][]byte, 0)
+
+	err := index.indexBPlusTree.Scan(startKey, endKey, func(key []byte, value []byte) bool {
+		indexKeys = append(indexKeys, key)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]IndexEntry, 0, len(indexKeys))
+
+	for _, indexKey := range indexKeys {
+
+		secondaryKey, primaryKey, err := decodeIndexKey(indexKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exists, err := index.primaryBPlusTree.Exists(primaryKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		value, err := index.primaryBPlusTree.Get(primaryKey)
+
+		// primary key expired after the existence check
+		if err != nil {
+			continue
+		}
+
+		if currentSecondaryKey, ok := index.extractor(value); !ok || !bytes.Equal(currentSecondaryKey, secondaryKey) {
+			continue
+		}
+
+		entries = append(entries, IndexEntry{SecondaryKey: secondaryKey, PrimaryKey: primaryKey, Value: value})
+	}
+
+	return entries, nil
+}
@@ -2,17 +2,25 @@ package storageengine
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
 	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
 	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
 )
 
+// interval at which the expiry reaper deletes expired keys from open B+ trees.
+const DEFAULT_EXPIRY_REAPER_INTERVAL = 1 * time.Second
+
 type StorageEngine struct {
 	currBPlusTreeId uint64
 
+	// guards the open B+ trees, and every write to the metadata made by the storage engine and its B+ trees.
+	// It is held while the metadata is encoded into the metadata page, so the page is never written while the metadata changes.
 	openBPlusTreesMutex *sync.Mutex
 	openBPlusTrees      map[uint64]*bplustree.BPlusTree
 	metadata            *codec.MetaData
@@ -20,24 +28,133 @@ type StorageEngine struct {
 	bufferPoolManager bpm.BufferPoolManager
 	// WAL dependency
 
+	// set if pages are encrypted at rest.
+	encryptedDisk *bpm.EncryptedDiskManager
+
+	// set if the database can be stored in more than one tablespace.
+	tablespaceDisk *bpm.TablespaceDiskManager
+
+	// serializes writes made through the storage engine, so a primary B+ tree and its secondary indexes are updated together.
+	writeMutex *sync.Mutex
+
+	secondaryIndexesMutex *sync.RWMutex
+	// primary B+ tree ID -> index name -> secondary index
+	secondaryIndexes map[uint64]map[string]*SecondaryIndex
+
+	// closed to signal the expiry reaper goroutine to exit.
+	reaperShutdown     chan struct{}
+	reaperShutdownOnce *sync.Once
+	reaperWaitGroup    *sync.WaitGroup
 }
 
+// NewStorageEngine opens the storage engine whose primary database file is dragon.db in the current directory.
 func NewStorageEngine() (engine *StorageEngine, isNewDatabase bool, err error) {
 
-	cache := bpm.NewLRUReplacer()
-	disk, metadata, isNewDatabase, err := bpm.NewDirectIODiskManager("dragon.db")
+	return NewStorageEngineAt("dragon.db")
+}
+
+// NewStorageEngineAt opens the storage engine whose primary database file is at filePath, along with the data files of its tablespaces.
+func NewStorageEngineAt(filePath string) (engine *StorageEngine, isNewDatabase bool, err error) {
+
+	disk, metadata, isNewDatabase, err := bpm.NewTablespaceDiskManager(filePath)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	engine, err = newStorageEngine(disk, metadata)
 
 	if err != nil {
 		return nil, false, err
 	}
 
-	bufferPoolManager, err := bpm.NewSimpleBufferPoolManager(5, 4096, cache, disk)
+	engine.tablespaceDisk = disk
+
+	return engine, isNewDatabase, nil
+}
+
+// NewStorageEngineWithPageSize opens a storage engine whose database file is created with pages of pageSize bytes.
+// An existing database must have been created with the same page size.
+func NewStorageEngineWithPageSize(pageSize int) (engine *StorageEngine, isNewDatabase bool, err error) {
+
+	disk, metadata, isNewDatabase, err := bpm.NewTablespaceDiskManagerWithPageSize("dragon.db", pageSize)
 
 	if err != nil {
 		return nil, false, err
 	}
 
-	return &StorageEngine{
+	engine, err = newStorageEngine(disk, metadata)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	engine.tablespaceDisk = disk
+
+	return engine, isNewDatabase, nil
+}
+
+// NewEphemeralStorageEngine creates a storage engine whose pages are kept in memory. Nothing is written to disk,
+// so the database is lost when the storage engine is closed. It is meant for caches and tests.
+func NewEphemeralStorageEngine() (*StorageEngine, error) {
+
+	disk, metadata := bpm.NewMemoryDiskManager()
+
+	return newStorageEngine(disk, metadata)
+}
+
+// NewOSBufferedStorageEngine opens the storage engine's database file using buffered I/O instead of Direct I/O.
+// The file format is the same, so a database can be opened either way.
+func NewOSBufferedStorageEngine() (engine *StorageEngine, isNewDatabase bool, err error) {
+
+	disk, metadata, isNewDatabase, err := bpm.NewOSBufferedDiskManager("dragon.db")
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	engine, err = newStorageEngine(disk, metadata)
+
+	return engine, isNewDatabase, err
+}
+
+// NewEncryptedStorageEngine opens a storage engine whose pages, including the metadata page, are encrypted at rest using keys supplied by keyProvider.
+func NewEncryptedStorageEngine(keyProvider bpm.KeyProvider) (engine *StorageEngine, isNewDatabase bool, err error) {
+
+	disk, metadata, isNewDatabase, err := bpm.NewEncryptedDirectIODiskManager("dragon.db", keyProvider)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	engine, err = newStorageEngine(disk, metadata)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	engine.encryptedDisk = disk
+
+	return engine, isNewDatabase, nil
+}
+
+func newStorageEngine(disk bpm.DiskManager, metadata *codec.MetaData) (engine *StorageEngine, err error) {
+
+	cache := bpm.NewLRUReplacer()
+
+	bufferPoolManager, err := bpm.NewSimpleBufferPoolManager(5, int(metadata.PageSize), cache, disk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bufferPoolManager.SetPinWaitTimeout(bpm.DEFAULT_PIN_WAIT_TIMEOUT)
+
+	if err := bufferPoolManager.StartBackgroundWriter(bpm.DefaultBackgroundWriterConfig()); err != nil {
+		return nil, err
+	}
+
+	engine = &StorageEngine{
 		currBPlusTreeId: metadata.CurrBPlusTreeId,
 
 		openBPlusTreesMutex: &sync.Mutex{},
@@ -45,15 +162,89 @@ func NewStorageEngine() (engine *StorageEngine, isNewDatabase bool, err error) {
 
 		metadata:          metadata,
 		bufferPoolManager: bufferPoolManager,
-	}, isNewDatabase, err
 
+		writeMutex: &sync.Mutex{},
+
+		secondaryIndexesMutex: &sync.RWMutex{},
+		secondaryIndexes:      make(map[uint64]map[string]*SecondaryIndex),
+
+		reaperShutdown:     make(chan struct{}),
+		reaperShutdownOnce: &sync.Once{},
+		reaperWaitGroup:    &sync.WaitGroup{},
+	}
+
+	engine.startExpiryReaper(DEFAULT_EXPIRY_REAPER_INTERVAL)
+
+	return engine, nil
+
+}
+
+// ReEncryptPages re-encrypts all pages encrypted with an older key, after the key provider's current key has been rotated.
+// It runs while the storage engine is in use, and returns the number of pages re-encrypted.
+func (engine *StorageEngine) ReEncryptPages() (int, error) {
+
+	if engine.encryptedDisk == nil {
+		return 0, fmt.Errorf("storage engine is not encrypted")
+	}
+
+	// the metadata page is re-encrypted by encoding the metadata again.
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	return engine.encryptedDisk.ReEncryptPages()
 }
+
+// ResizeBufferPool grows or shrinks the buffer pool to poolSize frames while the storage engine is in use.
+func (engine *StorageEngine) ResizeBufferPool(poolSize int) error {
+
+	return engine.bufferPoolManager.Resize(poolSize)
+}
+
+// BufferPoolStats returns a snapshot of the buffer pool's counters, such as its hit rate.
+func (engine *StorageEngine) BufferPoolStats() bpm.BufferPoolStats {
+
+	return engine.bufferPoolManager.Stats()
+}
+
+// Sync is a commit point. Writes made through the storage engine before Sync are on disk once it returns,
+// and are synced to stable storage if the sync mode syncs on commit. Writes wait for Sync to finish.
+func (engine *StorageEngine) Sync() error {
+
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	engine.recordMetaData()
+
+	return engine.bufferPoolManager.Sync()
+}
+
+// recordMetaData records the open B+ trees in the metadata, so they are written with the next metadata page.
+// Caller must hold the write mutex, and the open B+ trees mutex until the metadata page is written.
+func (engine *StorageEngine) recordMetaData() {
+
+	engine.metadata.CurrBPlusTreeId = atomic.LoadUint64(&engine.currBPlusTreeId)
+
+	for _, btree := range engine.openBPlusTrees {
+		btree.RecordMetaData()
+	}
+}
+
+// SetSyncConfig changes when the database file is synced to stable storage. The default is SyncPerCommit.
+func (engine *StorageEngine) SetSyncConfig(config bpm.SyncConfig) error {
+
+	return engine.bufferPoolManager.SetSyncConfig(config)
+}
+
 func (engine *StorageEngine) NewBPlusTree() (BPlusTreeId uint64) {
 
 	BPlusTreeId = atomic.AddUint64(&engine.currBPlusTreeId, 1)
 	return BPlusTreeId
 }
 
+// OpenBPlusTree returns the B+ tree with the given ID, loading it from the metadata page if it isn't already open.
 func (engine *StorageEngine) OpenBPlusTree(BPlusTreeId uint64) (btree *bplustree.BPlusTree, exists bool) {
 
 	engine.openBPlusTreesMutex.Lock()
@@ -61,7 +252,74 @@ func (engine *StorageEngine) OpenBPlusTree(BPlusTreeId uint64) (btree *bplustree
 
 	btree, exists = engine.openBPlusTrees[BPlusTreeId]
 
-	return btree, exists
+	if exists {
+		return btree, true
+	}
+
+	// B+ tree IDs are handed out in increasing order, so a B+ tree with a greater ID was never created.
+	if BPlusTreeId > atomic.LoadUint64(&engine.currBPlusTreeId) {
+		return nil, false
+	}
+
+	// a B+ tree can't be opened with a different comparator than the one it was created with
+	btree, err := bplustree.NewBPlusTree(BPlusTreeId, engine.bufferPoolManager, engine.metadata)
+
+	if err != nil {
+		slog.Error("Failed to open B+ tree", "BPlusTreeId", BPlusTreeId, "error", err.Error(), "function", "OpenBPlusTree", "at", "StorageEngine")
+		return nil, false
+	}
+
+	engine.openBPlusTrees[BPlusTreeId] = btree
+
+	return btree, true
+}
+
+// NewBPlusTreeWithComparator creates a B+ tree whose keys are ordered using the given comparator, and records the comparator in the metadata page.
+// Custom comparators must be registered using codec.RegisterComparator before the B+ tree is reopened.
+func (engine *StorageEngine) NewBPlusTreeWithComparator(comparator codec.Comparator) (BPlusTreeId uint64, err error) {
+
+	BPlusTreeId = engine.NewBPlusTree()
+
+	if _, err := engine.OpenBPlusTreeWithComparator(BPlusTreeId, comparator); err != nil {
+		return 0, err
+	}
+
+	return BPlusTreeId, nil
+}
+
+// OpenBPlusTreeWithComparator returns the B+ tree with the given ID, after checking that it was created with the given comparator.
+func (engine *StorageEngine) OpenBPlusTreeWithComparator(BPlusTreeId uint64, comparator codec.Comparator) (*bplustree.BPlusTree, error) {
+
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	if btree, exists := engine.openBPlusTrees[BPlusTreeId]; exists {
+
+		name, recorded := engine.metadata.Comparators[BPlusTreeId]
+
+		if !recorded {
+			name = codec.BytewiseComparator.Name
+		}
+
+		if name != comparator.Name {
+			return nil, fmt.Errorf("B Plus Tree is open with comparator %s, cannot open with comparator %s", name, comparator.Name)
+		}
+		return btree, nil
+	}
+
+	if BPlusTreeId > atomic.LoadUint64(&engine.currBPlusTreeId) {
+		return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	btree, err := bplustree.NewBPlusTreeWithComparator(BPlusTreeId, engine.bufferPoolManager, engine.metadata, comparator)
+
+	if err != nil {
+		return nil, err
+	}
+
+	engine.openBPlusTrees[BPlusTreeId] = btree
+
+	return btree, nil
 }
 
 func (engine *StorageEngine) CloseBPlusTree(BPlusTreeId uint64) error {
@@ -80,30 +338,279 @@ func (engine *StorageEngine) CloseBPlusTree(BPlusTreeId uint64) error {
 	return nil
 }
 func (engine *StorageEngine) Close() error {
-	engine.metadata.CurrBPlusTreeId = engine.currBPlusTreeId
+
+	engine.stopExpiryReaper()
+
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	engine.metadata.CurrBPlusTreeId = atomic.LoadUint64(&engine.currBPlusTreeId)
 	for _, btree := range engine.openBPlusTrees {
 		btree.Close()
 	}
 	return engine.bufferPoolManager.Close()
 }
 
-func (engine *StorageEngine) NewBPlusTreeIterator(BPlusTreeId uint64) (*bplustree.BPlusTreeIterator, error) {
+// Insert inserts the key value pair into the B+ tree, and updates the secondary indexes over it.
+func (engine *StorageEngine) Insert(BPlusTreeId uint64, key []byte, value []byte) error {
+
+	return engine.InsertWithTTL(BPlusTreeId, key, value, 0)
+}
+
+// InsertWithTTL inserts the key value pair into the B+ tree, and updates the secondary indexes over it.
+// A TTL of 0 means the key never expires. Index entries of expired keys are skipped by lookups.
+func (engine *StorageEngine) InsertWithTTL(BPlusTreeId uint64, key []byte, value []byte, ttl time.Duration) error {
+
+	btree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	indexes := engine.getSecondaryIndexes(BPlusTreeId)
+
+	oldValue, hadOldValue, err := engine.getOldValue(btree, key, indexes)
+
+	if err != nil {
+		return err
+	}
+
+	// if an index entry can't be inserted, the primary write isn't made, and the entries inserted into other indexes are left as stale entries.
+	for _, index := range indexes {
+
+		if err := index.insertNewEntry(key, oldValue, hadOldValue, value, true); err != nil {
+			return err
+		}
+	}
+
+	if ttl > 0 {
+		err = btree.InsertWithTTL(key, value, ttl)
+	} else {
+		err = btree.Insert(key, value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	engine.deleteOldIndexEntries(indexes, key, oldValue, hadOldValue, value, true)
+
+	return nil
+}
+
+// Delete deletes the key from the B+ tree, and removes it from the secondary indexes over it.
+func (engine *StorageEngine) Delete(BPlusTreeId uint64, key []byte) error {
+
+	btree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	indexes := engine.getSecondaryIndexes(BPlusTreeId)
+
+	oldValue, hadOldValue, err := engine.getOldValue(btree, key, indexes)
+
+	if err != nil {
+		return err
+	}
+
+	if err := btree.Delete(key); err != nil {
+		return err
+	}
+
+	engine.deleteOldIndexEntries(indexes, key, oldValue, hadOldValue, nil, false)
+
+	return nil
+}
+
+// deleteOldIndexEntries deletes the index entries the key had before a write to the primary B+ tree changed its value from oldValue to newValue.
+// The write has already been made, so an entry that can't be deleted is logged and left as a stale entry, which lookups skip.
+func (engine *StorageEngine) deleteOldIndexEntries(indexes []*SecondaryIndex, key []byte, oldValue []byte, hadOldValue bool, newValue []byte, hasNewValue bool) {
+
+	for _, index := range indexes {
+
+		if err := index.deleteOldEntry(key, oldValue, hadOldValue, newValue, hasNewValue); err != nil {
+			slog.Error("Left stale index entry", "index", index.Name, "key", string(key), "error", err.Error(), "function", "deleteOldIndexEntries", "at", "StorageEngine")
+		}
+	}
+}
+
+// getOldValue returns the value the key currently maps to, if the B+ tree has secondary indexes that need it.
+func (engine *StorageEngine) getOldValue(btree *bplustree.BPlusTree, key []byte, indexes []*SecondaryIndex) (oldValue []byte, exists bool, err error) {
+
+	if len(indexes) == 0 {
+		return nil, false, nil
+	}
+
+	exists, err = btree.Exists(key)
+
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	oldValue, err = btree.Get(key)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return oldValue, true, nil
+}
+
+// CreateSecondaryIndex creates a secondary index over the B+ tree, and indexes the elements already present in it.
+// The index is recorded in the metadata page, after a restart it must be reopened using OpenSecondaryIndex.
+func (engine *StorageEngine) CreateSecondaryIndex(BPlusTreeId uint64, name string, extractor KeyExtractor) (*SecondaryIndex, error) {
+
+	if len(name) == 0 || len(name) > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid secondary index name")
+	}
+
+	btree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	// block writes to the primary B+ tree while the index is backfilled
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	engine.secondaryIndexesMutex.Lock()
+	defer engine.secondaryIndexesMutex.Unlock()
+
+	if _, found := engine.findSecondaryIndexMetaData(BPlusTreeId, name); found {
+		return nil, fmt.Errorf("secondary index already exists")
+	}
+
+	indexBPlusTreeId := engine.NewBPlusTree()
+	indexBPlusTree, _ := engine.OpenBPlusTree(indexBPlusTreeId)
+
+	index := &SecondaryIndex{
+		Name:             name,
+		primaryBPlusTree: btree,
+		indexBPlusTree:   indexBPlusTree,
+		extractor:        extractor,
+	}
+
+	if err := index.backfill(); err != nil {
+		slog.Error("Failed to backfill secondary index", "index", name, "BPlusTreeId", BPlusTreeId, "error", err.Error(), "function", "CreateSecondaryIndex", "at", "StorageEngine")
+		return nil, err
+	}
 
 	engine.openBPlusTreesMutex.Lock()
-	defer engine.openBPlusTreesMutex.Unlock()
 
-	BPlusTree, ok := engine.openBPlusTrees[BPlusTreeId]
+	engine.metadata.SecondaryIndexes = append(engine.metadata.SecondaryIndexes, codec.SecondaryIndexMetaData{
+		Name:               name,
+		PrimaryBPlusTreeId: BPlusTreeId,
+		IndexBPlusTreeId:   indexBPlusTreeId,
+	})
 
-	if !ok {
+	engine.openBPlusTreesMutex.Unlock()
 
-		BPlusTree, exists := engine.OpenBPlusTree(BPlusTreeId)
+	engine.registerSecondaryIndex(BPlusTreeId, index)
 
-		if !exists {
-			return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	return index, nil
+}
+
+// OpenSecondaryIndex reopens a secondary index recorded in the metadata page. Key extractors can't be persisted,
+// so every secondary index must be reopened with the same extractor it was created with before writing to the primary B+ tree.
+func (engine *StorageEngine) OpenSecondaryIndex(BPlusTreeId uint64, name string, extractor KeyExtractor) (*SecondaryIndex, error) {
+
+	btree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
+	engine.secondaryIndexesMutex.Lock()
+	defer engine.secondaryIndexesMutex.Unlock()
+
+	if index, open := engine.secondaryIndexes[BPlusTreeId][name]; open {
+		return index, nil
+	}
+
+	indexMetaData, found := engine.findSecondaryIndexMetaData(BPlusTreeId, name)
+
+	if !found {
+		return nil, fmt.Errorf("secondary index doesnt exist")
+	}
+
+	indexBPlusTree, _ := engine.OpenBPlusTree(indexMetaData.IndexBPlusTreeId)
+
+	index := &SecondaryIndex{
+		Name:             name,
+		primaryBPlusTree: btree,
+		indexBPlusTree:   indexBPlusTree,
+		extractor:        extractor,
+	}
+
+	engine.registerSecondaryIndex(BPlusTreeId, index)
+
+	return index, nil
+}
+
+// GetSecondaryIndex returns an open secondary index over the B+ tree.
+func (engine *StorageEngine) GetSecondaryIndex(BPlusTreeId uint64, name string) (index *SecondaryIndex, exists bool) {
+
+	engine.secondaryIndexesMutex.RLock()
+	defer engine.secondaryIndexesMutex.RUnlock()
+
+	index, exists = engine.secondaryIndexes[BPlusTreeId][name]
+	return index, exists
+}
+
+// caller must hold the secondary indexes lock.
+func (engine *StorageEngine) findSecondaryIndexMetaData(BPlusTreeId uint64, name string) (codec.SecondaryIndexMetaData, bool) {
+
+	for _, indexMetaData := range engine.metadata.SecondaryIndexes {
+
+		if indexMetaData.PrimaryBPlusTreeId == BPlusTreeId && indexMetaData.Name == name {
+			return indexMetaData, true
 		}
+	}
+
+	return codec.SecondaryIndexMetaData{}, false
+}
 
-		engine.openBPlusTrees[BPlusTreeId] = BPlusTree
+// caller must hold the secondary indexes lock.
+func (engine *StorageEngine) registerSecondaryIndex(BPlusTreeId uint64, index *SecondaryIndex) {
+
+	if _, exists := engine.secondaryIndexes[BPlusTreeId]; !exists {
+		engine.secondaryIndexes[BPlusTreeId] = make(map[string]*SecondaryIndex)
+	}
+
+	engine.secondaryIndexes[BPlusTreeId][index.Name] = index
+}
+
+func (engine *StorageEngine) getSecondaryIndexes(BPlusTreeId uint64) []*SecondaryIndex {
+
+	engine.secondaryIndexesMutex.RLock()
+	defer engine.secondaryIndexesMutex.RUnlock()
+
+	indexes := make([]*SecondaryIndex, 0, len(engine.secondaryIndexes[BPlusTreeId]))
+
+	for _, index := range engine.secondaryIndexes[BPlusTreeId] {
+		indexes = append(indexes, index)
 	}
+
+	return indexes
+}
+
+func (engine *StorageEngine) NewBPlusTreeIterator(BPlusTreeId uint64) (*bplustree.BPlusTreeIterator, error) {
+
+	BPlusTree, exists := engine.OpenBPlusTree(BPlusTreeId)
+
+	if !exists {
+		return nil, fmt.Errorf("B Plus Tree doesnt exist")
+	}
+
 	return bplustree.NewBPlusIterator(BPlusTree)
 }
 
@@ -111,3 +618,90 @@ func (engine *StorageEngine) GetCurrBPlusTreeId() uint64 {
 
 	return engine.currBPlusTreeId
 }
+
+// startExpiryReaper starts a background goroutine that periodically deletes expired keys from all open B+ trees.
+func (engine *StorageEngine) startExpiryReaper(interval time.Duration) {
+
+	engine.reaperWaitGroup.Add(1)
+
+	go func() {
+
+		defer engine.reaperWaitGroup.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+
+			case <-engine.reaperShutdown:
+				slog.Info("expiry reaper exiting...", "function", "startExpiryReaper", "at", "StorageEngine")
+				return
+
+			case now := <-ticker.C:
+				engine.deleteExpiredKeys(now)
+			}
+		}
+	}()
+}
+
+// stopExpiryReaper signals the expiry reaper to exit, and waits until it does.
+func (engine *StorageEngine) stopExpiryReaper() {
+
+	engine.reaperShutdownOnce.Do(func() {
+		close(engine.reaperShutdown)
+	})
+
+	engine.reaperWaitGroup.Wait()
+}
+
+// deleteExpiredKeys deletes keys that have expired at the given time from all open B+ trees, in key order.
+// Expired keys are deleted through the same path as Delete, so they are removed from the secondary indexes over their B+ tree.
+func (engine *StorageEngine) deleteExpiredKeys(now time.Time) {
+
+	engine.openBPlusTreesMutex.Lock()
+
+	btrees := make([]*bplustree.BPlusTree, 0, len(engine.openBPlusTrees))
+
+	for _, btree := range engine.openBPlusTrees {
+		btrees = append(btrees, btree)
+	}
+
+	engine.openBPlusTreesMutex.Unlock()
+
+	for _, btree := range btrees {
+
+		expiredKeys, err := btree.ExpiredKeys(now)
+
+		if err != nil {
+			slog.Error("Failed to find expired keys", "BPlusTreeId", btree.BPlusTreeId, "error", err.Error(), "function", "deleteExpiredKeys", "at", "StorageEngine")
+			continue
+		}
+
+		for _, key := range expiredKeys {
+
+			if err := engine.deleteExpiredKey(btree, key, now); err != nil {
+				slog.Error("Failed to delete expired key", "BPlusTreeId", btree.BPlusTreeId, "key", string(key), "error", err.Error(), "function", "deleteExpiredKeys", "at", "StorageEngine")
+				break
+			}
+		}
+	}
+}
+
+// deleteExpiredKey deletes the key from the B+ tree if it has expired at the given time, and removes it from the secondary indexes over the B+ tree.
+// The write mutex orders the delete with other writes to the B+ tree and its indexes, as well as with a vacuum committing its progress.
+func (engine *StorageEngine) deleteExpiredKey(btree *bplustree.BPlusTree, key []byte, now time.Time) error {
+
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	oldValue, deleted, err := btree.DeleteIfExpired(key, now)
+
+	if err != nil || !deleted {
+		return err
+	}
+
+	engine.deleteOldIndexEntries(engine.getSecondaryIndexes(btree.BPlusTreeId), key, oldValue, true, nil, false)
+
+	return nil
+}
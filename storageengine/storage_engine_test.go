@@ -0,0 +1,576 @@
+package storageengine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+	"github.com/stretchr/testify/suite"
+)
+
+type StorageEngineTestSuite struct {
+	suite.Suite
+	engine *StorageEngine
+}
+
+func (ts *StorageEngineTestSuite) SetupTest() {
+
+	engine, _, err := NewStorageEngine()
+	ts.Require().NoError(err)
+
+	ts.engine = engine
+}
+
+func (ts *StorageEngineTestSuite) TearDownTest() {
+
+	if ts.engine != nil {
+		ts.engine.Close()
+	}
+
+	// Clean up test file
+	os.Remove("dragon.db")
+}
+
+// cityExtractor indexes values of the form "<city>:<name>" by city.
+func cityExtractor(value []byte) ([]byte, bool) {
+
+	city, _, found := bytes.Cut(value, []byte(":"))
+	return city, found
+}
+
+func (ts *StorageEngineTestSuite) TestIndexKeyEncoding() {
+
+	indexKey := encodeIndexKey([]byte{'a', 0x00, 'b'}, []byte("primary"))
+
+	secondaryKey, primaryKey, err := decodeIndexKey(indexKey)
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte{'a', 0x00, 'b'}, secondaryKey)
+	ts.Assert().Equal([]byte("primary"), primaryKey)
+
+	// a secondary key must sort before any longer secondary key it is a prefix of, regardless of the primary key
+	ts.Assert().Less(bytes.Compare(encodeIndexKey([]byte("a"), []byte{0xFF}), encodeIndexKey([]byte{'a', 0x00}, []byte{0x00})), 0)
+	ts.Assert().Less(bytes.Compare(encodeIndexKey([]byte{'a', 0x00}, []byte{0xFF}), encodeIndexKey([]byte{'a', 0x01}, []byte{0x00})), 0)
+}
+
+func (ts *StorageEngineTestSuite) TestSecondaryIndex() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	// elements inserted before the index is created are backfilled
+	err := ts.engine.Insert(BPlusTreeId, []byte("user_1"), []byte("paris:alice"))
+	ts.Require().NoError(err)
+
+	index, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	_, err = ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Assert().Error(err)
+
+	err = ts.engine.Insert(BPlusTreeId, []byte("user_2"), []byte("berlin:bob"))
+	ts.Require().NoError(err)
+
+	err = ts.engine.Insert(BPlusTreeId, []byte("user_3"), []byte("paris:carol"))
+	ts.Require().NoError(err)
+
+	// values without a city aren't indexed
+	err = ts.engine.Insert(BPlusTreeId, []byte("user_4"), []byte("dave"))
+	ts.Require().NoError(err)
+
+	entries, err := index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Require().Len(entries, 2)
+	ts.Assert().Equal([]byte("user_1"), entries[0].PrimaryKey)
+	ts.Assert().Equal([]byte("user_3"), entries[1].PrimaryKey)
+	ts.Assert().Equal([]byte("paris:carol"), entries[1].Value)
+
+	// updating a value moves its index entry
+	err = ts.engine.Insert(BPlusTreeId, []byte("user_1"), []byte("berlin:alice"))
+	ts.Require().NoError(err)
+
+	entries, err = index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Require().Len(entries, 1)
+	ts.Assert().Equal([]byte("user_3"), entries[0].PrimaryKey)
+
+	// deleting a key removes its index entry
+	err = ts.engine.Delete(BPlusTreeId, []byte("user_3"))
+	ts.Require().NoError(err)
+
+	entries, err = index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Assert().Empty(entries)
+
+	entries, err = index.RangeScan([]byte("a"), []byte("c"))
+	ts.Require().NoError(err)
+	ts.Require().Len(entries, 2)
+
+	for i, entry := range entries {
+		ts.Assert().Equal([]byte("berlin"), entry.SecondaryKey)
+		ts.Assert().Equal([]byte(fmt.Sprintf("user_%d", i+1)), entry.PrimaryKey)
+	}
+
+	openIndex, exists := ts.engine.GetSecondaryIndex(BPlusTreeId, "city")
+	ts.Require().True(exists)
+	ts.Assert().Same(index, openIndex)
+}
+
+func (ts *StorageEngineTestSuite) TestSecondaryIndexSpansMultipleLeafNodes() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	index, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	numElements := 40
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	for i := range numElements {
+
+		city := "paris"
+		if i%2 == 1 {
+			city = "berlin"
+		}
+
+		value := append([]byte(city+":"), padding...)
+		err := ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), value)
+		ts.Require().NoError(err)
+	}
+
+	entries, err := index.Lookup([]byte("berlin"))
+	ts.Require().NoError(err)
+	ts.Assert().Len(entries, numElements/2)
+
+	entries, err = index.RangeScan([]byte("a"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Len(entries, numElements)
+}
+
+func (ts *StorageEngineTestSuite) TestExpiredKeysAreRemovedFromSecondaryIndexes() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	index, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	ts.Require().NoError(ts.engine.InsertWithTTL(BPlusTreeId, []byte("user_1"), []byte("paris:alice"), time.Minute))
+	ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte("user_2"), []byte("paris:bob")))
+
+	ts.engine.deleteExpiredKeys(time.Now().Add(time.Hour))
+
+	btree, _ := ts.engine.OpenBPlusTree(BPlusTreeId)
+
+	exists, err := btree.Exists([]byte("user_1"))
+	ts.Require().NoError(err)
+	ts.Assert().False(exists)
+
+	// only the index entry of the key that didn't expire is left in the index B+ tree.
+	count, err := index.indexBPlusTree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(1), count)
+
+	entries, err := index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Require().Len(entries, 1)
+	ts.Assert().Equal([]byte("user_2"), entries[0].PrimaryKey)
+}
+
+func (ts *StorageEngineTestSuite) TestSecondaryIndexFailure() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	index, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte("user_1"), []byte("paris:alice")))
+
+	// the index is temporarily backed by a B+ tree on a crashed disk, so every write to it fails.
+	memoryDisk, metadata := bpm.NewMemoryDiskManager()
+	failingDisk := bpm.NewFaultInjectingDiskManager(memoryDisk, 1)
+	ts.Require().NoError(failingDisk.Crash())
+
+	failingBufferPool, err := bpm.NewSimpleBufferPoolManager(4, int(metadata.PageSize), bpm.NewLRUReplacer(), failingDisk)
+	ts.Require().NoError(err)
+
+	indexBPlusTree := index.indexBPlusTree
+	index.indexBPlusTree, err = bplustree.NewBPlusTree(1, failingBufferPool, metadata)
+	ts.Require().NoError(err)
+
+	// a write whose new index entry can't be inserted isn't made.
+	ts.Assert().Error(ts.engine.Insert(BPlusTreeId, []byte("user_2"), []byte("berlin:bob")))
+	ts.Assert().Error(ts.engine.Insert(BPlusTreeId, []byte("user_1"), []byte("berlin:alice")))
+
+	btree, _ := ts.engine.OpenBPlusTree(BPlusTreeId)
+
+	exists, err := btree.Exists([]byte("user_2"))
+	ts.Require().NoError(err)
+	ts.Assert().False(exists)
+
+	value, err := btree.Get([]byte("user_1"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal([]byte("paris:alice"), value)
+
+	// a delete is made even if the old index entry can't be deleted, which is left as a stale entry.
+	ts.Require().NoError(ts.engine.Delete(BPlusTreeId, []byte("user_1")))
+
+	index.indexBPlusTree = indexBPlusTree
+
+	count, err := index.indexBPlusTree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(1), count)
+
+	// lookups skip the stale entry.
+	entries, err := index.Lookup([]byte("paris"))
+	ts.Require().NoError(err)
+	ts.Assert().Empty(entries)
+}
+
+func (ts *StorageEngineTestSuite) TestComparatorIsCheckedOnOpen() {
+
+	BPlusTreeId, err := ts.engine.NewBPlusTreeWithComparator(codec.ReverseBytewiseComparator)
+	ts.Require().NoError(err)
+
+	_, err = ts.engine.OpenBPlusTreeWithComparator(BPlusTreeId, codec.ReverseBytewiseComparator)
+	ts.Assert().NoError(err)
+
+	_, err = ts.engine.OpenBPlusTreeWithComparator(BPlusTreeId, codec.BytewiseComparator)
+	ts.Assert().Error(err)
+
+	// B+ trees created without a comparator use the bytewise comparator
+	_, err = ts.engine.OpenBPlusTreeWithComparator(ts.engine.NewBPlusTree(), codec.BytewiseComparator)
+	ts.Assert().NoError(err)
+}
+
+func (ts *StorageEngineTestSuite) TestEncryptedStorageEngine() {
+
+	ts.Require().NoError(ts.engine.Close())
+	os.Remove("dragon.db")
+
+	keyProvider, err := bpm.NewStaticKeyProvider(bytes.Repeat([]byte{7}, 32))
+	ts.Require().NoError(err)
+
+	ts.engine, _, err = NewEncryptedStorageEngine(keyProvider)
+	ts.Require().NoError(err)
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	numElements := 200
+	padding := bytes.Repeat([]byte("x"), 100)
+
+	for i := range numElements {
+		err := ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("key_%04d", i)), padding)
+		ts.Require().NoError(err)
+	}
+
+	_, err = keyProvider.AddKey(bytes.Repeat([]byte{8}, 32))
+	ts.Require().NoError(err)
+
+	reEncryptedPages, err := ts.engine.ReEncryptPages()
+	ts.Require().NoError(err)
+	ts.Assert().Greater(reEncryptedPages, 0)
+
+	ts.Require().NoError(ts.engine.Close())
+
+	ts.engine, _, err = NewEncryptedStorageEngine(keyProvider)
+	ts.Require().NoError(err)
+
+	btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+	ts.Require().True(exists)
+
+	for i := range numElements {
+		value, err := btree.Get([]byte(fmt.Sprintf("key_%04d", i)))
+		ts.Require().NoError(err)
+		ts.Assert().Equal(padding, value)
+	}
+}
+
+func (ts *StorageEngineTestSuite) TestResizeBufferPool() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+	btree, _ := ts.engine.OpenBPlusTree(BPlusTreeId)
+
+	numElements := 40
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	for i := range numElements {
+		err := ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), padding)
+		ts.Require().NoError(err)
+	}
+
+	for _, poolSize := range []int{16, 4} {
+
+		ts.Require().NoError(ts.engine.ResizeBufferPool(poolSize))
+
+		count, err := btree.Count([]byte("user_"), nil)
+		ts.Require().NoError(err)
+		ts.Assert().Equal(uint64(numElements), count)
+	}
+
+	stats := ts.engine.BufferPoolStats()
+	ts.Assert().Equal(4, stats.PoolSize)
+	ts.Assert().Greater(stats.Hits+stats.Misses, uint64(0))
+}
+
+func (ts *StorageEngineTestSuite) TestPageSize() {
+
+	numElements := 300
+	value := bytes.Repeat([]byte("x"), 1000)
+
+	for _, pageSize := range []int{16384, codec.MAX_PAGE_SIZE} {
+
+		ts.Require().NoError(ts.engine.Close())
+		os.Remove("dragon.db")
+
+		var err error
+		ts.engine, _, err = NewStorageEngineWithPageSize(pageSize)
+		ts.Require().NoError(err)
+
+		BPlusTreeId := ts.engine.NewBPlusTree()
+
+		for i := range numElements {
+			ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), value))
+		}
+
+		ts.Require().NoError(ts.engine.Close())
+
+		// an existing database can't be opened with a different page size.
+		ts.engine, _, err = NewStorageEngineWithPageSize(8192)
+		ts.Require().Error(err)
+
+		ts.engine, _, err = NewStorageEngine()
+		ts.Require().NoError(err)
+
+		btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+		ts.Require().True(exists)
+
+		count, err := btree.Count([]byte("user_"), nil)
+		ts.Require().NoError(err)
+		ts.Assert().Equal(uint64(numElements), count)
+
+		for i := range numElements {
+			got, err := btree.Get([]byte(fmt.Sprintf("user_%04d", i)))
+			ts.Require().NoError(err)
+			ts.Assert().Equal(value, got)
+		}
+	}
+}
+
+func (ts *StorageEngineTestSuite) TestOSBufferedStorageEngine() {
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	insert := func(from int, to int) {
+		for i := from; i < to; i++ {
+			ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), padding))
+		}
+	}
+
+	assertCount := func(expected int) {
+		btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+		ts.Require().True(exists)
+
+		count, err := btree.Count([]byte("user_"), nil)
+		ts.Require().NoError(err)
+		ts.Assert().Equal(uint64(expected), count)
+	}
+
+	insert(0, 40)
+	ts.Require().NoError(ts.engine.Close())
+
+	// the file written with Direct I/O is opened with buffered I/O, and the other way around.
+	var err error
+	ts.engine, _, err = NewOSBufferedStorageEngine()
+	ts.Require().NoError(err)
+
+	assertCount(40)
+	insert(40, 80)
+	ts.Require().NoError(ts.engine.Close())
+
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().NoError(err)
+
+	assertCount(80)
+}
+
+func (ts *StorageEngineTestSuite) TestEphemeralStorageEngine() {
+
+	engine, err := NewEphemeralStorageEngine()
+	ts.Require().NoError(err)
+
+	BPlusTreeId := engine.NewBPlusTree()
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	for i := range 40 {
+		ts.Require().NoError(engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), padding))
+	}
+
+	btree, exists := engine.OpenBPlusTree(BPlusTreeId)
+	ts.Require().True(exists)
+
+	count, err := btree.Count([]byte("user_"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(40), count)
+
+	ts.Require().NoError(engine.Sync())
+	ts.Require().NoError(engine.Close())
+
+	// nothing is kept once an ephemeral storage engine is closed.
+	engine, err = NewEphemeralStorageEngine()
+	ts.Require().NoError(err)
+
+	ts.Assert().Equal(uint64(0), engine.GetCurrBPlusTreeId())
+	ts.Require().NoError(engine.Close())
+}
+
+func (ts *StorageEngineTestSuite) TestManySmallBPlusTrees() {
+
+	numBPlusTrees := 60
+	BPlusTreeIds := make([]uint64, 0, numBPlusTrees)
+
+	for i := range numBPlusTrees {
+
+		BPlusTreeId := ts.engine.NewBPlusTree()
+		ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("key_%04d", i)), []byte("value")))
+
+		BPlusTreeIds = append(BPlusTreeIds, BPlusTreeId)
+	}
+
+	// B+ trees holding a single leaf node don't reserve extents, so the free list still fits in the metadata page.
+	ts.Require().NoError(ts.engine.Sync())
+	ts.Require().NoError(ts.engine.Close())
+
+	var err error
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().NoError(err)
+
+	for i, BPlusTreeId := range BPlusTreeIds {
+
+		btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+		ts.Require().True(exists)
+
+		value, err := btree.Get([]byte(fmt.Sprintf("key_%04d", i)))
+		ts.Require().NoError(err)
+		ts.Assert().Equal([]byte("value"), value)
+	}
+}
+
+func (ts *StorageEngineTestSuite) TestSyncWhileOpeningBPlusTrees() {
+
+	numBPlusTrees := 30
+	BPlusTreeIds := make([]uint64, 0, numBPlusTrees)
+
+	done := make(chan struct{})
+	var openErr error
+
+	// creating, closing and reopening B+ trees records them in the metadata while it is encoded by Sync.
+	go func() {
+
+		defer close(done)
+
+		for i := range numBPlusTrees {
+
+			BPlusTreeId, err := ts.engine.NewBPlusTreeWithComparator(codec.ReverseBytewiseComparator)
+
+			if err != nil {
+				openErr = err
+				return
+			}
+
+			if err := ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("key_%04d", i)), []byte("value")); err != nil {
+				openErr = err
+				return
+			}
+
+			if err := ts.engine.CloseBPlusTree(BPlusTreeId); err != nil {
+				openErr = err
+				return
+			}
+
+			if _, err := ts.engine.OpenBPlusTreeWithComparator(BPlusTreeId, codec.ReverseBytewiseComparator); err != nil {
+				openErr = err
+				return
+			}
+
+			BPlusTreeIds = append(BPlusTreeIds, BPlusTreeId)
+		}
+	}()
+
+	for syncing := true; syncing; {
+
+		select {
+		case <-done:
+			syncing = false
+		default:
+		}
+
+		ts.Require().NoError(ts.engine.Sync())
+	}
+
+	ts.Require().NoError(openErr)
+	ts.Require().NoError(ts.engine.Close())
+
+	var err error
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().NoError(err)
+
+	for i, BPlusTreeId := range BPlusTreeIds {
+
+		btree, err := ts.engine.OpenBPlusTreeWithComparator(BPlusTreeId, codec.ReverseBytewiseComparator)
+		ts.Require().NoError(err)
+
+		value, err := btree.Get([]byte(fmt.Sprintf("key_%04d", i)))
+		ts.Require().NoError(err)
+		ts.Assert().Equal([]byte("value"), value)
+	}
+}
+
+func (ts *StorageEngineTestSuite) TestSync() {
+
+	ts.Assert().Error(ts.engine.SetSyncConfig(bpm.SyncConfig{Mode: bpm.SyncPeriodic}))
+	ts.Require().NoError(ts.engine.SetSyncConfig(bpm.SyncConfig{Mode: bpm.SyncFull}))
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	numElements := 40
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	for i := range numElements {
+		ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), padding))
+	}
+
+	ts.Require().NoError(ts.engine.Sync())
+
+	// a copy of the file taken after Sync is what a crash would leave behind, since the storage engine isn't closed.
+	data, err := os.ReadFile("dragon.db")
+	ts.Require().NoError(err)
+
+	crashedFilePath := filepath.Join(ts.T().TempDir(), "dragon.db")
+	ts.Require().NoError(os.WriteFile(crashedFilePath, data, 0644))
+
+	disk, metadata, _, err := bpm.NewDirectIODiskManager(crashedFilePath)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(BPlusTreeId, metadata.CurrBPlusTreeId)
+
+	bufferPool, err := bpm.NewSimpleBufferPoolManager(5, int(metadata.PageSize), bpm.NewLRUReplacer(), disk)
+	ts.Require().NoError(err)
+
+	btree, err := bplustree.NewBPlusTree(BPlusTreeId, bufferPool, metadata)
+	ts.Require().NoError(err)
+
+	count, err := btree.Count([]byte("user_"), nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(numElements), count)
+
+	ts.Require().NoError(bufferPool.Close())
+}
+
+func TestStorageEngine(t *testing.T) {
+
+	suite.Run(t, new(StorageEngineTestSuite))
+}
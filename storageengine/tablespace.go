@@ -0,0 +1,69 @@
+package storageengine
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+)
+
+// CreateTablespace creates a data file at filePath for a new tablespace, and returns the ID of the tablespace.
+// The file is opened along with the primary database file from then on, so it must stay at the same path.
+func (engine *StorageEngine) CreateTablespace(filePath string) (tablespaceId uint64, err error) {
+
+	if engine.tablespaceDisk == nil {
+		return 0, fmt.Errorf("storage engine can't store B+ trees in more than one tablespace")
+	}
+
+	// the data file is recorded by committing the metadata page.
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	return engine.tablespaceDisk.CreateTablespace(filePath)
+}
+
+// Tablespaces returns the path of the data file of every tablespace other than the primary tablespace.
+func (engine *StorageEngine) Tablespaces() map[uint64]string {
+
+	if engine.tablespaceDisk == nil {
+		return map[uint64]string{}
+	}
+
+	return engine.tablespaceDisk.Tablespaces()
+}
+
+// NewBPlusTreeInTablespace creates a B+ tree whose nodes are stored in the data file of a tablespace,
+// and records the tablespace in the metadata page.
+func (engine *StorageEngine) NewBPlusTreeInTablespace(tablespaceId uint64) (BPlusTreeId uint64, err error) {
+
+	if _, exists := engine.Tablespaces()[tablespaceId]; !exists && tablespaceId != bpm.PRIMARY_TABLESPACE_ID {
+		return 0, fmt.Errorf("tablespace %d doesn't exist", tablespaceId)
+	}
+
+	// the ID is handed out and its tablespace recorded under the mutex guarding the metadata. Opening a B+ tree and looking up its tablespace
+	// take the mutex too, so a B+ tree is never opened or vacuumed in the primary tablespace before its tablespace is recorded.
+	engine.openBPlusTreesMutex.Lock()
+
+	if engine.metadata.Tablespaces == nil {
+		engine.metadata.Tablespaces = make(map[uint64]uint64)
+	}
+
+	BPlusTreeId = atomic.AddUint64(&engine.currBPlusTreeId, 1)
+	engine.metadata.Tablespaces[BPlusTreeId] = tablespaceId
+
+	engine.openBPlusTreesMutex.Unlock()
+
+	slog.Info("Created B+ tree in tablespace", "BPlusTreeId", BPlusTreeId, "tablespaceId", tablespaceId, "function", "NewBPlusTreeInTablespace", "at", "StorageEngine")
+
+	return BPlusTreeId, nil
+}
+
+// tablespaceOf returns the tablespace the nodes of a B+ tree are stored in.
+func (engine *StorageEngine) tablespaceOf(BPlusTreeId uint64) uint64 {
+
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	return engine.metadata.Tablespaces[BPlusTreeId]
+}
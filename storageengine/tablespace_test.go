@@ -0,0 +1,95 @@
+package storageengine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (ts *StorageEngineTestSuite) TestTablespaces() {
+
+	filePath := filepath.Join(ts.T().TempDir(), "users.db")
+
+	tablespaceId, err := ts.engine.CreateTablespace(filePath)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(1), tablespaceId)
+
+	_, err = ts.engine.CreateTablespace(filePath)
+	ts.Assert().Error(err)
+
+	_, err = ts.engine.NewBPlusTreeInTablespace(9)
+	ts.Assert().Error(err)
+
+	BPlusTreeId, err := ts.engine.NewBPlusTreeInTablespace(tablespaceId)
+	ts.Require().NoError(err)
+
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("user_%04d", i))
+	}
+
+	for i := range 300 {
+		ts.Require().NoError(ts.engine.Insert(BPlusTreeId, key(i), padding))
+	}
+
+	ts.Require().NoError(ts.engine.Sync())
+
+	// every node of the B+ tree is stored in the data file of the tablespace, the primary file only holds the metadata page.
+	primaryFileInfo, err := os.Stat("dragon.db")
+	ts.Require().NoError(err)
+	ts.Assert().Equal(int64(ts.engine.metadata.PageSize), primaryFileInfo.Size())
+
+	fileInfo, err := os.Stat(filePath)
+	ts.Require().NoError(err)
+	ts.Assert().Greater(fileInfo.Size(), int64(16*ts.engine.metadata.PageSize))
+
+	primaryBPlusTreeId := ts.engine.NewBPlusTree()
+
+	for i := range 300 {
+		ts.Require().NoError(ts.engine.Insert(primaryBPlusTreeId, key(i), padding))
+	}
+
+	// B+ trees in other tablespaces are left in place by a vacuum.
+	_, err = ts.engine.Vacuum(DefaultVacuumConfig())
+	ts.Require().NoError(err)
+
+	ts.Require().NoError(ts.engine.Close())
+
+	// the primary file can't be opened without the data files of its tablespaces.
+	movedFilePath := filepath.Join(ts.T().TempDir(), "moved.db")
+	ts.Require().NoError(os.Rename(filePath, movedFilePath))
+
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().Error(err)
+
+	ts.Require().NoError(os.Rename(movedFilePath, filePath))
+
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().NoError(err)
+
+	ts.Assert().Equal(map[uint64]string{tablespaceId: filePath}, ts.engine.Tablespaces())
+
+	for _, id := range []uint64{BPlusTreeId, primaryBPlusTreeId} {
+
+		btree, exists := ts.engine.OpenBPlusTree(id)
+		ts.Require().True(exists)
+
+		for i := range 300 {
+
+			value, err := btree.Get(key(i))
+			ts.Require().NoError(err)
+			ts.Assert().Equal(padding, value)
+		}
+	}
+
+	// the B+ tree keeps growing in its tablespace once the database is reopened.
+	ts.Require().NoError(ts.engine.Insert(BPlusTreeId, key(300), padding))
+
+	btree, _ := ts.engine.OpenBPlusTree(BPlusTreeId)
+
+	count, err := btree.Count(nil, nil)
+	ts.Require().NoError(err)
+	ts.Assert().Equal(uint64(301), count)
+}
@@ -0,0 +1,141 @@
+package storageengine
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	bplustree "github.com/Adarsh-Kmt/DragonDB/bplustree"
+	bpm "github.com/Adarsh-Kmt/DragonDB/bufferpoolmanager"
+	codec "github.com/Adarsh-Kmt/DragonDB/pagecodec"
+)
+
+const (
+	// maximum number of pages a vacuum moves while a B+ tree is locked.
+	DEFAULT_VACUUM_BATCH_SIZE = 64
+
+	// pause between batches, letting operations waiting for the B+ tree run.
+	DEFAULT_VACUUM_BATCH_INTERVAL = 10 * time.Millisecond
+)
+
+// VacuumConfig bounds the impact of a vacuum on operations running alongside it.
+type VacuumConfig struct {
+
+	// maximum number of pages moved while a B+ tree is locked.
+	BatchSize int
+
+	// pause between batches.
+	BatchInterval time.Duration
+}
+
+func DefaultVacuumConfig() VacuumConfig {
+
+	return VacuumConfig{
+		BatchSize:     DEFAULT_VACUUM_BATCH_SIZE,
+		BatchInterval: DEFAULT_VACUUM_BATCH_INTERVAL,
+	}
+}
+
+// VacuumStats reports the work done by a vacuum.
+type VacuumStats struct {
+
+	// number of pages moved towards the start of the file.
+	RelocatedPages int
+
+	// number of pages removed from the end of the file.
+	ReleasedPages int
+}
+
+// Vacuum shrinks the database file while the storage engine is in use. Pages in use after the point the file could shrink to
+// are moved into deallocated pages before it, a batch at a time, then the deallocated pages at the end of the file are truncated.
+// Writes wait for the file to be truncated, which is a commit point like Sync. B+ trees stored in other tablespaces aren't moved,
+// only the deallocated pages at the end of their data files are truncated.
+func (engine *StorageEngine) Vacuum(config VacuumConfig) (stats VacuumStats, err error) {
+
+	if config.BatchSize <= 0 {
+		return stats, fmt.Errorf("vacuum batch size must be positive, got %d", config.BatchSize)
+	}
+
+	fmt.Println()
+	slog.Info("Vacuuming database file...", "function", "Vacuum", "at", "StorageEngine")
+
+	maxAllocatedPageId, deallocatedPages := engine.bufferPoolManager.AllocatedPages()
+
+	// the pages in use fit in the pages before the limit, so every page at or after it can be released once it is empty.
+	limit := maxAllocatedPageId - uint64(deallocatedPages) + 1
+
+	// B+ tree 0 isn't handed out by NewBPlusTree, but it holds the keys served by the server, and those of older databases.
+	for BPlusTreeId := uint64(0); BPlusTreeId <= atomic.LoadUint64(&engine.currBPlusTreeId); BPlusTreeId++ {
+
+		// the limit is a page ID in the primary database file, every page of another tablespace is after it.
+		if engine.tablespaceOf(BPlusTreeId) != bpm.PRIMARY_TABLESPACE_ID {
+			continue
+		}
+
+		btree, exists := engine.openRecordedBPlusTree(BPlusTreeId)
+
+		if !exists {
+			slog.Warn("Skipping B+ tree that can't be opened", "BPlusTreeId", BPlusTreeId, "function", "Vacuum", "at", "StorageEngine")
+			continue
+		}
+
+		for {
+
+			relocatedPages, done, err := btree.RelocatePages(limit, config.BatchSize)
+			stats.RelocatedPages += relocatedPages
+
+			if err != nil {
+				slog.Error("Failed to relocate pages", "BPlusTreeId", BPlusTreeId, "error", err.Error(), "function", "Vacuum", "at", "StorageEngine")
+				return stats, err
+			}
+
+			if done || relocatedPages == 0 {
+				break
+			}
+
+			time.Sleep(config.BatchInterval)
+		}
+	}
+
+	engine.writeMutex.Lock()
+	defer engine.writeMutex.Unlock()
+
+	engine.openBPlusTreesMutex.Lock()
+	defer engine.openBPlusTreesMutex.Unlock()
+
+	// the moved root and first leaf nodes must be recorded in the metadata page committed before the file is truncated.
+	engine.recordMetaData()
+
+	stats.ReleasedPages, err = engine.bufferPoolManager.Shrink()
+
+	if err != nil {
+		return stats, err
+	}
+
+	slog.Info("Vacuumed database file", "relocatedPages", stats.RelocatedPages, "releasedPages", stats.ReleasedPages, "function", "Vacuum", "at", "StorageEngine")
+
+	return stats, nil
+}
+
+// openRecordedBPlusTree opens a B+ tree with the comparator recorded for it in the metadata page.
+func (engine *StorageEngine) openRecordedBPlusTree(BPlusTreeId uint64) (*bplustree.BPlusTree, bool) {
+
+	engine.openBPlusTreesMutex.Lock()
+	name, recorded := engine.metadata.Comparators[BPlusTreeId]
+	engine.openBPlusTreesMutex.Unlock()
+
+	if !recorded {
+		return engine.OpenBPlusTree(BPlusTreeId)
+	}
+
+	comparator, registered := codec.GetComparator(name)
+
+	if !registered {
+		return nil, false
+	}
+
+	btree, err := engine.OpenBPlusTreeWithComparator(BPlusTreeId, comparator)
+
+	return btree, err == nil
+}
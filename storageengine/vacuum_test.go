@@ -0,0 +1,147 @@
+package storageengine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+func (ts *StorageEngineTestSuite) TestVacuum() {
+
+	// pages allocated before the B+ trees, and deallocated once they are built, leave free space at the start of the file.
+	freePageIds := make([]uint64, 0)
+
+	for range 40 {
+
+		pageId, err := ts.engine.bufferPoolManager.NewPage()
+		ts.Require().NoError(err)
+		freePageIds = append(freePageIds, pageId)
+	}
+
+	BPlusTreeId := ts.engine.NewBPlusTree()
+
+	_, err := ts.engine.CreateSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+	ts.Require().NoError(err)
+
+	numElements := 200
+	padding := bytes.Repeat([]byte("x"), 200)
+
+	value := func(i int) []byte {
+
+		city := "paris"
+		if i%2 == 1 {
+			city = "berlin"
+		}
+
+		return append([]byte(fmt.Sprintf("%s:user_%04d_", city, i)), padding...)
+	}
+
+	for i := range numElements {
+		ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte(fmt.Sprintf("user_%04d", i)), value(i)))
+	}
+
+	// B+ tree 0 holds the keys of databases created before B+ trees were handed out by the storage engine, it is moved too.
+	for i := range numElements {
+		ts.Require().NoError(ts.engine.Insert(0, []byte(fmt.Sprintf("legacy_%04d", i)), value(i)))
+	}
+
+	for _, pageId := range freePageIds {
+		ts.engine.bufferPoolManager.CleanupPage(pageId)
+	}
+
+	ts.Require().NoError(ts.engine.Sync())
+
+	fileInfo, err := os.Stat("dragon.db")
+	ts.Require().NoError(err)
+	fileSize := fileInfo.Size()
+
+	btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+	ts.Require().True(exists)
+
+	// reads keep running while pages are moved.
+	stop := make(chan struct{})
+	failedGets := 0
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+
+		defer wg.Done()
+
+		for i := 0; ; i = (i + 1) % numElements {
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if storedValue, err := btree.Get([]byte(fmt.Sprintf("user_%04d", i))); err != nil || !bytes.Equal(value(i), storedValue) {
+				failedGets++
+			}
+		}
+	}()
+
+	stats, err := ts.engine.Vacuum(VacuumConfig{BatchSize: 8, BatchInterval: time.Millisecond})
+
+	close(stop)
+	wg.Wait()
+
+	ts.Require().NoError(err)
+	ts.Assert().Zero(failedGets)
+	ts.Assert().Greater(stats.RelocatedPages, 0)
+	ts.Assert().Greater(stats.ReleasedPages, 0)
+
+	fileInfo, err = os.Stat("dragon.db")
+	ts.Require().NoError(err)
+	ts.Assert().Less(fileInfo.Size(), fileSize)
+
+	// every page in use was moved before the pages released at the end of the file.
+	_, deallocatedPages := ts.engine.bufferPoolManager.AllocatedPages()
+	ts.Assert().Zero(deallocatedPages)
+
+	assertElements := func() {
+
+		btree, exists := ts.engine.OpenBPlusTree(BPlusTreeId)
+		ts.Require().True(exists)
+
+		for i := range numElements {
+
+			storedValue, err := btree.Get([]byte(fmt.Sprintf("user_%04d", i)))
+			ts.Require().NoError(err)
+			ts.Assert().Equal(value(i), storedValue)
+		}
+
+		index, err := ts.engine.OpenSecondaryIndex(BPlusTreeId, "city", cityExtractor)
+		ts.Require().NoError(err)
+
+		entries, err := index.Lookup([]byte("berlin"))
+		ts.Require().NoError(err)
+		ts.Assert().Len(entries, numElements/2)
+
+		legacyBTree, exists := ts.engine.OpenBPlusTree(0)
+		ts.Require().True(exists)
+
+		for i := range numElements {
+
+			storedValue, err := legacyBTree.Get([]byte(fmt.Sprintf("legacy_%04d", i)))
+			ts.Require().NoError(err)
+			ts.Assert().Equal(value(i), storedValue)
+		}
+	}
+
+	assertElements()
+
+	// the moved root and first leaf nodes are recorded in the metadata page.
+	ts.Require().NoError(ts.engine.Close())
+
+	ts.engine, _, err = NewStorageEngine()
+	ts.Require().NoError(err)
+
+	assertElements()
+
+	ts.Require().NoError(ts.engine.Insert(BPlusTreeId, []byte("user_9999"), value(9999)))
+}